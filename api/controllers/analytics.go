@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/analytics"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+)
+
+// GetAnalytics ...
+// @Description GetAnalytics API reports the user's spending in a rolling period ending now: by category, by merchant and by weekday, the trend against the period before and the largest operations. Expenses and sent transfers count as spending, refunded amounts do not. Amounts are converted into the default currency.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param period query string false "Period, month by default" Enums(week, month, quarter, year)
+// @Success 200 {object} models.AnalyticsResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/analytics/ [get]
+func GetAnalytics(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	report, err := analytics.Service().Report(c.UserContext(), user.UserID.String(), c.Query("period", "month"))
+	if errors.Is(err, newerrors.ErrUnknownPeriod) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "period: must be one of week, month, quarter, year",
+		})
+	} else if err != nil {
+		logger.Error(c.UserContext(), "Error while building a spending report", logger.Err(err))
+		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
+			ErrorMessage: "Internal Server Error",
+		})
+	}
+
+	response := models.AnalyticsResponseModel{
+		Period:     report.Period,
+		From:       report.From.Format(time.RFC3339),
+		To:         report.To.Format(time.RFC3339),
+		Currency:   report.Currency,
+		Total:      report.Total,
+		Count:      report.Count,
+		ByCategory: analyticsLineModels(report.ByCategory),
+		ByMerchant: analyticsLineModels(report.ByMerchant),
+		ByWeekday:  analyticsLineModels(report.ByWeekday),
+		Trend: models.AnalyticsTrendModel{
+			Previous: report.Trend.Previous,
+			Change:   report.Trend.Change,
+			Percent:  report.Trend.Percent,
+		},
+		Largest: make([]models.Operation, 0, len(report.Largest)),
+	}
+	for _, op := range report.Largest {
+		response.Largest = append(response.Largest, operationModel(op))
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+func analyticsLineModels(lines []analytics.Line) []models.AnalyticsLineModel {
+	result := make([]models.AnalyticsLineModel, 0, len(lines))
+	for _, line := range lines {
+		result = append(result, models.AnalyticsLineModel{
+			Key:    line.Key,
+			Amount: line.Amount,
+			Count:  line.Count,
+			Share:  line.Share,
+		})
+	}
+
+	return result
+}
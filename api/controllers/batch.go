@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/batch"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+)
+
+// BatchOperations ...
+// @Description BatchOperations API tops up or reduces many balances in one call. Each income passes the same risk rules as a single top up, each expense the same risk rules and spending limits as the user's own expense; a step up or a limit override can not be confirmed in a batch, so such items fail. In all_or_nothing mode the first failure stops the batch and the items already done are reversed by compensating operations, which is not atomic and can fail if the money was already spent; in best_effort mode every item is tried. Small batches are answered right away, large ones with 202 and a job ID to follow the progress.
+// @Security ApiKeyAuth
+// @Tags batch
+// @Accept json
+// @Produce json
+// @Param batch body models.BatchOperationsModel true "Batch"
+// @Success 200 {object} models.BatchJobModel
+// @Success 202 {object} models.BatchJobModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /batch/operations/ [post]
+func BatchOperations(c *fiber.Ctx) error {
+	var (
+		body models.BatchOperationsModel
+		cfg  = config.Config()
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	if len(body.Items) > cfg.BatchMaxItems {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: fmt.Sprintf("A batch can have at most %d items", cfg.BatchMaxItems),
+		})
+	}
+
+	partner, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	items := make([]batch.Item, 0, len(body.Items))
+	for _, item := range body.Items {
+		items = append(items, batch.Item{
+			UserID:   item.UserID,
+			Type:     item.Type,
+			Amount:   item.Amount,
+			Currency: item.Currency,
+			Note:     item.Note,
+		})
+	}
+
+	if len(items) > cfg.BatchSyncLimit {
+		job, err := batch.Service().Start(c.UserContext(), partner.UserID.String(), body.Mode, items)
+		if err != nil {
+			return batchError(c, err)
+		}
+
+		return c.Status(http.StatusAccepted).JSON(batchJobModel(job))
+	}
+
+	job, err := batch.Service().Run(c.UserContext(), partner.UserID.String(), body.Mode, items)
+	if err != nil {
+		return batchError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(batchJobModel(job))
+}
+
+// GetBatchJob ...
+// @Description GetBatchJob API shows the progress and the results of a batch.
+// @Security ApiKeyAuth
+// @Tags batch
+// @Accept json
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.BatchJobModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /batch/operations/{id}/ [get]
+func GetBatchJob(c *fiber.Ctx) error {
+
+	partner, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	job, err := batch.Service().Job(c.UserContext(), partner.UserID.String(), c.Params("id"))
+	if err != nil {
+		return batchError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(batchJobModel(job))
+}
+
+func batchError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrJobNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Job not found",
+		})
+	}
+
+	return serviceError(c, err, serviceMessages{
+		action: "running a batch",
+	})
+}
+
+func batchJobModel(job batch.Job) models.BatchJobModel {
+	model := models.BatchJobModel{
+		JobID:     job.ID,
+		Mode:      job.Mode,
+		Status:    job.Status,
+		Total:     job.Total,
+		Done:      job.Done,
+		Succeeded: job.Succeeded,
+		Failed:    job.Failed,
+		Results:   make([]models.BatchItemResultModel, 0, len(job.Results)),
+		CreatedAt: job.CreatedAt.Format(time.RFC3339),
+	}
+
+	if !job.FinishedAt.IsZero() {
+		model.FinishedAt = job.FinishedAt.Format(time.RFC3339)
+	}
+
+	for _, result := range job.Results {
+		model.Results = append(model.Results, models.BatchItemResultModel{
+			Index:       result.Index,
+			Status:      result.Status,
+			OperationID: result.OperationID,
+			Error:       result.Error,
+		})
+	}
+
+	return model
+}
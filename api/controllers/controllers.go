@@ -1,20 +1,21 @@
 package controllers
 
 import (
-	"context"
-	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 
 	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
 	pb "github.com/toshkentov01/alif-tech-task/api-gateway/genproto/user-service"
 	client "github.com/toshkentov01/alif-tech-task/api-gateway/grpc_client"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/events"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/otp"
 	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
 )
 
 // SignUpFully ...
@@ -37,7 +38,7 @@ func SignUpFully(c *fiber.Ctx) error {
 
 	err := c.BodyParser(&body)
 	if err != nil {
-		log.Println("Error parsing body: ", err)
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
 		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
 			ErrorMessage: err.Error(),
 		})
@@ -73,7 +74,7 @@ func SignUpFully(c *fiber.Ctx) error {
 	}
 	accessToken, refreshToken = tokens.Access, tokens.Refresh
 
-	result, err := client.UserService().CheckFields(context.Background(), &pb.CheckfieldsRequest{
+	result, err := client.Upstreams().User().CheckFields(c.UserContext(), &pb.CheckfieldsRequest{
 		Username: body.Username,
 		Email:    body.Email,
 	})
@@ -94,7 +95,7 @@ func SignUpFully(c *fiber.Ctx) error {
 		})
 	}
 
-	_, serviceError := client.UserService().CreateIdentifiedUser(context.Background(), &pb.CreateIdentifiedUserRequest{
+	_, serviceError := client.Upstreams().User().CreateIdentifiedUser(c.UserContext(), &pb.CreateIdentifiedUserRequest{
 		Id:           id.String(),
 		Username:     body.Username,
 		FullName:     body.FullName,
@@ -110,6 +111,19 @@ func SignUpFully(c *fiber.Ctx) error {
 		})
 	}
 
+	err = otp.Service().SetEmail(c.UserContext(), id.String(), body.Email)
+	if err != nil {
+		logger.Error(c.UserContext(), "Error saving the email one-time codes are sent to", logger.Err(err))
+	}
+
+	grantSignUpPartner(c, id.String(), body.PartnerID)
+
+	events.Service().Publish(c.UserContext(), id.String(), events.AccountCreated, models.AccountCreatedEventModel{
+		UserID:     id.String(),
+		Username:   body.Username,
+		Identified: true,
+	})
+
 	return c.Status(http.StatusOK).JSON(models.SignUpResponseModel{
 		UserID:       id.String(),
 		AccessToken:  accessToken,
@@ -136,7 +150,7 @@ func CreateUnidentifiedUser(c *fiber.Ctx) error {
 
 	err := c.BodyParser(&body)
 	if err != nil {
-		log.Println("Error parsing body: ", err)
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
 		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
 			ErrorMessage: err.Error(),
 		})
@@ -159,7 +173,7 @@ func CreateUnidentifiedUser(c *fiber.Ctx) error {
 		})
 	}
 
-	result, err := client.UserService().CheckFields(context.Background(), &pb.CheckfieldsRequest{
+	result, err := client.Upstreams().User().CheckFields(c.UserContext(), &pb.CheckfieldsRequest{
 		Username: body.Username,
 		Email:    "",
 	})
@@ -186,7 +200,7 @@ func CreateUnidentifiedUser(c *fiber.Ctx) error {
 	}
 	accessToken, refreshToken := tokens.Access, tokens.Refresh
 
-	_, serviceError := client.UserService().CreateUnIdentifiedUser(context.Background(), &pb.CreateUnIdentifiedUserRequest{
+	_, serviceError := client.Upstreams().User().CreateUnIdentifiedUser(c.UserContext(), &pb.CreateUnIdentifiedUserRequest{
 		Id:           id.String(),
 		Username:     body.Username,
 		Password:     body.Password,
@@ -195,12 +209,20 @@ func CreateUnidentifiedUser(c *fiber.Ctx) error {
 	})
 
 	if serviceError != nil {
-		log.Println("Error while creating unidentified user. ERROR: ", err)
+		logger.Error(c.UserContext(), "Error while creating unidentified user", logger.Err(serviceError))
 		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
 			ErrorMessage: "Internal Server Error",
 		})
 	}
 
+	grantSignUpPartner(c, id.String(), body.PartnerID)
+
+	events.Service().Publish(c.UserContext(), id.String(), events.AccountCreated, models.AccountCreatedEventModel{
+		UserID:     id.String(),
+		Username:   body.Username,
+		Identified: false,
+	})
+
 	return c.Status(http.StatusOK).JSON(models.SignUpResponseModelForUnidentifiedUser{
 		ID:           id.String(),
 		AccessToken:  accessToken,
@@ -222,13 +244,13 @@ func CreateUnidentifiedUser(c *fiber.Ctx) error {
 // @Router /check-user-account/ [get]
 func CheckUserAccount(c *fiber.Ctx) error {
 
-	result, err := client.UserService().CheckUserAccount(context.Background(), &pb.CheckUserAccountRequest{
+	result, err := client.Upstreams().User().CheckUserAccount(c.UserContext(), &pb.CheckUserAccountRequest{
 		Username: c.Query("username"),
 		Password: c.Query("password"),
 	})
 
 	if err != nil {
-		log.Println("Error while checking user account. Error: ", err)
+		logger.Error(c.UserContext(), "Error while checking user account", logger.Err(err))
 		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
 			ErrorMessage: "Internal Server Error",
 		})
@@ -252,10 +274,13 @@ func CheckUserAccount(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param income body models.IncomeModel true "Income"
-// @Success 200 {object} models.Success
+// @Param X-Device-ID header string false "Device ID, operations from a new device may need a step_up one-time code"
+// @Success 200 {object} models.OperationResponseModel
 // @Failure 400 {object} models.StandardErrorModel
 // @Failure 404 {object} models.StandardErrorModel
 // @Failure 500 {object} models.StandardErrorModel
+// @Failure 503 {object} models.StandardErrorModel
+// @Failure 504 {object} models.StandardErrorModel
 // @Router /user/income/ [post]
 func Income(c *fiber.Ctx) error {
 	var (
@@ -264,7 +289,14 @@ func Income(c *fiber.Ctx) error {
 
 	err := c.BodyParser(&body)
 	if err != nil {
-		log.Println("Error parsing body: ", err)
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
 			ErrorMessage: err.Error(),
 		})
@@ -272,30 +304,46 @@ func Income(c *fiber.Ctx) error {
 
 	user, err := utils.ExtractTokenMetadata(c)
 	if err != nil {
-		log.Println("Error taking user id! ", err)
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
 		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
 			ErrorMessage: "Failed to extract id from token",
 		})
 	}
 
-	_, serviceErr := client.UserService().Income(context.Background(), &pb.IncomeRequest{
-		UserId:       user.UserID.String(),
-		IncomeAmount: body.IncomeAmount,
-	})
-
-	st, ok := status.FromError(serviceErr)
-	if !ok || st.Code() == codes.Internal {
-		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
-			ErrorMessage: "Internal Server Error",
-		})
-	} else if st.Code() == codes.PermissionDenied {
+	tags, err := validateDetails(body.Category, body.Tags)
+	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
-			ErrorMessage: "Permission Denied. If you top up balance with this amount, your balance will be above the maximum allowed cash",
+			ErrorMessage: err.Error(),
 		})
 	}
 
-	return c.Status(http.StatusOK).JSON(models.Success{
-		Success: true,
+	op := ledger.Operation{
+		UserID:   user.UserID.String(),
+		Type:     ledger.Income,
+		Currency: wallet.Service().Currency(body.Currency),
+		Amount:   body.IncomeAmount,
+		Note:     body.Note,
+		Category: body.Category,
+		Tags:     tags,
+	}
+
+	ctx := confirmed(c, body.StepUpOTP, "")
+	if _, err := wallet.Service().Assess(ctx, op); err != nil {
+		return riskError(c, err)
+	}
+
+	op, serviceErr := wallet.Service().Income(ctx, op)
+
+	if serviceErr != nil {
+		return serviceError(c, serviceErr, serviceMessages{
+			action: "topping up a balance",
+			denied: "Permission Denied. If you top up balance with this amount, your balance will be above the maximum allowed cash",
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(models.OperationResponseModel{
+		Success:     true,
+		OperationID: op.ID,
 	})
 }
 
@@ -306,10 +354,13 @@ func Income(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param income body models.ExpenseModel true "Income"
-// @Success 200 {object} models.Success
+// @Param X-Device-ID header string false "Device ID, operations from a new device may need a step_up one-time code"
+// @Success 200 {object} models.OperationResponseModel
 // @Failure 400 {object} models.StandardErrorModel
 // @Failure 404 {object} models.StandardErrorModel
 // @Failure 500 {object} models.StandardErrorModel
+// @Failure 503 {object} models.StandardErrorModel
+// @Failure 504 {object} models.StandardErrorModel
 // @Router /user/expense/ [post]
 func Expense(c *fiber.Ctx) error {
 	var (
@@ -318,7 +369,14 @@ func Expense(c *fiber.Ctx) error {
 
 	err := c.BodyParser(&body)
 	if err != nil {
-		log.Println("Error parsing body: ", err)
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
 			ErrorMessage: err.Error(),
 		})
@@ -326,35 +384,130 @@ func Expense(c *fiber.Ctx) error {
 
 	user, err := utils.ExtractTokenMetadata(c)
 	if err != nil {
-		log.Println("Error taking user id! ", err)
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
 		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
 			ErrorMessage: "Failed to extract id from token",
 		})
 	}
 
-	_, serviceErr := client.UserService().Expense(context.Background(), &pb.ExpenseRequest{
-		UserId:        user.UserID.String(),
-		ExpenseAmount: body.ExpenseAmount,
+	tags, err := validateDetails(body.Category, body.Tags)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	op := ledger.Operation{
+		UserID:   user.UserID.String(),
+		Type:     ledger.Expense,
+		Currency: wallet.Service().Currency(body.Currency),
+		Amount:   body.ExpenseAmount,
+		Merchant: body.Merchant,
+		Note:     body.Note,
+		Category: body.Category,
+		Tags:     tags,
+	}
+
+	op, serviceErr := wallet.Service().Expense(confirmed(c, body.StepUpOTP, body.OTP), op)
+
+	if serviceErr != nil {
+		return serviceError(c, serviceErr, serviceMessages{
+			action: "reducing a balance",
+			denied: "Permission Denied. If you reduce a balance with this amount, your balance will be under the minimum allowed cash",
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(models.OperationResponseModel{
+		Success:     true,
+		OperationID: op.ID,
 	})
+}
 
-	st, ok := status.FromError(serviceErr)
-	if !ok || st.Code() == codes.Internal {
-		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
-			ErrorMessage: "Internal Server Error",
+// Transfer ...
+// @Description Transfer API sends money from the user's balance to another user.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param transfer body models.TransferModel true "Transfer"
+// @Param X-Device-ID header string false "Device ID, operations from a new device may need a step_up one-time code"
+// @Success 200 {object} models.OperationResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Failure 503 {object} models.StandardErrorModel
+// @Failure 504 {object} models.StandardErrorModel
+// @Router /user/transfer/ [post]
+func Transfer(c *fiber.Ctx) error {
+	var (
+		body models.TransferModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
 		})
-	} else if st.Code() == codes.PermissionDenied {
+	}
+
+	err = body.Validate()
+	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
-			ErrorMessage: "Permission Denied. If you reduce a balance with this amount, your balance will be under the minimum allowed cash",
+			ErrorMessage: err.Error(),
 		})
 	}
 
-	return c.Status(http.StatusOK).JSON(models.Success{
-		Success: true,
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	if body.RecipientID == user.UserID.String() {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Can not transfer money to yourself",
+		})
+	}
+
+	tags, err := validateDetails(body.Category, body.Tags)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	op := ledger.Operation{
+		UserID:       user.UserID.String(),
+		Type:         ledger.Transfer,
+		Counterparty: body.RecipientID,
+		Currency:     wallet.Service().Currency(body.Currency),
+		Amount:       body.Amount,
+		Note:         body.Note,
+		Category:     body.Category,
+		Tags:         tags,
+	}
+
+	op, serviceErr := wallet.Service().Transfer(confirmed(c, body.StepUpOTP, ""), op)
+
+	if serviceErr != nil {
+		return serviceError(c, serviceErr, serviceMessages{
+			action:   "transferring money",
+			denied:   "Permission Denied. Not enough cash or the recipient can not receive this amount",
+			notFound: "Recipient not found",
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(models.OperationResponseModel{
+		Success:     true,
+		OperationID: op.ID,
 	})
 }
 
 // GetBalance ...
-// @Description GetBalance API used for getting a user balance.
+// @Description GetBalance API used for getting a user balance. Each balance shows the total amount, the parts held and set aside in pockets, and what is available; the amount of each pocket is listed too.
 // @Security ApiKeyAuth
 // @Tags user
 // @Accept json
@@ -368,30 +521,59 @@ func GetBalance(c *fiber.Ctx) error {
 
 	user, err := utils.ExtractTokenMetadata(c)
 	if err != nil {
-		log.Println("Error taking user id! ", err)
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
 		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
 			ErrorMessage: "Failed to extract id from token",
 		})
 	}
 
-	result, serviceErr := client.UserService().GetBalance(context.Background(), &pb.GetBalanceRequest{
-		UserId: user.UserID.String(),
-	})
-
+	balances, serviceErr := wallet.Service().Balances(c.UserContext(), user.UserID.String())
 	if serviceErr != nil {
-		log.Println("Error while getting a balance, error: ", err.Error())
+		logger.Error(c.UserContext(), "Error while getting a balance", logger.Err(serviceErr))
 		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
 			ErrorMessage: "Internal Server Errr",
 		})
 	}
 
-	return c.Status(http.StatusOK).JSON(models.GetBalanceResponseModel{
-		Balance: result.Balance,
-	})
+	pockets, err := wallet.Service().Pockets(c.UserContext(), user.UserID.String())
+	if err != nil {
+		return pocketError(c, err)
+	}
+
+	response := models.GetBalanceResponseModel{
+		Balance:  balances[0].Amount,
+		Balances: balanceModels(balances),
+		Pockets:  make([]models.PocketBalanceModel, 0, len(pockets)),
+	}
+	for _, pocket := range pockets {
+		response.Pockets = append(response.Pockets, models.PocketBalanceModel{
+			ID:       pocket.ID,
+			Name:     pocket.Name,
+			Currency: pocket.Currency,
+			Amount:   pocket.Amount,
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+func balanceModels(balances []wallet.Balance) []models.BalanceModel {
+	result := make([]models.BalanceModel, 0, len(balances))
+	for _, balance := range balances {
+		result = append(result, models.BalanceModel{
+			Currency:  balance.Currency,
+			Amount:    balance.Amount,
+			Held:      balance.Held,
+			Pocketed:  balance.Pocketed,
+			Available: balance.Available,
+		})
+	}
+
+	return result
 }
 
 // ListOperationsByType ...
-// @Description GetBalance API used for getting a user balance.
+// @Description ListOperationsByType API lists the user's income or expense operations from the same ledger as the history, with all their fields. Without an OperationType all operations are listed.
 // @Security ApiKeyAuth
 // @Tags user
 // @Accept json
@@ -406,25 +588,25 @@ func ListOperationsByType(c *fiber.Ctx) error {
 
 	user, err := utils.ExtractTokenMetadata(c)
 	if err != nil {
-		log.Println("Error taking user id! ", err)
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
 		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
 			ErrorMessage: "Failed to extract id from token",
 		})
 	}
 
-	operaionType := c.Get("OperationType")
+	operationType, ok := operationTypes[c.Get("OperationType")]
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "OperationType must be income_operations or expense_operations",
+		})
+	}
 
-	result, serviceErr := client.UserService().ListTotalOperationsByType(context.Background(), &pb.ListTotalOperationsByTypeRequest{
-		UserId:        user.UserID.String(),
-		OperationType: operaionType,
+	operations, err := ledger.Service().List(c.UserContext(), user.UserID.String(), ledger.Filter{
+		Type: operationType,
 	})
-
-	if serviceErr != nil {
-		log.Println("Error while getting a balance, error: ", serviceErr.Error())
-		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
-			ErrorMessage: "Internal Server Errr",
-		})
+	if err != nil {
+		return reversalError(c, err)
 	}
 
-	return c.Status(http.StatusOK).JSON(result)
+	return c.Status(http.StatusOK).JSON(operationsModel(operations))
 }
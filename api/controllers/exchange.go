@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/currency"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// ExchangeQuote ...
+// @Description ExchangeQuote API gives a rate for converting money between currencies. The rate is kept until the quote expires.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param quote body models.ExchangeQuoteRequestModel true "Quote"
+// @Success 200 {object} models.ExchangeQuoteModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/exchange/quote/ [post]
+func ExchangeQuote(c *fiber.Ctx) error {
+	var (
+		body models.ExchangeQuoteRequestModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	quote, err := currency.Quotes().New(c.UserContext(), user.UserID.String(), body.From, body.To, body.Amount)
+	if errors.Is(err, newerrors.ErrUnsupportedCurrency) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Unsupported currency",
+		})
+	} else if err != nil {
+		logger.Error(c.UserContext(), "Error while getting a quote", logger.Err(err))
+		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
+			ErrorMessage: "Internal Server Error",
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(quoteModel(quote))
+}
+
+// Exchange ...
+// @Description Exchange API converts money between currencies with the rate of a quote.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param exchange body models.ExchangeModel true "Exchange"
+// @Param X-Device-ID header string false "Device ID, operations from a new device may need a step_up one-time code"
+// @Success 200 {object} models.ExchangeResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/exchange/ [post]
+func Exchange(c *fiber.Ctx) error {
+	var (
+		body models.ExchangeModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	quote, err := currency.Quotes().Take(user.UserID.String(), body.QuoteID)
+	if errors.Is(err, newerrors.ErrQuoteNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Quote not found",
+		})
+	} else if errors.Is(err, newerrors.ErrQuoteExpired) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Quote expired, request a new one",
+		})
+	}
+
+	serviceErr := wallet.Service().Exchange(confirmed(c, body.StepUpOTP, ""), quote)
+
+	if serviceErr != nil {
+		return serviceError(c, serviceErr, serviceMessages{
+			action: "exchanging currency",
+			denied: "Permission Denied. Not enough cash to exchange this amount",
+		})
+	}
+
+	balances, err := wallet.Service().Balances(c.UserContext(), user.UserID.String())
+	if err != nil {
+		logger.Error(c.UserContext(), "Error while getting a balance", logger.Err(err))
+		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
+			ErrorMessage: "Internal Server Error",
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(models.ExchangeResponseModel{
+		Quote:    quoteModel(quote),
+		Balances: balanceModels(balances),
+	})
+}
+
+func quoteModel(quote *currency.Quote) models.ExchangeQuoteModel {
+	return models.ExchangeQuoteModel{
+		QuoteID:         quote.ID,
+		From:            quote.From,
+		To:              quote.To,
+		Amount:          quote.Amount,
+		ConvertedAmount: quote.Converted,
+		Rate:            quote.Rate,
+		ExpiresAt:       quote.ExpiresAt.Format(time.RFC3339),
+	}
+}
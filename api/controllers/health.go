@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/health"
+)
+
+// Healthz tells the process is alive. It checks nothing else, so a gateway
+// whose upstreams are down is not restarted.
+func Healthz(c *fiber.Ctx) error {
+	return c.Status(http.StatusOK).JSON(models.LivenessResponseModel{
+		Status: "ok",
+	})
+}
+
+// Readyz tells the gateway can serve requests, answering 503 with the failed
+// checks when it can not or when it is shutting down.
+func Readyz(c *fiber.Ctx) error {
+
+	report := health.Service().Ready(c.UserContext())
+
+	response := models.ReadinessResponseModel{
+		Status:    "ready",
+		Checks:    make([]models.HealthCheckModel, 0, len(report.Checks)),
+		CheckedAt: report.CheckedAt.Format(time.RFC3339),
+	}
+	for _, result := range report.Checks {
+		response.Checks = append(response.Checks, models.HealthCheckModel{
+			Name:   result.Name,
+			Passed: result.Error == "",
+			Error:  result.Error,
+		})
+	}
+
+	if !report.Ready {
+		response.Status = "not_ready"
+		return c.Status(http.StatusServiceUnavailable).JSON(response)
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/merchant"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// CreateHold ...
+// @Description CreateHold API reserves an amount of the balance for a merchant. The amount is not available for spending until the merchant captures or voids the hold, or it expires.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param hold body models.CreateHoldModel true "Hold"
+// @Param X-Device-ID header string false "Device ID, operations from a new device may need a step_up one-time code"
+// @Success 200 {object} models.HoldModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/holds/ [post]
+func CreateHold(c *fiber.Ctx) error {
+	var (
+		body models.CreateHoldModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	m, err := merchant.Service().Get(c.UserContext(), body.Merchant)
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	// The merchant captures the hold later, the user confirms it now.
+	ctx := confirmed(c, body.StepUpOTP, body.OTP)
+	hold, serviceErr := wallet.Service().CreateHold(ctx, user.UserID.String(), m.ID, body.Currency, body.Amount)
+	if serviceErr != nil {
+		return holdError(c, serviceErr)
+	}
+
+	return c.Status(http.StatusOK).JSON(holdModel(hold))
+}
+
+// ListHolds ...
+// @Description ListHolds API lists holds of a user.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ListHoldsResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/holds/ [get]
+func ListHolds(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	holds, err := wallet.Service().Holds(c.UserContext(), user.UserID.String())
+	if err != nil {
+		return holdError(c, err)
+	}
+
+	response := models.ListHoldsResponseModel{
+		Results: make([]models.HoldModel, 0, len(holds)),
+		Count:   int64(len(holds)),
+	}
+	for i := range holds {
+		response.Results = append(response.Results, holdModel(&holds[i]))
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// CaptureMerchantHold ...
+// @Description CaptureMerchantHold API debits an amount a user held for the merchant and pays it to the merchant. The captured amount can be lower than the held one, the rest is released.
+// @Security MerchantKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json
+// @Param id path string true "Hold ID"
+// @Param capture body models.CaptureHoldModel false "Capture"
+// @Success 200 {object} models.HoldModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 403 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /merchant/holds/{id}/capture/ [post]
+func CaptureMerchantHold(c *fiber.Ctx) error {
+	var (
+		body models.CaptureHoldModel
+	)
+
+	if len(c.Body()) > 0 {
+		err := c.BodyParser(&body)
+		if err != nil {
+			logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+			return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+				ErrorMessage: err.Error(),
+			})
+		}
+	}
+
+	m, ok := c.Locals(merchant.LocalsKey).(merchant.Merchant)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to take merchant from api key",
+		})
+	}
+
+	hold, err := merchant.Service().CaptureHold(c.UserContext(), m, c.Params("id"), body.Amount)
+	if err != nil {
+		return captureError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(holdModel(hold))
+}
+
+// VoidMerchantHold ...
+// @Description VoidMerchantHold API releases an amount a user held for the merchant without debiting it.
+// @Security MerchantKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json
+// @Param id path string true "Hold ID"
+// @Success 200 {object} models.HoldModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /merchant/holds/{id}/void/ [post]
+func VoidMerchantHold(c *fiber.Ctx) error {
+
+	m, ok := c.Locals(merchant.LocalsKey).(merchant.Merchant)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to take merchant from api key",
+		})
+	}
+
+	hold, err := merchant.Service().VoidHold(c.UserContext(), m, c.Params("id"))
+	if err != nil {
+		return holdError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(holdModel(hold))
+}
+
+// captureError tells the merchant a capture needs the user, who confirmed
+// nothing with the hold.
+func captureError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrStepUpRequired) {
+		return c.Status(http.StatusForbidden).JSON(models.StandardErrorModel{
+			ErrorMessage: "Capture needs the user's confirmation. The user has to make the hold again with a step_up one-time code",
+		})
+	} else if errors.Is(err, newerrors.ErrSpendingLimitExceeded) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error() + ". The user has to make the hold again with a limit_override one-time code",
+		})
+	}
+
+	return holdError(c, err)
+}
+
+func holdError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrHoldNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Hold not found",
+		})
+	} else if errors.Is(err, newerrors.ErrHoldNotActive) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Hold is already captured, voided or expired",
+		})
+	} else if errors.Is(err, newerrors.ErrCaptureAmount) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Capture amount must not be above the held amount",
+		})
+	}
+
+	return serviceError(c, err, serviceMessages{
+		action: "processing a hold",
+		denied: "Permission Denied. Not enough available cash",
+	})
+}
+
+func holdModel(hold *wallet.Hold) models.HoldModel {
+	return models.HoldModel{
+		ID:             hold.ID,
+		Merchant:       hold.Merchant,
+		Currency:       hold.Currency,
+		Amount:         hold.Amount,
+		CapturedAmount: hold.CapturedAmount,
+		Status:         hold.Status,
+		OperationID:    hold.OperationID,
+		CreatedAt:      hold.CreatedAt.Format(time.RFC3339),
+		ExpiresAt:      hold.ExpiresAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/currency"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/limits"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/notification"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/otp"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// SetLimit ...
+// @Description SetLimit API sets the user's own daily or monthly spending limit, for all expenses or for one category. A limit of the same period, category and currency is replaced. The user is notified when spending crosses the thresholds; expenses above the limit need an OTP.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param limit body models.SetLimitModel true "Limit"
+// @Success 200 {object} models.LimitModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/limits/ [post]
+func SetLimit(c *fiber.Ctx) error {
+	var (
+		body models.SetLimitModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	if _, err := validateDetails(body.Category, nil); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	body.Currency = wallet.Service().Currency(body.Currency)
+	if !currency.IsSupported(currency.Provider(), body.Currency) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: newerrors.ErrUnsupportedCurrency.Error(),
+		})
+	}
+
+	limit, err := limits.Service().Set(c.UserContext(), limits.Limit{
+		UserID:     user.UserID.String(),
+		Period:     body.Period,
+		Category:   body.Category,
+		Currency:   body.Currency,
+		Amount:     body.Amount,
+		Thresholds: body.Thresholds,
+	})
+	if err != nil {
+		return limitError(c, err)
+	}
+
+	usages, err := limits.Service().List(c.UserContext(), user.UserID.String())
+	if err != nil {
+		return limitError(c, err)
+	}
+
+	for _, usage := range usages {
+		if usage.ID == limit.ID {
+			return c.Status(http.StatusOK).JSON(limitModel(usage))
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(limitModel(limits.Usage{Limit: limit}))
+}
+
+// ListLimits ...
+// @Description ListLimits API lists the user's own spending limits with what is spent in the current period.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ListLimitsResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/limits/ [get]
+func ListLimits(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	usages, err := limits.Service().List(c.UserContext(), user.UserID.String())
+	if err != nil {
+		return limitError(c, err)
+	}
+
+	response := models.ListLimitsResponseModel{
+		Results: make([]models.LimitModel, 0, len(usages)),
+		Count:   int64(len(usages)),
+	}
+	for _, usage := range usages {
+		response.Results = append(response.Results, limitModel(usage))
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// DeleteLimit ...
+// @Description DeleteLimit API removes the user's own spending limit.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Limit ID"
+// @Success 200 {object} models.Success
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/limits/{id}/ [delete]
+func DeleteLimit(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	err = limits.Service().Delete(c.UserContext(), user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return limitError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(models.Success{
+		Success: true,
+	})
+}
+
+// IssueOTP ...
+// @Description IssueOTP API emails the user a one-time code to the address they signed up with. A limit_override code lets one expense go above the user's own spending limits.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param otp body models.IssueOTPModel true "OTP"
+// @Success 200 {object} models.IssueOTPResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Failure 503 {object} models.StandardErrorModel
+// @Router /user/otp/ [post]
+func IssueOTP(c *fiber.Ctx) error {
+	var (
+		body models.IssueOTPModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	expiresAt, err := otp.Service().Issue(c.UserContext(), user.UserID.String(), body.Purpose)
+	if errors.Is(err, newerrors.ErrNoOTPChannel) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "No email to send the code to",
+		})
+	} else if errors.Is(err, newerrors.ErrOTPUnavailable) {
+		return c.Status(http.StatusServiceUnavailable).JSON(models.StandardErrorModel{
+			ErrorMessage: "The code can not be sent now, try again later",
+		})
+	} else if err != nil {
+		logger.Error(c.UserContext(), "Error issuing one-time code", logger.Err(err))
+		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to issue the code",
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(models.IssueOTPResponseModel{
+		Success:   true,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	})
+}
+
+// ListNotifications ...
+// @Description ListNotifications API lists the latest notifications of a user, such as spending limit alerts. New notifications are also sent to the event stream.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ListNotificationsResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/notifications/ [get]
+func ListNotifications(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	notifications := notification.Service().List(user.UserID.String())
+
+	response := models.ListNotificationsResponseModel{
+		Results: make([]models.NotificationModel, 0, len(notifications)),
+		Count:   int64(len(notifications)),
+	}
+	for _, n := range notifications {
+		response.Results = append(response.Results, models.NotificationModel{
+			ID:        n.ID,
+			Kind:      n.Kind,
+			Message:   n.Message,
+			Data:      n.Data,
+			CreatedAt: n.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+func limitError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrLimitNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Limit not found",
+		})
+	} else if errors.Is(err, newerrors.ErrInvalidOTP) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Invalid or expired one-time code",
+		})
+	} else if errors.Is(err, newerrors.ErrSpendingLimitExceeded) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error() + ". Request a limit_override one-time code and send it with the expense to go above the limit",
+		})
+	}
+
+	return serviceError(c, err, serviceMessages{
+		action: "checking spending limits",
+	})
+}
+
+func limitModel(usage limits.Usage) models.LimitModel {
+	model := models.LimitModel{
+		ID:         usage.ID,
+		Period:     usage.Period,
+		Category:   usage.Category,
+		Currency:   usage.Currency,
+		Amount:     usage.Amount,
+		Thresholds: usage.Thresholds,
+		Spent:      usage.Spent,
+		Remaining:  usage.Remaining,
+	}
+
+	if !usage.ResetsAt.IsZero() {
+		model.ResetsAt = usage.ResetsAt.Format(time.RFC3339)
+	}
+
+	return model
+}
@@ -0,0 +1,605 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/merchant"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+)
+
+// dateLayout is the layout of dates in query parameters.
+const dateLayout = "2006-01-02"
+
+// OnboardMerchant ...
+// @Description OnboardMerchant API registers a merchant owned by the user. Payments to the merchant are credited to the user's balance. The response has the merchant's first API key, which is not shown again.
+// @Security ApiKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json
+// @Param merchant body models.OnboardMerchantModel true "Merchant"
+// @Success 200 {object} models.OnboardMerchantResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/merchants/ [post]
+func OnboardMerchant(c *fiber.Ctx) error {
+	var (
+		body models.OnboardMerchantModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	m, key, plain, err := merchant.Service().Onboard(c.UserContext(), user.UserID.String(), body.Name)
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(models.OnboardMerchantResponseModel{
+		Merchant: merchantModel(m),
+		APIKey:   merchantAPIKeyModel(key, plain),
+	})
+}
+
+// ListMerchants ...
+// @Description ListMerchants API lists the merchants owned by the user.
+// @Security ApiKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ListMerchantsResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/merchants/ [get]
+func ListMerchants(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	merchants, err := merchant.Service().Owned(c.UserContext(), user.UserID.String())
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	response := models.ListMerchantsResponseModel{
+		Results: make([]models.MerchantModel, 0, len(merchants)),
+		Count:   int64(len(merchants)),
+	}
+	for _, m := range merchants {
+		response.Results = append(response.Results, merchantModel(m))
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// ListMerchantAPIKeys ...
+// @Description ListMerchantAPIKeys API lists the API keys of the user's merchant. The keys themselves are not shown.
+// @Security ApiKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json
+// @Param id path string true "Merchant ID"
+// @Success 200 {object} models.ListMerchantAPIKeysResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/merchants/{id}/keys/ [get]
+func ListMerchantAPIKeys(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	keys, err := merchant.Service().Keys(c.UserContext(), user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	response := models.ListMerchantAPIKeysResponseModel{
+		Results: make([]models.MerchantAPIKeyModel, 0, len(keys)),
+		Count:   int64(len(keys)),
+	}
+	for _, key := range keys {
+		response.Results = append(response.Results, merchantAPIKeyModel(key, ""))
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// CreateMerchantAPIKey ...
+// @Description CreateMerchantAPIKey API issues a new API key for the user's merchant. The key is shown only in this response.
+// @Security ApiKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json
+// @Param id path string true "Merchant ID"
+// @Success 200 {object} models.MerchantAPIKeyModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/merchants/{id}/keys/ [post]
+func CreateMerchantAPIKey(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	key, plain, err := merchant.Service().CreateKey(c.UserContext(), user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(merchantAPIKeyModel(key, plain))
+}
+
+// RevokeMerchantAPIKey ...
+// @Description RevokeMerchantAPIKey API stops an API key of the user's merchant from working.
+// @Security ApiKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json
+// @Param id path string true "Merchant ID"
+// @Param key_id path string true "API key ID"
+// @Success 200 {object} models.MerchantAPIKeyModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/merchants/{id}/keys/{key_id}/ [delete]
+func RevokeMerchantAPIKey(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	key, err := merchant.Service().RevokeKey(c.UserContext(), user.UserID.String(), c.Params("id"), c.Params("key_id"))
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(merchantAPIKeyModel(key, ""))
+}
+
+// CreateCharge ...
+// @Description CreateCharge API creates a charge the user confirms from the app. The charge expires if it is not confirmed in time.
+// @Security MerchantKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json
+// @Param charge body models.CreateChargeModel true "Charge"
+// @Success 200 {object} models.ChargeModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /merchant/charge/ [post]
+func CreateCharge(c *fiber.Ctx) error {
+	var (
+		body models.CreateChargeModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	m, ok := c.Locals(merchant.LocalsKey).(merchant.Merchant)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to take merchant from api key",
+		})
+	}
+
+	charge, err := merchant.Service().CreateCharge(c.UserContext(), merchant.Charge{
+		MerchantID:  m.ID,
+		Amount:      body.Amount,
+		Currency:    body.Currency,
+		Description: body.Description,
+		Reference:   body.Reference,
+	})
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(chargeModel(charge, m))
+}
+
+// GetMerchantCharge ...
+// @Description GetMerchantCharge API returns a charge of the merchant, to see whether the user paid it.
+// @Security MerchantKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json
+// @Param id path string true "Charge ID"
+// @Success 200 {object} models.ChargeModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /merchant/charges/{id}/ [get]
+func GetMerchantCharge(c *fiber.Ctx) error {
+
+	m, ok := c.Locals(merchant.LocalsKey).(merchant.Merchant)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to take merchant from api key",
+		})
+	}
+
+	charge, err := merchant.Service().Charge(c.UserContext(), m.ID, c.Params("id"))
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(chargeModel(charge, m))
+}
+
+// CancelMerchantCharge ...
+// @Description CancelMerchantCharge API withdraws a charge the user has not paid yet.
+// @Security MerchantKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json
+// @Param id path string true "Charge ID"
+// @Success 200 {object} models.ChargeModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /merchant/charges/{id}/cancel/ [post]
+func CancelMerchantCharge(c *fiber.Ctx) error {
+
+	m, ok := c.Locals(merchant.LocalsKey).(merchant.Merchant)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to take merchant from api key",
+		})
+	}
+
+	charge, err := merchant.Service().CancelCharge(c.UserContext(), m.ID, c.Params("id"))
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(chargeModel(charge, m))
+}
+
+// GetSettlement ...
+// @Description GetSettlement API reports the payments the merchant received per day and currency, with refunds taken off. Dates are inclusive, the current month is reported by default.
+// @Security MerchantKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Success 200 {object} models.SettlementModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /merchant/settlements/ [get]
+func GetSettlement(c *fiber.Ctx) error {
+
+	m, ok := c.Locals(merchant.LocalsKey).(merchant.Merchant)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to take merchant from api key",
+		})
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.ParseInLocation(dateLayout, value, time.Local); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+				ErrorMessage: "from: must be a date like 2006-01-02",
+			})
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.ParseInLocation(dateLayout, value, time.Local); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+				ErrorMessage: "to: must be a date like 2006-01-02",
+			})
+		}
+	}
+
+	if to.Before(from) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "to: must not be before from",
+		})
+	}
+
+	settlement, err := merchant.Service().Settlement(c.UserContext(), m.ID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	response := models.SettlementModel{
+		MerchantID: settlement.MerchantID,
+		From:       from.Format(dateLayout),
+		To:         to.Format(dateLayout),
+		Days:       settlementLineModels(settlement.Days),
+		Totals:     settlementLineModels(settlement.Totals),
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// GetCharge ...
+// @Description GetCharge API shows the user a merchant charge to confirm.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Charge ID"
+// @Success 200 {object} models.ChargeModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/charges/{id}/ [get]
+func GetCharge(c *fiber.Ctx) error {
+
+	charge, err := merchant.Service().Charge(c.UserContext(), "", c.Params("id"))
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	m, err := merchant.Service().Get(c.UserContext(), charge.MerchantID)
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(chargeModel(charge, m))
+}
+
+// ConfirmCharge ...
+// @Description ConfirmCharge API pays a merchant charge from the user's balance. The payment goes through the risk rules and the user's own spending limits like any expense.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Charge ID"
+// @Param confirm body models.ConfirmChargeModel false "Confirm"
+// @Param X-Device-ID header string false "Device ID, operations from a new device may need a step_up one-time code"
+// @Success 200 {object} models.ChargeModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/charges/{id}/confirm/ [post]
+func ConfirmCharge(c *fiber.Ctx) error {
+	var (
+		body models.ConfirmChargeModel
+	)
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+			return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+				ErrorMessage: err.Error(),
+			})
+		}
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	tags, err := validateDetails(body.Category, body.Tags)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	charge, err := merchant.Service().Charge(c.UserContext(), "", c.Params("id"))
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	m, err := merchant.Service().Get(c.UserContext(), charge.MerchantID)
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	op := ledger.Operation{
+		UserID:   user.UserID.String(),
+		Type:     ledger.Expense,
+		Currency: charge.Currency,
+		Amount:   charge.Amount,
+		Merchant: m.ID,
+		Category: body.Category,
+		Tags:     tags,
+	}
+
+	charge, err = merchant.Service().ConfirmCharge(confirmed(c, body.StepUpOTP, body.OTP), op, charge.ID)
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(chargeModel(charge, m))
+}
+
+// DeclineCharge ...
+// @Description DeclineCharge API refuses a merchant charge.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Charge ID"
+// @Success 200 {object} models.ChargeModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/charges/{id}/decline/ [post]
+func DeclineCharge(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	charge, err := merchant.Service().DeclineCharge(c.UserContext(), user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	m, err := merchant.Service().Get(c.UserContext(), charge.MerchantID)
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(chargeModel(charge, m))
+}
+
+func merchantError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrMerchantNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Merchant not found",
+		})
+	} else if errors.Is(err, newerrors.ErrAPIKeyNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "API key not found",
+		})
+	} else if errors.Is(err, newerrors.ErrChargeNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Charge not found",
+		})
+	} else if errors.Is(err, newerrors.ErrChargeNotPending) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Charge is already paid, declined, cancelled or expired",
+		})
+	}
+
+	return serviceError(c, err, serviceMessages{
+		action: "processing a merchant payment",
+		denied: "Permission Denied. Not enough cash or the merchant can not receive this amount",
+	})
+}
+
+func merchantModel(m merchant.Merchant) models.MerchantModel {
+	return models.MerchantModel{
+		ID:        m.ID,
+		Name:      m.Name,
+		CreatedAt: m.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func merchantAPIKeyModel(key merchant.APIKey, plain string) models.MerchantAPIKeyModel {
+	model := models.MerchantAPIKeyModel{
+		ID:        key.ID,
+		Key:       plain,
+		Hint:      key.Hint,
+		CreatedAt: key.CreatedAt.Format(time.RFC3339),
+	}
+
+	if !key.RevokedAt.IsZero() {
+		model.RevokedAt = key.RevokedAt.Format(time.RFC3339)
+	}
+
+	return model
+}
+
+func chargeModel(charge merchant.Charge, m merchant.Merchant) models.ChargeModel {
+	model := models.ChargeModel{
+		ID:           charge.ID,
+		MerchantID:   charge.MerchantID,
+		MerchantName: m.Name,
+		Amount:       charge.Amount,
+		Currency:     charge.Currency,
+		Description:  charge.Description,
+		Reference:    charge.Reference,
+		Status:       charge.Status,
+		UserID:       charge.UserID,
+		OperationID:  charge.OperationID,
+		ExpiresAt:    charge.ExpiresAt.Format(time.RFC3339),
+		CreatedAt:    charge.CreatedAt.Format(time.RFC3339),
+
+		IncomeOperationID: charge.IncomeOperationID,
+	}
+
+	if !charge.PaidAt.IsZero() {
+		model.PaidAt = charge.PaidAt.Format(time.RFC3339)
+	}
+
+	return model
+}
+
+func settlementLineModels(lines []merchant.SettlementLine) []models.SettlementLineModel {
+	result := make([]models.SettlementLineModel, 0, len(lines))
+	for _, line := range lines {
+		result = append(result, models.SettlementLineModel{
+			Date:     line.Date,
+			Currency: line.Currency,
+			Count:    line.Count,
+			Gross:    line.Gross,
+			Refunded: line.Refunded,
+			Net:      line.Net,
+		})
+	}
+
+	return result
+}
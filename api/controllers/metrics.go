@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/metrics"
+)
+
+// Metrics writes the metrics of the gateway in the Prometheus text format.
+// It is served by the admin listener only.
+func Metrics(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, metrics.ContentType)
+
+	return metrics.Write(c)
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+)
+
+const (
+	maxTags      = 10
+	maxTagLength = 30
+)
+
+// operationTypes maps the OperationType header of ListOperationsByType to the
+// ledger's operation types, an empty header lists all of them.
+var operationTypes = map[string]string{
+	"":                   "",
+	"income_operations":  ledger.Income,
+	"expense_operations": ledger.Expense,
+}
+
+// ListHistory ...
+// @Description ListHistory API lists operations made through the gateway, including reversals and refunds. Operations can be filtered by type, category, tag, merchant and currency.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param type query string false "Operation type" Enums(income, expense, exchange_in, exchange_out, reversal, refund)
+// @Param category query string false "Category"
+// @Param tag query string false "Tag"
+// @Param merchant query string false "Merchant"
+// @Param currency query string false "Currency"
+// @Success 200 {object} models.ListOperationsByTypeResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/history/ [get]
+func ListHistory(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	operations, err := ledger.Service().List(c.UserContext(), user.UserID.String(), ledger.Filter{
+		Type:     c.Query("type"),
+		Category: c.Query("category"),
+		Tag:      strings.ToLower(c.Query("tag")),
+		Merchant: c.Query("merchant"),
+		Currency: strings.ToUpper(c.Query("currency")),
+	})
+	if err != nil {
+		return reversalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(operationsModel(operations))
+}
+
+// SetOperationCategory ...
+// @Description SetOperationCategory API changes the category of an operation.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Operation ID"
+// @Param category body models.SetCategoryModel true "Category"
+// @Success 200 {object} models.Operation
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/history/{id}/category/ [put]
+func SetOperationCategory(c *fiber.Ctx) error {
+	var (
+		body models.SetCategoryModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	if !utils.InEnums(body.Category, ledger.Categories) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Unknown category, use one of: " + strings.Join(ledger.Categories, ", "),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	op, err := ledger.Service().SetCategory(c.UserContext(), user.UserID.String(), c.Params("id"), body.Category)
+	if err != nil {
+		return reversalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(operationModel(op))
+}
+
+// SetOperationTags ...
+// @Description SetOperationTags API replaces the tags of an operation.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Operation ID"
+// @Param tags body models.SetTagsModel true "Tags"
+// @Success 200 {object} models.Operation
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/history/{id}/tags/ [put]
+func SetOperationTags(c *fiber.Ctx) error {
+	var (
+		body models.SetTagsModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	tags, err := normalizeTags(body.Tags)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	op, err := ledger.Service().SetTags(c.UserContext(), user.UserID.String(), c.Params("id"), tags)
+	if err != nil {
+		return reversalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(operationModel(op))
+}
+
+// validateDetails checks the category and tags given with a new operation.
+func validateDetails(category string, tags []string) ([]string, error) {
+	if category != "" && !utils.InEnums(category, ledger.Categories) {
+		return nil, fmt.Errorf("unknown category, use one of: %s", strings.Join(ledger.Categories, ", "))
+	}
+
+	return normalizeTags(tags)
+}
+
+// normalizeTags lowercases tags and drops empty and repeated ones.
+func normalizeTags(tags []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utils.InEnums(tag, result) {
+			continue
+		}
+
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+		result = append(result, tag)
+	}
+
+	if len(result) > maxTags {
+		return nil, fmt.Errorf("an operation can have at most %d tags", maxTags)
+	}
+
+	return result, nil
+}
+
+func operationsModel(operations []ledger.Operation) models.ListOperationsByTypeResponseModel {
+	response := models.ListOperationsByTypeResponseModel{
+		Results: make([]models.Operation, 0, len(operations)),
+		Count:   int64(len(operations)),
+	}
+	for _, op := range operations {
+		response.Results = append(response.Results, operationModel(op))
+	}
+
+	return response
+}
+
+func operationModel(op ledger.Operation) models.Operation {
+	return models.Operation{
+		ID:            op.ID,
+		Action:        op.Type,
+		Date:          op.CreatedAt.Format(time.RFC3339),
+		Direction:     op.Direction,
+		Amount:        op.Amount,
+		Currency:      op.Currency,
+		Merchant:      op.Merchant,
+		Counterparty:  op.Counterparty,
+		RequestID:     op.RequestID,
+		Status:        op.Status,
+		Note:          op.Note,
+		Category:      op.Category,
+		Tags:          op.Tags,
+		Reason:        op.Reason,
+		Reverses:      op.Reverses,
+		LegOf:         op.LegOf,
+		Compensated:   op.Compensated,
+		Compensations: op.Compensations,
+	}
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/webhook"
+)
+
+// GrantPartner ...
+// @Description GrantPartner API lets a partner receive webhooks about the user's wallet.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param grant body models.GrantPartnerModel true "Grant"
+// @Success 200 {object} models.PartnerGrantModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/partners/ [post]
+func GrantPartner(c *fiber.Ctx) error {
+	var (
+		body models.GrantPartnerModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	grant, err := webhook.Service().Grant(c.UserContext(), user.UserID.String(), body.PartnerID)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(partnerGrantModel(grant))
+}
+
+// ListPartnerGrants ...
+// @Description ListPartnerGrants API lists the partners the user lets receive webhooks about their wallet.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ListPartnerGrantsResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/partners/ [get]
+func ListPartnerGrants(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	grants, err := webhook.Service().Grants(c.UserContext(), user.UserID.String())
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	response := models.ListPartnerGrantsResponseModel{
+		Results: make([]models.PartnerGrantModel, 0, len(grants)),
+		Count:   int64(len(grants)),
+	}
+	for _, grant := range grants {
+		response.Results = append(response.Results, partnerGrantModel(grant))
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// RevokePartner ...
+// @Description RevokePartner API stops a partner from receiving webhooks about the user's wallet and deletes the partner's subscriptions to the user.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Partner ID"
+// @Success 200 {object} models.Success
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/partners/{id}/ [delete]
+func RevokePartner(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	err = webhook.Service().Revoke(c.UserContext(), user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(models.Success{
+		Success: true,
+	})
+}
+
+// grantSignUpPartner lets the partner a user signs up through receive the
+// user's webhooks, starting with the account creation. The account is created
+// already, so a failure is only logged.
+func grantSignUpPartner(c *fiber.Ctx, userID, partnerID string) {
+	if partnerID == "" {
+		return
+	}
+
+	if _, err := webhook.Service().Grant(c.UserContext(), userID, partnerID); err != nil {
+		logger.Error(c.UserContext(), "Error while granting the sign up partner access", logger.Err(err))
+	}
+}
+
+func partnerGrantModel(grant webhook.Grant) models.PartnerGrantModel {
+	return models.PartnerGrantModel{
+		PartnerID: grant.PartnerID,
+		CreatedAt: grant.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/payrequest"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+)
+
+// CreatePaymentRequest ...
+// @Description CreatePaymentRequest API asks another user for money. The payer sees the request in their list and can accept or decline it until it expires. The response has a shareable link and a QR payload of the request.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body models.CreatePaymentRequestModel true "Payment request"
+// @Success 200 {object} models.PaymentRequestModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/requests/ [post]
+func CreatePaymentRequest(c *fiber.Ctx) error {
+	var (
+		body models.CreatePaymentRequestModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	if body.PayerID == user.UserID.String() {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Can not request money from yourself",
+		})
+	}
+
+	request, err := payrequest.Service().Create(payrequest.Request{
+		RequesterID: user.UserID.String(),
+		PayerID:     body.PayerID,
+		Amount:      body.Amount,
+		Currency:    body.Currency,
+		Note:        body.Note,
+	}, time.Second*time.Duration(body.ExpiresIn))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(paymentRequestModel(request, user.UserID.String()))
+}
+
+// ListPaymentRequests ...
+// @Description ListPaymentRequests API lists payment requests sent and received by a user. Direction narrows the list to incoming requests the user has to pay or to outgoing ones.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param direction query string false "incoming or outgoing"
+// @Param status query string false "pending, accepted, declined, cancelled or expired"
+// @Success 200 {object} models.ListPaymentRequestsResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/requests/ [get]
+func ListPaymentRequests(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	direction, requestStatus := c.Query("direction"), c.Query("status")
+
+	response := models.ListPaymentRequestsResponseModel{
+		Results: make([]models.PaymentRequestModel, 0),
+	}
+	for _, request := range payrequest.Service().List(user.UserID.String()) {
+		model := paymentRequestModel(request, user.UserID.String())
+		if (direction != "" && direction != model.Direction) || (requestStatus != "" && requestStatus != model.Status) {
+			continue
+		}
+
+		response.Results = append(response.Results, model)
+	}
+	response.Count = int64(len(response.Results))
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// GetPaymentRequest ...
+// @Description GetPaymentRequest API returns a payment request the user sent or received. Shareable links point here.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Payment request ID"
+// @Success 200 {object} models.PaymentRequestModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/requests/{id}/ [get]
+func GetPaymentRequest(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	request, err := payrequest.Service().Get(user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return paymentRequestError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(paymentRequestModel(request, user.UserID.String()))
+}
+
+// AcceptPaymentRequest ...
+// @Description AcceptPaymentRequest API pays a received payment request by a transfer to the requester.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Payment request ID"
+// @Param accept body models.AcceptPaymentRequestModel false "Accept"
+// @Param X-Device-ID header string false "Device ID, operations from a new device may need a step_up one-time code"
+// @Success 200 {object} models.PaymentRequestModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/requests/{id}/accept/ [post]
+func AcceptPaymentRequest(c *fiber.Ctx) error {
+	var (
+		body models.AcceptPaymentRequestModel
+	)
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+			return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+				ErrorMessage: err.Error(),
+			})
+		}
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	request, err := payrequest.Service().Get(user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return paymentRequestError(c, err)
+	}
+
+	request, err = payrequest.Service().Accept(confirmed(c, body.StepUpOTP, ""), user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return paymentRequestError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(paymentRequestModel(request, user.UserID.String()))
+}
+
+// DeclinePaymentRequest ...
+// @Description DeclinePaymentRequest API refuses a received payment request.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Payment request ID"
+// @Success 200 {object} models.PaymentRequestModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/requests/{id}/decline/ [post]
+func DeclinePaymentRequest(c *fiber.Ctx) error {
+	return changePaymentRequest(c, payrequest.Service().Decline)
+}
+
+// CancelPaymentRequest ...
+// @Description CancelPaymentRequest API withdraws a payment request the user sent.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Payment request ID"
+// @Success 200 {object} models.PaymentRequestModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/requests/{id}/cancel/ [post]
+func CancelPaymentRequest(c *fiber.Ctx) error {
+	return changePaymentRequest(c, payrequest.Service().Cancel)
+}
+
+func changePaymentRequest(c *fiber.Ctx, change func(userID, id string) (payrequest.Request, error)) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	request, err := change(user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return paymentRequestError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(paymentRequestModel(request, user.UserID.String()))
+}
+
+func paymentRequestError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrPaymentRequestNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Payment request not found",
+		})
+	} else if errors.Is(err, newerrors.ErrPaymentRequestNotPending) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Payment request is already accepted, declined, cancelled or expired",
+		})
+	}
+
+	return serviceError(c, err, serviceMessages{
+		action:   "processing a payment request",
+		denied:   "Permission Denied. Not enough cash or the requester can not receive this amount",
+		notFound: "Requester not found",
+	})
+}
+
+func paymentRequestModel(request payrequest.Request, userID string) models.PaymentRequestModel {
+	direction := "outgoing"
+	if request.PayerID == userID {
+		direction = "incoming"
+	}
+
+	return models.PaymentRequestModel{
+		ID:          request.ID,
+		RequesterID: request.RequesterID,
+		PayerID:     request.PayerID,
+		Direction:   direction,
+		Amount:      request.Amount,
+		Currency:    request.Currency,
+		Note:        request.Note,
+		Status:      request.Status,
+		OperationID: request.OperationID,
+		Link:        request.Link(),
+		Payload:     request.Payload(),
+		ExpiresAt:   request.ExpiresAt.Format(time.RFC3339),
+		CreatedAt:   request.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   request.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,348 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// CreatePocket ...
+// @Description CreatePocket API opens a savings pocket, optionally with a target amount and date. Money moved into the pocket stays in the balance but can not be spent.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param pocket body models.PocketModel true "Pocket"
+// @Success 200 {object} models.PocketResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/pockets/ [post]
+func CreatePocket(c *fiber.Ctx) error {
+	var (
+		body models.PocketModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	targetDate, err := parseTargetDate(body.TargetDate)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	pocket, err := wallet.Service().CreatePocket(c.UserContext(), user.UserID.String(), body.Name, body.Currency, body.TargetAmount, targetDate)
+	if err != nil {
+		return pocketError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(pocketModel(pocket))
+}
+
+// ListPockets ...
+// @Description ListPockets API lists the user's savings pockets with their progress toward the target.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ListPocketsResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/pockets/ [get]
+func ListPockets(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	pockets, err := wallet.Service().Pockets(c.UserContext(), user.UserID.String())
+	if err != nil {
+		return pocketError(c, err)
+	}
+
+	response := models.ListPocketsResponseModel{
+		Results: make([]models.PocketResponseModel, 0, len(pockets)),
+		Count:   int64(len(pockets)),
+	}
+	for i := range pockets {
+		response.Results = append(response.Results, pocketModel(&pockets[i]))
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// GetPocket ...
+// @Description GetPocket API returns a savings pocket with its progress toward the target.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Pocket ID"
+// @Success 200 {object} models.PocketResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/pockets/{id}/ [get]
+func GetPocket(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	pocket, err := wallet.Service().Pocket(c.UserContext(), user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return pocketError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(pocketModel(pocket))
+}
+
+// UpdatePocket ...
+// @Description UpdatePocket API renames a savings pocket and sets its target. The currency of a pocket does not change.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Pocket ID"
+// @Param pocket body models.PocketModel true "Pocket"
+// @Success 200 {object} models.PocketResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/pockets/{id}/ [put]
+func UpdatePocket(c *fiber.Ctx) error {
+	var (
+		body models.PocketModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	targetDate, err := parseTargetDate(body.TargetDate)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	pocket, err := wallet.Service().UpdatePocket(c.UserContext(), user.UserID.String(), c.Params("id"), body.Name, body.TargetAmount, targetDate)
+	if err != nil {
+		return pocketError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(pocketModel(pocket))
+}
+
+// DeletePocket ...
+// @Description DeletePocket API closes a savings pocket. The money in it becomes available for spending again.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Pocket ID"
+// @Success 200 {object} models.PocketResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/pockets/{id}/ [delete]
+func DeletePocket(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	pocket, err := wallet.Service().DeletePocket(c.UserContext(), user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return pocketError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(pocketModel(pocket))
+}
+
+// MoveToPocket ...
+// @Description MoveToPocket API sets an amount of the available balance aside in a savings pocket.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Pocket ID"
+// @Param move body models.MovePocketModel true "Move"
+// @Success 200 {object} models.PocketResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/pockets/{id}/deposit/ [post]
+func MoveToPocket(c *fiber.Ctx) error {
+	return movePocket(c, wallet.Service().MoveToPocket)
+}
+
+// MoveFromPocket ...
+// @Description MoveFromPocket API moves an amount of a savings pocket back to the available balance.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Pocket ID"
+// @Param move body models.MovePocketModel true "Move"
+// @Success 200 {object} models.PocketResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/pockets/{id}/withdraw/ [post]
+func MoveFromPocket(c *fiber.Ctx) error {
+	return movePocket(c, wallet.Service().MoveFromPocket)
+}
+
+func movePocket(c *fiber.Ctx, move func(ctx context.Context, userID, id string, amount int64) (*wallet.Pocket, error)) error {
+	var (
+		body models.MovePocketModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	pocket, err := move(c.UserContext(), user.UserID.String(), c.Params("id"), body.Amount)
+	if err != nil {
+		return pocketError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(pocketModel(pocket))
+}
+
+func parseTargetDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := time.ParseInLocation(dateLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("target_date: must be a date like 2006-01-02")
+	}
+
+	return date, nil
+}
+
+func pocketError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrPocketNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Pocket not found",
+		})
+	} else if errors.Is(err, newerrors.ErrPocketAmount) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Amount must not be above the pocket amount",
+		})
+	} else if errors.Is(err, newerrors.ErrTooManyPockets) || errors.Is(err, newerrors.ErrUnsupportedCurrency) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	return serviceError(c, err, serviceMessages{
+		action: "processing a pocket",
+		denied: "Permission Denied. Not enough available cash",
+	})
+}
+
+func pocketModel(pocket *wallet.Pocket) models.PocketResponseModel {
+	model := models.PocketResponseModel{
+		ID:           pocket.ID,
+		Name:         pocket.Name,
+		Currency:     pocket.Currency,
+		Amount:       pocket.Amount,
+		TargetAmount: pocket.TargetAmount,
+		Progress:     pocket.Progress(),
+		Remaining:    pocket.Remaining(),
+		CreatedAt:    pocket.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    pocket.UpdatedAt.Format(time.RFC3339),
+	}
+
+	if !pocket.TargetDate.IsZero() {
+		model.TargetDate = pocket.TargetDate.Format(dateLayout)
+	}
+
+	return model
+}
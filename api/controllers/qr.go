@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/currency"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/emv"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/merchant"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/qr"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/rand"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+const (
+	// qrScale is the size of a QR code module in PNG pixels
+	qrScale = 8
+	// qrPayloadHeader carries the payload when the QR code is returned as an image
+	qrPayloadHeader = "X-QR-Payload"
+	// maxQRReferenceLength keeps the reference within the additional data field
+	maxQRReferenceLength = 25
+	// qrReferenceLength is the length of the references made for QR codes with an amount
+	qrReferenceLength = 20
+)
+
+// GetMerchantQR ...
+// @Description GetMerchantQR API makes an EMVCo QR code of the merchant to show at the till. Without an amount the code is static and the payer enters the amount. A code with an amount can be paid once, its reference identifies it and is generated when none is given. The format is json by default, with the payload, a base64 PNG and an SVG; png and svg return the image alone with the payload in the X-QR-Payload header.
+// @Security MerchantKeyAuth
+// @Tags merchant
+// @Accept json
+// @Produce json,png,xml
+// @Param amount query int false "Amount to pay"
+// @Param currency query string false "Currency, the default currency if empty"
+// @Param reference query string false "Merchant's own identifier, such as an order number"
+// @Param format query string false "json, png or svg"
+// @Success 200 {object} models.MerchantQRModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /merchant/qr/ [get]
+func GetMerchantQR(c *fiber.Ctx) error {
+
+	m, ok := c.Locals(merchant.LocalsKey).(merchant.Merchant)
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to take merchant from api key",
+		})
+	}
+
+	var amount int64
+	if value := c.Query("amount"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+				ErrorMessage: "amount: must be a positive number",
+			})
+		}
+		amount = parsed
+	}
+
+	reference := c.Query("reference")
+	if len(reference) > maxQRReferenceLength {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "reference: the length must be no more than 25",
+		})
+	}
+
+	if amount > 0 && reference == "" {
+		reference = rand.String(qrReferenceLength)
+	}
+
+	format := strings.ToLower(c.Query("format", "json"))
+	if !utils.InEnums(format, []string{"json", "png", "svg"}) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "format: must be one of json, png, svg",
+		})
+	}
+
+	cfg := config.Config()
+	code := wallet.Service().Currency(strings.ToUpper(c.Query("currency")))
+	if !currency.IsSupported(currency.Provider(), code) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: newerrors.ErrUnsupportedCurrency.Error(),
+		})
+	}
+
+	payload, err := emv.Payload{
+		GUID:         cfg.QRMerchantGUID,
+		MerchantID:   m.ID,
+		Name:         m.Name,
+		City:         cfg.QRMerchantCity,
+		Country:      cfg.QRCountryCode,
+		CategoryCode: cfg.QRCategoryCode,
+		Currency:     code,
+		Amount:       amount,
+		Reference:    reference,
+	}.Encode()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	symbol, err := qr.Encode(payload)
+	if err != nil {
+		logger.Error(c.UserContext(), "Error while encoding a QR code", logger.Err(err))
+		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
+			ErrorMessage: "Internal Server Error",
+		})
+	}
+
+	png, err := symbol.PNG(qrScale)
+	if err != nil {
+		logger.Error(c.UserContext(), "Error while rendering a QR code", logger.Err(err))
+		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
+			ErrorMessage: "Internal Server Error",
+		})
+	}
+
+	switch format {
+	case "png":
+		c.Set(qrPayloadHeader, payload)
+		c.Type("png")
+		return c.Status(http.StatusOK).Send(png)
+	case "svg":
+		c.Set(qrPayloadHeader, payload)
+		c.Type("svg")
+		return c.Status(http.StatusOK).SendString(symbol.SVG())
+	}
+
+	return c.Status(http.StatusOK).JSON(models.MerchantQRModel{
+		Payload: payload,
+		PNG:     base64.StdEncoding.EncodeToString(png),
+		SVG:     symbol.SVG(),
+	})
+}
+
+// PayQR ...
+// @Description PayQR API pays a merchant from a scanned QR code. The payload checksum is checked, and the payment goes through the risk rules and the user's own spending limits like any expense. The amount of the body is used only when the QR code has none. A QR code with an amount can be paid only once.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param payment body models.PayQRModel true "Payment"
+// @Param X-Device-ID header string false "Device ID, operations from a new device may need a step_up one-time code"
+// @Success 200 {object} models.ChargeModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 409 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/pay-qr/ [post]
+func PayQR(c *fiber.Ctx) error {
+	var (
+		body models.PayQRModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	tags, err := validateDetails(body.Category, body.Tags)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	payload, err := emv.Parse(strings.TrimSpace(body.Payload))
+	if err == nil && payload.GUID != config.Config().QRMerchantGUID {
+		err = newerrors.ErrInvalidQRPayload
+	}
+	if err != nil {
+		return qrError(c, err)
+	}
+
+	// A code with an amount pays one order, the reference tells it from a replay.
+	dynamic := payload.Amount > 0
+	if dynamic && payload.Reference == "" {
+		return qrError(c, newerrors.ErrInvalidQRPayload)
+	}
+
+	amount := payload.Amount
+	if amount == 0 {
+		amount = body.Amount
+	}
+	if amount == 0 {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "amount: the QR code has no amount, it is required",
+		})
+	}
+
+	m, err := merchant.Service().Get(c.UserContext(), payload.MerchantID)
+	if err != nil {
+		return merchantError(c, err)
+	}
+
+	op := ledger.Operation{
+		UserID:   user.UserID.String(),
+		Type:     ledger.Expense,
+		Currency: payload.Currency,
+		Amount:   amount,
+		Merchant: m.ID,
+		Category: body.Category,
+		Tags:     tags,
+	}
+
+	// The payment is a charge of the merchant, so it shows in its settlements.
+	charge, err := merchant.Service().CreateCharge(c.UserContext(), merchant.Charge{
+		MerchantID: m.ID,
+		Amount:     amount,
+		Currency:   payload.Currency,
+		Reference:  payload.Reference,
+	})
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	cancelCtx, cancel := wallet.Service().Detached()
+	defer cancel()
+
+	if dynamic {
+		if err := merchant.Service().ClaimQR(c.UserContext(), m.ID, payload.Reference, charge.ID); err != nil {
+			if _, cancelErr := merchant.Service().CancelCharge(cancelCtx, m.ID, charge.ID); cancelErr != nil {
+				logger.Error(c.UserContext(), "Error while cancelling an unpaid QR charge", logger.Err(cancelErr))
+			}
+			return qrError(c, err)
+		}
+	}
+
+	paid, err := merchant.Service().ConfirmCharge(confirmed(c, body.StepUpOTP, body.OTP), op, charge.ID)
+	if err != nil {
+		if _, cancelErr := merchant.Service().CancelCharge(cancelCtx, m.ID, charge.ID); cancelErr != nil {
+			// the charge may have been paid, keep the code claimed
+			logger.Error(c.UserContext(), "Error while cancelling an unpaid QR charge", logger.Err(cancelErr))
+		} else if dynamic {
+			if releaseErr := merchant.Service().ReleaseQR(cancelCtx, m.ID, payload.Reference, charge.ID); releaseErr != nil {
+				logger.Error(c.UserContext(), "Error while releasing an unpaid QR code", logger.Err(releaseErr))
+			}
+		}
+		return merchantError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(chargeModel(paid, m))
+}
+
+func qrError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrInvalidQRPayload) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	} else if errors.Is(err, newerrors.ErrQRAlreadyPaid) {
+		return c.Status(http.StatusConflict).JSON(models.StandardErrorModel{
+			ErrorMessage: "This QR code has already been paid",
+		})
+	}
+
+	logger.Error(c.UserContext(), "Error while reading a QR payload", logger.Err(err))
+	return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
+		ErrorMessage: "Internal Server Error",
+	})
+}
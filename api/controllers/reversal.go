@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// GetOperation ...
+// @Description GetOperation API returns an operation with its reversals and refunds.
+// @Security ApiKeyAuth
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Operation ID"
+// @Success 200 {object} models.Operation
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /admin/operations/{id}/ [get]
+func GetOperation(c *fiber.Ctx) error {
+
+	op, err := ledger.Service().Get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return reversalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(operationModel(op))
+}
+
+// ReverseOperation ...
+// @Description ReverseOperation API undoes an operation with a linked compensating operation. An operation can be reversed only once, transfers and exchanges can not be reversed. Reversing a merchant payment takes the money back from the merchant's owner.
+// @Security ApiKeyAuth
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Operation ID"
+// @Param reverse body models.ReverseOperationModel true "Reverse"
+// @Success 200 {object} models.Operation
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /admin/operations/{id}/reverse/ [post]
+func ReverseOperation(c *fiber.Ctx) error {
+	var (
+		body models.ReverseOperationModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	op, err := wallet.Service().Reverse(c.UserContext(), c.Params("id"), 0, body.Reason)
+	if err != nil {
+		return reversalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(operationModel(op))
+}
+
+// RefundOperation ...
+// @Description RefundOperation API gives back a part of a merchant payment with a linked refund operation, taking it back from the merchant's owner.
+// @Security ApiKeyAuth
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Operation ID"
+// @Param refund body models.RefundOperationModel true "Refund"
+// @Success 200 {object} models.Operation
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /admin/operations/{id}/refund/ [post]
+func RefundOperation(c *fiber.Ctx) error {
+	var (
+		body models.RefundOperationModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	op, err := wallet.Service().Reverse(c.UserContext(), c.Params("id"), body.Amount, body.Reason)
+	if err != nil {
+		return reversalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(operationModel(op))
+}
+
+func reversalError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrOperationNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Operation not found",
+		})
+	} else if errors.Is(err, newerrors.ErrAlreadyReversed) {
+		return c.Status(http.StatusConflict).JSON(models.StandardErrorModel{
+			ErrorMessage: "Operation is already reversed",
+		})
+	} else if errors.Is(err, newerrors.ErrNotReversible) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Operation can not be reversed this way",
+		})
+	} else if errors.Is(err, newerrors.ErrRefundAmount) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Refund amount is above the refundable amount",
+		})
+	}
+
+	return serviceError(c, err, serviceMessages{
+		action: "reversing an operation",
+		denied: "Permission Denied. The balance does not allow to move the money back",
+	})
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/risk"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// ListRiskDecisions ...
+// @Description ListRiskDecisions API returns the audit of the risk rules decisions on money operations, newest first, 1000 at most.
+// @Security ApiKeyAuth
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param user_id query string false "User ID"
+// @Param outcome query string false "allow, step_up or deny"
+// @Param limit query int false "Number of decisions, at most 1000"
+// @Success 200 {object} models.ListRiskDecisionsResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /admin/risk/decisions/ [get]
+func ListRiskDecisions(c *fiber.Ctx) error {
+
+	limit := risk.MaxDecisions
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+				ErrorMessage: "limit: must be a positive number",
+			})
+		}
+		limit = parsed
+	}
+
+	decisions, err := risk.Service().Decisions(c.UserContext(), c.Query("user_id"), c.Query("outcome"), limit)
+	if err != nil {
+		return serviceError(c, err, serviceMessages{
+			action: "listing risk decisions",
+		})
+	}
+
+	response := models.ListRiskDecisionsResponseModel{
+		Results: make([]models.RiskDecisionModel, 0, len(decisions)),
+		Count:   int64(len(decisions)),
+	}
+	for _, decision := range decisions {
+		response.Results = append(response.Results, models.RiskDecisionModel{
+			ID:        decision.ID,
+			UserID:    decision.UserID,
+			Type:      decision.Type,
+			Amount:    decision.Amount,
+			Currency:  decision.Currency,
+			Recipient: decision.Recipient,
+			IP:        decision.IP,
+			DeviceID:  decision.DeviceID,
+			Outcome:   decision.Outcome,
+			Rules:     decision.Rules,
+			Confirmed: decision.Confirmed,
+			CreatedAt: decision.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// deviceIDHeader carries the identifier of the client's device, the risk
+// rules may ask to confirm operations from a new one.
+const deviceIDHeader = "X-Device-ID"
+
+// confirmed returns the request context carrying the one-time codes and the
+// device ID the user sent along, the wallet checks the operation against the risk rules and
+// the user's limits with them.
+func confirmed(c *fiber.Ctx, stepUpOTP, limitOTP string) context.Context {
+	return wallet.WithConfirmation(c.UserContext(), wallet.Confirmation{
+		StepUpOTP: stepUpOTP,
+		LimitOTP:  limitOTP,
+		IP:        c.IP(),
+		DeviceID:  c.Get(deviceIDHeader),
+	})
+}
+
+func riskError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrOperationDenied) {
+		return c.Status(http.StatusForbidden).JSON(models.StandardErrorModel{
+			ErrorMessage: "Operation denied. Try again later or contact support",
+		})
+	} else if errors.Is(err, newerrors.ErrStepUpRequired) {
+		return c.Status(http.StatusForbidden).JSON(models.StandardErrorModel{
+			ErrorMessage: "Operation needs confirmation. Request a step_up one-time code and send it as step_up_otp",
+		})
+	} else if errors.Is(err, newerrors.ErrInvalidOTP) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Invalid or expired one-time code",
+		})
+	}
+
+	return serviceError(c, err, serviceMessages{
+		action: "assessing the risk of an operation",
+	})
+}
@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/scheduler"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+)
+
+// CreateSchedule ...
+// @Description CreateSchedule API schedules a recurring expense or transfer with a cron rule, e.g. "0 9 1 * *" for 09:00 on the 1st of every month. On insufficient funds the occurrence is skipped, or with the retry policy tried again a few times first. Every occurrence is claimed before it is paid, so it is paid at most once: an occurrence whose payment has an unknown outcome, like a timeout of the user service, is not tried again and gets the failed status. Occurrences refused for other reasons, like the risk rules or the spending limits, are failed too.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param schedule body models.CreateScheduleModel true "Schedule"
+// @Success 200 {object} models.ScheduleModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/schedules/ [post]
+func CreateSchedule(c *fiber.Ctx) error {
+	var (
+		body models.CreateScheduleModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	if body.Kind == scheduler.KindTransfer && (body.RecipientID == "" || body.RecipientID == user.UserID.String()) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "recipient_id: must be another user for a transfer",
+		})
+	}
+
+	if _, err := validateDetails(body.Category, nil); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	if body.Policy == "" {
+		body.Policy = scheduler.PolicySkip
+	}
+
+	schedule, err := scheduler.Service().Create(c.UserContext(), scheduler.Schedule{
+		UserID:      user.UserID.String(),
+		Kind:        body.Kind,
+		Amount:      body.Amount,
+		Currency:    body.Currency,
+		RecipientID: body.RecipientID,
+		Merchant:    body.Merchant,
+		Note:        body.Note,
+		Category:    body.Category,
+		Rule:        body.Rule,
+		Policy:      body.Policy,
+	})
+	if err != nil {
+		return scheduleError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(scheduleModel(schedule))
+}
+
+// ListSchedules ...
+// @Description ListSchedules API lists scheduled payments of a user.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ListSchedulesResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/schedules/ [get]
+func ListSchedules(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	schedules, err := scheduler.Service().List(c.UserContext(), user.UserID.String())
+	if err != nil {
+		return scheduleError(c, err)
+	}
+
+	response := models.ListSchedulesResponseModel{
+		Results: make([]models.ScheduleModel, 0, len(schedules)),
+		Count:   int64(len(schedules)),
+	}
+	for _, schedule := range schedules {
+		response.Results = append(response.Results, scheduleModel(schedule))
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// PauseSchedule ...
+// @Description PauseSchedule API stops a scheduled payment until it is resumed.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} models.ScheduleModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/schedules/{id}/pause/ [post]
+func PauseSchedule(c *fiber.Ctx) error {
+	return changeSchedule(c, scheduler.Service().Pause)
+}
+
+// ResumeSchedule ...
+// @Description ResumeSchedule API runs a paused scheduled payment again from its next occurrence.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} models.ScheduleModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/schedules/{id}/resume/ [post]
+func ResumeSchedule(c *fiber.Ctx) error {
+	return changeSchedule(c, scheduler.Service().Resume)
+}
+
+// DeleteSchedule ...
+// @Description DeleteSchedule API deletes a scheduled payment.
+// @Security ApiKeyAuth
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} models.Success
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/schedules/{id}/ [delete]
+func DeleteSchedule(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	err = scheduler.Service().Delete(c.UserContext(), user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return scheduleError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(models.Success{
+		Success: true,
+	})
+}
+
+func changeSchedule(c *fiber.Ctx, change func(ctx context.Context, userID, id string) (scheduler.Schedule, error)) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	schedule, err := change(c.UserContext(), user.UserID.String(), c.Params("id"))
+	if err != nil {
+		return scheduleError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(scheduleModel(schedule))
+}
+
+func scheduleError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrScheduleNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Schedule not found",
+		})
+	} else if errors.Is(err, newerrors.ErrInvalidRule) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	return serviceError(c, err, serviceMessages{
+		action: "processing a schedule",
+	})
+}
+
+func scheduleModel(schedule scheduler.Schedule) models.ScheduleModel {
+	model := models.ScheduleModel{
+		ID:          schedule.ID,
+		Kind:        schedule.Kind,
+		Amount:      schedule.Amount,
+		Currency:    schedule.Currency,
+		RecipientID: schedule.RecipientID,
+		Merchant:    schedule.Merchant,
+		Note:        schedule.Note,
+		Category:    schedule.Category,
+		Rule:        schedule.Rule,
+		Policy:      schedule.Policy,
+		Status:      schedule.Status,
+		NextRunAt:   schedule.NextRunAt.Format(time.RFC3339),
+		LastStatus:  schedule.LastStatus,
+		LastError:   schedule.LastError,
+		Runs:        schedule.Runs,
+		CreatedAt:   schedule.CreatedAt.Format(time.RFC3339),
+	}
+
+	if !schedule.LastRunAt.IsZero() {
+		model.LastRunAt = schedule.LastRunAt.Format(time.RFC3339)
+	}
+
+	return model
+}
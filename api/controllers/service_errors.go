@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// serviceMessages are the texts shown for the codes the caller can act on.
+type serviceMessages struct {
+	// action is logged when the call failed for an unexpected reason
+	action string
+	// denied is shown when the service refused to move the money
+	denied string
+	// notFound is shown on NotFound, "Not found" when empty
+	notFound string
+}
+
+// serviceError answers a failed call of the user service with the status
+// matching its gRPC code. Codes not listed are internal errors.
+func serviceError(c *fiber.Ctx, err error, messages serviceMessages) error {
+	// The wallet stops debits the risk rules or the user's own limits do not let through.
+	switch {
+	case errors.Is(err, newerrors.ErrOperationDenied), errors.Is(err, newerrors.ErrStepUpRequired):
+		return riskError(c, err)
+	case errors.Is(err, newerrors.ErrSpendingLimitExceeded), errors.Is(err, newerrors.ErrInvalidOTP):
+		return limitError(c, err)
+	}
+
+	code := status.Code(err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		code = codes.DeadlineExceeded
+	}
+
+	switch code {
+	case codes.PermissionDenied:
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: messages.denied,
+		})
+	case codes.InvalidArgument:
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: status.Convert(err).Message(),
+		})
+	case codes.NotFound:
+		message := messages.notFound
+		if message == "" {
+			message = "Not found"
+		}
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: message,
+		})
+	case codes.Unavailable, codes.ResourceExhausted:
+		logger.Warn(c.UserContext(), "Service unavailable while "+messages.action, logger.Err(err))
+		return c.Status(http.StatusServiceUnavailable).JSON(models.StandardErrorModel{
+			ErrorMessage: "Service is unavailable, try again later",
+		})
+	case codes.DeadlineExceeded:
+		logger.Warn(c.UserContext(), "Service did not answer in time while "+messages.action, logger.Err(err))
+		return c.Status(http.StatusGatewayTimeout).JSON(models.StandardErrorModel{
+			ErrorMessage: "Upstream service did not answer in time",
+		})
+	}
+
+	logger.Error(c.UserContext(), "Error while "+messages.action, logger.Err(err))
+	return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
+		ErrorMessage: "Internal Server Error",
+	})
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/events"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/websocket"
+)
+
+const heartbeatEvent = "heartbeat"
+
+// Stream ...
+// @Description Stream API pushes balance changes and new operations of a user. It is served as Server-Sent Events, or as a WebSocket when the request asks for an upgrade. A dropped stream is resumed with the Last-Event-ID header or the last_event_id query parameter.
+// @Security ApiKeyAuth
+// @Tags user
+// @Produce text/event-stream
+// @Param Last-Event-ID header string false "ID of the last received event"
+// @Param last_event_id query string false "ID of the last received event"
+// @Success 200 {object} events.Event
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /user/stream/ [get]
+func Stream(c *fiber.Ctx) error {
+
+	user, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	userID := user.UserID.String()
+	heartbeat := time.Second * time.Duration(config.Config().StreamHeartbeat)
+
+	lastID := c.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	lastEventID, _ := strconv.ParseUint(lastID, 10, 64)
+
+	if websocket.IsUpgrade(c) {
+		return websocket.Upgrade(c, func(conn *websocket.Conn) {
+			streamWebSocket(conn, userID, lastEventID, heartbeat)
+		})
+	}
+
+	sub, missed, err := events.Service().Subscribe(c.UserContext(), userID, lastEventID)
+	if err != nil {
+		logger.Error(c.UserContext(), "Error while subscribing to events", logger.Err(err))
+		return c.Status(http.StatusInternalServerError).JSON(models.StandardErrorModel{
+			ErrorMessage: "Internal Server Error",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		streamServerSentEvents(w, sub, missed, userID, heartbeat)
+	})
+
+	return nil
+}
+
+func streamServerSentEvents(w *bufio.Writer, sub *events.Subscription, missed []events.Event, userID string, heartbeat time.Duration) {
+	defer sub.Close()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	write := func(event events.Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		if event.ID > 0 {
+			fmt.Fprintf(w, "id: %d\n", event.ID)
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+
+		// A failed flush means the client went away.
+		return w.Flush()
+	}
+
+	for _, event := range missed {
+		if err := write(event); err != nil {
+			return
+		}
+	}
+
+	// Flush the headers right away, so the client knows the stream is open.
+	if err := w.Flush(); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case event := <-sub.Events():
+			if err := write(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := write(events.Event{Type: heartbeatEvent, UserID: userID, CreatedAt: time.Now()}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func streamWebSocket(conn *websocket.Conn, userID string, lastEventID uint64, heartbeat time.Duration) {
+	// The connection is hijacked, a failed subscription can only close it.
+	sub, missed, err := events.Service().Subscribe(context.Background(), userID, lastEventID)
+	if err != nil {
+		logger.Error(context.Background(), "Error while subscribing to events", logger.Err(err))
+		return
+	}
+	defer sub.Close()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	// The client does not send anything useful, but reading is how a closed
+	// connection is noticed and how pings get answered.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(event events.Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		_ = conn.SetWriteDeadline(time.Now().Add(heartbeat))
+		return conn.WriteText(data)
+	}
+
+	for _, event := range missed {
+		if err := write(event); err != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case event := <-sub.Events():
+			if err := write(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := write(events.Event{Type: heartbeatEvent, UserID: userID, CreatedAt: time.Now()}); err != nil {
+				return
+			}
+			if err := conn.WritePing(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	client "github.com/toshkentov01/alif-tech-task/api-gateway/grpc_client"
+)
+
+// ListUpstreams ...
+// @Description ListUpstreams API returns the upstream services with their resolved addresses, connection state, last health check and circuit breakers.
+// @Security ApiKeyAuth
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ListUpstreamsResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /admin/upstreams/ [get]
+func ListUpstreams(c *fiber.Ctx) error {
+
+	upstreams := client.Upstreams().List()
+
+	response := models.ListUpstreamsResponseModel{
+		Results: make([]models.UpstreamModel, 0, len(upstreams)),
+		Count:   int64(len(upstreams)),
+	}
+	for _, upstream := range upstreams {
+		health := upstream.Health()
+
+		model := models.UpstreamModel{
+			Name:      upstream.Name(),
+			Addresses: upstream.Addresses(),
+			Resolved:  upstream.Resolved(),
+			Discovery: upstream.Discovery(),
+			Balancer:  upstream.Balancer(),
+			State:     health.State,
+			Status:    health.Status,
+			Error:     health.Error,
+			Healthy:   health.Healthy(),
+		}
+		if !health.CheckedAt.IsZero() {
+			model.CheckedAt = health.CheckedAt.Format(time.RFC3339)
+		}
+
+		breakers := upstream.Breakers()
+		model.Breakers = make([]models.BreakerModel, 0, len(breakers))
+		for _, breaker := range breakers {
+			breakerModel := models.BreakerModel{
+				Method:   breaker.Method,
+				State:    breaker.State,
+				Failures: breaker.Failures,
+			}
+			if !breaker.OpenedAt.IsZero() {
+				breakerModel.OpenedAt = breaker.OpenedAt.Format(time.RFC3339)
+			}
+			model.Breakers = append(model.Breakers, breakerModel)
+		}
+		response.Results = append(response.Results, model)
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/webhook"
+)
+
+// CreateWebhook ...
+// @Description CreateWebhook API subscribes a URL to wallet events: those of the caller's own account and of every user who granted the caller access, or only those of user_id when it is given. A user grants access with /user/partners/ or with partner_id at sign up, so account creation can be delivered too. The URL must be http or https and may not point at an internal address. Every delivery is signed: X-Webhook-Signature is "sha256=" followed by the hex HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>" with the secret. The secret is generated when it is not given and is shown only once.
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body models.CreateWebhookModel true "Webhook"
+// @Success 200 {object} models.WebhookModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 403 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /webhooks/ [post]
+func CreateWebhook(c *fiber.Ctx) error {
+	var (
+		body models.CreateWebhookModel
+	)
+
+	err := c.BodyParser(&body)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error parsing body", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	err = body.Validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	}
+
+	partner, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	sub, err := webhook.Service().Subscribe(c.UserContext(), partner.UserID.String(), body.UserID, body.URL, body.Secret, body.EventTypes)
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	response := webhookModel(sub)
+	response.Secret = sub.Secret
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// ListWebhooks ...
+// @Description ListWebhooks API lists webhook subscriptions.
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ListWebhooksResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /webhooks/ [get]
+func ListWebhooks(c *fiber.Ctx) error {
+
+	partner, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	subs, err := webhook.Service().Subscriptions(c.UserContext(), partner.UserID.String())
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	response := models.ListWebhooksResponseModel{
+		Results: make([]models.WebhookModel, 0, len(subs)),
+		Count:   int64(len(subs)),
+	}
+	for _, sub := range subs {
+		response.Results = append(response.Results, webhookModel(sub))
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// DeleteWebhook ...
+// @Description DeleteWebhook API deletes a webhook subscription.
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} models.Success
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /webhooks/{id}/ [delete]
+func DeleteWebhook(c *fiber.Ctx) error {
+
+	partner, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	err = webhook.Service().Unsubscribe(c.UserContext(), partner.UserID.String(), c.Params("id"))
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(models.Success{
+		Success: true,
+	})
+}
+
+// ListWebhookDeliveries ...
+// @Description ListWebhookDeliveries API lists webhook deliveries. Deliveries with the "dead" status failed all attempts and make up the dead-letter list.
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param status query string false "Status" Enums(pending, delivered, dead)
+// @Success 200 {object} models.ListWebhookDeliveriesResponseModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /webhooks/deliveries/ [get]
+func ListWebhookDeliveries(c *fiber.Ctx) error {
+
+	partner, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	deliveries, err := webhook.Service().Deliveries(c.UserContext(), partner.UserID.String(), c.Query("status"))
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	response := models.ListWebhookDeliveriesResponseModel{
+		Results: make([]models.WebhookDeliveryModel, 0, len(deliveries)),
+		Count:   int64(len(deliveries)),
+	}
+	for _, delivery := range deliveries {
+		response.Results = append(response.Results, webhookDeliveryModel(delivery))
+	}
+
+	return c.Status(http.StatusOK).JSON(response)
+}
+
+// ReplayWebhookDelivery ...
+// @Description ReplayWebhookDelivery API sends a delivery again, starting over with the retries.
+// @Security ApiKeyAuth
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Delivery ID"
+// @Success 200 {object} models.WebhookDeliveryModel
+// @Failure 400 {object} models.StandardErrorModel
+// @Failure 404 {object} models.StandardErrorModel
+// @Failure 500 {object} models.StandardErrorModel
+// @Router /webhooks/deliveries/{id}/replay/ [post]
+func ReplayWebhookDelivery(c *fiber.Ctx) error {
+
+	partner, err := utils.ExtractTokenMetadata(c)
+	if err != nil {
+		logger.Warn(c.UserContext(), "Error taking user id", logger.Err(err))
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Failed to extract id from token",
+		})
+	}
+
+	delivery, err := webhook.Service().Replay(c.UserContext(), partner.UserID.String(), c.Params("id"))
+	if err != nil {
+		return webhookError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(webhookDeliveryModel(delivery))
+}
+
+func webhookError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, newerrors.ErrUnknownEventType) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: "Unknown event type, use: " + strings.Join(webhook.EventTypes, ", "),
+		})
+	} else if errors.Is(err, newerrors.ErrWebhookURL) {
+		return c.Status(http.StatusBadRequest).JSON(models.StandardErrorModel{
+			ErrorMessage: err.Error(),
+		})
+	} else if errors.Is(err, newerrors.ErrNotGranted) {
+		return c.Status(http.StatusForbidden).JSON(models.StandardErrorModel{
+			ErrorMessage: "The user has not granted you access",
+		})
+	} else if errors.Is(err, newerrors.ErrGrantNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Grant not found",
+		})
+	} else if errors.Is(err, newerrors.ErrSubscriptionNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Webhook not found",
+		})
+	} else if errors.Is(err, newerrors.ErrDeliveryNotFound) {
+		return c.Status(http.StatusNotFound).JSON(models.StandardErrorModel{
+			ErrorMessage: "Delivery not found",
+		})
+	}
+
+	return serviceError(c, err, serviceMessages{
+		action: "processing a webhook",
+	})
+}
+
+func webhookModel(sub webhook.Subscription) models.WebhookModel {
+	return models.WebhookModel{
+		ID:         sub.ID,
+		UserID:     sub.UserID,
+		URL:        sub.URL,
+		EventTypes: sub.EventTypes,
+		CreatedAt:  sub.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func webhookDeliveryModel(delivery webhook.Delivery) models.WebhookDeliveryModel {
+	model := models.WebhookDeliveryModel{
+		ID:             delivery.ID,
+		SubscriptionID: delivery.SubscriptionID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt.Format(time.RFC3339),
+	}
+
+	if delivery.Status == webhook.Pending {
+		model.NextAttemptAt = delivery.NextAttemptAt.Format(time.RFC3339)
+	}
+	if delivery.Status == webhook.Delivered {
+		model.DeliveredAt = delivery.DeliveredAt.Format(time.RFC3339)
+	}
+
+	return model
+}
@@ -11,6 +11,8 @@ const (
 	InternalMsg = "Internal Server Error"
 	// NotEnoughRights - error message for lack of rights
 	NotEnoughRights = "Not Enough Rights"
+	// InvalidAPIKey - error message for an unknown or revoked merchant API key
+	InvalidAPIKey = "Invalid API Key"
 )
 
 // ErrorResponse is a customized error type
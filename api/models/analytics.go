@@ -0,0 +1,37 @@
+package models
+
+// AnalyticsLineModel ...
+type AnalyticsLineModel struct {
+	// Key is the category, merchant or weekday
+	Key    string `json:"key"`
+	Amount int64  `json:"amount"`
+	Count  int    `json:"count"`
+	// Share is the percent of the period's spending
+	Share int `json:"share"`
+}
+
+// AnalyticsTrendModel ...
+type AnalyticsTrendModel struct {
+	// Previous is the spending of the period before
+	Previous int64 `json:"previous"`
+	Change   int64 `json:"change"`
+	// Percent is the change relative to the previous period
+	Percent int `json:"percent"`
+}
+
+// AnalyticsResponseModel ...
+type AnalyticsResponseModel struct {
+	Period string `json:"period"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	// Currency of the amounts, spending in other currencies is converted
+	Currency   string               `json:"currency"`
+	Total      int64                `json:"total"`
+	Count      int                  `json:"count"`
+	ByCategory []AnalyticsLineModel `json:"by_category"`
+	ByMerchant []AnalyticsLineModel `json:"by_merchant"`
+	ByWeekday  []AnalyticsLineModel `json:"by_weekday"`
+	Trend      AnalyticsTrendModel  `json:"trend"`
+	// Largest operations of the period, in their own currency
+	Largest []Operation `json:"largest"`
+}
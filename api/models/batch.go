@@ -0,0 +1,64 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v3"
+	"github.com/go-ozzo/ozzo-validation/v3/is"
+)
+
+// BatchOperationsModel ...
+type BatchOperationsModel struct {
+	// Mode is either all_or_nothing or best_effort
+	Mode  string               `json:"mode"`
+	Items []BatchOperationItem `json:"items"`
+}
+
+// Validate Batch Operations Model
+func (m *BatchOperationsModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Mode, validation.Required, validation.In("all_or_nothing", "best_effort")),
+		validation.Field(&m.Items, validation.Required),
+	)
+}
+
+// BatchOperationItem ...
+type BatchOperationItem struct {
+	UserID string `json:"user_id"`
+	// Type is income or expense
+	Type     string `json:"type"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Note     string `json:"note"`
+}
+
+// Validate Batch Operation Item
+func (m BatchOperationItem) Validate() error {
+	return validation.ValidateStruct(
+		&m,
+		validation.Field(&m.UserID, validation.Required, is.UUID),
+		validation.Field(&m.Type, validation.Required, validation.In("income", "expense")),
+		validation.Field(&m.Amount, validation.Required, validation.Min(int64(1))),
+	)
+}
+
+// BatchJobModel ...
+type BatchJobModel struct {
+	JobID      string                 `json:"job_id"`
+	Mode       string                 `json:"mode"`
+	Status     string                 `json:"status"`
+	Total      int                    `json:"total"`
+	Done       int                    `json:"done"`
+	Succeeded  int                    `json:"succeeded"`
+	Failed     int                    `json:"failed"`
+	Results    []BatchItemResultModel `json:"results"`
+	CreatedAt  string                 `json:"created_at"`
+	FinishedAt string                 `json:"finished_at,omitempty"`
+}
+
+// BatchItemResultModel ...
+type BatchItemResultModel struct {
+	Index       int    `json:"index"`
+	Status      string `json:"status"`
+	OperationID string `json:"operation_id,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
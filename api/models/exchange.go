@@ -0,0 +1,46 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v3"
+)
+
+// ExchangeQuoteRequestModel ...
+type ExchangeQuoteRequestModel struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount int64  `json:"amount"`
+}
+
+// Validate Exchange Quote Request Model
+func (m *ExchangeQuoteRequestModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.From, validation.Required, validation.Length(3, 3)),
+		validation.Field(&m.To, validation.Required, validation.Length(3, 3)),
+		validation.Field(&m.Amount, validation.Required, validation.Min(int64(1))),
+	)
+}
+
+// ExchangeQuoteModel ...
+type ExchangeQuoteModel struct {
+	QuoteID         string `json:"quote_id"`
+	From            string `json:"from"`
+	To              string `json:"to"`
+	Amount          int64  `json:"amount"`
+	ConvertedAmount int64  `json:"converted_amount"`
+	Rate            string `json:"rate"`
+	ExpiresAt       string `json:"expires_at"`
+}
+
+// ExchangeModel ...
+type ExchangeModel struct {
+	QuoteID string `json:"quote_id"`
+	// StepUpOTP confirms an exchange the risk rules ask to confirm
+	StepUpOTP string `json:"step_up_otp"`
+}
+
+// ExchangeResponseModel ...
+type ExchangeResponseModel struct {
+	Quote    ExchangeQuoteModel `json:"quote"`
+	Balances []BalanceModel     `json:"balances"`
+}
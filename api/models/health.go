@@ -0,0 +1,20 @@
+package models
+
+// LivenessResponseModel ...
+type LivenessResponseModel struct {
+	Status string `json:"status"`
+}
+
+// HealthCheckModel ...
+type HealthCheckModel struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadinessResponseModel ...
+type ReadinessResponseModel struct {
+	Status    string             `json:"status"`
+	Checks    []HealthCheckModel `json:"checks"`
+	CheckedAt string             `json:"checked_at"`
+}
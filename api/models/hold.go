@@ -0,0 +1,51 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v3"
+)
+
+// CreateHoldModel ...
+type CreateHoldModel struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	// Merchant is the ID of the merchant which captures or voids the hold
+	Merchant string `json:"merchant"`
+	// OTP overrides the user's own spending limits
+	OTP string `json:"otp"`
+	// StepUpOTP confirms a hold the risk rules ask to confirm
+	StepUpOTP string `json:"step_up_otp"`
+}
+
+// Validate Create Hold Model
+func (m *CreateHoldModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Amount, validation.Required, validation.Min(int64(1))),
+		validation.Field(&m.Merchant, validation.Required, validation.Length(1, 100)),
+	)
+}
+
+// CaptureHoldModel ...
+type CaptureHoldModel struct {
+	// Amount to capture, zero captures the whole hold
+	Amount int64 `json:"amount"`
+}
+
+// HoldModel ...
+type HoldModel struct {
+	ID             string `json:"id"`
+	Merchant       string `json:"merchant"`
+	Currency       string `json:"currency"`
+	Amount         int64  `json:"amount"`
+	CapturedAmount int64  `json:"captured_amount"`
+	Status         string `json:"status"`
+	OperationID    string `json:"operation_id,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	ExpiresAt      string `json:"expires_at"`
+}
+
+// ListHoldsResponseModel ...
+type ListHoldsResponseModel struct {
+	Results []HoldModel `json:"results"`
+	Count   int64       `json:"count"`
+}
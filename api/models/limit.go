@@ -0,0 +1,82 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v3"
+)
+
+// SetLimitModel ...
+type SetLimitModel struct {
+	// Period is either daily or monthly
+	Period string `json:"period"`
+	// Category limits expenses of one category, empty limits all of them
+	Category string `json:"category"`
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+	// Thresholds are percents of the amount to be alerted at, 80 and 100 by default
+	Thresholds []int `json:"thresholds"`
+}
+
+// Validate Set Limit Model
+func (m *SetLimitModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Period, validation.Required, validation.In("daily", "monthly")),
+		validation.Field(&m.Amount, validation.Required, validation.Min(int64(1))),
+		validation.Field(&m.Thresholds, validation.Length(0, 10), validation.Each(validation.Min(1), validation.Max(100))),
+	)
+}
+
+// LimitModel ...
+type LimitModel struct {
+	ID         string `json:"id"`
+	Period     string `json:"period"`
+	Category   string `json:"category,omitempty"`
+	Currency   string `json:"currency"`
+	Amount     int64  `json:"amount"`
+	Thresholds []int  `json:"thresholds"`
+	Spent      int64  `json:"spent"`
+	Remaining  int64  `json:"remaining"`
+	ResetsAt   string `json:"resets_at"`
+}
+
+// ListLimitsResponseModel ...
+type ListLimitsResponseModel struct {
+	Results []LimitModel `json:"results"`
+	Count   int64        `json:"count"`
+}
+
+// IssueOTPModel ...
+type IssueOTPModel struct {
+	// Purpose of the code, limit_override for expenses above the user's own limits,
+	// step_up for operations the risk rules ask to confirm
+	Purpose string `json:"purpose"`
+}
+
+// Validate Issue OTP Model
+func (m *IssueOTPModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Purpose, validation.Required, validation.In("limit_override", "step_up")),
+	)
+}
+
+// IssueOTPResponseModel ...
+type IssueOTPResponseModel struct {
+	Success   bool   `json:"success"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// NotificationModel ...
+type NotificationModel struct {
+	ID        string      `json:"id"`
+	Kind      string      `json:"kind"`
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"`
+	CreatedAt string      `json:"created_at"`
+}
+
+// ListNotificationsResponseModel ...
+type ListNotificationsResponseModel struct {
+	Results []NotificationModel `json:"results"`
+	Count   int64               `json:"count"`
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v3"
+)
+
+// OnboardMerchantModel ...
+type OnboardMerchantModel struct {
+	Name string `json:"name"`
+}
+
+// Validate Onboard Merchant Model
+func (m *OnboardMerchantModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Name, validation.Required, validation.Length(2, 100)),
+	)
+}
+
+// MerchantModel ...
+type MerchantModel struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+// MerchantAPIKeyModel ...
+type MerchantAPIKeyModel struct {
+	ID string `json:"id"`
+	// Key is returned only when the key is created, send it in the X-API-Key header
+	Key string `json:"key,omitempty"`
+	// Hint is the beginning of the key
+	Hint      string `json:"hint"`
+	CreatedAt string `json:"created_at"`
+	RevokedAt string `json:"revoked_at,omitempty"`
+}
+
+// OnboardMerchantResponseModel ...
+type OnboardMerchantResponseModel struct {
+	Merchant MerchantModel       `json:"merchant"`
+	APIKey   MerchantAPIKeyModel `json:"api_key"`
+}
+
+// ListMerchantsResponseModel ...
+type ListMerchantsResponseModel struct {
+	Results []MerchantModel `json:"results"`
+	Count   int64           `json:"count"`
+}
+
+// ListMerchantAPIKeysResponseModel ...
+type ListMerchantAPIKeysResponseModel struct {
+	Results []MerchantAPIKeyModel `json:"results"`
+	Count   int64                 `json:"count"`
+}
+
+// CreateChargeModel ...
+type CreateChargeModel struct {
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	Description string `json:"description"`
+	// Reference is the merchant's own identifier, such as an order number
+	Reference string `json:"reference"`
+}
+
+// Validate Create Charge Model
+func (m *CreateChargeModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Amount, validation.Required, validation.Min(int64(1))),
+		validation.Field(&m.Description, validation.Length(0, 255)),
+		validation.Field(&m.Reference, validation.Length(0, 100)),
+	)
+}
+
+// ConfirmChargeModel ...
+type ConfirmChargeModel struct {
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
+	// OTP overrides the user's own spending limits
+	OTP string `json:"otp"`
+	// StepUpOTP confirms a payment the risk rules ask to confirm
+	StepUpOTP string `json:"step_up_otp"`
+}
+
+// ChargeModel ...
+type ChargeModel struct {
+	ID           string `json:"id"`
+	MerchantID   string `json:"merchant_id"`
+	MerchantName string `json:"merchant_name"`
+	Amount       int64  `json:"amount"`
+	Currency     string `json:"currency"`
+	Description  string `json:"description,omitempty"`
+	Reference    string `json:"reference,omitempty"`
+	Status       string `json:"status"`
+	UserID       string `json:"user_id,omitempty"`
+	OperationID  string `json:"operation_id,omitempty"`
+	// IncomeOperationID is the income of the merchant's owner for a paid charge
+	IncomeOperationID string `json:"income_operation_id,omitempty"`
+	ExpiresAt         string `json:"expires_at"`
+	CreatedAt         string `json:"created_at"`
+	PaidAt            string `json:"paid_at,omitempty"`
+}
+
+// ListChargesResponseModel ...
+type ListChargesResponseModel struct {
+	Results []ChargeModel `json:"results"`
+	Count   int64         `json:"count"`
+}
+
+// SettlementLineModel ...
+type SettlementLineModel struct {
+	Date     string `json:"date,omitempty"`
+	Currency string `json:"currency"`
+	Count    int    `json:"count"`
+	Gross    int64  `json:"gross"`
+	Refunded int64  `json:"refunded"`
+	Net      int64  `json:"net"`
+}
+
+// SettlementModel ...
+type SettlementModel struct {
+	MerchantID string                `json:"merchant_id"`
+	From       string                `json:"from"`
+	To         string                `json:"to"`
+	Days       []SettlementLineModel `json:"days"`
+	Totals     []SettlementLineModel `json:"totals"`
+}
@@ -13,6 +13,8 @@ type SignUpModel struct {
 	FullName string `json:"full_name" validate:"required"`
 	Email    string `json:"email"`
 	Password string `json:"password" validate:"required"`
+	// PartnerID is the partner the user signs up through, it gets the user's webhooks
+	PartnerID string `json:"partner_id"`
 }
 
 // Validate Register Model
@@ -20,6 +22,7 @@ func (rm *SignUpModel) Validate() error {
 	return validation.ValidateStruct(
 		rm,
 		validation.Field(&rm.Email, validation.Required, is.Email),
+		validation.Field(&rm.PartnerID, is.UUID),
 		validation.Field(&rm.Password, validation.Required, validation.Length(8, 30), validation.Match(regexp.MustCompile("[a-z]|[A-Z][0-9]"))),
 		validation.Field(&rm.Username, validation.Required, validation.Length(5, 30)),
 	)
@@ -41,6 +44,8 @@ type StandardErrorModel struct {
 type SignUpModelForUnidentifiedUser struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// PartnerID is the partner the user signs up through, it gets the user's webhooks
+	PartnerID string `json:"partner_id"`
 }
 
 // Validate Register Model
@@ -49,6 +54,7 @@ func (rm *SignUpModelForUnidentifiedUser) Validate() error {
 		rm,
 		validation.Field(&rm.Password, validation.Required, validation.Length(8, 30), validation.Match(regexp.MustCompile("[a-z]|[A-Z][0-9]"))),
 		validation.Field(&rm.Username, validation.Required, validation.Length(5, 30)),
+		validation.Field(&rm.PartnerID, is.UUID),
 	)
 }
 
@@ -59,6 +65,13 @@ type SignUpResponseModelForUnidentifiedUser struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// AccountCreatedEventModel ...
+type AccountCreatedEventModel struct {
+	UserID     string `json:"user_id"`
+	Username   string `json:"username"`
+	Identified bool   `json:"identified"`
+}
+
 // CheckUserAccountResponseModel ...
 type CheckUserAccountResponseModel struct {
 	Exists bool `json:"exists"`
@@ -66,7 +79,21 @@ type CheckUserAccountResponseModel struct {
 
 // IncomeModel ...
 type IncomeModel struct {
-	IncomeAmount int64 `json:"income_amount"`
+	IncomeAmount int64    `json:"income_amount"`
+	Currency     string   `json:"currency"`
+	Note         string   `json:"note"`
+	Category     string   `json:"category"`
+	Tags         []string `json:"tags"`
+	// StepUpOTP confirms an operation the risk rules ask to confirm
+	StepUpOTP string `json:"step_up_otp"`
+}
+
+// Validate Income Model
+func (m *IncomeModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.IncomeAmount, validation.Required, validation.Min(int64(1))),
+	)
 }
 
 // Success ...
@@ -74,20 +101,102 @@ type Success struct {
 	Success bool `json:"success"`
 }
 
+// TransferModel ...
+type TransferModel struct {
+	RecipientID string   `json:"recipient_id"`
+	Amount      int64    `json:"amount"`
+	Currency    string   `json:"currency"`
+	Note        string   `json:"note"`
+	Category    string   `json:"category"`
+	Tags        []string `json:"tags"`
+	// StepUpOTP confirms an operation the risk rules ask to confirm
+	StepUpOTP string `json:"step_up_otp"`
+}
+
+// Validate Transfer Model
+func (m *TransferModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.RecipientID, validation.Required, is.UUID),
+		validation.Field(&m.Amount, validation.Required, validation.Min(int64(1))),
+	)
+}
+
+// OperationResponseModel ...
+type OperationResponseModel struct {
+	Success     bool   `json:"success"`
+	OperationID string `json:"operation_id"`
+}
+
 // ExpenseModel ...
 type ExpenseModel struct {
-	ExpenseAmount int64 `json:"expense_amount"`
+	ExpenseAmount int64    `json:"expense_amount"`
+	Currency      string   `json:"currency"`
+	Merchant      string   `json:"merchant"`
+	Note          string   `json:"note"`
+	Category      string   `json:"category"`
+	Tags          []string `json:"tags"`
+	// OTP overrides the user's own spending limits, see /user/otp/
+	OTP string `json:"otp"`
+	// StepUpOTP confirms an operation the risk rules ask to confirm
+	StepUpOTP string `json:"step_up_otp"`
+}
+
+// Validate Expense Model
+func (m *ExpenseModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.ExpenseAmount, validation.Required, validation.Min(int64(1))),
+	)
 }
 
 // GetBalanceResponseModel ...
 type GetBalanceResponseModel struct {
-	Balance int64 `json:"balance"`
+	Balance  int64                `json:"balance"`
+	Balances []BalanceModel       `json:"balances"`
+	Pockets  []PocketBalanceModel `json:"pockets"`
+}
+
+// BalanceModel ...
+type BalanceModel struct {
+	Currency string `json:"currency"`
+	// Amount is the total, pockets and holds included
+	Amount    int64 `json:"amount"`
+	Held      int64 `json:"held"`
+	Pocketed  int64 `json:"pocketed"`
+	Available int64 `json:"available"`
 }
 
 // Operation ...
 type Operation struct {
-	Action string `json:"action"`
-	Data   string `json:"date"`
+	ID            string   `json:"id,omitempty"`
+	Action        string   `json:"action"`
+	Date          string   `json:"date"`
+	Direction     string   `json:"direction,omitempty"`
+	Amount        int64    `json:"amount,omitempty"`
+	Currency      string   `json:"currency,omitempty"`
+	Merchant      string   `json:"merchant,omitempty"`
+	Counterparty  string   `json:"counterparty,omitempty"`
+	RequestID     string   `json:"request_id,omitempty"`
+	Status        string   `json:"status,omitempty"`
+	Note          string   `json:"note,omitempty"`
+	Category      string   `json:"category,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	Reason        string   `json:"reason,omitempty"`
+	Reverses      string   `json:"reverses,omitempty"`
+	LegOf         string   `json:"leg_of,omitempty"`
+	Compensated   int64    `json:"compensated_amount,omitempty"`
+	Compensations []string `json:"compensations,omitempty"`
+}
+
+// SetCategoryModel ...
+type SetCategoryModel struct {
+	Category string `json:"category"`
+}
+
+// SetTagsModel ...
+type SetTagsModel struct {
+	Tags []string `json:"tags"`
 }
 
 // ListOperationsByTypeResponseModel ...
@@ -0,0 +1,59 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v3"
+	"github.com/go-ozzo/ozzo-validation/v3/is"
+)
+
+// CreatePaymentRequestModel ...
+type CreatePaymentRequestModel struct {
+	PayerID  string `json:"payer_id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Note     string `json:"note"`
+	// ExpiresIn is the lifetime of the request in seconds, zero uses the default
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// Validate Create Payment Request Model
+func (m *CreatePaymentRequestModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.PayerID, validation.Required, is.UUID),
+		validation.Field(&m.Amount, validation.Required, validation.Min(int64(1))),
+		validation.Field(&m.Note, validation.Length(0, 255)),
+		validation.Field(&m.ExpiresIn, validation.Min(int64(0)), validation.Max(int64(30*24*60*60))),
+	)
+}
+
+// AcceptPaymentRequestModel ...
+type AcceptPaymentRequestModel struct {
+	// StepUpOTP confirms a payment the risk rules ask to confirm
+	StepUpOTP string `json:"step_up_otp"`
+}
+
+// PaymentRequestModel ...
+type PaymentRequestModel struct {
+	ID          string `json:"id"`
+	RequesterID string `json:"requester_id"`
+	PayerID     string `json:"payer_id"`
+	// Direction is incoming for requests the user has to pay, outgoing for the user's own
+	Direction   string `json:"direction"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	Note        string `json:"note,omitempty"`
+	Status      string `json:"status"`
+	OperationID string `json:"operation_id,omitempty"`
+	Link        string `json:"link"`
+	// Payload is the text to put into a QR code
+	Payload   string `json:"payload"`
+	ExpiresAt string `json:"expires_at"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// ListPaymentRequestsResponseModel ...
+type ListPaymentRequestsResponseModel struct {
+	Results []PaymentRequestModel `json:"results"`
+	Count   int64                 `json:"count"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v3"
+)
+
+// PocketModel is the body to create or update a pocket.
+type PocketModel struct {
+	Name string `json:"name"`
+	// Currency can not be changed once the pocket is created, the default currency if empty
+	Currency     string `json:"currency"`
+	TargetAmount int64  `json:"target_amount"`
+	// TargetDate is a date like 2006-01-02
+	TargetDate string `json:"target_date"`
+}
+
+// Validate Pocket Model
+func (m *PocketModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Name, validation.Required, validation.Length(1, 50)),
+		validation.Field(&m.TargetAmount, validation.Min(int64(0))),
+	)
+}
+
+// MovePocketModel ...
+type MovePocketModel struct {
+	Amount int64 `json:"amount"`
+}
+
+// Validate Move Pocket Model
+func (m *MovePocketModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Amount, validation.Required, validation.Min(int64(1))),
+	)
+}
+
+// PocketResponseModel ...
+type PocketResponseModel struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Currency     string `json:"currency"`
+	Amount       int64  `json:"amount"`
+	TargetAmount int64  `json:"target_amount,omitempty"`
+	TargetDate   string `json:"target_date,omitempty"`
+	// Progress is the percent of the target amount in the pocket
+	Progress int `json:"progress"`
+	// Remaining is what is left to put into the pocket to reach the target
+	Remaining int64  `json:"remaining"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// ListPocketsResponseModel ...
+type ListPocketsResponseModel struct {
+	Results []PocketResponseModel `json:"results"`
+	Count   int64                 `json:"count"`
+}
+
+// PocketBalanceModel ...
+type PocketBalanceModel struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+}
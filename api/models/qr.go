@@ -0,0 +1,37 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v3"
+)
+
+// MerchantQRModel ...
+type MerchantQRModel struct {
+	// Payload is the EMVCo text encoded in the QR code
+	Payload string `json:"payload"`
+	// PNG is the QR code image, base64 encoded
+	PNG string `json:"png"`
+	SVG string `json:"svg"`
+}
+
+// PayQRModel ...
+type PayQRModel struct {
+	// Payload is the text read from the merchant's QR code
+	Payload string `json:"payload"`
+	// Amount is required when the QR code does not have one
+	Amount   int64    `json:"amount"`
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
+	// OTP overrides the user's own spending limits
+	OTP string `json:"otp"`
+	// StepUpOTP confirms a payment the risk rules ask to confirm
+	StepUpOTP string `json:"step_up_otp"`
+}
+
+// Validate Pay QR Model
+func (m *PayQRModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Payload, validation.Required, validation.Length(1, 512)),
+		validation.Field(&m.Amount, validation.Min(int64(0))),
+	)
+}
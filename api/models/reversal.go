@@ -0,0 +1,33 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v3"
+)
+
+// ReverseOperationModel ...
+type ReverseOperationModel struct {
+	Reason string `json:"reason"`
+}
+
+// Validate Reverse Operation Model
+func (m *ReverseOperationModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Reason, validation.Required, validation.Length(3, 500)),
+	)
+}
+
+// RefundOperationModel ...
+type RefundOperationModel struct {
+	Amount int64  `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+// Validate Refund Operation Model
+func (m *RefundOperationModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Amount, validation.Required, validation.Min(int64(1))),
+		validation.Field(&m.Reason, validation.Required, validation.Length(3, 500)),
+	)
+}
@@ -0,0 +1,23 @@
+package models
+
+// RiskDecisionModel ...
+type RiskDecisionModel struct {
+	ID        string   `json:"id"`
+	UserID    string   `json:"user_id"`
+	Type      string   `json:"type"`
+	Amount    int64    `json:"amount"`
+	Currency  string   `json:"currency"`
+	Recipient string   `json:"recipient,omitempty"`
+	IP        string   `json:"ip,omitempty"`
+	DeviceID  string   `json:"device_id,omitempty"`
+	Outcome   string   `json:"outcome"`
+	Rules     []string `json:"rules"`
+	Confirmed bool     `json:"confirmed"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// ListRiskDecisionsResponseModel ...
+type ListRiskDecisionsResponseModel struct {
+	Results []RiskDecisionModel `json:"results"`
+	Count   int64               `json:"count"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v3"
+	"github.com/go-ozzo/ozzo-validation/v3/is"
+)
+
+// CreateScheduleModel ...
+type CreateScheduleModel struct {
+	// Kind is either expense or transfer
+	Kind        string `json:"kind"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	RecipientID string `json:"recipient_id"`
+	Merchant    string `json:"merchant"`
+	Note        string `json:"note"`
+	Category    string `json:"category"`
+	// Rule is a cron rule like "0 9 1 * *" or a shortcut like "@monthly"
+	Rule string `json:"rule"`
+	// Policy on insufficient funds is either skip or retry
+	Policy string `json:"policy"`
+}
+
+// Validate Create Schedule Model
+func (m *CreateScheduleModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.Kind, validation.Required, validation.In("expense", "transfer")),
+		validation.Field(&m.Amount, validation.Required, validation.Min(int64(1))),
+		validation.Field(&m.RecipientID, is.UUID),
+		validation.Field(&m.Rule, validation.Required),
+		validation.Field(&m.Policy, validation.In("skip", "retry")),
+	)
+}
+
+// ScheduleModel ...
+type ScheduleModel struct {
+	ID          string `json:"id"`
+	Kind        string `json:"kind"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency,omitempty"`
+	RecipientID string `json:"recipient_id,omitempty"`
+	Merchant    string `json:"merchant,omitempty"`
+	Note        string `json:"note,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Rule        string `json:"rule"`
+	Policy      string `json:"policy"`
+	Status      string `json:"status"`
+	NextRunAt   string `json:"next_run_at"`
+	LastRunAt   string `json:"last_run_at,omitempty"`
+	LastStatus  string `json:"last_status,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+	Runs        int    `json:"runs"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// ListSchedulesResponseModel ...
+type ListSchedulesResponseModel struct {
+	Results []ScheduleModel `json:"results"`
+	Count   int64           `json:"count"`
+}
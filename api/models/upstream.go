@@ -0,0 +1,31 @@
+package models
+
+// UpstreamModel ...
+type UpstreamModel struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"`
+	Resolved  []string `json:"resolved"`
+	Discovery string   `json:"discovery"`
+	Balancer  string   `json:"balancer"`
+	State     string   `json:"state"`
+	Status    string   `json:"status,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	CheckedAt string   `json:"checked_at,omitempty"`
+	Healthy   bool     `json:"healthy"`
+
+	Breakers []BreakerModel `json:"breakers"`
+}
+
+// BreakerModel ...
+type BreakerModel struct {
+	Method   string `json:"method"`
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	OpenedAt string `json:"opened_at,omitempty"`
+}
+
+// ListUpstreamsResponseModel ...
+type ListUpstreamsResponseModel struct {
+	Results []UpstreamModel `json:"results"`
+	Count   int64           `json:"count"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v3"
+	"github.com/go-ozzo/ozzo-validation/v3/is"
+)
+
+// CreateWebhookModel ...
+type CreateWebhookModel struct {
+	// UserID limits the subscription to the events of one user who granted access
+	UserID     string   `json:"user_id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+}
+
+// Validate Create Webhook Model
+func (m *CreateWebhookModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.UserID, is.UUID),
+		validation.Field(&m.URL, validation.Required, is.URL),
+		validation.Field(&m.Secret, validation.Length(16, 128)),
+		validation.Field(&m.EventTypes, validation.Required),
+	)
+}
+
+// WebhookModel ...
+type WebhookModel struct {
+	ID         string   `json:"id"`
+	UserID     string   `json:"user_id,omitempty"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"event_types"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// ListWebhooksResponseModel ...
+type ListWebhooksResponseModel struct {
+	Results []WebhookModel `json:"results"`
+	Count   int64          `json:"count"`
+}
+
+// WebhookDeliveryModel ...
+type WebhookDeliveryModel struct {
+	ID             string `json:"id"`
+	SubscriptionID string `json:"subscription_id"`
+	EventID        uint64 `json:"event_id"`
+	EventType      string `json:"event_type"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	LastError      string `json:"last_error,omitempty"`
+	NextAttemptAt  string `json:"next_attempt_at,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	DeliveredAt    string `json:"delivered_at,omitempty"`
+}
+
+// ListWebhookDeliveriesResponseModel ...
+type ListWebhookDeliveriesResponseModel struct {
+	Results []WebhookDeliveryModel `json:"results"`
+	Count   int64                  `json:"count"`
+}
+
+// GrantPartnerModel ...
+type GrantPartnerModel struct {
+	PartnerID string `json:"partner_id"`
+}
+
+// Validate Grant Partner Model
+func (m *GrantPartnerModel) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.PartnerID, validation.Required, is.UUID),
+	)
+}
+
+// PartnerGrantModel ...
+type PartnerGrantModel struct {
+	PartnerID string `json:"partner_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ListPartnerGrantsResponseModel ...
+type ListPartnerGrantsResponseModel struct {
+	Results []PartnerGrantModel `json:"results"`
+	Count   int64               `json:"count"`
+}
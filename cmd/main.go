@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	_ "github.com/joho/godotenv/autoload"
 	_ "github.com/toshkentov01/alif-tech-task/api-gateway/api/docs" //register swagger
 	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	client "github.com/toshkentov01/alif-tech-task/api-gateway/grpc_client"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
 	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/middleware"
 	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/routes"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/scheduler"
 	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/webhook"
 )
 
 var (
@@ -24,26 +30,58 @@ var (
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name Authorization
+// @securityDefinitions.apikey MerchantKeyAuth
+// @in header
+// @name X-API-Key
 // @BasePath /api
 func main() {
-	app := fiber.New(fiberConfig)
+	logger.Service()
 
-	app.Use(logger.New(logger.Config{
-		// For more options, see the Config section
-		Format: "${pid} ${locals:requestid} ${status} - ${method} ${path}\n",
-	}))
+	app := fiber.New(fiberConfig)
 
+	app.Use(middleware.RequestID())
+	app.Use(middleware.AccessLog())
+	app.Use(middleware.Metrics())
+	app.Use(middleware.Tracing())
 	middleware.FiberMiddleware(app)
+	app.Use(middleware.RequestContext(time.Second * time.Duration(appConfig.CtxTimeout)))
 
 	jwtRoleAuthorizer, err := middleware.NewJWTRoleAuthorizer(appConfig)
 	if err != nil {
 		log.Fatal("Could not initialize JWT Role Authorizer")
 	}
 
+	if appConfig.BatchConcurrency < 1 {
+		log.Fatal("BATCH_CONCURRENCY must be at least 1")
+	}
+
+	if err := database.Migrate(context.Background(), database.Service()); err != nil {
+		log.Fatal("Could not migrate the database: ", err)
+	}
+
+	client.Upstreams().Start()
+	webhook.Service().Start()
+	scheduler.Service().Start()
+
+	routes.HealthRoutes(app, jwtRoleAuthorizer)
 	app.Use(middleware.NewAuthorizer(jwtRoleAuthorizer))
 	routes.SwaggerRoute(app)
 	routes.UserRoutes(app)
 
+	policies, err := routes.GatewayRoutes(app)
+	if err != nil {
+		log.Fatal("Could not load gateway routes: ", err)
+	}
+	if err := jwtRoleAuthorizer.AddPolicies(policies); err != nil {
+		log.Fatal("Could not add policies of gateway routes: ", err)
+	}
+
+	if appConfig.MetricsAddress != "" {
+		admin := fiber.New(fiber.Config{DisableStartupMessage: true})
+		routes.MetricsRoutes(admin)
+		go utils.StartAdminServer(admin, appConfig.MetricsAddress)
+	}
+
 	// Start server (with or without graceful shutdown).
 	if config.Config().Environment == "develop" {
 		utils.StartServer(app)
@@ -31,6 +31,8 @@ type Configuration struct {
 	PostgresDatabase           string
 	PostgresUser               string
 	PostgresPassword           string
+	// PostgresMaxConnections caps the connections of the pool, 0 for no cap
+	PostgresMaxConnections     int
 	ServerPort                 int
 	ServerHost                 string
 	LogLevel                   string
@@ -55,6 +57,121 @@ type Configuration struct {
 	UserServiceHost string
 	UserServicePort int
 	HTTPPort string
+
+	// UpstreamsConfigPath is the YAML file of the upstream services, empty for the user service only
+	UpstreamsConfigPath string
+
+	// DefaultCurrency is the currency of the balance kept by the user service
+	DefaultCurrency string
+	// RateProvider is one of "static" or "file"
+	RateProvider  string
+	RatesFilePath string
+	// exchange quote lifetime in seconds
+	ExchangeQuoteTTL int
+	// hold lifetime in seconds
+	HoldTTL int
+
+	// heartbeat interval of the event stream in seconds
+	StreamHeartbeat int
+	// number of missed events sent when a stream is resumed
+	EventHistorySize int
+	// seconds published events are kept
+	EventHistoryTTL int
+
+	WebhookMaxAttempts int
+	// first retry delay in seconds, doubled on every attempt
+	WebhookBackoff int
+	// delivery request timeout in seconds
+	WebhookTimeout int
+	// days delivered and dead deliveries are kept
+	WebhookRetention int
+
+	BatchConcurrency int
+	BatchMaxItems    int
+	// batches above this size run in the background and are tracked by a job ID
+	BatchSyncLimit int
+	// deadline of a synchronous batch request in seconds, longer than CTX_TIMEOUT
+	BatchTimeout int
+	// days batch jobs are kept
+	BatchRetention int
+
+	// how often due schedules are looked for, in seconds
+	SchedulerTick int
+	// delay before retrying a schedule which failed for lack of money, in seconds
+	SchedulerRetryInterval int
+	// retries of an occurrence which failed for lack of money or with an unknown outcome
+	SchedulerMaxRetries int
+
+	// payment request lifetime in seconds when the request does not set one
+	PaymentRequestTTL int
+	// PaymentLinkURL is followed by the request ID in shareable links
+	PaymentLinkURL string
+
+	// one-time code lifetime in seconds
+	OTPTTL    int
+	OTPLength int
+	// SMTP server one-time codes are emailed through, without it no codes are issued
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	// number of notifications kept per user
+	NotificationInboxSize int
+
+	RiskRulesPath string
+
+	// merchant charge lifetime in seconds
+	MerchantChargeTTL int
+
+	// number of savings pockets a user can have
+	MaxPockets int
+
+	// how long a spending report is cached, in seconds
+	AnalyticsCacheTTL int
+
+	// RoutesConfigPath is the YAML file of routes served by calling upstream RPCs, empty for none
+	RoutesConfigPath string
+
+	// TranscodingDescriptorSets are comma separated FileDescriptorSet files whose
+	// google.api.http annotated methods are served
+	TranscodingDescriptorSets string
+	// TranscodingReflection fetches the descriptors from the transcoding upstream through server reflection
+	TranscodingReflection bool
+	// TranscodingUpstream is the upstream the annotated methods are called on
+	TranscodingUpstream string
+	// TranscodingPrefix is put before the annotated paths
+	TranscodingPrefix string
+	// TranscodingRoles are comma separated roles allowed to call the annotated methods
+	TranscodingRoles string
+	// TranscodingUserIDField is the request field set to the ID of the token's user
+	TranscodingUserIDField string
+
+	// MetricsAddress is the admin listener serving /metrics, like :9090. Metrics are not served when empty
+	MetricsAddress string
+
+	// TracingExporter is one of "none", "stdout", "file" or "otlp"
+	TracingExporter string
+	// TracingEndpoint is the OTLP/HTTP traces URL of the collector
+	TracingEndpoint    string
+	TracingFile        string
+	TracingServiceName string
+	// TracingSampleRatio is the share of new traces recorded, from 0 to 1
+	TracingSampleRatio float64
+
+	// how long a readiness result is reused, in seconds
+	HealthCacheTTL int
+	// timeout of each readiness check in seconds
+	HealthCheckTimeout int
+	// how long the gateway reports not ready before shutting down, in seconds
+	ShutdownDrain int
+
+	// QRMerchantGUID names this payment system in the merchant information of QR payloads
+	QRMerchantGUID string
+	QRCountryCode  string
+	QRMerchantCity string
+	// QRCategoryCode is the merchant category code put into QR payloads
+	QRCategoryCode string
 }
 
 func load() *Configuration {
@@ -64,6 +181,14 @@ func load() *Configuration {
 		ServerPort:          cast.ToInt(getOrReturnDefault("SERVER_PORT", "8000")),
 		Environment:         cast.ToString(getOrReturnDefault("ENVIRONMENT", "develop")),
 		LogLevel:            cast.ToString(getOrReturnDefault("LOG_LEVEL", "debug")),
+
+		PostgresHost:           cast.ToString(getOrReturnDefault("POSTGRES_HOST", "localhost")),
+		PostgresPort:           cast.ToInt(getOrReturnDefault("POSTGRES_PORT", 5432)),
+		PostgresDatabase:       cast.ToString(getOrReturnDefault("POSTGRES_DB", "alif")),
+		PostgresUser:           cast.ToString(getOrReturnDefault("POSTGRES_USER", "postgres")),
+		PostgresPassword:       cast.ToString(getOrReturnDefault("POSTGRES_PASSWORD", "postgres")),
+		PostgresMaxConnections: cast.ToInt(getOrReturnDefault("POSTGRES_MAX_CONNECTIONS", 20)),
+
 		ServiceDir:          cast.ToString(getOrReturnDefault("CURRENT_DIR", "")),
 		CtxTimeout:          cast.ToInt(getOrReturnDefault("CTX_TIMEOUT", 7)),
 		CasbinConfigPath:    cast.ToString(getOrReturnDefault("CASBIN_CONFIG_PATH", "./config/rbac_model.conf")),
@@ -78,8 +203,81 @@ func load() *Configuration {
 
 		UserServiceHost: cast.ToString(getOrReturnDefault("USER_SERVICE_HOST", "")),
 		UserServicePort: cast.ToInt(getOrReturnDefault("USER_SERVICE_PORT", 9000)),
+
+		UpstreamsConfigPath: cast.ToString(getOrReturnDefault("UPSTREAMS_CONFIG_PATH", "./config/upstreams.yaml")),
 		
 		HTTPPort: cast.ToString(getOrReturnDefault("HTTP_PORT", "8000")),
+
+		DefaultCurrency:  cast.ToString(getOrReturnDefault("DEFAULT_CURRENCY", "UZS")),
+		RateProvider:     cast.ToString(getOrReturnDefault("RATE_PROVIDER", "file")),
+		RatesFilePath:    cast.ToString(getOrReturnDefault("RATES_FILE_PATH", "./config/rates.json")),
+		ExchangeQuoteTTL: cast.ToInt(getOrReturnDefault("EXCHANGE_QUOTE_TTL", 30)),
+		HoldTTL:          cast.ToInt(getOrReturnDefault("HOLD_TTL", 1800)),
+
+		StreamHeartbeat:  cast.ToInt(getOrReturnDefault("STREAM_HEARTBEAT", 15)),
+		EventHistorySize: cast.ToInt(getOrReturnDefault("EVENT_HISTORY_SIZE", 100)),
+		EventHistoryTTL:  cast.ToInt(getOrReturnDefault("EVENT_HISTORY_TTL", 86400)),
+
+		WebhookMaxAttempts: cast.ToInt(getOrReturnDefault("WEBHOOK_MAX_ATTEMPTS", 8)),
+		WebhookBackoff:     cast.ToInt(getOrReturnDefault("WEBHOOK_BACKOFF", 5)),
+		WebhookTimeout:     cast.ToInt(getOrReturnDefault("WEBHOOK_TIMEOUT", 10)),
+		WebhookRetention:   cast.ToInt(getOrReturnDefault("WEBHOOK_RETENTION", 30)),
+
+		BatchConcurrency: cast.ToInt(getOrReturnDefault("BATCH_CONCURRENCY", 8)),
+		BatchMaxItems:    cast.ToInt(getOrReturnDefault("BATCH_MAX_ITEMS", 1000)),
+		BatchSyncLimit:   cast.ToInt(getOrReturnDefault("BATCH_SYNC_LIMIT", 50)),
+		BatchTimeout:     cast.ToInt(getOrReturnDefault("BATCH_TIMEOUT", 60)),
+		BatchRetention:   cast.ToInt(getOrReturnDefault("BATCH_RETENTION", 7)),
+
+		SchedulerTick:          cast.ToInt(getOrReturnDefault("SCHEDULER_TICK", 30)),
+		SchedulerRetryInterval: cast.ToInt(getOrReturnDefault("SCHEDULER_RETRY_INTERVAL", 3600)),
+		SchedulerMaxRetries:    cast.ToInt(getOrReturnDefault("SCHEDULER_MAX_RETRIES", 3)),
+
+		PaymentRequestTTL: cast.ToInt(getOrReturnDefault("PAYMENT_REQUEST_TTL", 86400)),
+		PaymentLinkURL:    cast.ToString(getOrReturnDefault("PAYMENT_LINK_URL", "http://localhost:8000/api/user/requests/")),
+
+		OTPTTL:                cast.ToInt(getOrReturnDefault("OTP_TTL", 300)),
+		OTPLength:             cast.ToInt(getOrReturnDefault("OTP_LENGTH", 6)),
+		SMTPHost:              cast.ToString(getOrReturnDefault("SMTP_HOST", "")),
+		SMTPPort:              cast.ToInt(getOrReturnDefault("SMTP_PORT", 587)),
+		SMTPUsername:          cast.ToString(getOrReturnDefault("SMTP_USERNAME", "")),
+		SMTPPassword:          cast.ToString(getOrReturnDefault("SMTP_PASSWORD", "")),
+		SMTPFrom:              cast.ToString(getOrReturnDefault("SMTP_FROM", "no-reply@localhost")),
+		NotificationInboxSize: cast.ToInt(getOrReturnDefault("NOTIFICATION_INBOX_SIZE", 100)),
+
+		RiskRulesPath: cast.ToString(getOrReturnDefault("RISK_RULES_PATH", "./config/risk_rules.json")),
+
+		MerchantChargeTTL: cast.ToInt(getOrReturnDefault("MERCHANT_CHARGE_TTL", 900)),
+
+		MaxPockets: cast.ToInt(getOrReturnDefault("MAX_POCKETS", 20)),
+
+		AnalyticsCacheTTL: cast.ToInt(getOrReturnDefault("ANALYTICS_CACHE_TTL", 300)),
+
+		RoutesConfigPath: cast.ToString(getOrReturnDefault("ROUTES_CONFIG_PATH", "./config/routes.yaml")),
+
+		TranscodingDescriptorSets: cast.ToString(getOrReturnDefault("TRANSCODING_DESCRIPTOR_SETS", "")),
+		TranscodingReflection:     cast.ToBool(getOrReturnDefault("TRANSCODING_REFLECTION", false)),
+		TranscodingUpstream:       cast.ToString(getOrReturnDefault("TRANSCODING_UPSTREAM", "user")),
+		TranscodingPrefix:         cast.ToString(getOrReturnDefault("TRANSCODING_PREFIX", "/api")),
+		TranscodingRoles:          cast.ToString(getOrReturnDefault("TRANSCODING_ROLES", "user")),
+		TranscodingUserIDField:    cast.ToString(getOrReturnDefault("TRANSCODING_USER_ID_FIELD", "user_id")),
+
+		MetricsAddress: cast.ToString(getOrReturnDefault("METRICS_ADDRESS", ":9090")),
+
+		TracingExporter:    cast.ToString(getOrReturnDefault("TRACING_EXPORTER", "none")),
+		TracingEndpoint:    cast.ToString(getOrReturnDefault("TRACING_ENDPOINT", "http://localhost:4318/v1/traces")),
+		TracingFile:        cast.ToString(getOrReturnDefault("TRACING_FILE", "./traces.json")),
+		TracingServiceName: cast.ToString(getOrReturnDefault("TRACING_SERVICE_NAME", "api-gateway")),
+		TracingSampleRatio: cast.ToFloat64(getOrReturnDefault("TRACING_SAMPLE_RATIO", 1)),
+
+		HealthCacheTTL:     cast.ToInt(getOrReturnDefault("HEALTH_CACHE_TTL", 2)),
+		HealthCheckTimeout: cast.ToInt(getOrReturnDefault("HEALTH_CHECK_TIMEOUT", 2)),
+		ShutdownDrain:      cast.ToInt(getOrReturnDefault("SHUTDOWN_DRAIN", 5)),
+
+		QRMerchantGUID: cast.ToString(getOrReturnDefault("QR_MERCHANT_GUID", "uz.alif.pay")),
+		QRCountryCode:  cast.ToString(getOrReturnDefault("QR_COUNTRY_CODE", "UZ")),
+		QRMerchantCity: cast.ToString(getOrReturnDefault("QR_MERCHANT_CITY", "Tashkent")),
+		QRCategoryCode: cast.ToString(getOrReturnDefault("QR_CATEGORY_CODE", "5999")),
 	}
 }
 
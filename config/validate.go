@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// Validate tells whether the configuration can serve requests: the secrets are
+// set, the timeouts are positive and the files it points to exist.
+func (c *Configuration) Validate() error {
+	if c.JWTSecretKey == "" {
+		return fmt.Errorf("JWT_SECRET_KEY is not set")
+	}
+	if c.CtxTimeout <= 0 {
+		return fmt.Errorf("CTX_TIMEOUT must be positive, got %d", c.CtxTimeout)
+	}
+
+	files := map[string]string{
+		"CASBIN_CONFIG_PATH":    c.CasbinConfigPath,
+		"MIDDLEWARE_ROLES_PATH": c.MiddlewareRolesPath,
+		"UPSTREAMS_CONFIG_PATH": c.UpstreamsConfigPath,
+		"ROUTES_CONFIG_PATH":    c.RoutesConfigPath,
+	}
+	for key, path := range files {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+	}
+
+	return nil
+}
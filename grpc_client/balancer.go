@@ -0,0 +1,96 @@
+package grpcclient
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// Balancing policies of upstreams with several addresses
+const (
+	PickFirst    = "pick_first"
+	RoundRobin   = "round_robin"
+	LeastRequest = "least_request"
+)
+
+func init() {
+	balancer.Register(leastRequestBuilder{})
+}
+
+// leastRequestBuilder builds balancers sending each call to the ready address
+// with the fewest calls in flight.
+type leastRequestBuilder struct{}
+
+// Build gives every connection its own counters of calls in flight.
+func (leastRequestBuilder) Build(cc balancer.ClientConn, options balancer.BuildOptions) balancer.Balancer {
+	pickerBuilder := &leastRequestPickerBuilder{inFlight: make(map[balancer.SubConn]*int64)}
+
+	return base.NewBalancerBuilder(LeastRequest, pickerBuilder, base.Config{}).Build(cc, options)
+}
+
+func (leastRequestBuilder) Name() string {
+	return LeastRequest
+}
+
+type leastRequestPickerBuilder struct {
+	mu       sync.Mutex
+	inFlight map[balancer.SubConn]*int64
+}
+
+// Build keeps the counters of the subconns still ready, so calls in flight
+// are not forgotten when the ready set changes.
+func (b *leastRequestPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	counters := make(map[balancer.SubConn]*int64, len(info.ReadySCs))
+	picker := &leastRequestPicker{}
+	for subConn := range info.ReadySCs {
+		counter := b.inFlight[subConn]
+		if counter == nil {
+			counter = new(int64)
+		}
+		counters[subConn] = counter
+
+		picker.subConns = append(picker.subConns, subConn)
+		picker.inFlight = append(picker.inFlight, counter)
+	}
+	b.inFlight = counters
+
+	return picker
+}
+
+type leastRequestPicker struct {
+	subConns []balancer.SubConn
+	inFlight []*int64
+}
+
+// Pick starts at a random subconn, so ties are spread over the addresses.
+func (p *leastRequestPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	start := rand.Intn(len(p.subConns))
+
+	best := start
+	for i := 1; i < len(p.subConns); i++ {
+		next := (start + i) % len(p.subConns)
+		if atomic.LoadInt64(p.inFlight[next]) < atomic.LoadInt64(p.inFlight[best]) {
+			best = next
+		}
+	}
+
+	counter := p.inFlight[best]
+	atomic.AddInt64(counter, 1)
+
+	return balancer.PickResult{
+		SubConn: p.subConns[best],
+		Done: func(balancer.DoneInfo) {
+			atomic.AddInt64(counter, -1)
+		},
+	}, nil
+}
@@ -1,35 +1,299 @@
 package grpcclient
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
-	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
 	user "github.com/toshkentov01/alif-tech-task/api-gateway/genproto/user-service"
-	"google.golang.org/grpc"
 )
 
-var cfg = config.Config()
 var (
-	onceUserService sync.Once
-
-	instanceUserService user.UserServiceClient
+	onceUpstreams     sync.Once
+	instanceUpstreams *Registry
 )
 
-// UserService ...
-func UserService() user.UserServiceClient {
-	onceUserService.Do(func() {
-		connUser, err := grpc.Dial(
-			fmt.Sprintf("%s:%d", cfg.UserServiceHost, cfg.UserServicePort),
-			grpc.WithInsecure())
+// Registry keeps the connections of the upstream services by name.
+type Registry struct {
+	upstreams map[string]*Upstream
+}
+
+// Upstream is a named upstream service and its connection.
+type Upstream struct {
+	name      string
+	config    *UpstreamConfig
+	conn      *grpc.ClientConn
+	discovery *discovery
+	guard     *guard
+
+	mu     sync.RWMutex
+	health Health
+}
+
+// Health is the state of an upstream. State is the connectivity state of the
+// connection, like READY, Status the result of the last health check.
+type Health struct {
+	State     string
+	Status    string
+	Error     string
+	CheckedAt time.Time
+}
+
+// Healthy tells the connection did not fail and the last health check, if any, passed.
+func (h Health) Healthy() bool {
+	switch h.State {
+	case "TRANSIENT_FAILURE", "SHUTDOWN":
+		return false
+	}
+
+	return h.Status == "" || h.Status == grpc_health_v1.HealthCheckResponse_SERVING.String()
+}
+
+// Upstreams returns the registry of the upstreams in the upstreams file. The
+// user service is taken from USER_SERVICE_HOST and USER_SERVICE_PORT when the
+// file has no addresses for it.
+func Upstreams() *Registry {
+	onceUpstreams.Do(func() {
+		cfg := config.Config()
+
+		configs := make(map[string]*UpstreamConfig)
+		if cfg.UpstreamsConfigPath != "" {
+			loaded, err := LoadUpstreams(cfg.UpstreamsConfigPath)
+			if err != nil {
+				panic(fmt.Errorf("upstreams %s: %s", cfg.UpstreamsConfigPath, err))
+			}
+			configs = loaded
+		}
+
+		if configs[UserUpstream] == nil {
+			configs[UserUpstream] = &UpstreamConfig{Discovery: StaticDiscovery, Balancer: PickFirst}
+		}
+		if len(configs[UserUpstream].Addresses) == 0 && configs[UserUpstream].Discovery != FileDiscovery {
+			configs[UserUpstream].Addresses = []string{
+				cfg.UserServiceHost + ":" + strconv.Itoa(cfg.UserServicePort),
+			}
+		}
+
+		registry, err := NewRegistry(configs)
 		if err != nil {
-			panic(fmt.Errorf("user service dial host: %s port:%d err: %s",
-				cfg.UserServiceHost, cfg.UserServicePort, err))
+			panic(err)
 		}
+		instanceUpstreams = registry
+	})
+
+	return instanceUpstreams
+}
+
+// NewRegistry dials the upstreams. Dialing does not wait for the connections,
+// they are made in the background.
+func NewRegistry(configs map[string]*UpstreamConfig) (*Registry, error) {
+	r := &Registry{upstreams: make(map[string]*Upstream, len(configs))}
+
+	for name, upstreamConfig := range configs {
+		if len(upstreamConfig.Addresses) == 0 && upstreamConfig.Discovery != FileDiscovery {
+			return nil, fmt.Errorf("upstream %s has no addresses", name)
+		}
+
+		options, err := upstreamConfig.dialOptions()
+		if err != nil {
+			return nil, fmt.Errorf("upstream %s: %s", name, err)
+		}
+
+		discovery := newDiscovery(name, upstreamConfig)
+		guard := newGuard(name, upstreamConfig)
+		options = append(options, grpc.WithResolvers(discovery), grpc.WithChainUnaryInterceptor(propagateRequestID, trace(name), observe(name), guard.intercept))
+
+		conn, err := grpc.Dial(discoveryScheme+":///"+name, options...)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %s dial %v: %s", name, upstreamConfig.Addresses, err)
+		}
+
+		r.upstreams[name] = &Upstream{
+			name:      name,
+			config:    upstreamConfig,
+			conn:      conn,
+			discovery: discovery,
+			guard:     guard,
+		}
+	}
+
+	return r, nil
+}
+
+// Start runs the health checks of the upstreams having a check interval.
+func (r *Registry) Start() {
+	for _, upstream := range r.upstreams {
+		if upstream.config.Health.interval > 0 {
+			go upstream.checkHealth()
+		}
+	}
+}
+
+// Get returns the upstream of the name.
+func (r *Registry) Get(name string) (*Upstream, error) {
+	upstream, ok := r.upstreams[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown upstream %s", name)
+	}
+
+	return upstream, nil
+}
+
+// Conn returns the connection of the named upstream.
+func (r *Registry) Conn(name string) (grpc.ClientConnInterface, error) {
+	upstream, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
 
-		instanceUserService = user.NewUserServiceClient(connUser)
+	return upstream.conn, nil
+}
+
+// List returns the upstreams sorted by name.
+func (r *Registry) List() []*Upstream {
+	upstreams := make([]*Upstream, 0, len(r.upstreams))
+	for _, upstream := range r.upstreams {
+		upstreams = append(upstreams, upstream)
+	}
+	sort.Slice(upstreams, func(i, j int) bool {
+		return upstreams[i].name < upstreams[j].name
+	})
+
+	return upstreams
+}
+
+// Breakers returns the circuit breakers of the methods called so far, by
+// upstream and method.
+func (r *Registry) Breakers() []BreakerState {
+	var states []BreakerState
+	for _, upstream := range r.List() {
+		states = append(states, upstream.Breakers()...)
+	}
+
+	return states
+}
+
+// User is the client of the user service, which is always registered.
+func (r *Registry) User() user.UserServiceClient {
+	return user.NewUserServiceClient(r.upstreams[UserUpstream].conn)
+}
+
+// Name ...
+func (u *Upstream) Name() string {
+	return u.name
+}
+
+// Addresses are the configured addresses, host names for the dns discovery.
+func (u *Upstream) Addresses() []string {
+	return u.config.Addresses
+}
+
+// Resolved are the addresses the calls are balanced over, found last by the discovery.
+func (u *Upstream) Resolved() []string {
+	return u.discovery.Resolved()
+}
+
+// Discovery ...
+func (u *Upstream) Discovery() string {
+	return u.config.Discovery
+}
+
+// Balancer ...
+func (u *Upstream) Balancer() string {
+	return u.config.Balancer
+}
+
+// Breakers returns the circuit breakers of the methods called so far.
+func (u *Upstream) Breakers() []BreakerState {
+	return u.guard.states()
+}
+
+// Conn ...
+func (u *Upstream) Conn() *grpc.ClientConn {
+	return u.conn
+}
+
+// Timeout of the calls, 0 when they are not limited.
+func (u *Upstream) Timeout() time.Duration {
+	return u.config.timeout
+}
+
+// Health returns the current connectivity state and the last health check.
+func (u *Upstream) Health() Health {
+	u.mu.RLock()
+	health := u.health
+	u.mu.RUnlock()
+
+	health.State = u.conn.GetState().String()
+
+	return health
+}
+
+// Check tells the upstream can take calls: its connection gets READY before
+// ctx is done and its grpc.health.v1 service answers SERVING. An upstream without the health
+// service only needs a ready connection.
+func (u *Upstream) Check(ctx context.Context) error {
+	for state := u.conn.GetState(); state != connectivity.Ready; state = u.conn.GetState() {
+		if state == connectivity.Idle {
+			u.conn.Connect()
+		}
+		if !u.conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("%s upstream: connection is %s", u.name, state)
+		}
+	}
+
+	health, err := u.probe(ctx)
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	if health.Status != grpc_health_v1.HealthCheckResponse_SERVING.String() {
+		if err != nil {
+			return fmt.Errorf("%s upstream: health check failed: %s", u.name, err)
+		}
+		return fmt.Errorf("%s upstream: health check answered %s", u.name, health.Status)
+	}
+
+	return nil
+}
+
+func (u *Upstream) checkHealth() {
+	ticker := time.NewTicker(u.config.Health.interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), u.config.Health.interval)
+		health, _ := u.probe(ctx)
+		cancel()
+
+		u.mu.Lock()
+		u.health = health
+		u.mu.Unlock()
+	}
+}
+
+// probe calls the grpc.health.v1 service of the upstream once.
+func (u *Upstream) probe(ctx context.Context) (Health, error) {
+	response, err := grpc_health_v1.NewHealthClient(u.conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{
+		Service: u.config.Health.Service,
 	})
 
-	return instanceUserService
+	health := Health{CheckedAt: time.Now()}
+	if err != nil {
+		health.Status = grpc_health_v1.HealthCheckResponse_UNKNOWN.String()
+		health.Error = err.Error()
+	} else {
+		health.Status = response.GetStatus().String()
+	}
+
+	return health, err
 }
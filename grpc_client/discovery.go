@@ -0,0 +1,232 @@
+package grpcclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// Ways of finding the addresses of an upstream
+const (
+	// StaticDiscovery uses the addresses as they are
+	StaticDiscovery = "static"
+	// DNSDiscovery resolves the host names of the addresses to all their IPs
+	DNSDiscovery = "dns"
+	// FileDiscovery reads the addresses from a file, one host:port per line
+	FileDiscovery = "file"
+)
+
+// discoveryScheme names the resolver of upstreams in dial targets.
+const discoveryScheme = "upstream"
+
+// discovery is the resolver builder of an upstream. It finds the addresses
+// with lookup, again every refresh interval when it is set.
+type discovery struct {
+	upstream string
+	lookup   func(ctx context.Context) ([]string, error)
+	refresh  time.Duration
+
+	mu       sync.RWMutex
+	resolved []string
+}
+
+func newDiscovery(name string, config *UpstreamConfig) *discovery {
+	d := &discovery{upstream: name, refresh: config.refresh}
+
+	switch config.Discovery {
+	case DNSDiscovery:
+		d.lookup = func(ctx context.Context) ([]string, error) {
+			return lookupDNS(ctx, config.Addresses)
+		}
+	case FileDiscovery:
+		d.lookup = func(context.Context) ([]string, error) {
+			return readAddresses(config.File)
+		}
+	default:
+		d.lookup = func(context.Context) ([]string, error) {
+			return config.Addresses, nil
+		}
+	}
+
+	return d
+}
+
+// Resolved returns the addresses found last.
+func (d *discovery) Resolved() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.resolved
+}
+
+// Build ...
+func (d *discovery) Build(target resolver.Target, cc resolver.ClientConn, options resolver.BuildOptions) (resolver.Resolver, error) {
+	r := &discoveryResolver{
+		discovery:  d,
+		cc:         cc,
+		resolveNow: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	go r.watch()
+
+	return r, nil
+}
+
+// Scheme ...
+func (d *discovery) Scheme() string {
+	return discoveryScheme
+}
+
+type discoveryResolver struct {
+	*discovery
+	cc         resolver.ClientConn
+	resolveNow chan struct{}
+	done       chan struct{}
+}
+
+// ResolveNow is called by gRPC when connecting fails, the addresses may have changed.
+func (r *discoveryResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+// Close ...
+func (r *discoveryResolver) Close() {
+	close(r.done)
+}
+
+func (r *discoveryResolver) watch() {
+	var refresh <-chan time.Time
+	if r.refresh > 0 {
+		ticker := time.NewTicker(r.refresh)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	for {
+		r.resolve()
+
+		select {
+		case <-r.done:
+			return
+		case <-refresh:
+		case <-r.resolveNow:
+			// gRPC asks again on every failed connection, do not flood DNS
+			select {
+			case <-r.done:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// resolve updates the connection when the addresses changed. The last found
+// addresses are kept when the lookup fails.
+func (r *discoveryResolver) resolve() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	addresses, err := r.lookup(ctx)
+	cancel()
+
+	if err == nil && len(addresses) == 0 {
+		err = fmt.Errorf("no addresses found")
+	}
+	if err != nil {
+		logger.Error(ctx, "Error while resolving an upstream", logger.Err(err), logger.Any("upstream", r.upstream))
+		if len(r.Resolved()) == 0 {
+			r.cc.ReportError(err)
+		}
+		return
+	}
+
+	if equalAddresses(addresses, r.Resolved()) {
+		return
+	}
+
+	r.mu.Lock()
+	r.resolved = addresses
+	r.mu.Unlock()
+
+	state := resolver.State{Addresses: make([]resolver.Address, 0, len(addresses))}
+	for _, address := range addresses {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: address})
+	}
+	if err := r.cc.UpdateState(state); err != nil {
+		logger.Error(ctx, "Error while updating the addresses of an upstream", logger.Err(err), logger.Any("upstream", r.upstream))
+	}
+}
+
+// lookupDNS resolves the host of each address to all its IPs, sorted.
+func lookupDNS(ctx context.Context, addresses []string) ([]string, error) {
+	var resolved []string
+	for _, address := range addresses {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		if net.ParseIP(host) != nil {
+			resolved = append(resolved, address)
+			continue
+		}
+
+		ips, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			resolved = append(resolved, net.JoinHostPort(ip, port))
+		}
+	}
+	sort.Strings(resolved)
+
+	return resolved, nil
+}
+
+// readAddresses reads host:port lines, skipping empty ones and # comments.
+func readAddresses(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if _, _, err := net.SplitHostPort(line); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		addresses = append(addresses, line)
+	}
+	sort.Strings(addresses)
+
+	return addresses, nil
+}
+
+func equalAddresses(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
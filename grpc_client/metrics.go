@@ -0,0 +1,28 @@
+package grpcclient
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/metrics"
+)
+
+// observe counts the calls of an upstream and their latency by method and
+// code, calls rejected by the breaker or the bulkhead included.
+func observe(upstream string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, fullMethod string, request, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, options ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, fullMethod, request, reply, cc, options...)
+
+		method := strings.TrimPrefix(fullMethod, "/")
+		code := status.Code(err).String()
+		metrics.UpstreamCalls.Inc(upstream, method, code)
+		metrics.UpstreamDuration.Observe(time.Since(start).Seconds(), upstream, method, code)
+
+		return err
+	}
+}
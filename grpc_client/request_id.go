@@ -0,0 +1,22 @@
+package grpcclient
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// requestIDMetadata carries the request ID of the gateway to the upstreams.
+const requestIDMetadata = "x-request-id"
+
+// propagateRequestID passes the request ID of the call context on to the upstream.
+func propagateRequestID(ctx context.Context, fullMethod string, request, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, options ...grpc.CallOption) error {
+	if requestID := logger.RequestID(ctx); requestID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, requestIDMetadata, requestID)
+	}
+
+	return invoker(ctx, fullMethod, request, reply, cc, options...)
+}
@@ -0,0 +1,320 @@
+package grpcclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerConfig opens the circuit of a method after consecutive failures, so
+// calls fail fast instead of waiting on a broken upstream. After Open a few
+// probe calls are let through, the circuit closes again when they succeed.
+type BreakerConfig struct {
+	// Failures in a row opening the circuit, the breaker is off when 0
+	Failures int `yaml:"failures"`
+	// Open is how long calls are rejected, like 30s
+	Open string `yaml:"open"`
+	// HalfOpenCalls are the probe calls let through at once, 1 by default
+	HalfOpenCalls int `yaml:"half_open_calls"`
+
+	open time.Duration
+}
+
+// BulkheadConfig limits the calls in flight of each method, so a slow method
+// can not take all the connections and workers from the others.
+type BulkheadConfig struct {
+	// MaxConcurrent calls of a method, no limit when 0
+	MaxConcurrent int `yaml:"max_concurrent"`
+	// MaxWait for a free slot, like 100ms. Calls over the limit fail at once when empty
+	MaxWait string `yaml:"max_wait"`
+	// Methods override MaxConcurrent, like user.UserService/ListTotalOperationsByType: 10
+	Methods map[string]int `yaml:"methods"`
+
+	maxWait time.Duration
+}
+
+// BreakerState is the circuit breaker of one method of an upstream.
+type BreakerState struct {
+	Upstream string
+	Method   string
+	State    string
+	// Failures in a row
+	Failures int
+	OpenedAt time.Time
+}
+
+// failureCodes are the codes telling the upstream is in trouble. Other codes,
+// like NotFound, are answers of a working upstream.
+var failureCodes = map[codes.Code]bool{
+	codes.Unavailable:       true,
+	codes.DeadlineExceeded:  true,
+	codes.Internal:          true,
+	codes.Unknown:           true,
+	codes.ResourceExhausted: true,
+}
+
+func (b *BreakerConfig) check() error {
+	if b.Failures < 0 || b.HalfOpenCalls < 0 {
+		return fmt.Errorf("breaker failures and half_open_calls can not be negative")
+	}
+
+	var err error
+	if b.open, err = parseDuration(b.Open); err != nil {
+		return fmt.Errorf("breaker open: %s", err)
+	}
+	if b.open == 0 {
+		b.open = 30 * time.Second
+	}
+	if b.HalfOpenCalls == 0 {
+		b.HalfOpenCalls = 1
+	}
+
+	return nil
+}
+
+func (b *BulkheadConfig) check() error {
+	if b.MaxConcurrent < 0 {
+		return fmt.Errorf("bulkhead max_concurrent can not be negative")
+	}
+	for method, limit := range b.Methods {
+		if limit < 0 {
+			return fmt.Errorf("bulkhead %s: limit can not be negative", method)
+		}
+	}
+
+	var err error
+	if b.maxWait, err = parseDuration(b.MaxWait); err != nil {
+		return fmt.Errorf("bulkhead max_wait: %s", err)
+	}
+
+	return nil
+}
+
+func (b *BulkheadConfig) limit(method string) int {
+	if limit, ok := b.Methods[method]; ok {
+		return limit
+	}
+
+	return b.MaxConcurrent
+}
+
+type timeoutsKey struct{}
+
+// TrackTimeouts returns a context noting whether calls made with it, or with
+// contexts derived from it, timed out.
+func TrackTimeouts(ctx context.Context) (context.Context, func() bool) {
+	timedOut := new(int32)
+
+	return context.WithValue(ctx, timeoutsKey{}, timedOut), func() bool {
+		return atomic.LoadInt32(timedOut) == 1
+	}
+}
+
+func markTimeout(ctx context.Context) {
+	if timedOut, ok := ctx.Value(timeoutsKey{}).(*int32); ok {
+		atomic.StoreInt32(timedOut, 1)
+	}
+}
+
+// guard keeps the breakers and the bulkheads of an upstream by method.
+type guard struct {
+	upstream string
+	breaker  BreakerConfig
+	bulkhead BulkheadConfig
+
+	mu        sync.Mutex
+	breakers  map[string]*breaker
+	bulkheads map[string]chan struct{}
+}
+
+type breaker struct {
+	state    string
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+func newGuard(upstream string, config *UpstreamConfig) *guard {
+	return &guard{
+		upstream:  upstream,
+		breaker:   config.Breaker,
+		bulkhead:  config.Bulkhead,
+		breakers:  make(map[string]*breaker),
+		bulkheads: make(map[string]chan struct{}),
+	}
+}
+
+// intercept runs a call through the breaker and the bulkhead of its method.
+// Calls rejected by the bulkhead do not count as failures of the upstream.
+func (g *guard) intercept(ctx context.Context, fullMethod string, request, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, options ...grpc.CallOption) error {
+	method := strings.TrimPrefix(fullMethod, "/")
+
+	allowed, probe := g.allow(method)
+	if !allowed {
+		return status.Errorf(codes.Unavailable, "%s upstream: circuit breaker of %s is open", g.upstream, method)
+	}
+
+	release, err := g.acquire(ctx, method)
+	if err != nil {
+		g.record(method, probe, status.Error(codes.Canceled, "not called"))
+		return err
+	}
+	defer release()
+
+	err = invoker(ctx, fullMethod, request, reply, cc, options...)
+	g.record(method, probe, err)
+	if status.Code(err) == codes.DeadlineExceeded {
+		markTimeout(ctx)
+	}
+
+	return err
+}
+
+// allow tells the call may go on, and if it is a probe of a half open
+// circuit. An open circuit becomes half open once the open time passed.
+func (g *guard) allow(method string) (allowed, probe bool) {
+	if g.breaker.Failures == 0 {
+		return true, false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b := g.breakers[method]
+	if b == nil {
+		b = &breaker{state: BreakerClosed}
+		g.breakers[method] = b
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < g.breaker.open {
+			return false, false
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= g.breaker.HalfOpenCalls {
+			return false, false
+		}
+		b.probes++
+
+		return true, true
+	}
+
+	return true, false
+}
+
+// record counts the result of an allowed call. A cancelled call tells nothing
+// about the upstream, it only gives its probe back.
+func (g *guard) record(method string, probe bool, err error) {
+	if g.breaker.Failures == 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b := g.breakers[method]
+	if probe && b.state == BreakerHalfOpen {
+		b.probes--
+	}
+
+	code := status.Code(err)
+	if code == codes.Canceled {
+		return
+	}
+	if !failureCodes[code] {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= g.breaker.Failures {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// acquire takes a slot of the method's bulkhead, waiting at most MaxWait.
+func (g *guard) acquire(ctx context.Context, method string) (func(), error) {
+	limit := g.bulkhead.limit(method)
+	if limit == 0 {
+		return func() {}, nil
+	}
+
+	g.mu.Lock()
+	slots := g.bulkheads[method]
+	if slots == nil {
+		slots = make(chan struct{}, limit)
+		g.bulkheads[method] = slots
+	}
+	g.mu.Unlock()
+
+	release := func() { <-slots }
+
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if g.bulkhead.maxWait > 0 {
+		timer := time.NewTimer(g.bulkhead.maxWait)
+		defer timer.Stop()
+
+		select {
+		case slots <- struct{}{}:
+			return release, nil
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+		}
+	}
+
+	return nil, status.Errorf(codes.ResourceExhausted, "%s upstream: too many calls of %s in flight", g.upstream, method)
+}
+
+// states returns the breakers of the methods called so far, sorted by method.
+func (g *guard) states() []BreakerState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	states := make([]BreakerState, 0, len(g.breakers))
+	for method, b := range g.breakers {
+		state := BreakerState{
+			Upstream: g.upstream,
+			Method:   method,
+			State:    b.state,
+			Failures: b.failures,
+			OpenedAt: b.openedAt,
+		}
+		// an open circuit whose time passed lets the next call through
+		if b.state == BreakerOpen && time.Since(b.openedAt) >= g.breaker.open {
+			state.State = BreakerHalfOpen
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Method < states[j].Method
+	})
+
+	return states
+}
@@ -0,0 +1,319 @@
+package grpcclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testMethod = "user.UserService/GetUser"
+
+func newTestGuard(t *testing.T, config UpstreamConfig) *guard {
+	t.Helper()
+
+	if err := config.Breaker.check(); err != nil {
+		t.Fatalf("Breaker.check() error = %v", err)
+	}
+	if err := config.Bulkhead.check(); err != nil {
+		t.Fatalf("Bulkhead.check() error = %v", err)
+	}
+
+	return newGuard("user", &config)
+}
+
+// expire moves the opening of the method's circuit back past the open time.
+func expire(g *guard, method string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if b := g.breakers[method]; b != nil {
+		b.openedAt = b.openedAt.Add(-g.breaker.open)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "down")
+	deadline := status.Error(codes.DeadlineExceeded, "slow")
+	notFound := status.Error(codes.NotFound, "no user")
+	canceled := status.Error(codes.Canceled, "gone")
+
+	type step struct {
+		// err is the result of the upstream, the call is rejected when the
+		// circuit is open
+		err error
+		// expire lets the open time pass before the call
+		expire     bool
+		wantCalled bool
+		wantCode   codes.Code
+		wantState  string
+	}
+
+	tests := []struct {
+		name    string
+		breaker BreakerConfig
+		steps   []step
+	}{
+		{
+			name:    "opens after failures in a row",
+			breaker: BreakerConfig{Failures: 3},
+			steps: []step{
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable, wantState: BreakerClosed},
+				{err: deadline, wantCalled: true, wantCode: codes.DeadlineExceeded, wantState: BreakerClosed},
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable, wantState: BreakerOpen},
+				{wantCalled: false, wantCode: codes.Unavailable, wantState: BreakerOpen},
+			},
+		},
+		{
+			name:    "answers reset the failures",
+			breaker: BreakerConfig{Failures: 2},
+			steps: []step{
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable, wantState: BreakerClosed},
+				{err: notFound, wantCalled: true, wantCode: codes.NotFound, wantState: BreakerClosed},
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable, wantState: BreakerClosed},
+				{wantCalled: true, wantCode: codes.OK, wantState: BreakerClosed},
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable, wantState: BreakerClosed},
+			},
+		},
+		{
+			name:    "cancelled calls do not count",
+			breaker: BreakerConfig{Failures: 2},
+			steps: []step{
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable, wantState: BreakerClosed},
+				{err: canceled, wantCalled: true, wantCode: codes.Canceled, wantState: BreakerClosed},
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable, wantState: BreakerOpen},
+			},
+		},
+		{
+			name:    "probe closes the circuit",
+			breaker: BreakerConfig{Failures: 1, Open: "1m"},
+			steps: []step{
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable, wantState: BreakerOpen},
+				{wantCalled: false, wantCode: codes.Unavailable, wantState: BreakerOpen},
+				{expire: true, wantCalled: true, wantCode: codes.OK, wantState: BreakerClosed},
+				{err: notFound, wantCalled: true, wantCode: codes.NotFound, wantState: BreakerClosed},
+			},
+		},
+		{
+			name:    "failed probe opens the circuit again",
+			breaker: BreakerConfig{Failures: 2},
+			steps: []step{
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable, wantState: BreakerClosed},
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable, wantState: BreakerOpen},
+				{expire: true, err: deadline, wantCalled: true, wantCode: codes.DeadlineExceeded, wantState: BreakerOpen},
+				{wantCalled: false, wantCode: codes.Unavailable, wantState: BreakerOpen},
+			},
+		},
+		{
+			name:    "off without failures",
+			breaker: BreakerConfig{},
+			steps: []step{
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable},
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable},
+				{err: unavailable, wantCalled: true, wantCode: codes.Unavailable},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGuard(t, UpstreamConfig{Breaker: tt.breaker})
+
+			for i, s := range tt.steps {
+				if s.expire {
+					expire(g, testMethod)
+				}
+
+				called := false
+				invoker := func(ctx context.Context, method string, request, reply interface{}, cc *grpc.ClientConn, options ...grpc.CallOption) error {
+					called = true
+					return s.err
+				}
+
+				err := g.intercept(context.Background(), "/"+testMethod, nil, nil, nil, invoker)
+				if called != s.wantCalled {
+					t.Errorf("step %d: called = %v, want %v", i, called, s.wantCalled)
+				}
+				if code := status.Code(err); code != s.wantCode {
+					t.Errorf("step %d: code = %v, want %v", i, code, s.wantCode)
+				}
+
+				var state string
+				for _, b := range g.states() {
+					if b.Method == testMethod {
+						state = b.State
+					}
+				}
+				if state != s.wantState {
+					t.Errorf("step %d: state = %q, want %q", i, state, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpenProbes(t *testing.T) {
+	g := newTestGuard(t, UpstreamConfig{Breaker: BreakerConfig{Failures: 1, HalfOpenCalls: 2}})
+	g.allow(testMethod)
+	g.record(testMethod, false, status.Error(codes.Unavailable, "down"))
+	expire(g, testMethod)
+
+	if states := g.states(); len(states) != 1 || states[0].State != BreakerHalfOpen {
+		t.Fatalf("states() = %+v, want one half open breaker", states)
+	}
+
+	tests := []struct {
+		name        string
+		wantAllowed bool
+		wantProbe   bool
+		// release gives the probe back as a cancelled call
+		release bool
+	}{
+		{name: "first probe", wantAllowed: true, wantProbe: true},
+		{name: "second probe", wantAllowed: true, wantProbe: true, release: true},
+		{name: "probe given back", wantAllowed: true, wantProbe: true},
+		{name: "no probe left", wantAllowed: false, wantProbe: false},
+	}
+
+	for _, tt := range tests {
+		allowed, probe := g.allow(testMethod)
+		if allowed != tt.wantAllowed || probe != tt.wantProbe {
+			t.Errorf("%s: allow() = %v, %v, want %v, %v", tt.name, allowed, probe, tt.wantAllowed, tt.wantProbe)
+		}
+		if tt.release {
+			g.record(testMethod, probe, status.Error(codes.Canceled, "not called"))
+		}
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	tests := []struct {
+		name     string
+		bulkhead BulkheadConfig
+		// held are the slots taken before the call
+		held int
+		// freed gives a held slot back while the call waits
+		freed    bool
+		cancel   bool
+		wantCode codes.Code
+	}{
+		{name: "no limit", held: 5, wantCode: codes.OK},
+		{name: "free slot", bulkhead: BulkheadConfig{MaxConcurrent: 2}, held: 1, wantCode: codes.OK},
+		{name: "full without waiting", bulkhead: BulkheadConfig{MaxConcurrent: 1}, held: 1, wantCode: codes.ResourceExhausted},
+		{name: "full after waiting", bulkhead: BulkheadConfig{MaxConcurrent: 1, MaxWait: "20ms"}, held: 1, wantCode: codes.ResourceExhausted},
+		{name: "slot freed while waiting", bulkhead: BulkheadConfig{MaxConcurrent: 1, MaxWait: "5s"}, held: 1, freed: true, wantCode: codes.OK},
+		{name: "cancelled while waiting", bulkhead: BulkheadConfig{MaxConcurrent: 1, MaxWait: "5s"}, held: 1, cancel: true, wantCode: codes.Canceled},
+		{
+			name:     "method limit",
+			bulkhead: BulkheadConfig{MaxConcurrent: 1, Methods: map[string]int{testMethod: 3}},
+			held:     2,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "method without limit",
+			bulkhead: BulkheadConfig{MaxConcurrent: 1, Methods: map[string]int{testMethod: 0}},
+			held:     3,
+			wantCode: codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGuard(t, UpstreamConfig{Bulkhead: tt.bulkhead})
+
+			var releases []func()
+			for i := 0; i < tt.held; i++ {
+				release, err := g.acquire(context.Background(), testMethod)
+				if err != nil {
+					t.Fatalf("acquire() of held slot %d error = %v", i, err)
+				}
+				releases = append(releases, release)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				if tt.freed {
+					releases[0]()
+				}
+				if tt.cancel {
+					cancel()
+				}
+			}()
+
+			release, err := g.acquire(ctx, testMethod)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("acquire() code = %v, want %v", code, tt.wantCode)
+			}
+			if err == nil {
+				release()
+			}
+		})
+	}
+}
+
+func TestBulkheadRejectionIsNotAFailure(t *testing.T) {
+	g := newTestGuard(t, UpstreamConfig{
+		Breaker:  BreakerConfig{Failures: 1},
+		Bulkhead: BulkheadConfig{MaxConcurrent: 1},
+	})
+
+	if _, err := g.acquire(context.Background(), testMethod); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+
+	invoker := func(ctx context.Context, method string, request, reply interface{}, cc *grpc.ClientConn, options ...grpc.CallOption) error {
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		err := g.intercept(context.Background(), "/"+testMethod, nil, nil, nil, invoker)
+		if code := status.Code(err); code != codes.ResourceExhausted {
+			t.Fatalf("call %d: code = %v, want %v", i, code, codes.ResourceExhausted)
+		}
+	}
+
+	if states := g.states(); len(states) != 1 || states[0].State != BreakerClosed || states[0].Failures != 0 {
+		t.Errorf("states() = %+v, want one closed breaker without failures", states)
+	}
+}
+
+func TestResilienceConfigCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  UpstreamConfig
+		wantErr bool
+	}{
+		{name: "empty", config: UpstreamConfig{}},
+		{name: "durations", config: UpstreamConfig{Breaker: BreakerConfig{Failures: 5, Open: "10s"}, Bulkhead: BulkheadConfig{MaxWait: "100ms"}}},
+		{name: "negative failures", config: UpstreamConfig{Breaker: BreakerConfig{Failures: -1}}, wantErr: true},
+		{name: "negative half open calls", config: UpstreamConfig{Breaker: BreakerConfig{HalfOpenCalls: -1}}, wantErr: true},
+		{name: "bad open", config: UpstreamConfig{Breaker: BreakerConfig{Open: "soon"}}, wantErr: true},
+		{name: "negative open", config: UpstreamConfig{Breaker: BreakerConfig{Open: "-1s"}}, wantErr: true},
+		{name: "negative max concurrent", config: UpstreamConfig{Bulkhead: BulkheadConfig{MaxConcurrent: -1}}, wantErr: true},
+		{name: "negative method limit", config: UpstreamConfig{Bulkhead: BulkheadConfig{Methods: map[string]int{"a/b": -1}}}, wantErr: true},
+		{name: "bad max wait", config: UpstreamConfig{Bulkhead: BulkheadConfig{MaxWait: "1"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := tt.config.Breaker.check()
+		if err == nil {
+			err = tt.config.Bulkhead.check()
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: check() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	breaker := BreakerConfig{}
+	if err := breaker.check(); err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	if breaker.open != 30*time.Second || breaker.HalfOpenCalls != 1 {
+		t.Errorf("check() defaults = %v, %d, want 30s, 1", breaker.open, breaker.HalfOpenCalls)
+	}
+}
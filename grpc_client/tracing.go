@@ -0,0 +1,50 @@
+package grpcclient
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/tracing"
+)
+
+// trace starts a client span for every call of an upstream and passes the
+// trace on to it in the traceparent metadata.
+func trace(upstream string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, fullMethod string, request, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, options ...grpc.CallOption) error {
+		method := strings.TrimPrefix(fullMethod, "/")
+
+		attributes := []attribute.KeyValue{
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("peer.service", upstream),
+		}
+		if i := strings.LastIndex(method, "/"); i >= 0 {
+			attributes = append(attributes,
+				attribute.String("rpc.service", method[:i]),
+				attribute.String("rpc.method", method[i+1:]),
+			)
+		}
+
+		ctx, span := tracing.Service().Start(ctx, method, oteltrace.WithSpanKind(oteltrace.SpanKindClient), oteltrace.WithAttributes(attributes...))
+		defer span.End()
+
+		carrier := propagation.MapCarrier{}
+		otel.GetTextMapPropagator().Inject(ctx, carrier)
+		for key, value := range carrier {
+			ctx = metadata.AppendToOutgoingContext(ctx, key, value)
+		}
+
+		err := invoker(ctx, fullMethod, request, reply, cc, options...)
+		span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(status.Code(err))))
+		tracing.SetError(span, err)
+
+		return err
+	}
+}
@@ -0,0 +1,378 @@
+package grpcclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"gopkg.in/yaml.v2"
+)
+
+// Names of the upstreams the gateway has typed clients for
+const (
+	UserUpstream          = "user"
+	PaymentsUpstream      = "payments"
+	NotificationsUpstream = "notifications"
+	KYCUpstream           = "kyc"
+)
+
+// UpstreamsFile is the layout of the upstreams file.
+type UpstreamsFile struct {
+	Upstreams map[string]*UpstreamConfig `yaml:"upstreams"`
+}
+
+// UpstreamConfig describes how to reach an upstream service.
+//
+//	upstreams:
+//	  payments:
+//	    addresses: [payments:9000]
+//	    discovery: dns
+//	    refresh: 30s
+//	    balancer: round_robin
+//	    timeout: 5s
+//	    tls: {enabled: true, ca_file: ./certs/ca.pem}
+//	    retry: {max_attempts: 3, initial_backoff: 100ms, max_backoff: 1s, codes: [Unavailable]}
+//	    breaker: {failures: 5, open: 30s}
+//	    bulkhead: {max_concurrent: 100, methods: {payments.PaymentService/ListPayments: 10}}
+//	    health: {service: payments.PaymentService, interval: 10s}
+type UpstreamConfig struct {
+	Addresses []string `yaml:"addresses"`
+	// Discovery is static, dns or file, static by default
+	Discovery string `yaml:"discovery"`
+	// File lists the addresses for the file discovery
+	File string `yaml:"file"`
+	// Refresh is how often dns names are resolved or the file is read again, like 30s
+	Refresh string `yaml:"refresh"`
+	// Balancer is pick_first, round_robin or least_request, pick_first by default
+	Balancer string `yaml:"balancer"`
+	// Timeout of every call, like 5s. Calls are not limited when empty
+	Timeout  string         `yaml:"timeout"`
+	TLS      TLSConfig      `yaml:"tls"`
+	Retry    RetryPolicy    `yaml:"retry"`
+	Breaker  BreakerConfig  `yaml:"breaker"`
+	Bulkhead BulkheadConfig `yaml:"bulkhead"`
+	Health   HealthCheck    `yaml:"health"`
+
+	timeout time.Duration
+	refresh time.Duration
+}
+
+// TLSConfig ...
+type TLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// CAFile verifies the server certificate, the system roots are used when empty
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the client certificate, for mutual TLS
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"`
+}
+
+// RetryPolicy retries failed calls with exponential backoff. Calls are not
+// retried when MaxAttempts is below 2.
+type RetryPolicy struct {
+	MaxAttempts       int     `yaml:"max_attempts"`
+	InitialBackoff    string  `yaml:"initial_backoff"`
+	MaxBackoff        string  `yaml:"max_backoff"`
+	BackoffMultiplier float64 `yaml:"backoff_multiplier"`
+	// Codes are the gRPC code names retried, Unavailable when empty
+	Codes []string `yaml:"codes"`
+	// Methods retried, like user.UserService/GetBalance. All methods are
+	// retried when empty, so list them unless every method is idempotent
+	Methods []string `yaml:"methods"`
+}
+
+// HealthCheck polls the grpc.health.v1 service of the upstream.
+type HealthCheck struct {
+	// Service is the name checked, the whole server when empty
+	Service string `yaml:"service"`
+	// Interval between checks, like 10s. The upstream is not checked when empty
+	Interval string `yaml:"interval"`
+
+	interval time.Duration
+}
+
+// LoadUpstreams reads and checks the upstreams file.
+func LoadUpstreams(path string) (map[string]*UpstreamConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file UpstreamsFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+
+	for name, upstream := range file.Upstreams {
+		if upstream == nil {
+			upstream = &UpstreamConfig{}
+			file.Upstreams[name] = upstream
+		}
+		if err := upstream.check(); err != nil {
+			return nil, fmt.Errorf("upstream %s: %s", name, err)
+		}
+	}
+
+	return file.Upstreams, nil
+}
+
+func (u *UpstreamConfig) check() error {
+	for _, address := range u.Addresses {
+		if !strings.Contains(address, ":") {
+			return fmt.Errorf("address %s has no port", address)
+		}
+	}
+
+	switch u.Discovery {
+	case "":
+		u.Discovery = StaticDiscovery
+	case StaticDiscovery, DNSDiscovery:
+	case FileDiscovery:
+		if u.File == "" {
+			return fmt.Errorf("file discovery needs a file")
+		}
+	default:
+		return fmt.Errorf("unknown discovery %s", u.Discovery)
+	}
+
+	switch u.Balancer {
+	case "":
+		u.Balancer = PickFirst
+	case PickFirst, RoundRobin, LeastRequest:
+	default:
+		return fmt.Errorf("unknown balancer %s", u.Balancer)
+	}
+
+	var err error
+	if u.timeout, err = parseDuration(u.Timeout); err != nil {
+		return fmt.Errorf("timeout: %s", err)
+	}
+	if u.refresh, err = parseDuration(u.Refresh); err != nil {
+		return fmt.Errorf("refresh: %s", err)
+	}
+	if u.Health.interval, err = parseDuration(u.Health.Interval); err != nil {
+		return fmt.Errorf("health interval: %s", err)
+	}
+
+	if err := u.Breaker.check(); err != nil {
+		return err
+	}
+	if err := u.Bulkhead.check(); err != nil {
+		return err
+	}
+
+	if u.TLS.CertFile != "" && u.TLS.KeyFile == "" || u.TLS.CertFile == "" && u.TLS.KeyFile != "" {
+		return fmt.Errorf("tls cert_file and key_file go together")
+	}
+
+	retry := u.Retry
+	if retry.MaxAttempts < 2 {
+		return nil
+	}
+	for _, backoff := range []string{retry.InitialBackoff, retry.MaxBackoff} {
+		if _, err := parseDuration(backoff); err != nil {
+			return fmt.Errorf("retry backoff: %s", err)
+		}
+	}
+	if retry.BackoffMultiplier < 0 {
+		return fmt.Errorf("retry backoff_multiplier can not be negative")
+	}
+	for _, name := range retry.Codes {
+		if code, ok := codeNames[name]; !ok || code == codes.OK {
+			return fmt.Errorf("retry: bad code %s", name)
+		}
+	}
+	for _, method := range retry.Methods {
+		parts := strings.Split(strings.TrimPrefix(method, "/"), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("retry: method %s is not like package.Service/Method", method)
+		}
+	}
+
+	return nil
+}
+
+// dialOptions are the credentials and the service config of the upstream.
+func (u *UpstreamConfig) dialOptions() ([]grpc.DialOption, error) {
+	creds, err := u.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	serviceConfig, err := u.serviceConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return []grpc.DialOption{creds, grpc.WithDefaultServiceConfig(serviceConfig)}, nil
+}
+
+func (u *UpstreamConfig) credentials() (grpc.DialOption, error) {
+	if !u.TLS.Enabled {
+		return grpc.WithInsecure(), nil
+	}
+
+	config := &tls.Config{
+		ServerName: u.TLS.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if u.TLS.CAFile != "" {
+		pem, err := os.ReadFile(u.TLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s has no certificates", u.TLS.CAFile)
+		}
+	}
+
+	if u.TLS.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(u.TLS.CertFile, u.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return grpc.WithTransportCredentials(credentials.NewTLS(config)), nil
+}
+
+type methodName struct {
+	Service string `json:"service,omitempty"`
+	Method  string `json:"method,omitempty"`
+}
+
+type methodConfig struct {
+	Name        []methodName `json:"name"`
+	Timeout     string       `json:"timeout,omitempty"`
+	RetryPolicy *retryConfig `json:"retryPolicy,omitempty"`
+}
+
+type retryConfig struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// serviceConfig is the gRPC service config choosing the balancer and applying
+// the timeout and the retry policy to the calls.
+func (u *UpstreamConfig) serviceConfig() (string, error) {
+	all := methodConfig{Name: []methodName{{}}}
+	if u.timeout > 0 {
+		all.Timeout = configDuration(u.timeout)
+	}
+
+	configs := []methodConfig{all}
+	if retry := u.retryConfig(); retry != nil {
+		if len(u.Retry.Methods) == 0 {
+			configs[0].RetryPolicy = retry
+		} else {
+			retried := methodConfig{Timeout: all.Timeout, RetryPolicy: retry}
+			for _, method := range u.Retry.Methods {
+				parts := strings.Split(strings.TrimPrefix(method, "/"), "/")
+				retried.Name = append(retried.Name, methodName{Service: parts[0], Method: parts[1]})
+			}
+			configs = append(configs, retried)
+		}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"loadBalancingConfig": []map[string]interface{}{{u.Balancer: struct{}{}}},
+		"methodConfig":        configs,
+	})
+	return string(data), err
+}
+
+func (u *UpstreamConfig) retryConfig() *retryConfig {
+	retry := u.Retry
+	if retry.MaxAttempts < 2 {
+		return nil
+	}
+
+	initial, _ := parseDuration(retry.InitialBackoff)
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	max, _ := parseDuration(retry.MaxBackoff)
+	if max < initial {
+		max = initial * 10
+	}
+	multiplier := retry.BackoffMultiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	names := retry.Codes
+	if len(names) == 0 {
+		names = []string{codes.Unavailable.String()}
+	}
+	statusCodes := make([]string, 0, len(names))
+	for _, name := range names {
+		statusCodes = append(statusCodes, codeConfigName(codeNames[name]))
+	}
+	sort.Strings(statusCodes)
+
+	return &retryConfig{
+		MaxAttempts:          retry.MaxAttempts,
+		InitialBackoff:       configDuration(initial),
+		MaxBackoff:           configDuration(max),
+		BackoffMultiplier:    multiplier,
+		RetryableStatusCodes: statusCodes,
+	}
+}
+
+// codeNames maps gRPC code names, like NotFound, to codes.
+var codeNames = func() map[string]codes.Code {
+	names := make(map[string]codes.Code)
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		names[code.String()] = code
+	}
+
+	return names
+}()
+
+// codeConfigName is the name of the code in service configs, like NOT_FOUND.
+func codeConfigName(code codes.Code) string {
+	var name strings.Builder
+	for i, r := range code.String() {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			name.WriteByte('_')
+		}
+		name.WriteRune(r)
+	}
+
+	return strings.ToUpper(name.String())
+}
+
+// configDuration formats a duration the way service configs take it, like 0.1s.
+func configDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+func parseDuration(text string) (time.Duration, error) {
+	if text == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(text)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("bad duration %s", text)
+	}
+
+	return d, nil
+}
@@ -23,4 +23,121 @@ var (
 
 	// ErrInvalidFieldForOperations ...
 	ErrInvalidFieldForOperations = errors.New("invalid field for operation type")
+
+	// ErrUnsupportedCurrency ...
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+	// ErrQuoteNotFound ...
+	ErrQuoteNotFound = errors.New("quote not found")
+
+	// ErrQuoteExpired ...
+	ErrQuoteExpired = errors.New("quote expired")
+
+	// ErrHoldNotFound ...
+	ErrHoldNotFound = errors.New("hold not found")
+
+	// ErrHoldNotActive ...
+	ErrHoldNotActive = errors.New("hold is not active")
+
+	// ErrCaptureAmount ...
+	ErrCaptureAmount = errors.New("capture amount is above the held amount")
+
+	// ErrOperationNotFound ...
+	ErrOperationNotFound = errors.New("operation not found")
+
+	// ErrAlreadyReversed ...
+	ErrAlreadyReversed = errors.New("operation is already reversed")
+
+	// ErrNotReversible ...
+	ErrNotReversible = errors.New("operation can not be reversed")
+
+	// ErrRefundAmount ...
+	ErrRefundAmount = errors.New("refund amount is above the refundable amount")
+
+	// ErrSubscriptionNotFound ...
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+	// ErrDeliveryNotFound ...
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+	// ErrWebhookURL ...
+	ErrWebhookURL = errors.New("webhook URL must be http or https and not an internal address")
+
+	// ErrUnknownEventType ...
+	ErrUnknownEventType = errors.New("unknown event type")
+
+	// ErrNotGranted ...
+	ErrNotGranted = errors.New("user has not granted the partner access")
+
+	// ErrGrantNotFound ...
+	ErrGrantNotFound = errors.New("partner grant not found")
+
+	// ErrJobNotFound ...
+	ErrJobNotFound = errors.New("job not found")
+
+	// ErrScheduleNotFound ...
+	ErrScheduleNotFound = errors.New("schedule not found")
+
+	// ErrInvalidRule ...
+	ErrInvalidRule = errors.New("invalid schedule rule")
+
+	// ErrPaymentRequestNotFound ...
+	ErrPaymentRequestNotFound = errors.New("payment request not found")
+
+	// ErrPaymentRequestNotPending ...
+	ErrPaymentRequestNotPending = errors.New("payment request is already accepted, declined, cancelled or expired")
+
+	// ErrLimitNotFound ...
+	ErrLimitNotFound = errors.New("spending limit not found")
+
+	// ErrSpendingLimitExceeded ...
+	ErrSpendingLimitExceeded = errors.New("spending limit exceeded")
+
+	// ErrInvalidOTP ...
+	ErrInvalidOTP = errors.New("invalid or expired one-time code")
+
+	// ErrNoOTPChannel ...
+	ErrNoOTPChannel = errors.New("no email to send one-time codes to")
+
+	// ErrOTPUnavailable ...
+	ErrOTPUnavailable = errors.New("one-time codes can not be sent")
+
+	// ErrOperationDenied ...
+	ErrOperationDenied = errors.New("operation denied by risk rules")
+
+	// ErrStepUpRequired ...
+	ErrStepUpRequired = errors.New("operation needs to be confirmed with a step_up one-time code")
+
+	// ErrMerchantNotFound ...
+	ErrMerchantNotFound = errors.New("merchant not found")
+
+	// ErrAPIKeyNotFound ...
+	ErrAPIKeyNotFound = errors.New("api key not found")
+
+	// ErrInvalidAPIKey ...
+	ErrInvalidAPIKey = errors.New("invalid api key")
+
+	// ErrChargeNotFound ...
+	ErrChargeNotFound = errors.New("charge not found")
+
+	// ErrChargeNotPending ...
+	ErrChargeNotPending = errors.New("charge is already paid, declined, cancelled or expired")
+
+	// ErrInvalidQRPayload ...
+	ErrInvalidQRPayload = errors.New("invalid qr payload")
+
+	// ErrQRAlreadyPaid ...
+	ErrQRAlreadyPaid = errors.New("qr code already paid")
+
+	// ErrPocketNotFound ...
+	ErrPocketNotFound = errors.New("pocket not found")
+
+	// ErrPocketAmount ...
+	ErrPocketAmount = errors.New("amount is above the pocket amount")
+
+	// ErrTooManyPockets ...
+	ErrTooManyPockets = errors.New("too many pockets")
+
+	// ErrUnknownPeriod ...
+	ErrUnknownPeriod = errors.New("unknown period")
 )
@@ -0,0 +1,270 @@
+package analytics
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/currency"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// Periods are rolling windows ending now, compared with the window before them.
+var Periods = map[string]time.Duration{
+	"week":    7 * 24 * time.Hour,
+	"month":   30 * 24 * time.Hour,
+	"quarter": 90 * 24 * time.Hour,
+	"year":    365 * 24 * time.Hour,
+}
+
+// Uncategorized groups the spending without a category.
+const Uncategorized = "uncategorized"
+
+// largestCount is the number of largest operations in a report.
+const largestCount = 5
+
+var (
+	onceAnalytics     sync.Once
+	instanceAnalytics *Analytics
+)
+
+// Line sums the spending of a category, merchant or weekday.
+type Line struct {
+	Key    string
+	Amount int64
+	Count  int
+	// Share is the percent of the period's spending
+	Share int
+}
+
+// Trend compares the spending of the period with the one before it.
+type Trend struct {
+	Previous int64
+	Change   int64
+	// Percent is the change relative to the previous period, 0 without previous spending
+	Percent int
+}
+
+// Report is the user's spending in a period. Amounts of all currencies are
+// converted into Currency, refunded amounts are not counted.
+type Report struct {
+	Period     string
+	From       time.Time
+	To         time.Time
+	Currency   string
+	Total      int64
+	Count      int
+	ByCategory []Line
+	ByMerchant []Line
+	// ByWeekday always has seven lines, Monday first
+	ByWeekday []Line
+	Trend     Trend
+	// Largest are the largest operations, their amounts are in their own currency
+	Largest []ledger.Operation
+}
+
+type entry struct {
+	report  Report
+	version uint64
+	expires time.Time
+}
+
+// Analytics computes spending reports from the ledger and caches them per user and period.
+type Analytics struct {
+	mu    sync.Mutex
+	cache map[string]entry
+	ttl   time.Duration
+}
+
+// Service returns the analytics shared by the handlers.
+func Service() *Analytics {
+	onceAnalytics.Do(func() {
+		instanceAnalytics = &Analytics{
+			cache: make(map[string]entry),
+			ttl:   time.Second * time.Duration(config.Config().AnalyticsCacheTTL),
+		}
+	})
+
+	return instanceAnalytics
+}
+
+// Report returns the user's spending report of the period. A cached report is
+// used until it expires or the user's operations change.
+func (a *Analytics) Report(ctx context.Context, userID, period string) (Report, error) {
+	length, ok := Periods[period]
+	if !ok {
+		return Report{}, newerrors.ErrUnknownPeriod
+	}
+
+	key := userID + "@" + period
+	version, err := ledger.Service().Version(ctx, userID)
+	if err != nil {
+		return Report{}, err
+	}
+	now := time.Now()
+
+	a.mu.Lock()
+	cached, ok := a.cache[key]
+	a.mu.Unlock()
+	if ok && cached.version == version && now.Before(cached.expires) {
+		return cached.report, nil
+	}
+
+	report, err := build(ctx, userID, period, length, now)
+	if err != nil {
+		return Report{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for k, e := range a.cache {
+		if !now.Before(e.expires) {
+			delete(a.cache, k)
+		}
+	}
+	a.cache[key] = entry{report: report, version: version, expires: now.Add(a.ttl)}
+
+	return report, nil
+}
+
+type spending struct {
+	op ledger.Operation
+	// amount is the part not refunded, converted into the report currency
+	amount int64
+}
+
+func build(ctx context.Context, userID, period string, length time.Duration, now time.Time) (Report, error) {
+	report := Report{
+		Period:   period,
+		From:     now.Add(-length),
+		To:       now,
+		Currency: wallet.Service().DefaultCurrency(),
+	}
+	previousFrom := report.From.Add(-length)
+
+	history, err := ledger.Service().List(ctx, userID, ledger.Filter{})
+	if err != nil {
+		return Report{}, err
+	}
+
+	rates := map[string]*big.Rat{}
+	var current []spending
+	for _, op := range history {
+		if op.CreatedAt.Before(previousFrom) {
+			// newest first, the rest is older
+			break
+		}
+		if !isSpending(op) || op.Amount <= op.Compensated {
+			continue
+		}
+
+		rate, ok := rates[op.Currency]
+		if !ok {
+			var err error
+			if rate, err = currency.Provider().Rate(ctx, op.Currency, report.Currency); err != nil {
+				return Report{}, err
+			}
+			rates[op.Currency] = rate
+		}
+		amount := currency.Convert(op.Amount-op.Compensated, rate)
+
+		if op.CreatedAt.Before(report.From) {
+			report.Trend.Previous += amount
+			continue
+		}
+		current = append(current, spending{op: op, amount: amount})
+	}
+
+	categories := map[string]*Line{}
+	merchants := map[string]*Line{}
+	weekdays := make([]Line, 7)
+	for i := range weekdays {
+		weekdays[i].Key = time.Weekday((i + 1) % 7).String()
+	}
+
+	for _, s := range current {
+		report.Total += s.amount
+		report.Count++
+
+		category := s.op.Category
+		if category == "" {
+			category = Uncategorized
+		}
+		add(categories, category, s.amount)
+		if s.op.Merchant != "" {
+			add(merchants, s.op.Merchant, s.amount)
+		}
+
+		day := &weekdays[(int(s.op.CreatedAt.Weekday())+6)%7]
+		day.Amount += s.amount
+		day.Count++
+	}
+
+	report.ByCategory = sorted(categories, report.Total)
+	report.ByMerchant = sorted(merchants, report.Total)
+	for i := range weekdays {
+		weekdays[i].Share = share(weekdays[i].Amount, report.Total)
+	}
+	report.ByWeekday = weekdays
+
+	report.Trend.Change = report.Total - report.Trend.Previous
+	if report.Trend.Previous > 0 {
+		report.Trend.Percent = int(report.Trend.Change * 100 / report.Trend.Previous)
+	}
+
+	sort.SliceStable(current, func(i, j int) bool {
+		return current[i].amount > current[j].amount
+	})
+	report.Largest = make([]ledger.Operation, 0, largestCount)
+	for i := 0; i < len(current) && i < largestCount; i++ {
+		report.Largest = append(report.Largest, current[i].op)
+	}
+
+	return report, nil
+}
+
+// isSpending tells whether the operation is money the user spent: expenses
+// and transfers sent to other users.
+func isSpending(op ledger.Operation) bool {
+	return op.Direction == ledger.Debit && (op.Type == ledger.Expense || op.Type == ledger.Transfer)
+}
+
+func add(lines map[string]*Line, key string, amount int64) {
+	if lines[key] == nil {
+		lines[key] = &Line{Key: key}
+	}
+	lines[key].Amount += amount
+	lines[key].Count++
+}
+
+// sorted returns the lines, largest amount first.
+func sorted(lines map[string]*Line, total int64) []Line {
+	result := make([]Line, 0, len(lines))
+	for _, line := range lines {
+		line.Share = share(line.Amount, total)
+		result = append(result, *line)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Amount != result[j].Amount {
+			return result[i].Amount > result[j].Amount
+		}
+		return result[i].Key < result[j].Key
+	})
+
+	return result
+}
+
+func share(amount, total int64) int {
+	if total == 0 {
+		return 0
+	}
+
+	return int(amount * 100 / total)
+}
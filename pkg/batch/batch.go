@@ -0,0 +1,359 @@
+package batch
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// Modes
+const (
+	// AllOrNothing stops on the first failure and reverses the items already
+	// done, incomes and expenses alike. It is not atomic: the reversals are
+	// compensating operations run after the fact, the users may spend the
+	// money before they run and a reversal that fails is reported on its item.
+	AllOrNothing = "all_or_nothing"
+	// BestEffort runs every item and reports failures one by one
+	BestEffort = "best_effort"
+)
+
+// Job statuses
+const (
+	Running    = "running"
+	Completed  = "completed"
+	RolledBack = "rolled_back"
+)
+
+// Item statuses
+const (
+	ItemPending    = "pending"
+	ItemSucceeded  = "succeeded"
+	ItemFailed     = "failed"
+	ItemSkipped    = "skipped"
+	ItemRolledBack = "rolled_back"
+)
+
+const (
+	rollbackReason = "batch rolled back"
+	// pruneBatch caps the old jobs deleted at once
+	pruneBatch = 100
+)
+
+var (
+	onceRunner     sync.Once
+	instanceRunner *Runner
+)
+
+// Item is one income or expense of a batch. An expense passes the risk rules
+// and the user's own limits like one the user makes, no one can confirm a
+// step up or a limit override in a batch.
+type Item struct {
+	UserID   string
+	Type     string
+	Amount   int64
+	Currency string
+	Note     string
+}
+
+// Result is the outcome of one item.
+type Result struct {
+	Index       int    `db:"position"`
+	Status      string `db:"status"`
+	OperationID string `db:"operation_id"`
+	Error       string `db:"error"`
+}
+
+// Job tracks a batch.
+type Job struct {
+	ID         string    `db:"id"`
+	Owner      string    `db:"owner"`
+	Mode       string    `db:"mode"`
+	Status     string    `db:"status"`
+	Total      int       `db:"total"`
+	Done       int       `db:"done"`
+	Succeeded  int       `db:"succeeded"`
+	Failed     int       `db:"failed"`
+	Results    []Result  `db:"-"`
+	CreatedAt  time.Time `db:"created_at"`
+	FinishedAt time.Time `db:"-"`
+}
+
+// jobRow is a job as it is read from the database, FinishedAt is NULL while
+// the job runs.
+type jobRow struct {
+	Job
+	FinishedAt sql.NullTime `db:"finished_at"`
+}
+
+const jobColumns = `id, owner, mode, status, total, done, succeeded, failed, created_at, finished_at`
+
+// Runner runs batches with bounded concurrency and keeps their jobs in the
+// shared database.
+type Runner struct {
+	db          *sqlx.DB
+	concurrency int
+	// retention is how long jobs are kept
+	retention time.Duration
+}
+
+// Service returns the batch runner shared by the handlers.
+func Service() *Runner {
+	onceRunner.Do(func() {
+		cfg := config.Config()
+		instanceRunner = &Runner{
+			db:          database.Service(),
+			concurrency: cfg.BatchConcurrency,
+			retention:   time.Hour * 24 * time.Duration(cfg.BatchRetention),
+		}
+	})
+
+	return instanceRunner
+}
+
+// Start creates a job for the items and runs it in the background.
+func (r *Runner) Start(ctx context.Context, owner, mode string, items []Item) (Job, error) {
+	job, err := r.newJob(ctx, owner, mode, items)
+	if err != nil {
+		return Job{}, err
+	}
+
+	go r.run(context.Background(), job, items)
+
+	return job, nil
+}
+
+// Run runs the items and returns the finished job.
+func (r *Runner) Run(ctx context.Context, owner, mode string, items []Item) (Job, error) {
+	job, err := r.newJob(ctx, owner, mode, items)
+	if err != nil {
+		return Job{}, err
+	}
+
+	r.run(ctx, job, items)
+
+	// the request may be cancelled, the job is done anyway
+	detached, cancel := wallet.Service().Detached()
+	defer cancel()
+
+	return r.Job(detached, owner, job.ID)
+}
+
+// Job returns the owner's job with the progress so far.
+func (r *Runner) Job(ctx context.Context, owner, id string) (Job, error) {
+	var row jobRow
+	err := r.db.GetContext(ctx, &row, `
+		SELECT `+jobColumns+` FROM batch_jobs WHERE id = $1 AND owner = $2`, id, owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, newerrors.ErrJobNotFound
+	} else if err != nil {
+		return Job{}, err
+	}
+
+	job := row.Job
+	job.FinishedAt = row.FinishedAt.Time
+
+	err = r.db.SelectContext(ctx, &job.Results, `
+		SELECT position, status, operation_id, error FROM batch_items
+		WHERE job_id = $1 ORDER BY position`, id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	return job, nil
+}
+
+func (r *Runner) newJob(ctx context.Context, owner, mode string, items []Item) (Job, error) {
+	job := Job{
+		ID:        uuid.New().String(),
+		Owner:     owner,
+		Mode:      mode,
+		Status:    Running,
+		Total:     len(items),
+		Results:   make([]Result, len(items)),
+		CreatedAt: time.Now(),
+	}
+	for i := range job.Results {
+		job.Results[i] = Result{Index: i, Status: ItemPending}
+	}
+
+	r.prune(ctx)
+
+	err := database.InTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(ctx, `
+			INSERT INTO batch_jobs (id, owner, mode, status, total, created_at)
+			VALUES (:id, :owner, :mode, :status, :total, :created_at)`, job)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO batch_items (job_id, position, status)
+			SELECT $1, position, $3 FROM generate_series(0, $2 - 1) AS position`, job.ID, job.Total, ItemPending)
+		return err
+	})
+	if err != nil {
+		return Job{}, err
+	}
+
+	return job, nil
+}
+
+// prune deletes the jobs older than the retention. A job still running that
+// old was left by a stopped instance.
+func (r *Runner) prune(ctx context.Context) {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM batch_jobs WHERE id IN (
+			SELECT id FROM batch_jobs WHERE created_at < now() - $1 * interval '1 second' LIMIT $2
+		)`, r.retention.Seconds(), pruneBatch)
+	if err != nil {
+		logger.Error(ctx, "Error while pruning batch jobs", logger.Err(err))
+	}
+}
+
+// run runs the items of the job. The progress is saved even if ctx is
+// cancelled, the items done so far have moved money.
+func (r *Runner) run(ctx context.Context, job Job, items []Item) {
+	saveCtx, cancel := wallet.Service().Detached()
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		slots   = make(chan struct{}, r.concurrency)
+		stopped = make(chan struct{})
+		once    sync.Once
+	)
+
+	finish := func(result Result) {
+		mu.Lock()
+		job.Results[result.Index] = result
+		if result.Status == ItemFailed {
+			job.Failed++
+		}
+		mu.Unlock()
+
+		r.saveItem(saveCtx, job.ID, result, true)
+	}
+
+	for i, item := range items {
+		// In all-or-nothing mode no new items are started after a failure.
+		select {
+		case <-stopped:
+			finish(Result{Index: i, Status: ItemSkipped})
+			continue
+		case slots <- struct{}{}:
+		}
+
+		select {
+		case <-stopped:
+			<-slots
+			finish(Result{Index: i, Status: ItemSkipped})
+			continue
+		default:
+		}
+
+		wg.Add(1)
+		go func(i int, item Item) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			op, err := r.runItem(ctx, item)
+			if err != nil {
+				finish(Result{Index: i, Status: ItemFailed, Error: err.Error()})
+				if job.Mode == AllOrNothing {
+					once.Do(func() { close(stopped) })
+				}
+				return
+			}
+
+			finish(Result{Index: i, Status: ItemSucceeded, OperationID: op.ID})
+		}(i, item)
+	}
+
+	wg.Wait()
+
+	status := Completed
+	if job.Failed > 0 && job.Mode == AllOrNothing {
+		// the items may have failed because the request was cancelled, roll back anyway
+		r.rollback(saveCtx, job)
+		status = RolledBack
+	}
+
+	_, err := r.db.ExecContext(saveCtx, `
+		UPDATE batch_jobs SET status = $2, finished_at = now() WHERE id = $1`, job.ID, status)
+	if err != nil {
+		logger.Error(saveCtx, "Error while saving a batch job", logger.Any("job_id", job.ID), logger.Err(err))
+	}
+}
+
+func (r *Runner) runItem(ctx context.Context, item Item) (ledger.Operation, error) {
+	op := ledger.Operation{
+		UserID:   item.UserID,
+		Type:     item.Type,
+		Currency: item.Currency,
+		Amount:   item.Amount,
+		Note:     item.Note,
+	}
+
+	switch item.Type {
+	case ledger.Income:
+		// the same risk rules as a single top up, no one can confirm a step-up here
+		if _, err := wallet.Service().Assess(ctx, op); err != nil {
+			return ledger.Operation{}, err
+		}
+
+		return wallet.Service().Income(ctx, op)
+	case ledger.Expense:
+		return wallet.Service().Expense(ctx, op)
+	}
+
+	return ledger.Operation{}, fmt.Errorf("batches can not run %q operations", item.Type)
+}
+
+// rollback reverses the succeeded items of a failed all-or-nothing batch.
+func (r *Runner) rollback(ctx context.Context, job Job) {
+	for _, result := range job.Results {
+		if result.Status != ItemSucceeded {
+			continue
+		}
+
+		_, err := wallet.Service().Reverse(ctx, result.OperationID, 0, rollbackReason)
+		if err != nil {
+			result.Error = "rollback failed: " + err.Error()
+		} else {
+			result.Status = ItemRolledBack
+		}
+
+		r.saveItem(ctx, job.ID, result, false)
+	}
+}
+
+// saveItem saves the outcome of an item, done counts it in the job's progress.
+func (r *Runner) saveItem(ctx context.Context, jobID string, result Result, done bool) {
+	_, err := r.db.ExecContext(ctx, `
+		WITH item AS (
+			UPDATE batch_items SET status = $3, operation_id = $4, error = $5
+			WHERE job_id = $1 AND position = $2
+		)
+		UPDATE batch_jobs SET
+			done = done + CASE WHEN $6 THEN 1 ELSE 0 END,
+			succeeded = succeeded + CASE WHEN $6 AND $3 = 'succeeded' THEN 1 ELSE 0 END,
+			failed = failed + CASE WHEN $6 AND $3 = 'failed' THEN 1 ELSE 0 END
+		WHERE id = $1`, jobID, result.Index, result.Status, result.OperationID, result.Error, done)
+	if err != nil {
+		logger.Error(ctx, "Error while saving a batch item", logger.Any("job_id", jobID), logger.Any("index", result.Index), logger.Err(err))
+	}
+}
@@ -0,0 +1,109 @@
+package batch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/testenv"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+func TestAllOrNothingRollback(t *testing.T) {
+	db := testenv.DB(t)
+	users := testenv.UserService(t)
+	ctx := context.Background()
+
+	// One item at a time, so the failing item comes after the others are done.
+	r := &Runner{db: db, concurrency: 1, retention: time.Hour}
+
+	topped, charged, poor := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	users.Add(topped, 1000)
+	users.Add(charged, 1000)
+	users.Add(poor, 50)
+	if err := wallet.Service().Credit(ctx, charged, "USD", 300); err != nil {
+		t.Fatal(err)
+	}
+
+	partner := uuid.New().String()
+	job, err := r.Run(ctx, partner, AllOrNothing, []Item{
+		{UserID: topped, Type: ledger.Income, Amount: 100},
+		{UserID: charged, Type: ledger.Expense, Amount: 200},
+		{UserID: charged, Type: ledger.Expense, Amount: 100, Currency: "USD"},
+		{UserID: poor, Type: ledger.Expense, Amount: 500},
+		{UserID: topped, Type: ledger.Income, Amount: 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != RolledBack || job.Done != 5 || job.Succeeded != 3 || job.Failed != 1 {
+		t.Errorf("job = %+v, want rolled back with 3 succeeded and 1 failed", job)
+	}
+
+	want := []string{ItemRolledBack, ItemRolledBack, ItemRolledBack, ItemFailed, ItemSkipped}
+	for i, status := range want {
+		if got := job.Results[i]; got.Status != status {
+			t.Errorf("item %d = %+v, want %s", i, got, status)
+		}
+	}
+
+	if balance := users.Balance(topped); balance != 1000 {
+		t.Errorf("topped up balance = %d, want 1000", balance)
+	}
+	if balance := users.Balance(charged); balance != 1000 {
+		t.Errorf("charged balance = %d, want 1000", balance)
+	}
+	if balance, err := wallet.Service().Balance(ctx, charged, "USD"); err != nil || balance != 300 {
+		t.Errorf("charged USD balance = %d, %v, want 300", balance, err)
+	}
+	if balance := users.Balance(poor); balance != 50 {
+		t.Errorf("failed balance = %d, want 50", balance)
+	}
+
+	// The job is in the shared database, another instance finds it too.
+	other := &Runner{db: db, concurrency: 1, retention: time.Hour}
+	found, err := other.Job(ctx, partner, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Status != RolledBack || len(found.Results) != len(want) || found.FinishedAt.IsZero() {
+		t.Errorf("job read back = %+v", found)
+	}
+	if _, err := other.Job(ctx, uuid.New().String(), job.ID); err == nil {
+		t.Error("job of another owner was found")
+	}
+}
+
+func TestBestEffortRunsEveryItem(t *testing.T) {
+	db := testenv.DB(t)
+	users := testenv.UserService(t)
+	ctx := context.Background()
+	r := &Runner{db: db, concurrency: 4, retention: time.Hour}
+
+	rich, poor := uuid.New().String(), uuid.New().String()
+	users.Add(rich, 1000)
+	users.Add(poor, 50)
+
+	job, err := r.Run(ctx, uuid.New().String(), BestEffort, []Item{
+		{UserID: rich, Type: ledger.Expense, Amount: 200},
+		{UserID: poor, Type: ledger.Expense, Amount: 500},
+		{UserID: poor, Type: ledger.Income, Amount: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != Completed || job.Succeeded != 2 || job.Failed != 1 {
+		t.Errorf("job = %+v, want completed with 2 succeeded and 1 failed", job)
+	}
+	if balance := users.Balance(rich); balance != 800 {
+		t.Errorf("rich balance = %d, want 800", balance)
+	}
+	if balance := users.Balance(poor); balance != 60 {
+		t.Errorf("poor balance = %d, want 60", balance)
+	}
+}
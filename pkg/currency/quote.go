@@ -0,0 +1,112 @@
+package currency
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+)
+
+var (
+	onceQuotes     sync.Once
+	instanceQuotes *QuoteStore
+)
+
+// Quote is a rate offered to a user which is applied if the user accepts it before it expires.
+type Quote struct {
+	ID        string
+	UserID    string
+	From      string
+	To        string
+	Amount    int64
+	Converted int64
+	Rate      string
+	ExpiresAt time.Time
+}
+
+// QuoteStore keeps issued quotes in memory until they are used or expire.
+type QuoteStore struct {
+	mu       sync.Mutex
+	quotes   map[string]*Quote
+	provider RateProvider
+	ttl      time.Duration
+}
+
+// Quotes returns the quote store shared by the exchange handlers.
+func Quotes() *QuoteStore {
+	onceQuotes.Do(func() {
+		instanceQuotes = NewQuoteStore(Provider(), time.Second*time.Duration(config.Config().ExchangeQuoteTTL))
+	})
+
+	return instanceQuotes
+}
+
+// NewQuoteStore ...
+func NewQuoteStore(provider RateProvider, ttl time.Duration) *QuoteStore {
+	return &QuoteStore{
+		quotes:   make(map[string]*Quote),
+		provider: provider,
+		ttl:      ttl,
+	}
+}
+
+// New issues a quote for converting amount of "from" currency into "to" currency.
+func (s *QuoteStore) New(ctx context.Context, userID, from, to string, amount int64) (*Quote, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+
+	rate, err := s.provider.Rate(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &Quote{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Converted: Convert(amount, rate),
+		Rate:      rate.FloatString(6),
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeExpired()
+	s.quotes[quote.ID] = quote
+
+	return quote, nil
+}
+
+// Take returns the user's quote and removes it, so a quote can be applied only once.
+func (s *QuoteStore) Take(userID, id string) (*Quote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	quote, ok := s.quotes[id]
+	if !ok || quote.UserID != userID {
+		return nil, newerrors.ErrQuoteNotFound
+	}
+
+	delete(s.quotes, id)
+
+	if time.Now().After(quote.ExpiresAt) {
+		return nil, newerrors.ErrQuoteExpired
+	}
+
+	return quote, nil
+}
+
+func (s *QuoteStore) removeExpired() {
+	now := time.Now()
+	for id, quote := range s.quotes {
+		if now.After(quote.ExpiresAt) {
+			delete(s.quotes, id)
+		}
+	}
+}
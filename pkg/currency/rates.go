@@ -0,0 +1,140 @@
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+)
+
+var (
+	onceProvider     sync.Once
+	instanceProvider RateProvider
+)
+
+// RateProvider gives the rate to convert one unit of "from" currency into "to" currency.
+type RateProvider interface {
+	Rate(ctx context.Context, from, to string) (*big.Rat, error)
+	Currencies() []string
+}
+
+// Provider returns the rate provider chosen by RATE_PROVIDER.
+func Provider() RateProvider {
+	onceProvider.Do(func() {
+		cfg := config.Config()
+
+		provider, err := NewRateProvider(cfg.RateProvider, cfg.RatesFilePath)
+		if err != nil {
+			panic(fmt.Errorf("rate provider %s: %s", cfg.RateProvider, err))
+		}
+
+		instanceProvider = provider
+	})
+
+	return instanceProvider
+}
+
+// NewRateProvider builds a rate provider by its name.
+func NewRateProvider(name, path string) (RateProvider, error) {
+	switch name {
+	case "file":
+		return NewFileProvider(path)
+	case "static":
+		return NewStaticProvider(defaultPrices)
+	default:
+		return nil, fmt.Errorf("rate provider '%v' is not supported", name)
+	}
+}
+
+// defaultPrices are used by the static provider when no rates file is available.
+var defaultPrices = map[string]string{
+	"UZS": "1",
+	"USD": "10850",
+}
+
+// StaticProvider keeps prices of currencies in a common base currency.
+type StaticProvider struct {
+	prices map[string]*big.Rat
+}
+
+// NewStaticProvider creates a provider from prices expressed in a common base currency.
+func NewStaticProvider(prices map[string]string) (*StaticProvider, error) {
+	provider := &StaticProvider{
+		prices: make(map[string]*big.Rat, len(prices)),
+	}
+
+	for code, price := range prices {
+		rat, ok := new(big.Rat).SetString(price)
+		if !ok || rat.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid price %q for %s", price, code)
+		}
+
+		provider.prices[strings.ToUpper(code)] = rat
+	}
+
+	return provider, nil
+}
+
+// NewFileProvider reads prices from a JSON file like {"UZS": "1", "USD": "10850"}.
+func NewFileProvider(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := map[string]string{}
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, err
+	}
+
+	return NewStaticProvider(prices)
+}
+
+// Rate ...
+func (p *StaticProvider) Rate(ctx context.Context, from, to string) (*big.Rat, error) {
+	fromPrice, ok := p.prices[strings.ToUpper(from)]
+	if !ok {
+		return nil, newerrors.ErrUnsupportedCurrency
+	}
+
+	toPrice, ok := p.prices[strings.ToUpper(to)]
+	if !ok {
+		return nil, newerrors.ErrUnsupportedCurrency
+	}
+
+	return new(big.Rat).Quo(fromPrice, toPrice), nil
+}
+
+// Currencies ...
+func (p *StaticProvider) Currencies() []string {
+	codes := make([]string, 0, len(p.prices))
+	for code := range p.prices {
+		codes = append(codes, code)
+	}
+
+	return codes
+}
+
+// IsSupported checks whether the currency is known to the provider.
+func IsSupported(provider RateProvider, code string) bool {
+	for _, c := range provider.Currencies() {
+		if c == strings.ToUpper(code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Convert converts an amount with the rate, rounding down to the minor unit.
+func Convert(amount int64, rate *big.Rat) int64 {
+	converted := new(big.Rat).Mul(new(big.Rat).SetInt64(amount), rate)
+
+	return new(big.Int).Quo(converted.Num(), converted.Denom()).Int64()
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	// registers the postgres driver
+	_ "github.com/lib/pq"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+)
+
+var (
+	onceDB     sync.Once
+	instanceDB *sqlx.DB
+)
+
+// Service returns the connection pool of the Postgres database keeping the
+// state shared by all gateway instances. Connections are opened on first use.
+func Service() *sqlx.DB {
+	onceDB.Do(func() {
+		url, _ := utils.ConnectionURLBuilder("postgres")
+
+		// Open only fails for an unknown driver, the driver is registered above.
+		instanceDB = sqlx.MustOpen("postgres", url)
+		instanceDB.SetMaxOpenConns(config.Config().PostgresMaxConnections)
+	})
+
+	return instanceDB
+}
+
+// InTx runs fn in a transaction, committed when fn returns nil and rolled back otherwise.
+func InTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
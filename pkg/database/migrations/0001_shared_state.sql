@@ -0,0 +1,186 @@
+-- Balances in currencies other than the default one, which lives in the user service.
+CREATE TABLE wallet_balances (
+    user_id    TEXT        NOT NULL,
+    currency   TEXT        NOT NULL,
+    amount     BIGINT      NOT NULL DEFAULT 0 CHECK (amount >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, currency)
+);
+
+CREATE TABLE wallet_holds (
+    id              TEXT        PRIMARY KEY,
+    user_id         TEXT        NOT NULL,
+    merchant        TEXT        NOT NULL DEFAULT '',
+    currency        TEXT        NOT NULL,
+    amount          BIGINT      NOT NULL CHECK (amount > 0),
+    captured_amount BIGINT      NOT NULL DEFAULT 0,
+    status          TEXT        NOT NULL,
+    operation_id    TEXT        NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL,
+    expires_at      TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX wallet_holds_user ON wallet_holds (user_id, created_at DESC);
+CREATE INDEX wallet_holds_active ON wallet_holds (user_id, currency) WHERE status = 'active';
+
+CREATE TABLE wallet_pockets (
+    id            TEXT        PRIMARY KEY,
+    user_id       TEXT        NOT NULL,
+    name          TEXT        NOT NULL,
+    currency      TEXT        NOT NULL,
+    amount        BIGINT      NOT NULL DEFAULT 0 CHECK (amount >= 0),
+    target_amount BIGINT      NOT NULL DEFAULT 0,
+    target_date   TIMESTAMPTZ NULL,
+    created_at    TIMESTAMPTZ NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX wallet_pockets_user ON wallet_pockets (user_id, currency);
+
+CREATE TABLE ledger_operations (
+    id           TEXT        PRIMARY KEY,
+    user_id      TEXT        NOT NULL,
+    type         TEXT        NOT NULL,
+    direction    TEXT        NOT NULL DEFAULT '',
+    currency     TEXT        NOT NULL DEFAULT '',
+    amount       BIGINT      NOT NULL,
+    merchant     TEXT        NOT NULL DEFAULT '',
+    counterparty TEXT        NOT NULL DEFAULT '',
+    request_id   TEXT        NOT NULL DEFAULT '',
+    status       TEXT        NOT NULL DEFAULT '',
+    note         TEXT        NOT NULL DEFAULT '',
+    category     TEXT        NOT NULL DEFAULT '',
+    tags         TEXT[]      NOT NULL DEFAULT '{}',
+    reason       TEXT        NOT NULL DEFAULT '',
+    reverses     TEXT        NULL REFERENCES ledger_operations (id),
+    compensated  BIGINT      NOT NULL DEFAULT 0 CHECK (compensated >= 0 AND compensated <= amount),
+    created_at   TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX ledger_operations_user ON ledger_operations (user_id, created_at DESC);
+CREATE INDEX ledger_operations_reverses ON ledger_operations (reverses) WHERE reverses IS NOT NULL;
+
+-- Versions count the changes of each user's operations, cached reports compare them.
+CREATE TABLE ledger_versions (
+    user_id TEXT   PRIMARY KEY,
+    version BIGINT NOT NULL
+);
+
+CREATE TABLE merchants (
+    id         TEXT        PRIMARY KEY,
+    owner_id   TEXT        NOT NULL,
+    name       TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX merchants_owner ON merchants (owner_id, created_at);
+
+CREATE TABLE merchant_api_keys (
+    id          TEXT        PRIMARY KEY,
+    merchant_id TEXT        NOT NULL REFERENCES merchants (id),
+    hint        TEXT        NOT NULL,
+    hash        TEXT        NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL,
+    revoked_at  TIMESTAMPTZ NULL
+);
+CREATE INDEX merchant_api_keys_merchant ON merchant_api_keys (merchant_id, created_at);
+
+CREATE TABLE merchant_charges (
+    id           TEXT        PRIMARY KEY,
+    merchant_id  TEXT        NOT NULL REFERENCES merchants (id),
+    amount       BIGINT      NOT NULL,
+    currency     TEXT        NOT NULL,
+    description  TEXT        NOT NULL DEFAULT '',
+    reference    TEXT        NOT NULL DEFAULT '',
+    status       TEXT        NOT NULL,
+    user_id      TEXT        NOT NULL DEFAULT '',
+    operation_id TEXT        NOT NULL DEFAULT '',
+    expires_at   TIMESTAMPTZ NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    paid_at      TIMESTAMPTZ NULL
+);
+CREATE INDEX merchant_charges_merchant ON merchant_charges (merchant_id, created_at DESC);
+CREATE INDEX merchant_charges_paid ON merchant_charges (merchant_id, paid_at) WHERE status = 'paid';
+
+CREATE TABLE schedules (
+    id           TEXT        PRIMARY KEY,
+    user_id      TEXT        NOT NULL,
+    kind         TEXT        NOT NULL,
+    amount       BIGINT      NOT NULL,
+    currency     TEXT        NOT NULL,
+    recipient_id TEXT        NOT NULL DEFAULT '',
+    merchant     TEXT        NOT NULL DEFAULT '',
+    note         TEXT        NOT NULL DEFAULT '',
+    category     TEXT        NOT NULL DEFAULT '',
+    rule         TEXT        NOT NULL,
+    policy       TEXT        NOT NULL,
+    status       TEXT        NOT NULL,
+    next_run_at  TIMESTAMPTZ NOT NULL,
+    last_run_at  TIMESTAMPTZ NULL,
+    last_status  TEXT        NOT NULL DEFAULT '',
+    last_error   TEXT        NOT NULL DEFAULT '',
+    runs         INTEGER     NOT NULL DEFAULT 0,
+    -- occurrence is the planned time of the run in progress, retries keep it
+    occurrence   TIMESTAMPTZ NOT NULL,
+    retries      INTEGER     NOT NULL DEFAULT 0,
+    -- locked_until is set by the instance running the schedule
+    locked_until TIMESTAMPTZ NULL,
+    created_at   TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX schedules_user ON schedules (user_id, created_at);
+CREATE INDEX schedules_due ON schedules (next_run_at) WHERE status = 'active';
+
+-- Paid occurrences, so an occurrence is never paid twice.
+CREATE TABLE schedule_runs (
+    schedule_id  TEXT        NOT NULL REFERENCES schedules (id) ON DELETE CASCADE,
+    occurrence   TIMESTAMPTZ NOT NULL,
+    operation_id TEXT        NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (schedule_id, occurrence)
+);
+
+CREATE TABLE webhook_subscriptions (
+    id          TEXT        PRIMARY KEY,
+    owner       TEXT        NOT NULL,
+    url         TEXT        NOT NULL,
+    secret      TEXT        NOT NULL,
+    event_types TEXT[]      NOT NULL,
+    user_id     TEXT        NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX webhook_subscriptions_owner ON webhook_subscriptions (owner, created_at);
+
+CREATE TABLE webhook_deliveries (
+    id              TEXT        PRIMARY KEY,
+    subscription_id TEXT        NOT NULL,
+    owner           TEXT        NOT NULL,
+    event_id        BIGINT      NOT NULL,
+    event_type      TEXT        NOT NULL,
+    payload         BYTEA       NOT NULL,
+    status          TEXT        NOT NULL,
+    attempts        INTEGER     NOT NULL DEFAULT 0,
+    last_error      TEXT        NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    -- locked_until is set by the instance sending the delivery
+    locked_until    TIMESTAMPTZ NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    delivered_at    TIMESTAMPTZ NULL
+);
+CREATE INDEX webhook_deliveries_owner ON webhook_deliveries (owner, created_at DESC);
+CREATE INDEX webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE spending_limits (
+    id         TEXT        PRIMARY KEY,
+    user_id    TEXT        NOT NULL,
+    period     TEXT        NOT NULL,
+    category   TEXT        NOT NULL DEFAULT '',
+    currency   TEXT        NOT NULL,
+    amount     BIGINT      NOT NULL,
+    thresholds INTEGER[]   NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (user_id, period, category, currency)
+);
+
+-- The highest threshold already alerted in a period of a limit.
+CREATE TABLE spending_limit_alerts (
+    limit_id     TEXT        NOT NULL REFERENCES spending_limits (id) ON DELETE CASCADE,
+    period_start TIMESTAMPTZ NOT NULL,
+    threshold    INTEGER     NOT NULL,
+    PRIMARY KEY (limit_id, period_start)
+);
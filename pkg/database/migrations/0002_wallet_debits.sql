@@ -0,0 +1,16 @@
+-- Debits of the available balance in progress. A debit reserves its amount
+-- before the money is taken, so checks running at the same time see each other.
+CREATE TABLE wallet_debits (
+    seq           BIGSERIAL   PRIMARY KEY,
+    user_id       TEXT        NOT NULL,
+    currency      TEXT        NOT NULL,
+    amount        BIGINT      NOT NULL CHECK (amount > 0),
+    -- completed_seq orders completed debits against the marks taken by checks
+    completed_seq BIGINT      NULL,
+    expires_at    TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX wallet_debits_user ON wallet_debits (user_id, currency);
+
+-- Marks tell the debits completed before a balance was read from the ones
+-- which may have completed after it.
+CREATE SEQUENCE wallet_debit_marks;
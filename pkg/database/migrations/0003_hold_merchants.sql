@@ -0,0 +1,4 @@
+-- Holds are made for registered merchants, which capture or void them.
+-- confirmed tells the payer confirmed the hold with a one-time code.
+ALTER TABLE wallet_holds ADD COLUMN confirmed BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX wallet_holds_merchant ON wallet_holds (merchant, created_at DESC);
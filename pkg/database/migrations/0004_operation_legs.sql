@@ -0,0 +1,6 @@
+-- The income of a merchant's owner is a leg of the user's expense paying the
+-- merchant, reversing the expense takes the money back from the owner too.
+ALTER TABLE ledger_operations ADD COLUMN leg_of TEXT NULL REFERENCES ledger_operations (id);
+CREATE UNIQUE INDEX ledger_operations_leg_of ON ledger_operations (leg_of) WHERE leg_of IS NOT NULL;
+
+ALTER TABLE merchant_charges ADD COLUMN income_operation_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+-- One-time codes are emailed to the address the user signed up with, they are
+-- never shown through the inbox or the event stream the bearer token can read.
+CREATE TABLE user_contacts (
+    user_id    TEXT        PRIMARY KEY,
+    email      TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
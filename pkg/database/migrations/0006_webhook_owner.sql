@@ -0,0 +1,5 @@
+-- A subscription gets the events of its owner only, no longer those of any
+-- user it names. Old deliveries are pruned once they are done.
+ALTER TABLE webhook_subscriptions DROP COLUMN user_id;
+
+CREATE INDEX webhook_deliveries_done ON webhook_deliveries (created_at) WHERE status <> 'pending';
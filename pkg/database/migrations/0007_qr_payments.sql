@@ -0,0 +1,9 @@
+-- A QR code with an amount is paid once: its merchant and reference are taken
+-- by the charge paying it, a replayed code finds them taken.
+CREATE TABLE qr_payments (
+    merchant_id TEXT        NOT NULL,
+    reference   TEXT        NOT NULL,
+    charge_id   TEXT        NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (merchant_id, reference)
+);
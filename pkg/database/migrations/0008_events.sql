@@ -0,0 +1,20 @@
+-- Events published by all gateway instances. Publishers take turns, so the IDs
+-- grow in the order the events are committed and a stream resumes from its
+-- last event ID on any instance.
+CREATE TABLE events (
+    id         BIGSERIAL   PRIMARY KEY,
+    user_id    TEXT        NOT NULL,
+    type       TEXT        NOT NULL,
+    data       JSONB       NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX events_user ON events (user_id, id);
+CREATE INDEX events_created ON events (created_at);
+
+-- The last event each durable consumer, like the webhook dispatcher, handled.
+CREATE TABLE event_consumers (
+    name          TEXT        PRIMARY KEY,
+    last_event_id BIGINT      NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- Users let partners receive the events of their wallet. A subscription gets
+-- the events of its owner and of the users who granted the owner access, or of
+-- the one granted user it names.
+CREATE TABLE partner_grants (
+    user_id    TEXT        NOT NULL,
+    partner_id TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, partner_id)
+);
+CREATE INDEX partner_grants_partner ON partner_grants (partner_id, user_id);
+
+ALTER TABLE webhook_subscriptions ADD COLUMN user_id TEXT NOT NULL DEFAULT '';
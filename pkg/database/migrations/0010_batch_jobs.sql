@@ -0,0 +1,25 @@
+-- Batch jobs are kept in the shared database, so their progress can be
+-- followed on any instance. Jobs are pruned once they are older than the
+-- retention, along with their items.
+CREATE TABLE batch_jobs (
+    id          TEXT        PRIMARY KEY,
+    owner       TEXT        NOT NULL,
+    mode        TEXT        NOT NULL,
+    status      TEXT        NOT NULL,
+    total       INTEGER     NOT NULL,
+    done        INTEGER     NOT NULL DEFAULT 0,
+    succeeded   INTEGER     NOT NULL DEFAULT 0,
+    failed      INTEGER     NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NULL
+);
+CREATE INDEX batch_jobs_created ON batch_jobs (created_at);
+
+CREATE TABLE batch_items (
+    job_id       TEXT    NOT NULL REFERENCES batch_jobs (id) ON DELETE CASCADE,
+    position     INTEGER NOT NULL,
+    status       TEXT    NOT NULL,
+    operation_id TEXT    NOT NULL DEFAULT '',
+    error        TEXT    NOT NULL DEFAULT '',
+    PRIMARY KEY (job_id, position)
+);
@@ -0,0 +1,6 @@
+-- An occurrence is claimed with a pending run before it is paid. A run still
+-- pending when the lease of its schedule is over may have been paid, it is
+-- failed and never paid again.
+ALTER TABLE schedule_runs ADD COLUMN status TEXT NOT NULL DEFAULT 'paid';
+ALTER TABLE schedule_runs ADD COLUMN error TEXT NOT NULL DEFAULT '';
+ALTER TABLE schedule_runs ALTER COLUMN operation_id SET DEFAULT '';
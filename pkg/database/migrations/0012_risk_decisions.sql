@@ -0,0 +1,22 @@
+-- Risk decisions are the audit of the rules engine. They are kept in the shared
+-- database, so the attempts counted by the velocity rules and the addresses and
+-- devices the users are known by are the same on every instance.
+CREATE TABLE risk_decisions (
+    id         TEXT        PRIMARY KEY,
+    user_id    TEXT        NOT NULL,
+    type       TEXT        NOT NULL,
+    amount     BIGINT      NOT NULL,
+    currency   TEXT        NOT NULL DEFAULT '',
+    recipient  TEXT        NOT NULL DEFAULT '',
+    ip         TEXT        NOT NULL DEFAULT '',
+    device_id  TEXT        NOT NULL DEFAULT '',
+    outcome    TEXT        NOT NULL,
+    rules      TEXT[]      NOT NULL DEFAULT '{}',
+    confirmed  BOOLEAN     NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX risk_decisions_user ON risk_decisions (user_id, created_at DESC);
+CREATE INDEX risk_decisions_created ON risk_decisions (created_at DESC);
+-- Addresses and devices of allowed or confirmed decisions are trusted.
+CREATE INDEX risk_decisions_trusted_ip ON risk_decisions (user_id, ip) WHERE outcome = 'allow' OR confirmed;
+CREATE INDEX risk_decisions_trusted_device ON risk_decisions (user_id, device_id) WHERE outcome = 'allow' OR confirmed;
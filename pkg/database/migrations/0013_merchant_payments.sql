@@ -0,0 +1,3 @@
+-- Settlements are built from the incomes merchants' owners get as legs of
+-- the users' payments.
+CREATE INDEX ledger_operations_merchant_legs ON ledger_operations (merchant, created_at) WHERE leg_of IS NOT NULL;
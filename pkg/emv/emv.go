@@ -0,0 +1,257 @@
+// Package emv builds and parses merchant-presented QR payloads in the EMVCo
+// format: a list of two-digit tag, two-digit length and value fields ending
+// with a CRC checksum.
+package emv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+)
+
+// Tags of the payload fields
+const (
+	tagFormat         = "00"
+	tagInitiation     = "01"
+	tagMerchantInfo   = "26"
+	tagCategory       = "52"
+	tagCurrency       = "53"
+	tagAmount         = "54"
+	tagCountry        = "58"
+	tagMerchantName   = "59"
+	tagMerchantCity   = "60"
+	tagAdditionalData = "62"
+	tagCRC            = "63"
+
+	// sub-tags of the merchant information template
+	subTagGUID       = "00"
+	subTagMerchantID = "01"
+	// sub-tag of the additional data template
+	subTagReference = "05"
+)
+
+const (
+	formatIndicator = "01"
+	// a static code is paid many times with any amount, a dynamic one once with its amount
+	staticInitiation  = "11"
+	dynamicInitiation = "12"
+
+	maxNameLength = 25
+	maxCityLength = 15
+)
+
+// numericCurrencies maps currency codes to their ISO 4217 numbers.
+var numericCurrencies = map[string]string{
+	"UZS": "860",
+	"USD": "840",
+	"EUR": "978",
+	"RUB": "643",
+}
+
+// Payload is a merchant-presented payment payload.
+type Payload struct {
+	// GUID tells which payment system the merchant information belongs to
+	GUID       string
+	MerchantID string
+	Name       string
+	City       string
+	Country    string
+	// CategoryCode is the ISO 18245 merchant category code
+	CategoryCode string
+	Currency     string
+	// Amount is in minor units, 0 leaves it to the payer
+	Amount    int64
+	Reference string
+}
+
+// Encode returns the payload text, checksum included.
+func (p Payload) Encode() (string, error) {
+	numeric, ok := numericCurrencies[p.Currency]
+	if !ok {
+		return "", newerrors.ErrUnsupportedCurrency
+	}
+
+	initiation := staticInitiation
+	if p.Amount > 0 {
+		initiation = dynamicInitiation
+	}
+
+	var b strings.Builder
+	writeField(&b, tagFormat, formatIndicator)
+	writeField(&b, tagInitiation, initiation)
+	writeField(&b, tagMerchantInfo, field(subTagGUID, p.GUID)+field(subTagMerchantID, p.MerchantID))
+	writeField(&b, tagCategory, p.CategoryCode)
+	writeField(&b, tagCurrency, numeric)
+	if p.Amount > 0 {
+		writeField(&b, tagAmount, formatAmount(p.Amount))
+	}
+	writeField(&b, tagCountry, p.Country)
+	writeField(&b, tagMerchantName, truncate(p.Name, maxNameLength))
+	writeField(&b, tagMerchantCity, truncate(p.City, maxCityLength))
+	if p.Reference != "" {
+		writeField(&b, tagAdditionalData, field(subTagReference, p.Reference))
+	}
+
+	b.WriteString(tagCRC + "04")
+	b.WriteString(fmt.Sprintf("%04X", crc16(b.String())))
+
+	return b.String(), nil
+}
+
+// Parse checks the checksum of the payload text and reads its fields.
+func Parse(text string) (Payload, error) {
+	// the checksum covers everything up to and including its own tag and length
+	if len(text) < 8 || text[len(text)-8:len(text)-4] != tagCRC+"04" {
+		return Payload{}, fmt.Errorf("%w: no checksum", newerrors.ErrInvalidQRPayload)
+	}
+	checksum, err := strconv.ParseUint(text[len(text)-4:], 16, 16)
+	if err != nil || uint16(checksum) != crc16(text[:len(text)-4]) {
+		return Payload{}, fmt.Errorf("%w: checksum mismatch", newerrors.ErrInvalidQRPayload)
+	}
+
+	fields, err := parseFields(text[:len(text)-8])
+	if err != nil {
+		return Payload{}, err
+	}
+
+	if fields[tagFormat] != formatIndicator {
+		return Payload{}, fmt.Errorf("%w: unknown format", newerrors.ErrInvalidQRPayload)
+	}
+
+	info, err := parseFields(fields[tagMerchantInfo])
+	if err != nil {
+		return Payload{}, err
+	}
+
+	payload := Payload{
+		GUID:         info[subTagGUID],
+		MerchantID:   info[subTagMerchantID],
+		Name:         fields[tagMerchantName],
+		City:         fields[tagMerchantCity],
+		Country:      fields[tagCountry],
+		CategoryCode: fields[tagCategory],
+		Currency:     alphaCurrency(fields[tagCurrency]),
+	}
+	if payload.MerchantID == "" {
+		return Payload{}, fmt.Errorf("%w: no merchant", newerrors.ErrInvalidQRPayload)
+	}
+	if payload.Currency == "" {
+		return Payload{}, fmt.Errorf("%w: unknown currency %s", newerrors.ErrInvalidQRPayload, fields[tagCurrency])
+	}
+
+	if value, ok := fields[tagAmount]; ok {
+		if payload.Amount, err = parseAmount(value); err != nil {
+			return Payload{}, err
+		}
+	}
+
+	if value, ok := fields[tagAdditionalData]; ok {
+		additional, err := parseFields(value)
+		if err != nil {
+			return Payload{}, err
+		}
+		payload.Reference = additional[subTagReference]
+	}
+
+	return payload, nil
+}
+
+func field(tag, value string) string {
+	return fmt.Sprintf("%s%02d%s", tag, len(value), value)
+}
+
+func writeField(b *strings.Builder, tag, value string) {
+	b.WriteString(field(tag, value))
+}
+
+func parseFields(text string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for len(text) > 0 {
+		if len(text) < 4 {
+			return nil, fmt.Errorf("%w: truncated field", newerrors.ErrInvalidQRPayload)
+		}
+
+		length, err := strconv.Atoi(text[2:4])
+		if err != nil || length > len(text)-4 {
+			return nil, fmt.Errorf("%w: bad length of field %s", newerrors.ErrInvalidQRPayload, text[:2])
+		}
+
+		fields[text[:2]] = text[4 : 4+length]
+		text = text[4+length:]
+	}
+
+	return fields, nil
+}
+
+// formatAmount writes minor units as a decimal with two fraction digits.
+func formatAmount(amount int64) string {
+	return fmt.Sprintf("%d.%02d", amount/100, amount%100)
+}
+
+func parseAmount(value string) (int64, error) {
+	whole, fraction := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		whole, fraction = value[:i], value[i+1:]
+	}
+	if len(fraction) > 2 {
+		return 0, fmt.Errorf("%w: bad amount %s", newerrors.ErrInvalidQRPayload, value)
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units < 0 {
+		return 0, fmt.Errorf("%w: bad amount %s", newerrors.ErrInvalidQRPayload, value)
+	}
+	minor, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil || minor < 0 {
+		return 0, fmt.Errorf("%w: bad amount %s", newerrors.ErrInvalidQRPayload, value)
+	}
+
+	return units*100 + minor, nil
+}
+
+func alphaCurrency(numeric string) string {
+	for code, number := range numericCurrencies {
+		if number == numeric {
+			return code
+		}
+	}
+
+	return ""
+}
+
+// truncate cuts the text to at most max bytes without splitting a character.
+func truncate(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+
+	for max > 0 && !isRuneStart(text[max]) {
+		max--
+	}
+
+	return text[:max]
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// crc16 is CRC-16/CCITT-FALSE, the checksum EMVCo payloads use.
+func crc16(text string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(text); i++ {
+		crc ^= uint16(text[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,197 @@
+package emv
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+)
+
+func TestCRC16(t *testing.T) {
+	tests := []struct {
+		text string
+		want uint16
+	}{
+		{"", 0xFFFF},
+		{"123456789", 0x29B1},
+		{"A", 0xB915},
+	}
+
+	for _, tt := range tests {
+		if got := crc16(tt.text); got != tt.want {
+			t.Errorf("crc16(%q) = %04X, want %04X", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeParse(t *testing.T) {
+	base := Payload{
+		GUID:         "uz.alif.pay",
+		MerchantID:   "3f1c6b2e-8d2a-4c8e-9a55-0b7c2f6d1e90",
+		Name:         "Coffee House",
+		City:         "Tashkent",
+		Country:      "UZ",
+		CategoryCode: "5999",
+		Currency:     "UZS",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(p *Payload)
+		want   func(p *Payload)
+	}{
+		{
+			name:   "static",
+			modify: func(p *Payload) {},
+		},
+		{
+			name: "dynamic with reference",
+			modify: func(p *Payload) {
+				p.Amount = 1250050
+				p.Reference = "ORDER-42"
+			},
+		},
+		{
+			name: "amount below one unit",
+			modify: func(p *Payload) {
+				p.Amount = 7
+			},
+		},
+		{
+			name: "other currency",
+			modify: func(p *Payload) {
+				p.Currency = "USD"
+				p.Amount = 100
+			},
+		},
+		{
+			name: "long name is cut on a character boundary",
+			modify: func(p *Payload) {
+				p.Name = "Чайхана у самого синего моря"
+			},
+			want: func(p *Payload) {
+				p.Name = "Чайхана у сам"
+			},
+		},
+		{
+			name: "long city is cut",
+			modify: func(p *Payload) {
+				p.City = "Tashkent Region North"
+			},
+			want: func(p *Payload) {
+				p.City = "Tashkent Region"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := base
+			tt.modify(&payload)
+
+			text, err := payload.Encode()
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			got, err := Parse(text)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", text, err)
+			}
+
+			want := payload
+			if tt.want != nil {
+				tt.want(&want)
+			}
+			if got != want {
+				t.Errorf("Parse(Encode()) = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestEncodeUnsupportedCurrency(t *testing.T) {
+	_, err := Payload{MerchantID: "m", Currency: "XYZ"}.Encode()
+	if !errors.Is(err, newerrors.ErrUnsupportedCurrency) {
+		t.Errorf("Encode() error = %v, want %v", err, newerrors.ErrUnsupportedCurrency)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	valid, err := Payload{
+		GUID:       "uz.alif.pay",
+		MerchantID: "merchant",
+		Name:       "Shop",
+		City:       "Tashkent",
+		Country:    "UZ",
+		Currency:   "UZS",
+		Amount:     500,
+	}.Encode()
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	// withChecksum replaces the checksum of the text with the right one.
+	withChecksum := func(text string) string {
+		body := text[:len(text)-4]
+		return body + fmt.Sprintf("%04X", crc16(body))
+	}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"no checksum", valid[:len(valid)-8]},
+		{"checksum mismatch", valid[:len(valid)-1] + "0"},
+		{"tampered amount", strings.Replace(valid, "54045.00", "54049.00", 1)},
+		{"checksum not hex", valid[:len(valid)-4] + "ZZZZ"},
+		{"unknown format", withChecksum("000202" + valid[6:])},
+		{"truncated field", withChecksum("00020101" + "6304" + "0000")},
+		{"bad length", withChecksum("000201" + "5999" + "6304" + "0000")},
+		{"no merchant", withChecksum("000201" + "5303860" + "6304" + "0000")},
+		{"unknown currency", withChecksum("000201" + "26120108merchant" + "5303999" + "6304" + "0000")},
+		{"bad amount", withChecksum("000201" + "26120108merchant" + "5303860" + "54051.234" + "6304" + "0000")},
+		{"negative amount", withChecksum("000201" + "26120108merchant" + "5303860" + "5403-10" + "6304" + "0000")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.text); !errors.Is(err, newerrors.ErrInvalidQRPayload) {
+				t.Errorf("Parse(%q) error = %v, want %v", tt.text, err, newerrors.ErrInvalidQRPayload)
+			}
+		})
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"12", 1200, false},
+		{"12.5", 1250, false},
+		{"12.05", 1205, false},
+		{"0.99", 99, false},
+		{"12.", 1200, false},
+		{"12.345", 0, true},
+		{"abc", 0, true},
+		{"-1", 0, true},
+		{"1.-5", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseAmount(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAmount(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAmount(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+)
+
+// Event types
+const (
+	BalanceChanged = "balance.changed"
+	AccountCreated = "account.created"
+	Notification   = "notification"
+	// OperationPrefix is followed by the operation type, e.g. "operation.income"
+	OperationPrefix = "operation."
+)
+
+// subscriptionBuffer is how many events a slow subscriber may lag behind before
+// events are dropped for it. A dropped stream can be resumed from the last event ID.
+const subscriptionBuffer = 64
+
+const (
+	// publishLock is the advisory lock publishers take turns with, so event IDs
+	// are committed in order and readers never skip one
+	publishLock = 7261002
+	// channel wakes up the instances when an event was published
+	channel = "events"
+	// pollInterval is how often events are looked for when no notification came
+	pollInterval = time.Second
+	readBatch    = 500
+	// pruneBatch caps the old events deleted at once
+	pruneBatch = 1000
+)
+
+var (
+	onceBus     sync.Once
+	instanceBus *Bus
+)
+
+// Event is something that happened to a user's wallet.
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	UserID    string      `json:"user_id"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type eventRow struct {
+	ID        uint64    `db:"id"`
+	Type      string    `db:"type"`
+	UserID    string    `db:"user_id"`
+	Data      []byte    `db:"data"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func (row eventRow) event() Event {
+	return Event{
+		ID:        row.ID,
+		Type:      row.Type,
+		UserID:    row.UserID,
+		Data:      json.RawMessage(row.Data),
+		CreatedAt: row.CreatedAt,
+	}
+}
+
+const selectEvents = `SELECT id, type, user_id, data, created_at FROM events`
+
+// Subscription receives published events until it is closed.
+type Subscription struct {
+	bus    *Bus
+	userID string
+	events chan Event
+}
+
+// Events ...
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close stops the subscription.
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+// Bus delivers events to the subscribers of all gateway instances. Published
+// events are stored in the shared database, every instance reads them back in
+// the order of their IDs and hands them to its own subscribers, so publishers
+// never wait for subscribers.
+type Bus struct {
+	db          *sqlx.DB
+	historySize int
+	// historyTTL is how long published events are kept
+	historyTTL time.Duration
+
+	mu sync.Mutex
+	// cursor is the last event handed to the subscribers of the instance
+	cursor      uint64
+	subscribers map[*Subscription]struct{}
+	wake        chan struct{}
+	startOnce   sync.Once
+}
+
+// Service returns the event bus shared by the gateway.
+func Service() *Bus {
+	onceBus.Do(func() {
+		cfg := config.Config()
+		instanceBus = NewBus(database.Service(), cfg.EventHistorySize, time.Second*time.Duration(cfg.EventHistoryTTL))
+	})
+
+	return instanceBus
+}
+
+// NewBus ...
+func NewBus(db *sqlx.DB, historySize int, historyTTL time.Duration) *Bus {
+	return &Bus{
+		db:          db,
+		historySize: historySize,
+		historyTTL:  historyTTL,
+		subscribers: make(map[*Subscription]struct{}),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Publish stores the event for the subscribers of every instance. The event
+// is what already happened, so a failure is logged and not returned.
+func (b *Bus) Publish(ctx context.Context, userID, eventType string, data interface{}) Event {
+	event := Event{Type: eventType, UserID: userID, Data: data}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logger.Error(ctx, "Error while encoding an event", logger.Any("type", eventType), logger.Err(err))
+		return event
+	}
+
+	err = database.InTx(ctx, b.db, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, publishLock); err != nil {
+			return err
+		}
+
+		err := tx.QueryRowxContext(ctx, `
+			INSERT INTO events (user_id, type, data) VALUES ($1, $2, $3)
+			RETURNING id, created_at`, userID, eventType, payload).Scan(&event.ID, &event.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `SELECT pg_notify($1, '')`, channel)
+		return err
+	})
+	if err != nil {
+		logger.Error(ctx, "Error while publishing an event", logger.Any("type", eventType), logger.Err(err))
+		return event
+	}
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+
+	return event
+}
+
+// Subscribe starts receiving the user's events. The last events published
+// after lastID are returned, up to the history size, so a stream can be
+// resumed on any instance.
+func (b *Bus) Subscribe(ctx context.Context, userID string, lastID uint64) (*Subscription, []Event, error) {
+	b.startOnce.Do(b.start)
+
+	b.mu.Lock()
+	sub := &Subscription{
+		bus:    b,
+		userID: userID,
+		events: make(chan Event, subscriptionBuffer),
+	}
+	b.subscribers[sub] = struct{}{}
+	// Events after the cursor reach the subscription, the ones up to it are read here.
+	cursor := b.cursor
+	b.mu.Unlock()
+
+	if lastID == 0 || lastID >= cursor {
+		return sub, nil, nil
+	}
+
+	var rows []eventRow
+	err := b.db.SelectContext(ctx, &rows, selectEvents+`
+		WHERE user_id = $1 AND id > $2 AND id <= $3 ORDER BY id DESC LIMIT $4`, userID, lastID, cursor, b.historySize)
+	if err != nil {
+		sub.Close()
+		return nil, nil, err
+	}
+
+	missed := make([]Event, 0, len(rows))
+	for i := len(rows) - 1; i >= 0; i-- {
+		missed = append(missed, rows[i].event())
+	}
+
+	return sub, missed, nil
+}
+
+// Consume hands the events after the consumer's last one to fn and moves the
+// consumer past them in the same transaction, so the events are handled once
+// even with several instances. A new consumer starts with the events published
+// after it was created. It returns how many events were handed over, none when
+// another instance is consuming.
+func (b *Bus) Consume(ctx context.Context, consumer string, limit int, fn func(tx *sqlx.Tx, events []Event) error) (int, error) {
+	var count int
+	err := database.InTx(ctx, b.db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO event_consumers (name, last_event_id)
+			SELECT $1, COALESCE(max(id), 0) FROM events
+			ON CONFLICT (name) DO NOTHING`, consumer)
+		if err != nil {
+			return err
+		}
+
+		var lastID uint64
+		err = tx.GetContext(ctx, &lastID, `
+			SELECT last_event_id FROM event_consumers WHERE name = $1 FOR UPDATE SKIP LOCKED`, consumer)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var rows []eventRow
+		if err := tx.SelectContext(ctx, &rows, selectEvents+` WHERE id > $1 ORDER BY id LIMIT $2`, lastID, limit); err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		events := make([]Event, 0, len(rows))
+		for _, row := range rows {
+			events = append(events, row.event())
+		}
+		if err := fn(tx, events); err != nil {
+			return err
+		}
+		count = len(events)
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE event_consumers SET last_event_id = $2, updated_at = now() WHERE name = $1`,
+			consumer, events[len(events)-1].ID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// start hands the events published from now on to the subscribers of the instance.
+func (b *Bus) start() {
+	ctx := context.Background()
+
+	var cursor uint64
+	if err := b.db.GetContext(ctx, &cursor, `SELECT COALESCE(max(id), 0) FROM events`); err != nil {
+		logger.Error(ctx, "Error while reading the last event", logger.Err(err))
+	}
+
+	b.mu.Lock()
+	b.cursor = cursor
+	b.mu.Unlock()
+
+	go b.run(ctx)
+}
+
+// run hands new events to the subscribers of the instance. It wakes up on
+// notifications of the other instances, on own publishes and every poll
+// interval in case a notification was missed.
+func (b *Bus) run(ctx context.Context) {
+	var notifications <-chan *pq.Notification
+	url, _ := utils.ConnectionURLBuilder("postgres")
+	listener := pq.NewListener(url, time.Second, time.Minute, nil)
+	if err := listener.Listen(channel); err != nil {
+		logger.Warn(ctx, "Could not listen to event notifications, polling for events", logger.Err(err))
+	} else {
+		notifications = listener.NotificationChannel()
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	pruned := time.Now()
+	for {
+		select {
+		case <-notifications:
+		case <-b.wake:
+		case <-ticker.C:
+		}
+
+		b.fanOut(ctx)
+
+		if now := time.Now(); now.Sub(pruned) >= pollInterval*60 {
+			pruned = now
+			b.prune(ctx)
+		}
+	}
+}
+
+// fanOut hands the events after the cursor to the subscribers of their users.
+func (b *Bus) fanOut(ctx context.Context) {
+	for {
+		b.mu.Lock()
+		cursor := b.cursor
+		b.mu.Unlock()
+
+		var rows []eventRow
+		if err := b.db.SelectContext(ctx, &rows, selectEvents+` WHERE id > $1 ORDER BY id LIMIT $2`, cursor, readBatch); err != nil {
+			logger.Error(ctx, "Error while reading events", logger.Err(err))
+			return
+		}
+
+		b.mu.Lock()
+		for _, row := range rows {
+			event := row.event()
+			for sub := range b.subscribers {
+				if sub.userID != event.UserID {
+					continue
+				}
+
+				select {
+				case sub.events <- event:
+				default:
+				}
+			}
+			b.cursor = event.ID
+		}
+		b.mu.Unlock()
+
+		if len(rows) < readBatch {
+			return
+		}
+	}
+}
+
+// prune deletes the events older than the history TTL.
+func (b *Bus) prune(ctx context.Context) {
+	if b.historyTTL <= 0 {
+		return
+	}
+
+	_, err := b.db.ExecContext(ctx, `
+		DELETE FROM events WHERE id IN (
+			SELECT id FROM events WHERE created_at < now() - $1 * interval '1 second' LIMIT $2
+		)`, b.historyTTL.Seconds(), pruneBatch)
+	if err != nil {
+		logger.Error(ctx, "Error while pruning events", logger.Err(err))
+	}
+}
+
+func (b *Bus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subscribers, sub)
+}
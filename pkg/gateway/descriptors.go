@@ -0,0 +1,179 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	// registers the google.api.http option, so it is read from loaded descriptors
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+)
+
+// Chain looks a name up in each of its descriptors in turn.
+type Chain []Descriptors
+
+// FindDescriptorByName ...
+func (c Chain) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	for _, descriptors := range c {
+		if descriptor, err := descriptors.FindDescriptorByName(name); err == nil {
+			return descriptor, nil
+		}
+	}
+
+	return nil, protoregistry.NotFound
+}
+
+// LoadDescriptorSets reads FileDescriptorSet files, as written by
+// protoc --include_imports --descriptor_set_out.
+func LoadDescriptorSets(paths []string) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var part descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &part); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		set.File = append(set.File, part.File...)
+	}
+
+	return newFiles(set.File)
+}
+
+// Reflect fetches the descriptors of all services of the upstream through gRPC
+// server reflection.
+func Reflect(ctx context.Context, conn grpc.ClientConnInterface) (*protoregistry.Files, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	response, err := reflectionCall(stream, &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	for _, service := range response.GetListServicesResponse().GetService() {
+		if strings.HasPrefix(service.GetName(), "grpc.reflection.") {
+			continue
+		}
+
+		response, err := reflectionCall(stream, &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service.GetName()},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %s", service.GetName(), err)
+		}
+		if err := addFiles(files, response); err != nil {
+			return nil, err
+		}
+	}
+
+	// Servers may leave dependencies out, ask for them until none is missing.
+	for {
+		missing := ""
+		for _, file := range files {
+			for _, dependency := range file.GetDependency() {
+				if files[dependency] == nil {
+					missing = dependency
+				}
+			}
+		}
+		if missing == "" {
+			break
+		}
+
+		response, err := reflectionCall(stream, &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: missing},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("file %s: %s", missing, err)
+		}
+		if err := addFiles(files, response); err != nil {
+			return nil, err
+		}
+		if files[missing] == nil {
+			return nil, fmt.Errorf("file %s: not returned by the server", missing)
+		}
+	}
+
+	list := make([]*descriptorpb.FileDescriptorProto, 0, len(files))
+	for _, file := range files {
+		list = append(list, file)
+	}
+
+	return newFiles(list)
+}
+
+func reflectionCall(stream rpb.ServerReflection_ServerReflectionInfoClient, request *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+	if err := stream.Send(request); err != nil {
+		return nil, err
+	}
+
+	response, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	if e := response.GetErrorResponse(); e != nil {
+		return nil, fmt.Errorf("reflection error %d: %s", e.GetErrorCode(), e.GetErrorMessage())
+	}
+
+	return response, nil
+}
+
+func addFiles(files map[string]*descriptorpb.FileDescriptorProto, response *rpb.ServerReflectionResponse) error {
+	for _, data := range response.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		file := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(data, file); err != nil {
+			return err
+		}
+		files[file.GetName()] = file
+	}
+
+	return nil
+}
+
+// newFiles builds a registry of the files. Well-known files the gateway is
+// built with, like google/api/http.proto, are taken from the global registry
+// when the set does not carry them.
+func newFiles(list []*descriptorpb.FileDescriptorProto) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{File: list}
+
+	known := make(map[string]bool, len(list))
+	for _, file := range list {
+		known[file.GetName()] = true
+	}
+	for _, file := range list {
+		for _, dependency := range file.GetDependency() {
+			if known[dependency] {
+				continue
+			}
+
+			descriptor, err := protoregistry.GlobalFiles.FindFileByPath(dependency)
+			if err != nil {
+				return nil, fmt.Errorf("file %s: dependency %s not found", file.GetName(), dependency)
+			}
+			set.File = append(set.File, protodesc.ToFileDescriptorProto(descriptor))
+			known[dependency] = true
+		}
+	}
+
+	return protodesc.NewFiles(set)
+}
@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// findField finds a field by its dotted path, like address.city.
+func findField(message protoreflect.MessageDescriptor, path string) (protoreflect.FieldDescriptor, error) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		field := message.Fields().ByName(protoreflect.Name(name))
+		if field == nil {
+			field = message.Fields().ByJSONName(name)
+		}
+		if field == nil {
+			return nil, fmt.Errorf("%s has no field %s", message.FullName(), name)
+		}
+
+		if i == len(names)-1 {
+			return field, nil
+		}
+
+		if field.Message() == nil || field.IsList() || field.IsMap() {
+			return nil, fmt.Errorf("field %s of %s is not a message", name, message.FullName())
+		}
+		message = field.Message()
+	}
+
+	return nil, fmt.Errorf("empty field path")
+}
+
+// mutableParent returns the message holding the last field of the path,
+// creating the messages on the way.
+func mutableParent(message protoreflect.ProtoMessage, path string) protoreflect.Message {
+	parent := message.ProtoReflect()
+
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		field, _ := findField(parent.Descriptor(), name)
+		parent = parent.Mutable(field).Message()
+	}
+
+	return parent
+}
+
+// setField parses the text into the scalar field of the path. A repeated field gets the value appended.
+func setField(message protoreflect.ProtoMessage, path, text string) error {
+	field, err := findField(message.ProtoReflect().Descriptor(), path)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseScalar(field, text)
+	if err != nil {
+		return fmt.Errorf("%s: bad %s value '%s'", path, field.Kind(), text)
+	}
+
+	parent := mutableParent(message, path)
+	if field.IsList() {
+		parent.Mutable(field).List().Append(value)
+		return nil
+	}
+	parent.Set(field, value)
+
+	return nil
+}
+
+func parseScalar(field protoreflect.FieldDescriptor, text string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(text), nil
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(text)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(text, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(text, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(text, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(text, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(text, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(text, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.BytesKind:
+		v, err := base64.StdEncoding.DecodeString(text)
+		return protoreflect.ValueOfBytes(v), err
+	case protoreflect.EnumKind:
+		if value := field.Enum().Values().ByName(protoreflect.Name(text)); value != nil {
+			return protoreflect.ValueOfEnum(value.Number()), nil
+		}
+		v, err := strconv.ParseInt(text, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), err
+	}
+
+	return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", field.Kind())
+}
@@ -0,0 +1,241 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/middleware"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+)
+
+var (
+	unmarshalOptions = protojson.UnmarshalOptions{DiscardUnknown: true}
+	marshalOptions   = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+)
+
+// Descriptors finds proto descriptors by their full name, like protoregistry.Files.
+type Descriptors interface {
+	FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error)
+}
+
+// Upstreams finds connections of upstreams by their name.
+type Upstreams interface {
+	Conn(name string) (grpc.ClientConnInterface, error)
+}
+
+// Gateway builds handlers calling upstream methods described by Descriptors.
+type Gateway struct {
+	upstreams   Upstreams
+	descriptors Descriptors
+}
+
+type errorResponse struct {
+	ErrorMessage string `json:"error_message"`
+}
+
+// New returns a gateway calling methods of the upstreams.
+func New(upstreams Upstreams, descriptors Descriptors) *Gateway {
+	return &Gateway{
+		upstreams:   upstreams,
+		descriptors: descriptors,
+	}
+}
+
+// Register adds handlers of the routes to the router.
+func (g *Gateway) Register(router fiber.Router, routes []*Route) error {
+	for _, route := range routes {
+		handler, err := g.Handler(route)
+		if err != nil {
+			return fmt.Errorf("route %s %s: %s", route.Method, route.Path, err)
+		}
+
+		router.Add(route.Method, route.Path, handler)
+	}
+
+	return nil
+}
+
+// Handler builds the handler of the route. The method and the mapped fields are
+// checked here, so a wrong route fails at startup instead of on a request.
+func (g *Gateway) Handler(route *Route) (fiber.Handler, error) {
+	conn, err := g.upstreams.Conn(route.Upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	method, err := g.method(route.Service, route.RPC)
+	if err != nil {
+		return nil, err
+	}
+	input := method.Input()
+
+	if route.Body != "" && route.Body != BodyAll {
+		field, err := findField(input, route.Body)
+		if err != nil {
+			return nil, err
+		}
+		if field.Message() == nil || field.IsList() || field.IsMap() {
+			return nil, fmt.Errorf("body field %s is not a message", route.Body)
+		}
+	}
+
+	fields := make([]string, 0, len(route.Query)+len(route.Params)+1)
+	for field := range route.Query {
+		fields = append(fields, field)
+	}
+	for field := range route.Params {
+		fields = append(fields, field)
+	}
+	if route.UserID != "" {
+		fields = append(fields, route.UserID)
+	}
+	for _, path := range fields {
+		field, err := findField(input, path)
+		if err != nil {
+			return nil, err
+		}
+		if field.Message() != nil || field.IsMap() {
+			return nil, fmt.Errorf("field %s is not a scalar", path)
+		}
+	}
+
+	// Calls are made with the request context, routes without their own
+	// timeout keep its deadline.
+	return func(c *fiber.Ctx) error {
+		request, err := buildRequest(c, route, input)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(errorResponse{
+				ErrorMessage: err.Error(),
+			})
+		}
+
+		if route.timeout > 0 {
+			middleware.SetDeadline(c, route.timeout)
+		}
+
+		response := dynamicpb.NewMessage(method.Output())
+		if err := conn.Invoke(c.UserContext(), route.FullMethod(), request, response); err != nil {
+			return upstreamError(c, route, err)
+		}
+
+		body, err := marshalOptions.Marshal(response)
+		if err != nil {
+			logger.Error(c.UserContext(), "Error while encoding an upstream response", logger.Err(err), logger.Any("method", route.FullMethod()))
+			return c.Status(http.StatusInternalServerError).JSON(errorResponse{
+				ErrorMessage: "Internal Server Error",
+			})
+		}
+
+		c.Type("json")
+		return c.Status(http.StatusOK).Send(body)
+	}, nil
+}
+
+func (g *Gateway) method(service, rpc string) (protoreflect.MethodDescriptor, error) {
+	descriptor, err := g.descriptors.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %s", service, err)
+	}
+
+	serviceDescriptor, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+
+	method := serviceDescriptor.Methods().ByName(protoreflect.Name(rpc))
+	if method == nil {
+		return nil, fmt.Errorf("service %s has no method %s", service, rpc)
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return nil, fmt.Errorf("method %s is streaming, only unary methods are supported", rpc)
+	}
+
+	return method, nil
+}
+
+// buildRequest fills the request from the body, the path and query parameters
+// and the token, in this order, so the user ID can not be overwritten.
+func buildRequest(c *fiber.Ctx, route *Route, input protoreflect.MessageDescriptor) (*dynamicpb.Message, error) {
+	request := dynamicpb.NewMessage(input)
+
+	if body := c.Body(); route.Body != "" && len(body) > 0 {
+		target := request.ProtoReflect()
+		if route.Body != BodyAll {
+			field, _ := findField(input, route.Body)
+			target = mutableParent(request, route.Body).Mutable(field).Message()
+		}
+
+		if err := unmarshalOptions.Unmarshal(body, target.Interface()); err != nil {
+			return nil, fmt.Errorf("body: %s", err)
+		}
+	}
+
+	for _, field := range sortedKeys(route.Params) {
+		if err := setField(request, field, c.Params(route.Params[field])); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, field := range sortedKeys(route.Query) {
+		value := c.Query(route.Query[field])
+		if value == "" {
+			continue
+		}
+		if err := setField(request, field, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if route.UserID != "" {
+		user, err := utils.ExtractTokenMetadata(c)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to extract id from token")
+		}
+
+		if err := setField(request, route.UserID, user.UserID.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	return request, nil
+}
+
+func upstreamError(c *fiber.Ctx, route *Route, err error) error {
+	st, _ := status.FromError(err)
+
+	mapping, ok := route.errors[st.Code()]
+	if !ok {
+		logger.Error(c.UserContext(), "Error while calling an upstream", logger.Err(err), logger.Any("method", route.FullMethod()))
+		return c.Status(http.StatusInternalServerError).JSON(errorResponse{
+			ErrorMessage: "Internal Server Error",
+		})
+	}
+
+	message := mapping.Message
+	if message == "" {
+		message = st.Message()
+	}
+
+	return c.Status(mapping.Status).JSON(errorResponse{
+		ErrorMessage: message,
+	})
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,189 @@
+// Package gateway builds HTTP handlers for upstream gRPC methods from routes
+// declared in a YAML file, so exposing an RPC needs no handler code.
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// BodyAll maps the whole request body onto the RPC request.
+	BodyAll = "*"
+	// DefaultUpstream is called by routes not naming their upstream.
+	DefaultUpstream = "user"
+)
+
+// File is the layout of the routes file.
+type File struct {
+	Routes []*Route `yaml:"routes"`
+}
+
+// Route exposes an upstream RPC over HTTP.
+//
+//	routes:
+//	  - method: GET
+//	    path: /api/user/type/
+//	    service: user.UserService
+//	    rpc: CheckUserType
+//	    user_id: user_id
+//	    roles: [user]
+type Route struct {
+	Method string `yaml:"method"`
+	// Path is the full HTTP path, with fiber parameters like :id
+	Path string `yaml:"path"`
+	// Upstream is the name of the upstream serving the RPC, user by default
+	Upstream string `yaml:"upstream"`
+	// Service is the full proto name of the upstream service, like user.UserService
+	Service string `yaml:"service"`
+	RPC     string `yaml:"rpc"`
+	// Body is the request field the JSON body is decoded into, "*" for the
+	// whole request and empty when the body is not read
+	Body string `yaml:"body"`
+	// Query maps request fields to query parameters. Fields of nested messages
+	// are written with dots, like address.city
+	Query map[string]string `yaml:"query"`
+	// Params maps request fields to path parameters
+	Params map[string]string `yaml:"params"`
+	// UserID is the request field the ID of the token's user is put into
+	UserID string `yaml:"user_id"`
+	// Timeout of the request, like 5s. CTX_TIMEOUT is used when empty
+	Timeout string `yaml:"timeout"`
+	// Roles allowed to call the route, added to the casbin policies
+	Roles []string `yaml:"roles"`
+	// Errors maps gRPC code names, like NotFound, to the HTTP response
+	Errors map[string]ErrorMapping `yaml:"errors"`
+
+	timeout time.Duration
+	errors  map[codes.Code]ErrorMapping
+}
+
+// ErrorMapping is the HTTP response of an upstream error code. Empty message
+// passes the upstream message on.
+type ErrorMapping struct {
+	Status  int    `yaml:"status"`
+	Message string `yaml:"message"`
+}
+
+// defaultErrors follow how the handlers of the gateway answer upstream errors.
+var defaultErrors = map[codes.Code]ErrorMapping{
+	codes.InvalidArgument:    {Status: http.StatusBadRequest},
+	codes.FailedPrecondition: {Status: http.StatusBadRequest},
+	codes.OutOfRange:         {Status: http.StatusBadRequest},
+	codes.PermissionDenied:   {Status: http.StatusBadRequest, Message: "Permission Denied"},
+	codes.NotFound:           {Status: http.StatusNotFound},
+	codes.AlreadyExists:      {Status: http.StatusConflict},
+	codes.Unauthenticated:    {Status: http.StatusUnauthorized},
+	codes.ResourceExhausted:  {Status: http.StatusTooManyRequests},
+	codes.DeadlineExceeded:   {Status: http.StatusGatewayTimeout, Message: "Upstream did not answer in time"},
+	codes.Unavailable:        {Status: http.StatusServiceUnavailable, Message: "Upstream is unavailable"},
+}
+
+// codeNames maps gRPC code names to codes.
+var codeNames = func() map[string]codes.Code {
+	names := make(map[string]codes.Code)
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		names[code.String()] = code
+	}
+
+	return names
+}()
+
+// LoadRoutes reads and checks the routes file.
+func LoadRoutes(path string) ([]*Route, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file File
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, route := range file.Routes {
+		if err := route.check(); err != nil {
+			return nil, fmt.Errorf("route %s %s: %s", route.Method, route.Path, err)
+		}
+
+		key := route.Method + " " + route.Path
+		if seen[key] {
+			return nil, fmt.Errorf("route %s: declared twice", key)
+		}
+		seen[key] = true
+	}
+
+	return file.Routes, nil
+}
+
+// FullMethod is the gRPC method name of the route, like /user.UserService/GetBalance.
+func (r *Route) FullMethod() string {
+	return "/" + r.Service + "/" + r.RPC
+}
+
+// Policies are the casbin policies letting the route's roles call it.
+func (r *Route) Policies() [][]string {
+	policies := make([][]string, 0, len(r.Roles))
+	for _, role := range r.Roles {
+		policies = append(policies, []string{role, r.Path, r.Method})
+	}
+
+	return policies
+}
+
+func (r *Route) check() error {
+	r.Method = strings.ToUpper(r.Method)
+	switch r.Method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return fmt.Errorf("unsupported method")
+	}
+
+	if !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	if r.Service == "" || r.RPC == "" {
+		return fmt.Errorf("service and rpc are required")
+	}
+	if r.Upstream == "" {
+		r.Upstream = DefaultUpstream
+	}
+
+	for field, param := range r.Params {
+		if !strings.Contains(r.Path, ":"+param) {
+			return fmt.Errorf("field %s: path has no parameter %s", field, param)
+		}
+	}
+
+	if r.Timeout != "" {
+		timeout, err := time.ParseDuration(r.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("bad timeout %s", r.Timeout)
+		}
+		r.timeout = timeout
+	}
+
+	r.errors = make(map[codes.Code]ErrorMapping, len(defaultErrors)+len(r.Errors))
+	for code, mapping := range defaultErrors {
+		r.errors[code] = mapping
+	}
+	for name, mapping := range r.Errors {
+		code, ok := codeNames[name]
+		if !ok {
+			return fmt.Errorf("unknown error code %s", name)
+		}
+		if mapping.Status < 400 || mapping.Status > 599 {
+			return fmt.Errorf("error %s: status must be 4xx or 5xx", name)
+		}
+		r.errors[code] = mapping
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Transcoding builds routes from the google.api.http annotations of methods:
+//
+//	rpc GetBalance(GetBalanceRequest) returns (Balance) {
+//	  option (google.api.http) = { get: "/v1/users/{user_id}/balance" };
+//	}
+//
+// Path variables become path parameters, the body is decoded into the field
+// named by the rule and, unless the rule takes the whole body, the other
+// scalar fields of the request are read from query parameters of the same name.
+type Transcoding struct {
+	// Upstream serving the methods
+	Upstream string
+	// Prefix is put before the annotated paths, like /api
+	Prefix string
+	// UserID is the request field set to the ID of the token's user, in
+	// requests having a string field of that name
+	UserID string
+	// Roles allowed to call the routes
+	Roles []string
+}
+
+// Routes builds the routes of all annotated unary methods of the files.
+// Methods without an annotation are not exposed.
+func (t Transcoding) Routes(files *protoregistry.Files) ([]*Route, error) {
+	var (
+		routes []*Route
+		err    error
+	)
+
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len() && err == nil; i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len() && err == nil; j++ {
+				var methodRoutes []*Route
+				methodRoutes, err = t.methodRoutes(methods.Get(j))
+				if err != nil {
+					err = fmt.Errorf("%s: %s", methods.Get(j).FullName(), err)
+				}
+				routes = append(routes, methodRoutes...)
+			}
+		}
+
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return routes, nil
+}
+
+func (t Transcoding) methodRoutes(method protoreflect.MethodDescriptor) ([]*Route, error) {
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return nil, nil
+	}
+
+	rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil, nil
+	}
+
+	rules := append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+	routes := make([]*Route, 0, len(rules))
+	for _, rule := range rules {
+		route, err := t.route(method, rule)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
+
+func (t Transcoding) route(method protoreflect.MethodDescriptor, rule *annotations.HttpRule) (*Route, error) {
+	var httpMethod, template string
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		httpMethod, template = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Post:
+		httpMethod, template = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Put:
+		httpMethod, template = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Patch:
+		httpMethod, template = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Delete:
+		httpMethod, template = http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Custom:
+		httpMethod, template = pattern.Custom.GetKind(), pattern.Custom.GetPath()
+	default:
+		return nil, fmt.Errorf("http rule has no pattern")
+	}
+
+	path, params, err := parseTemplate(template)
+	if err != nil {
+		return nil, fmt.Errorf("path %s: %s", template, err)
+	}
+
+	route := &Route{
+		Method:   httpMethod,
+		Path:     strings.TrimSuffix(t.Prefix, "/") + path,
+		Upstream: t.Upstream,
+		Service:  string(method.Parent().FullName()),
+		RPC:      string(method.Name()),
+		Body:     rule.GetBody(),
+		Params:   params,
+		Query:    make(map[string]string),
+		Roles:    t.Roles,
+	}
+
+	input := method.Input()
+	if t.UserID != "" {
+		if field := input.Fields().ByName(protoreflect.Name(t.UserID)); field != nil &&
+			field.Kind() == protoreflect.StringKind && !field.IsList() {
+			route.UserID = t.UserID
+		}
+	}
+
+	if route.Body != BodyAll {
+		fields := input.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			field := fields.Get(i)
+			name := string(field.Name())
+			if field.Message() != nil || field.IsMap() || name == route.Body || name == route.UserID {
+				continue
+			}
+			if _, ok := params[name]; ok {
+				continue
+			}
+			route.Query[name] = name
+		}
+	}
+
+	if err := route.check(); err != nil {
+		return nil, fmt.Errorf("route %s %s: %s", route.Method, route.Path, err)
+	}
+
+	return route, nil
+}
+
+// parseTemplate turns an http rule path template into a fiber path and the
+// mapping of request fields to its parameters. Variables matching a single
+// segment, {id} or {id=*}, are supported.
+func parseTemplate(template string) (string, map[string]string, error) {
+	if !strings.HasPrefix(template, "/") {
+		return "", nil, fmt.Errorf("must start with /")
+	}
+
+	params := make(map[string]string)
+	var path strings.Builder
+	for rest := template; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			if strings.Contains(rest, ":") {
+				return "", nil, fmt.Errorf("custom verbs are not supported")
+			}
+			path.WriteString(rest)
+			break
+		}
+		if strings.Contains(rest[:open], ":") {
+			return "", nil, fmt.Errorf("custom verbs are not supported")
+		}
+		path.WriteString(rest[:open])
+
+		end := strings.IndexByte(rest, '}')
+		if end < open {
+			return "", nil, fmt.Errorf("unclosed variable")
+		}
+
+		field, pattern := rest[open+1:end], "*"
+		if i := strings.IndexByte(field, '='); i >= 0 {
+			field, pattern = field[:i], field[i+1:]
+		}
+		if field == "" || pattern != "*" {
+			return "", nil, fmt.Errorf("variable {%s} must match a single segment", rest[open+1:end])
+		}
+
+		param := strings.ReplaceAll(field, ".", "_")
+		params[field] = param
+		path.WriteString(":" + param)
+
+		rest = rest[end+1:]
+	}
+
+	return path.String(), params, nil
+}
@@ -0,0 +1,131 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+)
+
+// ShutdownCheck is the check failing once the gateway started shutting down.
+const ShutdownCheck = "shutdown"
+
+var (
+	onceHealth     sync.Once
+	instanceHealth *Checker
+)
+
+// Check returns an error when a dependency of the gateway can not serve requests.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check, Error is empty when it passed.
+type Result struct {
+	Name  string
+	Error string
+}
+
+// Report is the readiness of the gateway, ready when all the checks passed.
+type Report struct {
+	Ready     bool
+	Checks    []Result
+	CheckedAt time.Time
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks and keeps their report for a short while,
+// so frequent probes do not call the upstreams on every request.
+type Checker struct {
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu       sync.Mutex
+	checks   []namedCheck
+	report   Report
+	draining bool
+}
+
+// Service returns the checker shared by the probes.
+func Service() *Checker {
+	onceHealth.Do(func() {
+		cfg := config.Config()
+
+		instanceHealth = &Checker{
+			ttl:     time.Second * time.Duration(cfg.HealthCacheTTL),
+			timeout: time.Second * time.Duration(cfg.HealthCheckTimeout),
+		}
+	})
+
+	return instanceHealth
+}
+
+// Register adds a readiness check, checks run in the order they were added.
+func (h *Checker) Register(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+	h.report = Report{}
+}
+
+// Drain makes the gateway report not ready from now on, so load balancers
+// stop sending requests before it shuts down.
+func (h *Checker) Drain() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.draining = true
+}
+
+// Ready runs the checks at the same time, each with its own timeout, unless
+// the last report is still fresh.
+func (h *Checker) Ready(ctx context.Context) Report {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.draining {
+		return Report{
+			Checks:    []Result{{Name: ShutdownCheck, Error: "server is shutting down"}},
+			CheckedAt: time.Now(),
+		}
+	}
+	if !h.report.CheckedAt.IsZero() && time.Since(h.report.CheckedAt) < h.ttl {
+		return h.report
+	}
+
+	report := Report{
+		Ready:  true,
+		Checks: make([]Result, len(h.checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			report.Checks[i].Name = check.name
+			if err := check.check(checkCtx); err != nil {
+				report.Checks[i].Error = err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Error != "" {
+			report.Ready = false
+		}
+	}
+	report.CheckedAt = time.Now()
+	h.report = report
+
+	return report
+}
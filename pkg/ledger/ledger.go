@@ -0,0 +1,487 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+)
+
+// Operation types
+const (
+	Income      = "income"
+	Expense     = "expense"
+	ExchangeIn  = "exchange_in"
+	ExchangeOut = "exchange_out"
+	Transfer    = "transfer"
+	// PaymentRequest entries move no money, they show a payment request in the history
+	PaymentRequest = "payment_request"
+	Reversal       = "reversal"
+	Refund         = "refund"
+)
+
+// Categories operations can be put in
+var Categories = []string{
+	"food",
+	"transport",
+	"shopping",
+	"bills",
+	"entertainment",
+	"health",
+	"education",
+	"transfers",
+	"salary",
+	"other",
+}
+
+// Operation directions
+const (
+	Credit = "credit"
+	Debit  = "debit"
+)
+
+var (
+	onceLedger     sync.Once
+	instanceLedger *Ledger
+)
+
+// Operation is a money movement done through the gateway.
+type Operation struct {
+	ID        string `json:"id" db:"id"`
+	UserID    string `json:"user_id" db:"user_id"`
+	Type      string `json:"type" db:"type"`
+	Direction string `json:"direction" db:"direction"`
+	Currency  string `json:"currency" db:"currency"`
+	// Amount is always positive, Direction tells whether it was added or taken
+	Amount   int64  `json:"amount" db:"amount"`
+	Merchant string `json:"merchant,omitempty" db:"merchant"`
+	// Counterparty is the other user of a transfer
+	Counterparty string `json:"counterparty,omitempty" db:"counterparty"`
+	// RequestID is the payment request the operation belongs to
+	RequestID string `json:"request_id,omitempty" db:"request_id"`
+	// Status is the state of the payment request a history entry shows
+	Status   string   `json:"status,omitempty" db:"status"`
+	Note     string   `json:"note,omitempty" db:"note"`
+	Category string   `json:"category,omitempty" db:"category"`
+	Tags     []string `json:"tags,omitempty" db:"-"`
+	Reason   string   `json:"reason,omitempty" db:"reason"`
+	// Reverses is the ID of the operation compensated by this one
+	Reverses string `json:"reverses,omitempty" db:"reverses"`
+	// LegOf is the operation this one is the other side of, like the user's
+	// expense paying a merchant for its owner's income. It is reversed with it.
+	LegOf string `json:"leg_of,omitempty" db:"leg_of"`
+	// Compensated is the part of Amount already reversed or refunded
+	Compensated   int64     `json:"compensated_amount,omitempty" db:"compensated"`
+	Compensations []string  `json:"compensations,omitempty" db:"-"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// operationRow is an operation as it is read from the database.
+type operationRow struct {
+	Operation
+	Tags          pq.StringArray `db:"tags"`
+	Compensations pq.StringArray `db:"compensations"`
+}
+
+func (row operationRow) operation() Operation {
+	op := row.Operation
+	op.Tags = append([]string(nil), row.Tags...)
+	op.Compensations = append([]string(nil), row.Compensations...)
+
+	return op
+}
+
+const selectOperations = `
+	SELECT o.id, o.user_id, o.type, o.direction, o.currency, o.amount, o.merchant,
+		o.counterparty, o.request_id, o.status, o.note, o.category, o.tags, o.reason,
+		COALESCE(o.reverses, '') AS reverses, COALESCE(o.leg_of, '') AS leg_of, o.compensated, o.created_at,
+		ARRAY(SELECT c.id FROM ledger_operations c WHERE c.reverses = o.id ORDER BY c.created_at) AS compensations
+	FROM ledger_operations o`
+
+// Ledger keeps operations in the shared database, so every gateway instance
+// sees them.
+type Ledger struct {
+	db *sqlx.DB
+}
+
+// Service returns the ledger shared by the handlers.
+func Service() *Ledger {
+	onceLedger.Do(func() {
+		instanceLedger = &Ledger{
+			db: database.Service(),
+		}
+	})
+
+	return instanceLedger
+}
+
+// Record stores the operation, giving it an ID. A compensating operation is
+// linked to the one it reverses.
+func (l *Ledger) Record(ctx context.Context, op Operation) (Operation, error) {
+	err := database.InTx(ctx, l.db, func(tx *sqlx.Tx) error {
+		var err error
+		op, err = l.RecordTx(ctx, tx, op)
+		return err
+	})
+	if err != nil {
+		return Operation{}, err
+	}
+
+	return op, nil
+}
+
+// RecordTx stores the operation within the transaction, so it is recorded
+// together with the changes it caused.
+func (l *Ledger) RecordTx(ctx context.Context, tx *sqlx.Tx, op Operation) (Operation, error) {
+	op.ID = uuid.New().String()
+	op.CreatedAt = time.Now()
+	op.Compensations = nil
+	op.Tags = append([]string(nil), op.Tags...)
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO ledger_operations (id, user_id, type, direction, currency, amount, merchant,
+			counterparty, request_id, status, note, category, tags, reason, reverses, leg_of, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
+		op.ID, op.UserID, op.Type, op.Direction, op.Currency, op.Amount, op.Merchant,
+		op.Counterparty, op.RequestID, op.Status, op.Note, op.Category, pq.StringArray(op.Tags), op.Reason,
+		nullString(op.Reverses), nullString(op.LegOf), op.CreatedAt,
+	)
+	if err != nil {
+		return Operation{}, err
+	}
+
+	if err := bumpVersion(ctx, tx, op.UserID); err != nil {
+		return Operation{}, err
+	}
+
+	if op.Reverses != "" {
+		var originalUserID string
+		err := tx.GetContext(ctx, &originalUserID, `SELECT user_id FROM ledger_operations WHERE id = $1`, op.Reverses)
+		if err != nil {
+			return Operation{}, err
+		}
+		if originalUserID != op.UserID {
+			if err := bumpVersion(ctx, tx, originalUserID); err != nil {
+				return Operation{}, err
+			}
+		}
+	}
+
+	return op, nil
+}
+
+// Get ...
+func (l *Ledger) Get(ctx context.Context, id string) (Operation, error) {
+	var row operationRow
+	err := l.db.GetContext(ctx, &row, selectOperations+` WHERE o.id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Operation{}, newerrors.ErrOperationNotFound
+	} else if err != nil {
+		return Operation{}, err
+	}
+
+	return row.operation(), nil
+}
+
+// Version changes whenever an operation of the user is recorded or changed,
+// so results computed from the user's history can tell they are stale.
+func (l *Ledger) Version(ctx context.Context, userID string) (uint64, error) {
+	var version int64
+	err := l.db.GetContext(ctx, &version, `SELECT version FROM ledger_versions WHERE user_id = $1`, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return uint64(version), nil
+}
+
+// Filter narrows the list of operations, empty fields match everything.
+type Filter struct {
+	Type     string
+	Category string
+	Tag      string
+	Merchant string
+	Currency string
+}
+
+// where returns the conditions of the filter on the operations aliased o,
+// with their arguments numbered after args.
+func (f Filter) where(args []interface{}) (string, []interface{}) {
+	var conditions []string
+	for _, condition := range []struct {
+		column string
+		value  string
+	}{
+		{"o.type = $%d", f.Type},
+		{"o.category = $%d", f.Category},
+		{"o.merchant = $%d", f.Merchant},
+		{"o.currency = $%d", f.Currency},
+		{"$%d = ANY(o.tags)", f.Tag},
+	} {
+		if condition.value == "" {
+			continue
+		}
+		args = append(args, condition.value)
+		conditions = append(conditions, fmt.Sprintf(condition.column, len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// List returns the user's operations matching the filter, newest first.
+func (l *Ledger) List(ctx context.Context, userID string, filter Filter) ([]Operation, error) {
+	where, args := filter.where([]interface{}{userID})
+
+	var rows []operationRow
+	err := l.db.SelectContext(ctx, &rows, selectOperations+` WHERE o.user_id = $1`+where+` ORDER BY o.created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	operations := make([]Operation, 0, len(rows))
+	for _, row := range rows {
+		operations = append(operations, row.operation())
+	}
+
+	return operations, nil
+}
+
+// MerchantPayments returns the users' expenses made in [from, to) which were
+// paid to the merchant's owner, oldest first. They are found through the
+// owner's incomes kept as their legs, so charges, captured holds and every
+// other way of paying the merchant are all in. Refunds show as Compensated.
+func (l *Ledger) MerchantPayments(ctx context.Context, merchantID string, from, to time.Time) ([]Operation, error) {
+	// An income is recorded after its expense, bounding it by from as well
+	// lets the merchant's incomes be found by their index.
+	var rows []operationRow
+	err := l.db.SelectContext(ctx, &rows, selectOperations+`
+		JOIN ledger_operations i ON i.leg_of = o.id
+		WHERE i.merchant = $1 AND i.type = $2 AND i.created_at >= $3
+			AND o.type = $4 AND o.created_at >= $3 AND o.created_at < $5
+		ORDER BY o.created_at`, merchantID, Income, from, Expense, to)
+	if err != nil {
+		return nil, err
+	}
+
+	operations := make([]Operation, 0, len(rows))
+	for _, row := range rows {
+		operations = append(operations, row.operation())
+	}
+
+	return operations, nil
+}
+
+// Stats sums up operations of a user.
+type Stats struct {
+	Count   int64   `db:"count"`
+	Average float64 `db:"average"`
+	Largest int64   `db:"largest"`
+	// Counterparty tells one of the operations was with the counterparty
+	Counterparty bool `db:"counterparty"`
+}
+
+// Stats sums up the user's operations of the direction matching the filter in
+// one query, without reading them.
+func (l *Ledger) Stats(ctx context.Context, userID, direction, counterparty string, filter Filter) (Stats, error) {
+	where, args := filter.where([]interface{}{userID, direction, counterparty})
+
+	var stats Stats
+	err := l.db.GetContext(ctx, &stats, `
+		SELECT count(*) AS count, COALESCE(avg(o.amount), 0)::float8 AS average,
+			COALESCE(max(o.amount), 0) AS largest,
+			COALESCE(bool_or($3 <> '' AND o.counterparty = $3), false) AS counterparty
+		FROM ledger_operations o WHERE o.user_id = $1 AND o.direction = $2`+where, args...)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return stats, nil
+}
+
+// SetCategory changes the category of the user's operation.
+func (l *Ledger) SetCategory(ctx context.Context, userID, id, category string) (Operation, error) {
+	return l.update(ctx, userID, id, `UPDATE ledger_operations SET category = $3 WHERE id = $1 AND user_id = $2`, category)
+}
+
+// SetTags replaces the tags of the user's operation.
+func (l *Ledger) SetTags(ctx context.Context, userID, id string, tags []string) (Operation, error) {
+	return l.update(ctx, userID, id, `UPDATE ledger_operations SET tags = $3 WHERE id = $1 AND user_id = $2`, pq.StringArray(tags))
+}
+
+func (l *Ledger) update(ctx context.Context, userID, id, query string, value interface{}) (Operation, error) {
+	err := database.InTx(ctx, l.db, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, query, id, userID, value)
+		if err != nil {
+			return err
+		}
+		if changed, err := result.RowsAffected(); err != nil {
+			return err
+		} else if changed == 0 {
+			return newerrors.ErrOperationNotFound
+		}
+
+		return bumpVersion(ctx, tx, userID)
+	})
+	if err != nil {
+		return Operation{}, err
+	}
+
+	return l.Get(ctx, id)
+}
+
+// Compensate books amount against the operation before the money is moved back,
+// so the same amount can not be reversed twice. Zero amount means a full reversal,
+// which is allowed only if nothing was refunded yet. Partial refunds are allowed
+// only for merchant payments. The operation's leg, if it has one, is booked and
+// returned along with it, a leg is never reversed on its own.
+func (l *Ledger) Compensate(ctx context.Context, id string, amount int64) (Operation, *Operation, error) {
+	var (
+		op  Operation
+		leg *Operation
+	)
+	err := database.InTx(ctx, l.db, func(tx *sqlx.Tx) error {
+		var row operationRow
+		err := tx.GetContext(ctx, &row, selectOperations+` WHERE o.id = $1 FOR UPDATE OF o`, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return newerrors.ErrOperationNotFound
+		} else if err != nil {
+			return err
+		}
+		op = row.operation()
+		if op.LegOf != "" {
+			return newerrors.ErrNotReversible
+		}
+
+		if err := book(ctx, tx, &op, amount); err != nil {
+			return err
+		}
+
+		var legRow operationRow
+		err = tx.GetContext(ctx, &legRow, selectOperations+` WHERE o.leg_of = $1 FOR UPDATE OF o`, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		leg = new(Operation)
+		*leg = legRow.operation()
+
+		return book(ctx, tx, leg, amount)
+	})
+	if err != nil {
+		return Operation{}, nil, err
+	}
+
+	return op, leg, nil
+}
+
+// book compensates the amount of the operation locked by the transaction.
+func book(ctx context.Context, tx *sqlx.Tx, op *Operation, amount int64) error {
+	booked, err := compensation(*op, amount)
+	if err != nil {
+		return err
+	}
+	op.Compensated += booked
+
+	_, err = tx.ExecContext(ctx, `UPDATE ledger_operations SET compensated = $2 WHERE id = $1`, op.ID, op.Compensated)
+	if err != nil {
+		return err
+	}
+
+	return bumpVersion(ctx, tx, op.UserID)
+}
+
+// Release gives back the amount booked by Compensate if the money could not
+// be moved, for the operation and its leg.
+func (l *Ledger) Release(ctx context.Context, id string, amount int64) error {
+	return database.InTx(ctx, l.db, func(tx *sqlx.Tx) error {
+		var userIDs []string
+		err := tx.SelectContext(ctx, &userIDs, `
+			UPDATE ledger_operations SET compensated = compensated - $2
+			WHERE (id = $1 OR leg_of = $1) AND compensated >= $2 RETURNING user_id`, id, amount)
+		if err != nil {
+			return err
+		}
+
+		for _, userID := range userIDs {
+			if err := bumpVersion(ctx, tx, userID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// compensation checks the amount can be booked against the operation and
+// returns the amount to book, the whole operation for a full reversal.
+func compensation(op Operation, amount int64) (int64, error) {
+	switch op.Type {
+	case Reversal, Refund, PaymentRequest:
+		return 0, newerrors.ErrNotReversible
+	case Transfer, ExchangeIn, ExchangeOut:
+		// Both legs moved money, undoing one of them would leave the other in place.
+		return 0, newerrors.ErrNotReversible
+	}
+
+	if op.Compensated >= op.Amount {
+		return 0, newerrors.ErrAlreadyReversed
+	}
+
+	if amount == 0 {
+		if op.Compensated > 0 {
+			return 0, newerrors.ErrAlreadyReversed
+		}
+		return op.Amount, nil
+	}
+
+	// Only merchant payments are refunded in parts.
+	if (op.Type != Expense && op.Type != Income) || op.Merchant == "" {
+		return 0, newerrors.ErrNotReversible
+	}
+	if amount < 0 || op.Compensated+amount > op.Amount {
+		return 0, newerrors.ErrRefundAmount
+	}
+
+	return amount, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func bumpVersion(ctx context.Context, tx *sqlx.Tx, userID string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO ledger_versions (user_id, version) VALUES ($1, 1)
+		ON CONFLICT (user_id) DO UPDATE SET version = ledger_versions.version + 1`, userID)
+
+	return err
+}
+
+// Spent sums the user's expenses in the currency since the given time, refunded
+// amounts are not counted. An empty category sums expenses of all categories.
+func (l *Ledger) Spent(ctx context.Context, userID, currency, category string, since time.Time) (int64, error) {
+	var spent int64
+	err := l.db.GetContext(ctx, &spent, `
+		SELECT COALESCE(SUM(amount - compensated), 0) FROM ledger_operations
+		WHERE user_id = $1 AND type = $2 AND currency = $3 AND ($4 = '' OR category = $4) AND created_at >= $5`,
+		userID, Expense, currency, category, since)
+
+	return spent, err
+}
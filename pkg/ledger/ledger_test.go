@@ -0,0 +1,51 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+)
+
+func TestCompensation(t *testing.T) {
+	payment := Operation{Type: Expense, Amount: 1000, Merchant: "shop"}
+
+	tests := []struct {
+		name    string
+		op      Operation
+		amount  int64
+		want    int64
+		wantErr error
+	}{
+		{name: "full reversal", op: Operation{Type: Expense, Amount: 1000}, want: 1000},
+		{name: "full reversal of income", op: Operation{Type: Income, Amount: 500}, want: 500},
+		{name: "full refund of a merchant payment", op: payment, want: 1000},
+		{name: "partial refund", op: payment, amount: 300, want: 300},
+		{name: "refund of the rest", op: Operation{Type: Expense, Amount: 1000, Merchant: "shop", Compensated: 300}, amount: 700, want: 700},
+		{name: "merchant income refunded in parts", op: Operation{Type: Income, Amount: 1000, Merchant: "shop"}, amount: 1, want: 1},
+		{name: "refund over the rest", op: Operation{Type: Expense, Amount: 1000, Merchant: "shop", Compensated: 300}, amount: 701, wantErr: newerrors.ErrRefundAmount},
+		{name: "refund over the amount", op: payment, amount: 1001, wantErr: newerrors.ErrRefundAmount},
+		{name: "negative refund", op: payment, amount: -1, wantErr: newerrors.ErrRefundAmount},
+		{name: "full reversal after a partial refund", op: Operation{Type: Expense, Amount: 1000, Merchant: "shop", Compensated: 1}, wantErr: newerrors.ErrAlreadyReversed},
+		{name: "already reversed", op: Operation{Type: Expense, Amount: 1000, Compensated: 1000}, wantErr: newerrors.ErrAlreadyReversed},
+		{name: "already refunded", op: Operation{Type: Expense, Amount: 1000, Merchant: "shop", Compensated: 1000}, amount: 1, wantErr: newerrors.ErrAlreadyReversed},
+		{name: "partial reversal without a merchant", op: Operation{Type: Expense, Amount: 1000}, amount: 100, wantErr: newerrors.ErrNotReversible},
+		{name: "reversal", op: Operation{Type: Reversal, Amount: 1000}, wantErr: newerrors.ErrNotReversible},
+		{name: "refund", op: Operation{Type: Refund, Amount: 1000, Merchant: "shop"}, amount: 100, wantErr: newerrors.ErrNotReversible},
+		{name: "payment request", op: Operation{Type: PaymentRequest, Amount: 1000}, wantErr: newerrors.ErrNotReversible},
+		{name: "transfer", op: Operation{Type: Transfer, Amount: 1000}, wantErr: newerrors.ErrNotReversible},
+		{name: "exchange in", op: Operation{Type: ExchangeIn, Amount: 1000}, wantErr: newerrors.ErrNotReversible},
+		{name: "exchange out", op: Operation{Type: ExchangeOut, Amount: 1000}, wantErr: newerrors.ErrNotReversible},
+	}
+
+	for _, tt := range tests {
+		got, err := compensation(tt.op, tt.amount)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: compensation() error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: compensation() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package limits
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/notification"
+)
+
+// Limit periods
+const (
+	Daily   = "daily"
+	Monthly = "monthly"
+)
+
+// DefaultThresholds are the alert thresholds in percent of a limit without its own.
+var DefaultThresholds = []int{80, 100}
+
+var (
+	onceLimits     sync.Once
+	instanceLimits *Limits
+)
+
+// Limit caps what the user spends in a period. An empty category limits
+// expenses of all categories.
+type Limit struct {
+	ID         string    `db:"id"`
+	UserID     string    `db:"user_id"`
+	Period     string    `db:"period"`
+	Category   string    `db:"category"`
+	Currency   string    `db:"currency"`
+	Amount     int64     `db:"amount"`
+	Thresholds []int     `db:"-"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// limitRow is a limit as it is read from the database.
+type limitRow struct {
+	Limit
+	Thresholds pq.Int64Array `db:"thresholds"`
+}
+
+func (row limitRow) limit() Limit {
+	limit := row.Limit
+	limit.Thresholds = make([]int, 0, len(row.Thresholds))
+	for _, threshold := range row.Thresholds {
+		limit.Thresholds = append(limit.Thresholds, int(threshold))
+	}
+
+	return limit
+}
+
+const limitColumns = `id, user_id, period, category, currency, amount, thresholds, created_at`
+
+// Usage is the state of a limit in the current period.
+type Usage struct {
+	Limit
+	Spent     int64
+	Remaining int64
+	ResetsAt  time.Time
+}
+
+// Limits keeps the users' own spending limits in the shared database.
+type Limits struct {
+	db *sqlx.DB
+}
+
+// Service returns the spending limits shared by the handlers.
+func Service() *Limits {
+	onceLimits.Do(func() {
+		instanceLimits = &Limits{
+			db: database.Service(),
+		}
+	})
+
+	return instanceLimits
+}
+
+// Set adds the limit or replaces the user's limit of the same period,
+// category and currency.
+func (l *Limits) Set(ctx context.Context, limit Limit) (Limit, error) {
+	if len(limit.Thresholds) == 0 {
+		limit.Thresholds = DefaultThresholds
+	}
+	thresholds := make(pq.Int64Array, 0, len(limit.Thresholds))
+	for _, threshold := range limit.Thresholds {
+		thresholds = append(thresholds, int64(threshold))
+	}
+	sort.Slice(thresholds, func(i, j int) bool {
+		return thresholds[i] < thresholds[j]
+	})
+
+	var row limitRow
+	err := l.db.GetContext(ctx, &row, `
+		INSERT INTO spending_limits (id, user_id, period, category, currency, amount, thresholds, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id, period, category, currency) DO UPDATE
+		SET amount = EXCLUDED.amount, thresholds = EXCLUDED.thresholds
+		RETURNING `+limitColumns,
+		uuid.New().String(), limit.UserID, limit.Period, limit.Category, limit.Currency, limit.Amount, thresholds, time.Now())
+	if err != nil {
+		return Limit{}, err
+	}
+
+	return row.limit(), nil
+}
+
+// Delete ...
+func (l *Limits) Delete(ctx context.Context, userID, id string) error {
+	result, err := l.db.ExecContext(ctx, `DELETE FROM spending_limits WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return newerrors.ErrLimitNotFound
+	}
+
+	return nil
+}
+
+// List returns the user's limits with what is spent in the current period.
+func (l *Limits) List(ctx context.Context, userID string) ([]Usage, error) {
+	limits, err := l.limits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	usages := make([]Usage, 0, len(limits))
+	for _, limit := range limits {
+		u, err := usage(ctx, limit, now)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, u)
+	}
+
+	return usages, nil
+}
+
+// Check tells whether the expense fits into the user's limits. The returned
+// error names the first limit the expense would go over.
+func (l *Limits) Check(ctx context.Context, op ledger.Operation) error {
+	limits, err := l.limits(ctx, op.UserID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, limit := range limits {
+		if !limit.covers(op) {
+			continue
+		}
+
+		u, err := usage(ctx, limit, now)
+		if err != nil {
+			return err
+		}
+		if u.Spent+op.Amount > limit.Amount {
+			return fmt.Errorf("%w: %s, %d %s left", newerrors.ErrSpendingLimitExceeded, limit.name(), u.Remaining, limit.Currency)
+		}
+	}
+
+	return nil
+}
+
+// Track sends an alert for every threshold the recorded expense crossed. A
+// threshold is alerted once per period, even with several gateway instances.
+func (l *Limits) Track(ctx context.Context, op ledger.Operation) error {
+	if op.Type != ledger.Expense {
+		return nil
+	}
+
+	limits, err := l.limits(ctx, op.UserID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, limit := range limits {
+		if !limit.covers(op) {
+			continue
+		}
+
+		u, err := usage(ctx, limit, now)
+		if err != nil {
+			return err
+		}
+
+		crossed := 0
+		for _, threshold := range limit.Thresholds {
+			if u.Spent*100 >= limit.Amount*int64(threshold) {
+				crossed = threshold
+			}
+		}
+		if crossed == 0 {
+			continue
+		}
+
+		// The row changes only when the threshold is higher than the one alerted.
+		result, err := l.db.ExecContext(ctx, `
+			INSERT INTO spending_limit_alerts (limit_id, period_start, threshold) VALUES ($1, $2, $3)
+			ON CONFLICT (limit_id, period_start) DO UPDATE SET threshold = EXCLUDED.threshold
+			WHERE spending_limit_alerts.threshold < EXCLUDED.threshold`,
+			limit.ID, periodStart(limit.Period, now), crossed)
+		if err != nil {
+			return err
+		}
+		if changed, err := result.RowsAffected(); err != nil {
+			return err
+		} else if changed == 0 {
+			continue
+		}
+
+		notification.Service().Send(ctx, op.UserID, notification.LimitThreshold,
+			fmt.Sprintf("You have spent %d%% of your %s", crossed, u.name()),
+			map[string]interface{}{
+				"limit_id":  u.ID,
+				"threshold": crossed,
+				"spent":     u.Spent,
+				"amount":    u.Amount,
+				"currency":  u.Currency,
+			})
+	}
+
+	return nil
+}
+
+func (l *Limits) limits(ctx context.Context, userID string) ([]Limit, error) {
+	var rows []limitRow
+	err := l.db.SelectContext(ctx, &rows, `SELECT `+limitColumns+` FROM spending_limits WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := make([]Limit, 0, len(rows))
+	for _, row := range rows {
+		limits = append(limits, row.limit())
+	}
+
+	return limits, nil
+}
+
+func (limit *Limit) covers(op ledger.Operation) bool {
+	return limit.Currency == op.Currency && (limit.Category == "" || limit.Category == op.Category)
+}
+
+func (limit *Limit) name() string {
+	if limit.Category == "" {
+		return limit.Period + " spending limit"
+	}
+
+	return limit.Period + " " + strings.ToLower(limit.Category) + " spending limit"
+}
+
+// usage sums the expenses of the limit's current period, refunded amounts are not counted.
+func usage(ctx context.Context, limit Limit, now time.Time) (Usage, error) {
+	start := periodStart(limit.Period, now)
+
+	spent, err := ledger.Service().Spent(ctx, limit.UserID, limit.Currency, limit.Category, start)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	u := Usage{
+		Limit:    limit,
+		Spent:    spent,
+		ResetsAt: periodEnd(limit.Period, start),
+	}
+	if u.Remaining = limit.Amount - u.Spent; u.Remaining < 0 {
+		u.Remaining = 0
+	}
+
+	return u, nil
+}
+
+func periodStart(period string, now time.Time) time.Time {
+	year, month, day := now.Date()
+	if period == Monthly {
+		return time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+	}
+
+	return time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+}
+
+func periodEnd(period string, start time.Time) time.Time {
+	if period == Monthly {
+		return start.AddDate(0, 1, 0)
+	}
+
+	return start.AddDate(0, 0, 1)
+}
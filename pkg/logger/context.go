@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"context"
+	"sync"
+)
+
+type requestInfoKey struct{}
+
+// requestInfo is shared by the contexts of a request, the user is only known
+// once the authorizer read the token.
+type requestInfo struct {
+	requestID string
+
+	mu   sync.RWMutex
+	user string
+}
+
+func (i *requestInfo) userID() string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.user
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// WithRequestID returns a context whose log lines carry the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, &requestInfo{requestID: requestID})
+}
+
+// RequestID returns the request ID of the context, empty when there is none.
+func RequestID(ctx context.Context) string {
+	if info := requestInfoFrom(ctx); info != nil {
+		return info.requestID
+	}
+
+	return ""
+}
+
+// SetUserID adds the user ID to the log lines of the request of the context,
+// those of the contexts derived from it before included.
+func SetUserID(ctx context.Context, userID string) {
+	info := requestInfoFrom(ctx)
+	if info == nil {
+		return
+	}
+
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	info.user = userID
+}
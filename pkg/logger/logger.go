@@ -0,0 +1,172 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+)
+
+// Levels of log lines, lines below LOG_LEVEL are dropped
+const (
+	DebugLevel = "debug"
+	InfoLevel  = "info"
+	WarnLevel  = "warn"
+	ErrorLevel = "error"
+)
+
+var levels = map[string]int{
+	DebugLevel: 0,
+	InfoLevel:  1,
+	WarnLevel:  2,
+	ErrorLevel: 3,
+}
+
+var (
+	onceLogger     sync.Once
+	instanceLogger *Logger
+)
+
+// Field is a key and a value added to a log line.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Any ...
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err adds the error message under the error key.
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error"}
+	}
+
+	return Field{Key: "error", Value: err.Error()}
+}
+
+// Logger writes a JSON object per line. The request ID, the user ID and the
+// trace ID of the context are added to every line.
+type Logger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level int
+}
+
+// Service returns the logger of the gateway, at LOG_LEVEL. Lines of the
+// standard log package are written through it as well.
+func Service() *Logger {
+	onceLogger.Do(func() {
+		instanceLogger = New(os.Stdout, config.Config().LogLevel)
+
+		log.SetFlags(0)
+		log.SetOutput(standardWriter{instanceLogger})
+	})
+
+	return instanceLogger
+}
+
+// New returns a logger writing lines at the level and above, info when the level is unknown.
+func New(w io.Writer, level string) *Logger {
+	l, ok := levels[strings.ToLower(level)]
+	if !ok {
+		l = levels[InfoLevel]
+	}
+
+	return &Logger{w: w, level: l}
+}
+
+// Enabled tells lines of the level are written.
+func (l *Logger) Enabled(level string) bool {
+	return levels[level] >= l.level
+}
+
+// Log writes a line of the level, later fields replace earlier ones with the same key.
+func (l *Logger) Log(ctx context.Context, level, msg string, fields ...Field) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	line := map[string]interface{}{
+		"time":  time.Now().UTC().Format(time.RFC3339Nano),
+		"level": level,
+		"msg":   msg,
+	}
+	if info := requestInfoFrom(ctx); info != nil {
+		line["request_id"] = info.requestID
+		if userID := info.userID(); userID != "" {
+			line["user_id"] = userID
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		line["trace_id"] = sc.TraceID().String()
+	}
+	for _, field := range fields {
+		line[field.Key] = field.Value
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{
+			"time":  line["time"],
+			"level": level,
+			"msg":   msg,
+			"error": fmt.Sprintf("fields can not be encoded: %s", err),
+		})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.w.Write(append(data, '\n'))
+}
+
+// Debug ...
+func Debug(ctx context.Context, msg string, fields ...Field) {
+	Service().Log(ctx, DebugLevel, msg, fields...)
+}
+
+// Info ...
+func Info(ctx context.Context, msg string, fields ...Field) {
+	Service().Log(ctx, InfoLevel, msg, fields...)
+}
+
+// Warn ...
+func Warn(ctx context.Context, msg string, fields ...Field) {
+	Service().Log(ctx, WarnLevel, msg, fields...)
+}
+
+// Error ...
+func Error(ctx context.Context, msg string, fields ...Field) {
+	Service().Log(ctx, ErrorLevel, msg, fields...)
+}
+
+// standardWriter turns the lines of the standard log package into JSON
+// lines, at the error level when they tell about an error.
+type standardWriter struct {
+	logger *Logger
+}
+
+// Write ...
+func (w standardWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+
+	level := InfoLevel
+	if strings.Contains(strings.ToLower(msg), "error") {
+		level = ErrorLevel
+	}
+	w.logger.Log(context.Background(), level, msg)
+
+	return len(p), nil
+}
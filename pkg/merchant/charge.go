@@ -0,0 +1,256 @@
+package merchant
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/currency"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// Charge statuses
+const (
+	ChargePending   = "pending"
+	ChargePaid      = "paid"
+	ChargeDeclined  = "declined"
+	ChargeCancelled = "cancelled"
+	ChargeExpired   = "expired"
+)
+
+// Charge is a payment a merchant asks for and a user confirms from the app.
+type Charge struct {
+	ID          string `db:"id"`
+	MerchantID  string `db:"merchant_id"`
+	Amount      int64  `db:"amount"`
+	Currency    string `db:"currency"`
+	Description string `db:"description"`
+	// Reference is the merchant's own identifier, such as an order number
+	Reference string `db:"reference"`
+	Status    string `db:"status"`
+	// UserID is the user who confirmed or declined the charge
+	UserID string `db:"user_id"`
+	// OperationID is the user's expense operation of a paid charge
+	OperationID string `db:"operation_id"`
+	// IncomeOperationID is the income of the merchant's owner, a leg of the expense
+	IncomeOperationID string    `db:"income_operation_id"`
+	ExpiresAt         time.Time `db:"expires_at"`
+	CreatedAt         time.Time `db:"created_at"`
+	PaidAt            time.Time `db:"-"`
+}
+
+// chargeRow is a charge as it is read from the database, PaidAt is NULL
+// until the charge is paid.
+type chargeRow struct {
+	Charge
+	PaidAt sql.NullTime `db:"paid_at"`
+}
+
+func (row chargeRow) charge() Charge {
+	charge := row.Charge
+	charge.PaidAt = row.PaidAt.Time
+
+	return charge
+}
+
+// chargeColumns show pending charges past their expiry as expired.
+const chargeColumns = `id, merchant_id, amount, currency, description, reference,
+	CASE WHEN status = 'pending' AND expires_at <= now() THEN 'expired' ELSE status END AS status,
+	user_id, operation_id, income_operation_id, expires_at, created_at, paid_at`
+
+// CreateCharge stores a pending charge of the merchant.
+func (r *Registry) CreateCharge(ctx context.Context, charge Charge) (Charge, error) {
+	charge.Currency = wallet.Service().Currency(charge.Currency)
+	if !currency.IsSupported(currency.Provider(), charge.Currency) {
+		return Charge{}, newerrors.ErrUnsupportedCurrency
+	}
+
+	now := time.Now()
+
+	charge.ID = uuid.New().String()
+	charge.Status = ChargePending
+	charge.UserID, charge.OperationID = "", ""
+	charge.CreatedAt = now
+	charge.ExpiresAt = now.Add(r.chargeTTL)
+	charge.PaidAt = time.Time{}
+
+	_, err := r.db.NamedExecContext(ctx, `
+		INSERT INTO merchant_charges (id, merchant_id, amount, currency, description, reference, status, expires_at, created_at)
+		VALUES (:id, :merchant_id, :amount, :currency, :description, :reference, :status, :expires_at, :created_at)`, charge)
+	if err != nil {
+		return Charge{}, err
+	}
+
+	return charge, nil
+}
+
+// Charge returns a charge. Empty merchantID finds a charge of any merchant,
+// which is how users look up charges they are asked to confirm.
+func (r *Registry) Charge(ctx context.Context, merchantID, id string) (Charge, error) {
+	var row chargeRow
+	err := r.db.GetContext(ctx, &row, `
+		SELECT `+chargeColumns+` FROM merchant_charges
+		WHERE id = $1 AND ($2 = '' OR merchant_id = $2)`, id, merchantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Charge{}, newerrors.ErrChargeNotFound
+	} else if err != nil {
+		return Charge{}, err
+	}
+
+	return row.charge(), nil
+}
+
+// ConfirmCharge pays the charge from the user's balance to the merchant's owner.
+// The user's expense operation keeps the merchant ID.
+func (r *Registry) ConfirmCharge(ctx context.Context, op ledger.Operation, id string) (Charge, error) {
+	// Taken out of pending before the money moves, so it can not be paid twice.
+	charge, err := r.closeCharge(ctx, "", id, ChargePaid, op.UserID)
+	if err != nil {
+		return Charge{}, err
+	}
+
+	m, err := r.Get(ctx, charge.MerchantID)
+	if err == nil {
+		op.Merchant = m.ID
+		op.Currency, op.Amount = charge.Currency, charge.Amount
+		if op.Note == "" {
+			op.Note = chargeNote(m, charge)
+		}
+
+		var paid, income ledger.Operation
+		if paid, income, err = r.pay(ctx, m, op); err == nil {
+			charge.OperationID = paid.ID
+			charge.IncomeOperationID = income.ID
+			charge.PaidAt = paid.CreatedAt
+		}
+	}
+
+	// The money moved or was given back, the charge is updated even if the request was cancelled.
+	updateCtx, cancel := wallet.Service().Detached()
+	defer cancel()
+
+	if err != nil {
+		_, restoreErr := r.db.ExecContext(updateCtx, `
+			UPDATE merchant_charges SET status = $2, user_id = '' WHERE id = $1`, id, ChargePending)
+		if restoreErr != nil {
+			return Charge{}, restoreErr
+		}
+		return Charge{}, err
+	}
+
+	_, err = r.db.ExecContext(updateCtx, `
+		UPDATE merchant_charges SET operation_id = $2, income_operation_id = $3, paid_at = $4 WHERE id = $1`,
+		id, charge.OperationID, charge.IncomeOperationID, charge.PaidAt)
+	if err != nil {
+		return Charge{}, err
+	}
+
+	return charge, nil
+}
+
+// DeclineCharge refuses the charge on behalf of the user.
+func (r *Registry) DeclineCharge(ctx context.Context, userID, id string) (Charge, error) {
+	return r.closeCharge(ctx, "", id, ChargeDeclined, userID)
+}
+
+// CancelCharge withdraws the merchant's charge.
+func (r *Registry) CancelCharge(ctx context.Context, merchantID, id string) (Charge, error) {
+	return r.closeCharge(ctx, merchantID, id, ChargeCancelled, "")
+}
+
+// Charges returns the merchant's charges created in [from, to), newest first.
+func (r *Registry) Charges(ctx context.Context, merchantID string, from, to time.Time) ([]Charge, error) {
+	var rows []chargeRow
+	err := r.db.SelectContext(ctx, &rows, `
+		SELECT `+chargeColumns+` FROM merchant_charges
+		WHERE merchant_id = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at DESC`, merchantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	charges := make([]Charge, 0, len(rows))
+	for _, row := range rows {
+		charges = append(charges, row.charge())
+	}
+
+	return charges, nil
+}
+
+// pay moves the user's payment to the merchant's owner, returning the user's
+// expense and the owner's income.
+func (r *Registry) pay(ctx context.Context, m Merchant, op ledger.Operation) (ledger.Operation, ledger.Operation, error) {
+	paid, err := wallet.Service().Expense(ctx, op)
+	if err != nil {
+		return ledger.Operation{}, ledger.Operation{}, err
+	}
+
+	income, err := r.credit(ctx, m, paid)
+	if err != nil {
+		return ledger.Operation{}, ledger.Operation{}, err
+	}
+
+	return paid, income, nil
+}
+
+// credit pays the user's expense to the merchant's owner. The owner's income
+// is a leg of the expense, so reversing the expense takes the money back from
+// the owner. If the owner can not get the money the expense is reversed.
+func (r *Registry) credit(ctx context.Context, m Merchant, paid ledger.Operation) (ledger.Operation, error) {
+	income, err := wallet.Service().Income(ctx, ledger.Operation{
+		UserID:       m.OwnerID,
+		Currency:     paid.Currency,
+		Amount:       paid.Amount,
+		Merchant:     m.ID,
+		Counterparty: paid.UserID,
+		Note:         paid.Note,
+		LegOf:        paid.ID,
+	})
+	if err != nil {
+		// The merchant did not get the money, give it back to the user.
+		reverseCtx, cancel := wallet.Service().Detached()
+		defer cancel()
+
+		if _, reverseErr := wallet.Service().Reverse(reverseCtx, paid.ID, 0, "merchant payment failed"); reverseErr != nil {
+			return ledger.Operation{}, reverseErr
+		}
+
+		return ledger.Operation{}, err
+	}
+
+	return income, nil
+}
+
+// closeCharge takes a pending charge to the status. Empty merchantID closes a
+// charge of any merchant.
+func (r *Registry) closeCharge(ctx context.Context, merchantID, id, status, userID string) (Charge, error) {
+	var row chargeRow
+	err := r.db.GetContext(ctx, &row, `
+		UPDATE merchant_charges SET status = $3, user_id = $4
+		WHERE id = $1 AND ($2 = '' OR merchant_id = $2) AND status = 'pending' AND expires_at > now()
+		RETURNING `+chargeColumns, id, merchantID, status, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Tell a missing charge from one which is not pending any more.
+		if _, err := r.Charge(ctx, merchantID, id); err != nil {
+			return Charge{}, err
+		}
+		return Charge{}, newerrors.ErrChargeNotPending
+	} else if err != nil {
+		return Charge{}, err
+	}
+
+	return row.charge(), nil
+}
+
+func chargeNote(m Merchant, charge Charge) string {
+	if charge.Description != "" {
+		return m.Name + ": " + charge.Description
+	}
+
+	return m.Name
+}
@@ -0,0 +1,27 @@
+package merchant
+
+import (
+	"context"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// CaptureHold captures the hold a user made for the merchant and pays the
+// captured amount to the merchant's owner. Zero amount captures the whole hold.
+func (r *Registry) CaptureHold(ctx context.Context, m Merchant, id string, amount int64) (*wallet.Hold, error) {
+	hold, paid, err := wallet.Service().CaptureHold(ctx, m.ID, id, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.credit(ctx, m, paid); err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// VoidHold releases the hold a user made for the merchant.
+func (r *Registry) VoidHold(ctx context.Context, m Merchant, id string) (*wallet.Hold, error) {
+	return wallet.Service().VoidHold(ctx, m.ID, id)
+}
@@ -0,0 +1,252 @@
+package merchant
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/rand"
+)
+
+// APIKeyHeader carries the merchant API key of merchant requests.
+const APIKeyHeader = "X-API-Key"
+
+// LocalsKey keeps the authenticated merchant in the request context.
+const LocalsKey = "merchant"
+
+const (
+	keyPrefix = "mk_"
+	keyLength = 40
+)
+
+var (
+	onceRegistry     sync.Once
+	instanceRegistry *Registry
+)
+
+// Merchant is a business accepting payments. Payments are credited to its owner.
+type Merchant struct {
+	ID        string    `db:"id"`
+	OwnerID   string    `db:"owner_id"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// APIKey authenticates a merchant. Only a hash of the key is kept.
+type APIKey struct {
+	ID         string `db:"id"`
+	MerchantID string `db:"merchant_id"`
+	// Hint is the beginning of the key, to tell keys apart
+	Hint      string    `db:"hint"`
+	CreatedAt time.Time `db:"created_at"`
+	RevokedAt time.Time `db:"-"`
+}
+
+// keyRow is an API key as it is read from the database, RevokedAt is NULL
+// until the key is revoked.
+type keyRow struct {
+	APIKey
+	RevokedAt sql.NullTime `db:"revoked_at"`
+}
+
+func (row keyRow) key() APIKey {
+	key := row.APIKey
+	key.RevokedAt = row.RevokedAt.Time
+
+	return key
+}
+
+const keyColumns = `id, merchant_id, hint, created_at, revoked_at`
+
+// Registry keeps merchants, their API keys and charges in the shared database.
+type Registry struct {
+	db *sqlx.DB
+
+	chargeTTL time.Duration
+}
+
+// Service returns the merchant registry shared by the handlers.
+func Service() *Registry {
+	onceRegistry.Do(func() {
+		instanceRegistry = &Registry{
+			db:        database.Service(),
+			chargeTTL: time.Second * time.Duration(config.Config().MerchantChargeTTL),
+		}
+	})
+
+	return instanceRegistry
+}
+
+// Onboard registers a merchant owned by the user and gives it its first API key.
+func (r *Registry) Onboard(ctx context.Context, ownerID, name string) (Merchant, APIKey, string, error) {
+	m := Merchant{
+		ID:        uuid.New().String(),
+		OwnerID:   ownerID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+
+	var (
+		key   APIKey
+		plain string
+	)
+	err := database.InTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(ctx, `
+			INSERT INTO merchants (id, owner_id, name, created_at)
+			VALUES (:id, :owner_id, :name, :created_at)`, m)
+		if err != nil {
+			return err
+		}
+
+		key, plain, err = newKey(ctx, tx, m.ID)
+		return err
+	})
+	if err != nil {
+		return Merchant{}, APIKey{}, "", err
+	}
+
+	return m, key, plain, nil
+}
+
+// Get ...
+func (r *Registry) Get(ctx context.Context, id string) (Merchant, error) {
+	var m Merchant
+	err := r.db.GetContext(ctx, &m, `SELECT id, owner_id, name, created_at FROM merchants WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Merchant{}, newerrors.ErrMerchantNotFound
+	} else if err != nil {
+		return Merchant{}, err
+	}
+
+	return m, nil
+}
+
+// Owned returns the merchants owned by the user.
+func (r *Registry) Owned(ctx context.Context, ownerID string) ([]Merchant, error) {
+	merchants := make([]Merchant, 0)
+	err := r.db.SelectContext(ctx, &merchants, `
+		SELECT id, owner_id, name, created_at FROM merchants
+		WHERE owner_id = $1 ORDER BY created_at`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return merchants, nil
+}
+
+// Keys returns the API keys of the owner's merchant.
+func (r *Registry) Keys(ctx context.Context, ownerID, merchantID string) ([]APIKey, error) {
+	if _, err := r.owned(ctx, ownerID, merchantID); err != nil {
+		return nil, err
+	}
+
+	var rows []keyRow
+	err := r.db.SelectContext(ctx, &rows, `
+		SELECT `+keyColumns+` FROM merchant_api_keys
+		WHERE merchant_id = $1 ORDER BY created_at`, merchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]APIKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, row.key())
+	}
+
+	return keys, nil
+}
+
+// CreateKey issues a new API key for the owner's merchant. The key itself is
+// returned only here.
+func (r *Registry) CreateKey(ctx context.Context, ownerID, merchantID string) (APIKey, string, error) {
+	if _, err := r.owned(ctx, ownerID, merchantID); err != nil {
+		return APIKey{}, "", err
+	}
+
+	return newKey(ctx, r.db, merchantID)
+}
+
+// RevokeKey stops the key from authenticating.
+func (r *Registry) RevokeKey(ctx context.Context, ownerID, merchantID, keyID string) (APIKey, error) {
+	if _, err := r.owned(ctx, ownerID, merchantID); err != nil {
+		return APIKey{}, err
+	}
+
+	var row keyRow
+	err := r.db.GetContext(ctx, &row, `
+		UPDATE merchant_api_keys SET revoked_at = COALESCE(revoked_at, now())
+		WHERE id = $1 AND merchant_id = $2
+		RETURNING `+keyColumns, keyID, merchantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, newerrors.ErrAPIKeyNotFound
+	} else if err != nil {
+		return APIKey{}, err
+	}
+
+	return row.key(), nil
+}
+
+// Authenticate returns the merchant of a valid API key.
+func (r *Registry) Authenticate(ctx context.Context, plain string) (Merchant, error) {
+	var m Merchant
+	err := r.db.GetContext(ctx, &m, `
+		SELECT m.id, m.owner_id, m.name, m.created_at
+		FROM merchant_api_keys k JOIN merchants m ON m.id = k.merchant_id
+		WHERE k.hash = $1 AND k.revoked_at IS NULL`, hashKey(plain))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Merchant{}, newerrors.ErrInvalidAPIKey
+	} else if err != nil {
+		return Merchant{}, err
+	}
+
+	return m, nil
+}
+
+func (r *Registry) owned(ctx context.Context, ownerID, merchantID string) (Merchant, error) {
+	m, err := r.Get(ctx, merchantID)
+	if err != nil {
+		return Merchant{}, err
+	}
+
+	if m.OwnerID != ownerID {
+		return Merchant{}, newerrors.ErrMerchantNotFound
+	}
+
+	return m, nil
+}
+
+func newKey(ctx context.Context, db sqlx.ExecerContext, merchantID string) (APIKey, string, error) {
+	plain := keyPrefix + rand.String(keyLength)
+
+	key := APIKey{
+		ID:         uuid.New().String(),
+		MerchantID: merchantID,
+		Hint:       plain[:len(keyPrefix)+4],
+		CreatedAt:  time.Now(),
+	}
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO merchant_api_keys (id, merchant_id, hint, hash, created_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		key.ID, key.MerchantID, key.Hint, hashKey(plain), key.CreatedAt)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	return key, plain, nil
+}
+
+func hashKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
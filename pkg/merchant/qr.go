@@ -0,0 +1,36 @@
+package merchant
+
+import (
+	"context"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+)
+
+// ClaimQR takes the reference of a QR code with an amount for the charge
+// paying it. A code whose reference is already taken was paid before.
+func (r *Registry) ClaimQR(ctx context.Context, merchantID, reference, chargeID string) error {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO qr_payments (merchant_id, reference, charge_id) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, merchantID, reference, chargeID)
+	if err != nil {
+		return err
+	}
+
+	if claimed, err := result.RowsAffected(); err != nil {
+		return err
+	} else if claimed == 0 {
+		return newerrors.ErrQRAlreadyPaid
+	}
+
+	return nil
+}
+
+// ReleaseQR gives the reference back when the charge was not paid, so the
+// code can be paid again.
+func (r *Registry) ReleaseQR(ctx context.Context, merchantID, reference, chargeID string) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM qr_payments WHERE merchant_id = $1 AND reference = $2 AND charge_id = $3`,
+		merchantID, reference, chargeID)
+
+	return err
+}
@@ -0,0 +1,86 @@
+package merchant
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+)
+
+// dateLayout is the day of a settlement line.
+const dateLayout = "2006-01-02"
+
+// SettlementLine sums the payments of a day in a currency. Lines of the totals have no date.
+type SettlementLine struct {
+	Date     string
+	Currency string
+	Count    int
+	Gross    int64
+	Refunded int64
+	Net      int64
+}
+
+// Settlement reports the payments received by a merchant in [From, To).
+type Settlement struct {
+	MerchantID string
+	From       time.Time
+	To         time.Time
+	Days       []SettlementLine
+	Totals     []SettlementLine
+}
+
+// Settlement builds the report of the payments the merchant received in
+// [from, to): paid charges, captured holds and any other payment to the
+// merchant's owner. Refunds of the payments are taken from the same query.
+func (r *Registry) Settlement(ctx context.Context, merchantID string, from, to time.Time) (Settlement, error) {
+	payments, err := ledger.Service().MerchantPayments(ctx, merchantID, from, to)
+	if err != nil {
+		return Settlement{}, err
+	}
+
+	days := map[[2]string]*SettlementLine{}
+	totals := map[string]*SettlementLine{}
+	for _, op := range payments {
+		day := [2]string{op.CreatedAt.Format(dateLayout), op.Currency}
+		if days[day] == nil {
+			days[day] = &SettlementLine{Date: day[0], Currency: day[1]}
+		}
+		if totals[op.Currency] == nil {
+			totals[op.Currency] = &SettlementLine{Currency: op.Currency}
+		}
+
+		for _, line := range []*SettlementLine{days[day], totals[op.Currency]} {
+			line.Count++
+			line.Gross += op.Amount
+			line.Refunded += op.Compensated
+			line.Net += op.Amount - op.Compensated
+		}
+	}
+
+	settlement := Settlement{
+		MerchantID: merchantID,
+		From:       from,
+		To:         to,
+		Days:       make([]SettlementLine, 0, len(days)),
+		Totals:     make([]SettlementLine, 0, len(totals)),
+	}
+	for _, line := range days {
+		settlement.Days = append(settlement.Days, *line)
+	}
+	for _, line := range totals {
+		settlement.Totals = append(settlement.Totals, *line)
+	}
+
+	sort.Slice(settlement.Days, func(i, j int) bool {
+		if settlement.Days[i].Date != settlement.Days[j].Date {
+			return settlement.Days[i].Date < settlement.Days[j].Date
+		}
+		return settlement.Days[i].Currency < settlement.Days[j].Currency
+	})
+	sort.Slice(settlement.Totals, func(i, j int) bool {
+		return settlement.Totals[i].Currency < settlement.Totals[j].Currency
+	})
+
+	return settlement, nil
+}
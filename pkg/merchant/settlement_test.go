@@ -0,0 +1,91 @@
+package merchant
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/testenv"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+func TestSettlementIncludesHoldCaptures(t *testing.T) {
+	testenv.DB(t)
+	users := testenv.UserService(t)
+	ctx := context.Background()
+	r := Service()
+
+	owner, payer := uuid.New().String(), uuid.New().String()
+	users.Add(owner, 0)
+	users.Add(payer, 10000)
+
+	m, _, _, err := r.Onboard(ctx, owner, "Corner shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Now().Add(-time.Minute)
+	code := wallet.Service().DefaultCurrency()
+
+	charge, err := r.CreateCharge(ctx, Charge{MerchantID: m.ID, Amount: 1000, Currency: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := ledger.Operation{UserID: payer, Type: ledger.Expense, Currency: code, Amount: charge.Amount, Merchant: m.ID}
+	if _, err := r.ConfirmCharge(ctx, op, charge.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	hold, err := wallet.Service().CreateHold(ctx, payer, m.ID, code, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	captured, err := r.CaptureHold(ctx, m, hold.ID, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallet.Service().Reverse(ctx, captured.OperationID, 500, "refund"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A hold of another merchant is not in the report.
+	other, _, _, err := r.Onboard(ctx, uuid.New().String(), "Other shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users.Add(other.OwnerID, 0)
+	otherHold, err := wallet.Service().CreateHold(ctx, payer, other.ID, code, 700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.CaptureHold(ctx, other, otherHold.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	settlement, err := r.Settlement(ctx, m.ID, from, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := SettlementLine{Currency: code, Count: 2, Gross: 3000, Refunded: 500, Net: 2500}
+	if len(settlement.Totals) != 1 || settlement.Totals[0] != want {
+		t.Errorf("totals = %+v, want %+v", settlement.Totals, want)
+	}
+
+	var (
+		count int
+		net   int64
+	)
+	for _, day := range settlement.Days {
+		count += day.Count
+		net += day.Net
+	}
+	if count != want.Count || net != want.Net {
+		t.Errorf("days = %+v, want both payments", settlement.Days)
+	}
+	if balance := users.Balance(owner); balance != want.Net {
+		t.Errorf("owner balance = %d, want %d", balance, want.Net)
+	}
+}
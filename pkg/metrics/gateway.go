@@ -0,0 +1,24 @@
+package metrics
+
+// Metrics of the gateway
+var (
+	HTTPRequests = NewCounterVec("gateway_http_requests_total",
+		"HTTP requests by route template, method and status.",
+		"route", "method", "status")
+	HTTPDuration = NewHistogramVec("gateway_http_request_duration_seconds",
+		"Latency of HTTP requests by route template, method and status.",
+		DefaultBuckets, "route", "method", "status")
+	HTTPInFlight = NewGauge("gateway_http_requests_in_flight",
+		"HTTP requests being served.")
+
+	UpstreamCalls = NewCounterVec("gateway_upstream_calls_total",
+		"gRPC calls to upstreams by upstream, method and code.",
+		"upstream", "method", "code")
+	UpstreamDuration = NewHistogramVec("gateway_upstream_call_duration_seconds",
+		"Latency of gRPC calls to upstreams by upstream, method and code.",
+		DefaultBuckets, "upstream", "method", "code")
+
+	Authorizations = NewCounterVec("gateway_authorizations_total",
+		"Authorization decisions by role and decision, allow or deny.",
+		"role", "decision")
+)
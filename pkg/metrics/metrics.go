@@ -0,0 +1,296 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the type of the Prometheus text format written by Write.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds of latency histograms, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	mu         sync.Mutex
+	collectors []collector
+)
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// desc names a metric and its labels.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, d.kind)
+}
+
+func register(c collector) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	collectors = append(collectors, c)
+}
+
+// Write writes all the metrics in the Prometheus text format. Scrapes are
+// written one at a time.
+func Write(w io.Writer) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	buffer := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buffer)
+	}
+
+	return buffer.Flush()
+}
+
+// CounterVec counts events by label values.
+type CounterVec struct {
+	desc
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	count  uint64
+}
+
+// NewCounterVec registers a counter with the labels.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		series: make(map[string]*counterSeries),
+	}
+	register(c)
+
+	return c
+}
+
+// Inc adds one to the series of the label values, given in the order of the labels.
+func (c *CounterVec) Inc(values ...string) {
+	key := strings.Join(values, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.series[key]
+	if s == nil {
+		s = &counterSeries{values: values}
+		c.series[key] = s
+	}
+	s.count++
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.series))
+	for key := range c.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	c.header(w)
+	for _, key := range keys {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %d\n", c.name, labelSet(c.labels, s.values), s.count)
+	}
+}
+
+// HistogramVec counts observed values into buckets by label values.
+type HistogramVec struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram with the bucket upper bounds and the labels.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	register(h)
+
+	return h
+}
+
+// Observe adds the value to the series of the label values.
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	key := strings.Join(values, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.series[key]
+	if s == nil {
+		s = &histogramSeries{values: values, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h.header(w)
+	labels := append(h.labels[:len(h.labels):len(h.labels)], "le")
+	for _, key := range keys {
+		s := h.series[key]
+		values := append(s.values[:len(s.values):len(s.values)], "")
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			values[len(values)-1] = formatFloat(bound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(labels, values), cumulative)
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(labels, values), s.count)
+
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelSet(h.labels, s.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelSet(h.labels, s.values), s.count)
+	}
+}
+
+// Gauge is a value going up and down, like the requests in flight.
+type Gauge struct {
+	desc
+	value int64
+}
+
+// NewGauge registers a gauge without labels.
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{name: name, help: help, kind: "gauge"}}
+	register(g)
+
+	return g
+}
+
+// Inc ...
+func (g *Gauge) Inc() {
+	atomic.AddInt64(&g.value, 1)
+}
+
+// Dec ...
+func (g *Gauge) Dec() {
+	atomic.AddInt64(&g.value, -1)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %d\n", g.name, atomic.LoadInt64(&g.value))
+}
+
+// Sample is a value of a metric read at scrape time, Values are in the order of its labels.
+type Sample struct {
+	Values []string
+	Value  float64
+}
+
+type funcCollector struct {
+	desc
+	collect func() []Sample
+}
+
+// NewGaugeFunc registers a gauge whose samples are read by collect on every scrape.
+func NewGaugeFunc(name, help string, collect func() []Sample, labels ...string) {
+	register(&funcCollector{
+		desc:    desc{name: name, help: help, kind: "gauge", labels: labels},
+		collect: collect,
+	})
+}
+
+// NewCounterFunc registers a counter whose samples are read by collect on every scrape.
+func NewCounterFunc(name, help string, collect func() []Sample, labels ...string) {
+	register(&funcCollector{
+		desc:    desc{name: name, help: help, kind: "counter", labels: labels},
+		collect: collect,
+	})
+}
+
+func (f *funcCollector) write(w *bufio.Writer) {
+	f.header(w)
+	for _, sample := range f.collect() {
+		fmt.Fprintf(w, "%s%s %s\n", f.name, labelSet(f.labels, sample.Values), formatFloat(sample.Value))
+	}
+}
+
+func labelSet(labels, values []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label)
+		b.WriteString(`="`)
+		if i < len(values) {
+			b.WriteString(labelEscaper.Replace(values[i]))
+		}
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"runtime"
+	"runtime/pprof"
+)
+
+func init() {
+	NewGaugeFunc("go_info", "Version of the Go runtime.", func() []Sample {
+		return []Sample{{Values: []string{runtime.Version()}, Value: 1}}
+	}, "version")
+	NewGaugeFunc("go_goroutines", "Number of goroutines.", func() []Sample {
+		return []Sample{{Value: float64(runtime.NumGoroutine())}}
+	})
+	NewGaugeFunc("go_threads", "Number of OS threads created.", func() []Sample {
+		return []Sample{{Value: float64(pprof.Lookup("threadcreate").Count())}}
+	})
+
+	// the memory stats are read once per scrape, by the first of their metrics
+	var stats runtime.MemStats
+	memory := func(value func() float64) func() []Sample {
+		return func() []Sample {
+			return []Sample{{Value: value()}}
+		}
+	}
+
+	NewGaugeFunc("go_memstats_alloc_bytes", "Bytes of allocated heap objects.", func() []Sample {
+		runtime.ReadMemStats(&stats)
+		return []Sample{{Value: float64(stats.Alloc)}}
+	})
+	NewGaugeFunc("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.",
+		memory(func() float64 { return float64(stats.HeapInuse) }))
+	NewGaugeFunc("go_memstats_heap_objects", "Number of allocated heap objects.",
+		memory(func() float64 { return float64(stats.HeapObjects) }))
+	NewGaugeFunc("go_memstats_stack_inuse_bytes", "Bytes in stack spans.",
+		memory(func() float64 { return float64(stats.StackInuse) }))
+	NewGaugeFunc("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.",
+		memory(func() float64 { return float64(stats.Sys) }))
+	NewCounterFunc("go_memstats_mallocs_total", "Heap objects allocated.",
+		memory(func() float64 { return float64(stats.Mallocs) }))
+	NewCounterFunc("go_gc_cycles_total", "Completed GC cycles.",
+		memory(func() float64 { return float64(stats.NumGC) }))
+	NewCounterFunc("go_gc_pause_seconds_total", "Total time the GC stopped the world.",
+		memory(func() float64 { return float64(stats.PauseTotalNs) / 1e9 }))
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// AccessLog writes one line per request once it is answered, at the error
+// level for server errors.
+func AccessLog() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		middlewarePath := c.Route().Path
+
+		err := c.Next()
+
+		route, status := outcome(c, middlewarePath, err)
+		level := logger.InfoLevel
+		if status >= fiber.StatusInternalServerError {
+			level = logger.ErrorLevel
+		}
+
+		fields := []logger.Field{
+			logger.Any("method", c.Method()),
+			logger.Any("path", c.Path()),
+			logger.Any("route", route),
+			logger.Any("status", status),
+			logger.Any("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			logger.Any("ip", c.IP()),
+			logger.Any("bytes", len(c.Response().Body())),
+			logger.Any("user_agent", c.Get(fiber.HeaderUserAgent)),
+		}
+		if err != nil {
+			fields = append(fields, logger.Err(err))
+		}
+		logger.Service().Log(c.UserContext(), level, "request", fields...)
+
+		return err
+	}
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	goerrors "errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,7 +11,13 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/toshkentov01/alif-tech-task/api-gateway/api/errors"
 	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
 	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/jwt"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/merchant"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/metrics"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 //JWTRoleAuthorizer is a sturcture for a Role Authorizer type
@@ -35,26 +43,89 @@ func NewJWTRoleAuthorizer(cfg *config.Configuration) (*JWTRoleAuthorizer, error)
 	}, nil
 }
 
+// AddPolicies lets roles call routes added at startup, like the routes of the routes file.
+// Each policy is a role, a path and a method.
+func (jwtra *JWTRoleAuthorizer) AddPolicies(policies [][]string) error {
+	if len(policies) == 0 {
+		return nil
+	}
+
+	_, err := jwtra.enforcer.AddPolicies(policies)
+	return err
+}
+
+// Check tells the authorizer has its policies loaded.
+func (jwtra *JWTRoleAuthorizer) Check(ctx context.Context) error {
+	if jwtra.enforcer == nil || len(jwtra.enforcer.GetPolicy()) == 0 {
+		return fmt.Errorf("casbin has no policies loaded")
+	}
+
+	return nil
+}
+
 //NewAuthorizer returns middleware function to be used by fiber app for authorization
 func NewAuthorizer(jwtra *JWTRoleAuthorizer) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		// the span ends before the handler runs, it times the authorization only
+		_, span := tracing.Service().Start(c.UserContext(), "authorize")
+		defer span.End()
+
 		accessToken := c.Get("Authorization")
 
-		claims, err := jwt.ExtractClaims(accessToken, jwtra.SigningKey)
-		if err != nil {
-			log.Println("could not extract claims:", err)
-			return err
-		}
+		var role interface{}
+		if apiKey := c.Get(merchant.APIKeyHeader); accessToken == "" && apiKey != "" {
+			// Merchants authenticate with an API key instead of a JWT.
+			m, err := merchant.Service().Authenticate(c.UserContext(), apiKey)
+			if err != nil && !goerrors.Is(err, newerrors.ErrInvalidAPIKey) {
+				logger.Error(c.UserContext(), "could not authenticate a merchant", logger.Err(err))
+				tracing.SetError(span, err)
+				return c.Status(http.StatusInternalServerError).JSON(errors.ErrorResponse{
+					Code:    http.StatusInternalServerError,
+					Message: errors.InternalMsg,
+				})
+			}
+			if err != nil {
+				tracing.SetError(span, err)
+				return c.Status(http.StatusUnauthorized).JSON(errors.ErrorResponse{
+					Code:    http.StatusUnauthorized,
+					Message: errors.InvalidAPIKey,
+				})
+			}
+
+			c.Locals(merchant.LocalsKey, m)
+			role = "merchant"
+			logger.SetUserID(c.UserContext(), m.OwnerID)
+		} else {
+			claims, err := jwt.ExtractClaims(accessToken, jwtra.SigningKey)
+			if err != nil {
+				logger.Warn(c.UserContext(), "could not extract claims", logger.Err(err))
+				tracing.SetError(span, err)
+				return err
+			}
 
-		role := claims["role"]
-		fmt.Println()
+			role = claims["role"]
+			if userID, ok := claims["id"].(string); ok {
+				logger.SetUserID(c.UserContext(), userID)
+			}
+		}
 
 		ok, err := jwtra.enforcer.Enforce(role, c.Path(), c.Method())
 		if err != nil {
-			log.Println("could not enforce:", err)
+			logger.Error(c.UserContext(), "could not enforce", logger.Err(err))
+			tracing.SetError(span, err)
 			return err
 		}
 
+		decision := "allow"
+		if !ok {
+			decision = "deny"
+		}
+		metrics.Authorizations.Inc(fmt.Sprint(role), decision)
+		span.SetAttributes(
+			attribute.String("auth.role", fmt.Sprint(role)),
+			attribute.String("auth.decision", decision),
+		)
+
 		if !ok {
 			err = c.SendStatus(http.StatusForbidden)
 			if err != nil {
@@ -66,6 +137,8 @@ func NewAuthorizer(jwtra *JWTRoleAuthorizer) fiber.Handler {
 			})
 		}
 
+		span.End()
+
 		return c.Next()
 	}
 }
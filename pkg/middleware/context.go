@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/models"
+	client "github.com/toshkentov01/alif-tech-task/api-gateway/grpc_client"
+)
+
+const (
+	baseContextKey = "request_base_context"
+	deadlineKey    = "request_deadline"
+	cancelKey      = "request_cancel"
+)
+
+// RequestContext gives every request a context, returned by c.UserContext(),
+// that starts at arrival, expires after the timeout and is cancelled when the
+// client disconnects. It keeps the values of the context set before it, like
+// the span of the request. Handlers pass it to every upstream call. A request answered with an error after its deadline
+// passed, or after an upstream call timed out, is answered with 504 whatever
+// status the handler chose; successful answers are kept, the operation is done.
+func RequestContext(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		base, cancel := context.WithCancel(c.UserContext())
+		defer cancel()
+		base, upstreamTimedOut := client.TrackTimeouts(base)
+
+		stop := watchDisconnect(c.Context().Conn(), cancel)
+		defer stop()
+
+		c.Locals(baseContextKey, base)
+		SetDeadline(c, timeout)
+
+		err := c.Next()
+
+		expired := c.UserContext().Err() == context.DeadlineExceeded
+		if cancelDeadline, ok := c.Locals(cancelKey).(context.CancelFunc); ok {
+			cancelDeadline()
+		}
+
+		if err == nil && c.Response().StatusCode() < http.StatusBadRequest {
+			return nil
+		}
+
+		if expired {
+			return c.Status(http.StatusGatewayTimeout).JSON(models.StandardErrorModel{
+				ErrorMessage: fmt.Sprintf("Request did not complete in %s", c.Locals(deadlineKey)),
+			})
+		}
+		if upstreamTimedOut() {
+			return c.Status(http.StatusGatewayTimeout).JSON(models.StandardErrorModel{
+				ErrorMessage: "Upstream service did not answer in time",
+			})
+		}
+
+		return err
+	}
+}
+
+// Deadline gives the requests of a route their own deadline, counted from
+// the arrival of the request.
+func Deadline(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		SetDeadline(c, timeout)
+
+		return c.Next()
+	}
+}
+
+// SetDeadline replaces the deadline of the request context.
+func SetDeadline(c *fiber.Ctx, timeout time.Duration) {
+	base, ok := c.Locals(baseContextKey).(context.Context)
+	if !ok {
+		base = context.Background()
+	}
+
+	ctx, cancel := context.WithDeadline(base, c.Context().Time().Add(timeout))
+	if previous, ok := c.Locals(cancelKey).(context.CancelFunc); ok {
+		previous()
+	}
+
+	c.Locals(cancelKey, cancel)
+	c.Locals(deadlineKey, timeout)
+	c.SetUserContext(ctx)
+}
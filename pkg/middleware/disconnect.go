@@ -0,0 +1,62 @@
+//go:build !windows
+// +build !windows
+
+package middleware
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+)
+
+// watchDisconnect cancels the request when the client closes the connection.
+// It waits in the network poller for the socket to turn readable and peeks
+// at it without taking bytes: the end of the stream or a reset is a
+// disconnect, data is a pipelined request the server reads next and ends the
+// watch. Connections without a socket, like TLS ones, are not watched.
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return func() {}
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return func() {}
+	}
+
+	// The request is read already, the read deadline of the server would only
+	// end the watch early. The server sets it again before the next request.
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		buf := make([]byte, 1)
+		closed := false
+		raw.Read(func(fd uintptr) bool {
+			n, _, err := syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				// nothing to read yet, wait until the socket is readable
+				return false
+			}
+
+			closed = n == 0 && err == nil || err == syscall.ECONNRESET
+			return true
+		})
+		if closed {
+			cancel()
+		}
+	}()
+
+	return func() {
+		// A read deadline in the past wakes the watch up.
+		conn.SetReadDeadline(time.Unix(1, 0))
+		<-done
+		conn.SetReadDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,12 @@
+package middleware
+
+import (
+	"context"
+	"net"
+)
+
+// watchDisconnect does not watch connections on Windows, requests end at
+// their deadline.
+func watchDisconnect(net.Conn, context.CancelFunc) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/metrics"
+)
+
+// unmatchedRoute labels the requests answered before reaching a route, like
+// unknown paths and requests the authorizer rejected, so their paths do not
+// become labels.
+const unmatchedRoute = "unmatched"
+
+// Metrics counts the requests and their latency by route template, method and status.
+func Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		middlewarePath := c.Route().Path
+
+		metrics.HTTPInFlight.Inc()
+		defer metrics.HTTPInFlight.Dec()
+
+		err := c.Next()
+
+		route, status := outcome(c, middlewarePath, err)
+		labels := []string{route, c.Method(), strconv.Itoa(status)}
+		metrics.HTTPRequests.Inc(labels...)
+		metrics.HTTPDuration.Observe(time.Since(start).Seconds(), labels...)
+
+		return err
+	}
+}
+
+// outcome returns the route template and the status of a served request.
+// middlewarePath is the path of the middleware asking, read before c.Next.
+func outcome(c *fiber.Ctx, middlewarePath string, err error) (string, int) {
+	status := c.Response().StatusCode()
+	if err != nil {
+		// the error handler writes the status after the handlers returned
+		status = fiber.StatusInternalServerError
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		}
+	}
+
+	route := c.Route().Path
+	if route == middlewarePath {
+		route = unmatchedRoute
+	}
+
+	return route, status
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// RequestIDHeader carries the request ID from the caller and back in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs taken from callers.
+const maxRequestIDLength = 128
+
+// RequestID gives every request an ID, the caller's one when it sent a valid
+// one. The ID is sent back in the response, added to the log lines of the
+// request and passed on to the upstreams.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID := c.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		c.Set(RequestIDHeader, requestID)
+		c.Locals("requestid", requestID)
+		c.SetUserContext(logger.WithRequestID(c.UserContext(), requestID))
+
+		return c.Next()
+	}
+}
+
+// validRequestID accepts letters, digits, dashes, underscores and dots, so
+// callers can not forge log lines or headers with it.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/tracing"
+)
+
+// Tracing starts a server span for every request, continuing the trace of the
+// caller's traceparent header. The span is put into the request context, so
+// the spans of the authorization and the upstream calls become its children.
+func Tracing() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		middlewarePath := c.Route().Path
+		tracer := tracing.Service()
+
+		carrier := propagation.MapCarrier{}
+		for _, key := range otel.GetTextMapPropagator().Fields() {
+			if value := c.Get(key); value != "" {
+				carrier.Set(key, value)
+			}
+		}
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), carrier)
+
+		ctx, span := tracer.Start(ctx, c.Method(), trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.method", c.Method()),
+			attribute.String("http.target", c.OriginalURL()),
+			attribute.String("http.user_agent", c.Get(fiber.HeaderUserAgent)),
+		))
+		defer span.End()
+
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		route, status := outcome(c, middlewarePath, err)
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(
+			attribute.String("http.route", route),
+			attribute.Int("http.status_code", status),
+		)
+
+		switch {
+		case err != nil:
+			tracing.SetError(span, err)
+		case status >= fiber.StatusInternalServerError:
+			tracing.SetError(span, errors.New(utils.StatusMessage(status)))
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,90 @@
+package notification
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/events"
+)
+
+// Notification kinds
+const (
+	LimitThreshold = "limit.threshold"
+)
+
+var (
+	onceCenter     sync.Once
+	instanceCenter *Center
+)
+
+// Notification is a message for a user.
+type Notification struct {
+	ID        string      `json:"id"`
+	UserID    string      `json:"user_id"`
+	Kind      string      `json:"kind"`
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Center keeps the latest notifications of every user and pushes new ones to
+// the event bus, where the user's stream and other channels pick them up.
+type Center struct {
+	mu        sync.Mutex
+	inbox     map[string][]Notification
+	inboxSize int
+}
+
+// Service returns the notification center shared by the gateway.
+func Service() *Center {
+	onceCenter.Do(func() {
+		instanceCenter = &Center{
+			inbox:     make(map[string][]Notification),
+			inboxSize: config.Config().NotificationInboxSize,
+		}
+	})
+
+	return instanceCenter
+}
+
+// Send stores the notification in the user's inbox and publishes it.
+func (c *Center) Send(ctx context.Context, userID, kind, message string, data interface{}) Notification {
+	n := Notification{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Kind:      kind,
+		Message:   message,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+
+	c.mu.Lock()
+	inbox := append(c.inbox[userID], n)
+	if len(inbox) > c.inboxSize {
+		inbox = inbox[len(inbox)-c.inboxSize:]
+	}
+	c.inbox[userID] = inbox
+	c.mu.Unlock()
+
+	events.Service().Publish(ctx, userID, events.Notification, n)
+
+	return n
+}
+
+// List returns the user's notifications, newest first.
+func (c *Center) List(userID string) []Notification {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	inbox := c.inbox[userID]
+	notifications := make([]Notification, 0, len(inbox))
+	for i := len(inbox) - 1; i >= 0; i-- {
+		notifications = append(notifications, inbox[i])
+	}
+
+	return notifications
+}
@@ -0,0 +1,56 @@
+package otp
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+)
+
+// Sender delivers a code to the user out of band.
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// smtpSender emails codes through the configured SMTP server.
+type smtpSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// newSender returns nil when no SMTP server is configured.
+func newSender(cfg *config.Configuration) Sender {
+	if cfg.SMTPHost == "" {
+		return nil
+	}
+
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	return &smtpSender{
+		addr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		auth: auth,
+		from: cfg.SMTPFrom,
+	}
+}
+
+// Send ...
+func (s *smtpSender) Send(to, subject, body string) error {
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", to)
+	}
+
+	message := "From: " + s.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body + "\r\n"
+
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{to}, []byte(message))
+}
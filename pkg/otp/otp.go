@@ -0,0 +1,145 @@
+package otp
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/etc"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// Purposes a code can be issued for
+const (
+	LimitOverride = "limit_override"
+	StepUp        = "step_up"
+)
+
+// maxAttempts is how many wrong codes are accepted before the code is dropped.
+const maxAttempts = 5
+
+var (
+	onceStore     sync.Once
+	instanceStore *Store
+)
+
+type code struct {
+	value     string
+	expiresAt time.Time
+	attempts  int
+}
+
+// Store issues one-time codes and checks them. Codes are only ever emailed,
+// anything the bearer token can read would let a stolen token confirm itself.
+type Store struct {
+	mu     sync.Mutex
+	codes  map[string]*code
+	ttl    time.Duration
+	length int
+	db     *sqlx.DB
+	sender Sender
+}
+
+// Service returns the one-time code store shared by the handlers.
+func Service() *Store {
+	onceStore.Do(func() {
+		cfg := config.Config()
+
+		instanceStore = &Store{
+			codes:  make(map[string]*code),
+			ttl:    time.Second * time.Duration(cfg.OTPTTL),
+			length: cfg.OTPLength,
+			db:     database.Service(),
+			sender: newSender(cfg),
+		}
+	})
+
+	return instanceStore
+}
+
+// SetEmail records the address the user's codes are sent to.
+func (s *Store) SetEmail(ctx context.Context, userID, email string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_contacts (user_id, email)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET email = EXCLUDED.email`,
+		userID, email,
+	)
+
+	return err
+}
+
+// Issue emails the user a new code for the purpose, replacing an earlier one.
+func (s *Store) Issue(ctx context.Context, userID, purpose string) (time.Time, error) {
+	if s.sender == nil {
+		return time.Time{}, newerrors.ErrOTPUnavailable
+	}
+
+	var email string
+	err := s.db.GetContext(ctx, &email, `SELECT email FROM user_contacts WHERE user_id = $1`, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, newerrors.ErrNoOTPChannel
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	value := etc.GenerateCode(s.length)
+	expiresAt := time.Now().Add(s.ttl)
+	key := userID + "/" + purpose
+
+	s.mu.Lock()
+	s.codes[key] = &code{
+		value:     value,
+		expiresAt: expiresAt,
+	}
+	s.mu.Unlock()
+
+	err = s.sender.Send(email, "Your confirmation code", "Your confirmation code is "+value+
+		". It is valid until "+expiresAt.UTC().Format(time.RFC1123)+". Do not share it with anyone.")
+	if err != nil {
+		logger.Error(ctx, "Error sending one-time code", logger.Err(err), logger.Any("purpose", purpose))
+
+		s.mu.Lock()
+		if c, ok := s.codes[key]; ok && c.value == value {
+			delete(s.codes, key)
+		}
+		s.mu.Unlock()
+
+		return time.Time{}, newerrors.ErrOTPUnavailable
+	}
+
+	return expiresAt, nil
+}
+
+// Verify checks the code and uses it up.
+func (s *Store) Verify(userID, purpose, value string) error {
+	key := userID + "/" + purpose
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.codes[key]
+	if !ok || time.Now().After(c.expiresAt) {
+		delete(s.codes, key)
+		return newerrors.ErrInvalidOTP
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.value), []byte(value)) != 1 {
+		if c.attempts++; c.attempts >= maxAttempts {
+			delete(s.codes, key)
+		}
+		return newerrors.ErrInvalidOTP
+	}
+
+	delete(s.codes, key)
+
+	return nil
+}
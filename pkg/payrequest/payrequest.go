@@ -0,0 +1,273 @@
+package payrequest
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/currency"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/events"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// Request statuses
+const (
+	Pending   = "pending"
+	Accepted  = "accepted"
+	Declined  = "declined"
+	Cancelled = "cancelled"
+	Expired   = "expired"
+)
+
+// payloadScheme starts the payload put into a QR code for a request.
+const payloadScheme = "alifpay://request"
+
+var (
+	onceStore     sync.Once
+	instanceStore *Store
+)
+
+// Request is money asked by the requester from the payer.
+type Request struct {
+	ID          string
+	RequesterID string
+	PayerID     string
+	Amount      int64
+	Currency    string
+	Note        string
+	Status      string
+	// OperationID is the payer's transfer operation of an accepted request
+	OperationID string
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Link is the shareable link of the request.
+func (r Request) Link() string {
+	return config.Config().PaymentLinkURL + r.ID + "/"
+}
+
+// Payload is the text put into a QR code for the request.
+func (r Request) Payload() string {
+	query := url.Values{}
+	query.Set("id", r.ID)
+	query.Set("amount", strconv.FormatInt(r.Amount, 10))
+	query.Set("currency", r.Currency)
+
+	return payloadScheme + "?" + query.Encode()
+}
+
+// Store keeps payment requests in memory.
+type Store struct {
+	mu       sync.Mutex
+	requests map[string]*Request
+	ttl      time.Duration
+}
+
+// Service returns the payment request store shared by the handlers.
+func Service() *Store {
+	onceStore.Do(func() {
+		instanceStore = &Store{
+			requests: make(map[string]*Request),
+			ttl:      time.Second * time.Duration(config.Config().PaymentRequestTTL),
+		}
+	})
+
+	return instanceStore
+}
+
+// Create stores a pending request. Zero ttl uses the configured lifetime.
+func (s *Store) Create(request Request, ttl time.Duration) (Request, error) {
+	request.Currency = wallet.Service().Currency(request.Currency)
+	if !currency.IsSupported(currency.Provider(), request.Currency) {
+		return Request{}, newerrors.ErrUnsupportedCurrency
+	}
+
+	if ttl <= 0 {
+		ttl = s.ttl
+	}
+
+	now := time.Now()
+
+	request.ID = uuid.New().String()
+	request.Status = Pending
+	request.OperationID = ""
+	request.CreatedAt = now
+	request.UpdatedAt = now
+	request.ExpiresAt = now.Add(ttl)
+
+	s.mu.Lock()
+	s.requests[request.ID] = &request
+	s.mu.Unlock()
+
+	record(request)
+
+	return request, nil
+}
+
+// Get returns the request if the user is its requester or payer.
+func (s *Store) Get(userID, id string) (Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.requests[id]
+	if !ok || (request.RequesterID != userID && request.PayerID != userID) {
+		return Request{}, newerrors.ErrPaymentRequestNotFound
+	}
+	s.expire(request)
+
+	return *request, nil
+}
+
+// List returns the requests sent and received by the user, newest first.
+func (s *Store) List(userID string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := make([]Request, 0)
+	for _, request := range s.requests {
+		if request.RequesterID != userID && request.PayerID != userID {
+			continue
+		}
+		s.expire(request)
+		requests = append(requests, *request)
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.After(requests[j].CreatedAt)
+	})
+
+	return requests
+}
+
+// Accept pays the request by a transfer from the payer to the requester.
+func (s *Store) Accept(ctx context.Context, payerID, id string) (Request, error) {
+	s.mu.Lock()
+	request, err := s.pending(id, func(r *Request) bool { return r.PayerID == payerID })
+	if err != nil {
+		s.mu.Unlock()
+		return Request{}, err
+	}
+	// Taken out of pending before the money moves, so it can not be paid twice.
+	request.Status = Accepted
+	s.mu.Unlock()
+
+	op, err := wallet.Service().Transfer(ctx, ledger.Operation{
+		UserID:       request.PayerID,
+		Counterparty: request.RequesterID,
+		RequestID:    request.ID,
+		Currency:     request.Currency,
+		Amount:       request.Amount,
+		Note:         request.Note,
+		Category:     "transfers",
+	})
+
+	s.mu.Lock()
+	if err != nil {
+		request.Status = Pending
+		s.mu.Unlock()
+		return Request{}, err
+	}
+	request.OperationID = op.ID
+	request.UpdatedAt = time.Now()
+	accepted := *request
+	s.mu.Unlock()
+
+	record(accepted)
+
+	return accepted, nil
+}
+
+// Decline refuses the request, only its payer can decline it.
+func (s *Store) Decline(payerID, id string) (Request, error) {
+	return s.close(id, Declined, func(r *Request) bool { return r.PayerID == payerID })
+}
+
+// Cancel withdraws the request, only its requester can cancel it.
+func (s *Store) Cancel(requesterID, id string) (Request, error) {
+	return s.close(id, Cancelled, func(r *Request) bool { return r.RequesterID == requesterID })
+}
+
+func (s *Store) close(id, status string, allowed func(*Request) bool) (Request, error) {
+	s.mu.Lock()
+	request, err := s.pending(id, allowed)
+	if err != nil {
+		s.mu.Unlock()
+		return Request{}, err
+	}
+	request.Status = status
+	request.UpdatedAt = time.Now()
+	closed := *request
+	s.mu.Unlock()
+
+	record(closed)
+
+	return closed, nil
+}
+
+// pending returns the request if the user may change it and it is still pending.
+// It must be called with s.mu held.
+func (s *Store) pending(id string, allowed func(*Request) bool) (*Request, error) {
+	request, ok := s.requests[id]
+	if !ok || !allowed(request) {
+		return nil, newerrors.ErrPaymentRequestNotFound
+	}
+
+	if s.expire(request); request.Status != Pending {
+		return nil, newerrors.ErrPaymentRequestNotPending
+	}
+
+	return request, nil
+}
+
+// expire marks a pending request past its expiry as expired.
+// It must be called with s.mu held.
+func (s *Store) expire(request *Request) {
+	if request.Status != Pending || time.Now().Before(request.ExpiresAt) {
+		return
+	}
+
+	request.Status = Expired
+	request.UpdatedAt = request.ExpiresAt
+
+	record(*request)
+}
+
+// record puts the request's status into both users' histories. The status
+// changed already, so it is recorded even if the request was cancelled.
+func record(request Request) {
+	ctx, cancel := wallet.Service().Detached()
+	defer cancel()
+
+	for _, side := range [][2]string{
+		{request.RequesterID, request.PayerID},
+		{request.PayerID, request.RequesterID},
+	} {
+		op, err := ledger.Service().Record(ctx, ledger.Operation{
+			UserID:       side[0],
+			Type:         ledger.PaymentRequest,
+			Currency:     request.Currency,
+			Amount:       request.Amount,
+			Counterparty: side[1],
+			RequestID:    request.ID,
+			Status:       request.Status,
+			Note:         request.Note,
+		})
+		if err != nil {
+			logger.Error(ctx, "Error while recording a payment request", logger.Any("request_id", request.ID), logger.Err(err))
+			continue
+		}
+
+		events.Service().Publish(ctx, op.UserID, events.OperationPrefix+op.Type, op)
+	}
+}
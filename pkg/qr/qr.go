@@ -0,0 +1,524 @@
+// Package qr encodes text into QR codes in byte mode with medium error
+// correction, which is what payment payloads need.
+package qr
+
+import (
+	"errors"
+)
+
+// ErrTooLong is returned for text that does not fit into the largest supported version.
+var ErrTooLong = errors.New("qr: text is too long")
+
+// blockLayout is the error correction block structure of a version at level M.
+type blockLayout struct {
+	ecPerBlock int
+	// groups of blocks as {number of blocks, data codewords per block}
+	groups [2][2]int
+}
+
+// layouts of versions 1 to 20 at level M, indexed by version.
+var layouts = [...]blockLayout{
+	{},
+	{10, [2][2]int{{1, 16}}},
+	{16, [2][2]int{{1, 28}}},
+	{26, [2][2]int{{1, 44}}},
+	{18, [2][2]int{{2, 32}}},
+	{24, [2][2]int{{2, 43}}},
+	{16, [2][2]int{{4, 27}}},
+	{18, [2][2]int{{4, 31}}},
+	{22, [2][2]int{{2, 38}, {2, 39}}},
+	{22, [2][2]int{{3, 36}, {2, 37}}},
+	{26, [2][2]int{{4, 43}, {1, 44}}},
+	{30, [2][2]int{{1, 50}, {4, 51}}},
+	{22, [2][2]int{{6, 36}, {2, 37}}},
+	{22, [2][2]int{{8, 37}, {1, 38}}},
+	{24, [2][2]int{{4, 40}, {5, 41}}},
+	{24, [2][2]int{{5, 41}, {5, 42}}},
+	{28, [2][2]int{{7, 45}, {3, 46}}},
+	{28, [2][2]int{{10, 46}, {1, 47}}},
+	{26, [2][2]int{{9, 43}, {4, 44}}},
+	{26, [2][2]int{{3, 44}, {11, 45}}},
+	{26, [2][2]int{{3, 41}, {13, 42}}},
+}
+
+func (l blockLayout) dataCodewords() int {
+	return l.groups[0][0]*l.groups[0][1] + l.groups[1][0]*l.groups[1][1]
+}
+
+// Code is an encoded QR symbol.
+type Code struct {
+	Version int
+	Size    int
+	modules [][]bool
+	// function marks modules of patterns, which are not masked
+	function [][]bool
+}
+
+// Dark tells whether the module in column x and row y is dark.
+func (q *Code) Dark(x, y int) bool {
+	return q.modules[y][x]
+}
+
+// Encode makes the smallest QR code holding the text.
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+
+	version := 1
+	for ; version < len(layouts); version++ {
+		if bitsNeeded(version, len(data)) <= layouts[version].dataCodewords()*8 {
+			break
+		}
+	}
+	if version == len(layouts) {
+		return nil, ErrTooLong
+	}
+
+	q := newCode(version)
+	q.drawFunctionPatterns()
+	q.drawCodewords(q.addErrorCorrection(q.dataCodewords(data)))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		// Masking twice restores the modules.
+		q.applyMask(mask)
+	}
+
+	q.applyMask(best)
+	q.drawFormatBits(best)
+
+	return q, nil
+}
+
+func bitsNeeded(version, length int) int {
+	return 4 + countBits(version) + length*8
+}
+
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+
+	return 16
+}
+
+func newCode(version int) *Code {
+	size := version*4 + 17
+
+	q := &Code{
+		Version:  version,
+		Size:     size,
+		modules:  make([][]bool, size),
+		function: make([][]bool, size),
+	}
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+
+	return q
+}
+
+func (q *Code) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+func (q *Code) drawFunctionPatterns() {
+	for i := 0; i < q.Size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+
+	q.drawFinder(3, 3)
+	q.drawFinder(q.Size-4, 3)
+	q.drawFinder(3, q.Size-4)
+
+	positions := alignmentPositions(q.Version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Skip the corners taken by finder patterns.
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			q.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format areas, they are drawn for real after masking.
+	q.drawFormatBits(0)
+	q.drawVersion()
+}
+
+func (q *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= q.Size || y < 0 || y >= q.Size {
+				continue
+			}
+
+			dist := abs(dx)
+			if abs(dy) > dist {
+				dist = abs(dy)
+			}
+			q.set(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (q *Code) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			dist := abs(dx)
+			if abs(dy) > dist {
+				dist = abs(dy)
+			}
+			q.set(cx+dx, cy+dy, dist != 1)
+		}
+	}
+}
+
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	count := version/7 + 2
+	step := (version*8 + count*3 + 5) / (count*4 - 4) * 2
+
+	positions := make([]int, count)
+	positions[0] = 6
+	for i, pos := count-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+
+	return positions
+}
+
+// drawFormatBits draws the error correction level M and the mask, twice.
+func (q *Code) drawFormatBits(mask int) {
+	data := mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(bits, i))
+	}
+	q.set(8, 7, bit(bits, 6))
+	q.set(8, 8, bit(bits, 7))
+	q.set(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.set(q.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.Size-15+i, bit(bits, i))
+	}
+	q.set(8, q.Size-8, true)
+}
+
+func (q *Code) drawVersion() {
+	if q.Version < 7 {
+		return
+	}
+
+	rem := q.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := q.Version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		a, b := q.Size-11+i%3, i/3
+		q.set(a, b, bit(bits, i))
+		q.set(b, a, bit(bits, i))
+	}
+}
+
+// dataCodewords puts the text in byte mode and pads it to the capacity.
+func (q *Code) dataCodewords(data []byte) []byte {
+	capacity := layouts[q.Version].dataCodewords() * 8
+
+	var w bitWriter
+	w.write(0x4, 4)
+	w.write(len(data), countBits(q.Version))
+	for _, b := range data {
+		w.write(int(b), 8)
+	}
+
+	terminator := capacity - w.length
+	if terminator > 4 {
+		terminator = 4
+	}
+	w.write(0, terminator)
+	if w.length%8 != 0 {
+		w.write(0, 8-w.length%8)
+	}
+
+	for pad := 0xEC; w.length < capacity; pad ^= 0xEC ^ 0x11 {
+		w.write(pad, 8)
+	}
+
+	return w.bytes
+}
+
+// addErrorCorrection splits the data into blocks and interleaves them with
+// their error correction codewords.
+func (q *Code) addErrorCorrection(data []byte) []byte {
+	layout := layouts[q.Version]
+	divisor := rsDivisor(layout.ecPerBlock)
+
+	var blocks, ecBlocks [][]byte
+	offset := 0
+	for _, group := range layout.groups {
+		for i := 0; i < group[0]; i++ {
+			block := data[offset : offset+group[1]]
+			offset += group[1]
+
+			blocks = append(blocks, block)
+			ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+		}
+	}
+
+	result := make([]byte, 0, len(data)+len(blocks)*layout.ecPerBlock)
+	for i := 0; ; i++ {
+		added := false
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+
+	return result
+}
+
+// drawCodewords fills the data area in the zigzag order.
+func (q *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.Size - 1 - vert
+				}
+
+				if !q.function[y][x] && i < len(codewords)*8 {
+					q.modules[y][x] = bit(int(codewords[i>>3]), 7-i&7)
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *Code) applyMask(mask int) {
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.function[y][x] {
+				continue
+			}
+
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+
+			if invert {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to read, lower is better.
+func (q *Code) penalty() int {
+	result := 0
+
+	line := func(get func(i int) bool) {
+		run, prev := 0, false
+		history := make([]bool, 0, q.Size)
+		for i := 0; i < q.Size; i++ {
+			dark := get(i)
+			history = append(history, dark)
+
+			if i > 0 && dark == prev {
+				run++
+			} else {
+				if run >= 5 {
+					result += run - 2
+				}
+				run = 1
+			}
+			prev = dark
+
+			// Finder-like pattern 1011101 with four light modules on a side.
+			if i >= 10 {
+				window := history[i-10 : i+1]
+				if matches(window, "10111010000") || matches(window, "00001011101") {
+					result += 40
+				}
+			}
+		}
+		if run >= 5 {
+			result += run - 2
+		}
+	}
+
+	for y := 0; y < q.Size; y++ {
+		line(func(i int) bool { return q.modules[y][i] })
+	}
+	for x := 0; x < q.Size; x++ {
+		line(func(i int) bool { return q.modules[i][x] })
+	}
+
+	dark := 0
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+
+			if x < q.Size-1 && y < q.Size-1 {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					result += 3
+				}
+			}
+		}
+	}
+
+	total := q.Size * q.Size
+	deviation := abs(dark*20-total*10)/total - 1
+	if deviation > 0 {
+		result += deviation * 10
+	}
+
+	return result
+}
+
+func matches(window []bool, pattern string) bool {
+	for i, dark := range window {
+		if dark != (pattern[i] == '1') {
+			return false
+		}
+	}
+
+	return true
+}
+
+type bitWriter struct {
+	bytes  []byte
+	length int
+}
+
+func (w *bitWriter) write(value, count int) {
+	for i := count - 1; i >= 0; i-- {
+		if w.length%8 == 0 {
+			w.bytes = append(w.bytes, 0)
+		}
+		if value>>uint(i)&1 == 1 {
+			w.bytes[len(w.bytes)-1] |= 1 << uint(7-w.length%8)
+		}
+		w.length++
+	}
+}
+
+// rsDivisor returns the generator polynomial of the given degree, highest
+// coefficient first without the leading 1.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+
+	return byte(z)
+}
+
+func bit(value, i int) bool {
+	return value>>uint(i)&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
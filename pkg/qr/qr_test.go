@@ -0,0 +1,202 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestEncodeVersion(t *testing.T) {
+	tests := []struct {
+		length  int
+		version int
+		err     error
+	}{
+		{0, 1, nil},
+		{14, 1, nil},
+		{15, 2, nil},
+		{26, 2, nil},
+		{27, 3, nil},
+		{62, 4, nil},
+		{63, 5, nil},
+		{180, 9, nil},
+		{181, 10, nil},
+		{666, 20, nil},
+		{667, 0, ErrTooLong},
+	}
+
+	for _, tt := range tests {
+		q, err := Encode(strings.Repeat("a", tt.length))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Encode(%d bytes) error = %v, want %v", tt.length, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if q.Version != tt.version {
+			t.Errorf("Encode(%d bytes) version = %d, want %d", tt.length, q.Version, tt.version)
+		}
+		if q.Size != tt.version*4+17 {
+			t.Errorf("Encode(%d bytes) size = %d, want %d", tt.length, q.Size, tt.version*4+17)
+		}
+	}
+}
+
+func TestEncodePatterns(t *testing.T) {
+	// format information of level M for masks 0 to 7
+	formats := map[int]bool{
+		0x5412: true, 0x5125: true, 0x5E7C: true, 0x5B4B: true,
+		0x45F9: true, 0x40CE: true, 0x4F97: true, 0x4AA0: true,
+	}
+	// version information of versions 7 and up
+	versions := map[int]int{7: 0x07C94, 8: 0x085BC, 10: 0x0A4D3}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"version 1", "000201010211"},
+		{"version 4", strings.Repeat("x", 60)},
+		{"version 7", strings.Repeat("y", 120)},
+		{"version 8", strings.Repeat("z", 150)},
+		{"version 10", strings.Repeat("w", 200)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Encode(tt.text)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			// finder patterns in three corners, with their light separators
+			for _, corner := range [][2]int{{0, 0}, {q.Size - 7, 0}, {0, q.Size - 7}} {
+				x, y := corner[0], corner[1]
+				if !q.Dark(x, y) || !q.Dark(x+6, y+6) || !q.Dark(x+3, y+3) || q.Dark(x+1, y+1) {
+					t.Errorf("no finder pattern at %d,%d", x, y)
+				}
+			}
+			if q.Dark(7, 7) || q.Dark(q.Size-8, 7) || q.Dark(7, q.Size-8) {
+				t.Error("finder separators are dark")
+			}
+
+			for i := 8; i < q.Size-8; i++ {
+				if q.Dark(i, 6) != (i%2 == 0) || q.Dark(6, i) != (i%2 == 0) {
+					t.Errorf("timing patterns are broken at %d", i)
+					break
+				}
+			}
+
+			if !q.Dark(8, q.Size-8) {
+				t.Error("dark module is light")
+			}
+
+			var first, second int
+			for i := 0; i < 15; i++ {
+				var x, y int
+				switch {
+				case i <= 5:
+					x, y = 8, i
+				case i == 6:
+					x, y = 8, 7
+				case i == 7:
+					x, y = 8, 8
+				case i == 8:
+					x, y = 7, 8
+				default:
+					x, y = 14-i, 8
+				}
+				if q.Dark(x, y) {
+					first |= 1 << uint(i)
+				}
+
+				if i < 8 {
+					x, y = q.Size-1-i, 8
+				} else {
+					x, y = 8, q.Size-15+i
+				}
+				if q.Dark(x, y) {
+					second |= 1 << uint(i)
+				}
+			}
+			if !formats[first] {
+				t.Errorf("format information = %015b, want level M", first)
+			}
+			if first != second {
+				t.Errorf("format information copies differ: %015b and %015b", first, second)
+			}
+
+			want, ok := versions[q.Version]
+			if !ok {
+				return
+			}
+			var upper, lower int
+			for i := 0; i < 18; i++ {
+				a, b := q.Size-11+i%3, i/3
+				if q.Dark(a, b) {
+					upper |= 1 << uint(i)
+				}
+				if q.Dark(b, a) {
+					lower |= 1 << uint(i)
+				}
+			}
+			if upper != want || lower != want {
+				t.Errorf("version information = %018b and %018b, want %018b", upper, lower, want)
+			}
+		})
+	}
+}
+
+func TestErrorCorrection(t *testing.T) {
+	// "HELLO WORLD" at version 1-M, from the worked example of the standard
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if got := rsRemainder(data, rsDivisor(len(want))); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder() = %v, want %v", got, want)
+	}
+}
+
+func TestGFMultiply(t *testing.T) {
+	tests := []struct {
+		x, y, want byte
+	}{
+		{0, 0x53, 0},
+		{1, 0x53, 0x53},
+		{2, 0x80, 0x1D},
+		{0x80, 2, 0x1D},
+		{2, 0x8E, 0x01},
+	}
+
+	for _, tt := range tests {
+		if got := gfMultiply(tt.x, tt.y); got != tt.want {
+			t.Errorf("gfMultiply(%#x, %#x) = %#x, want %#x", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	q, err := Encode("hello")
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	data, err := q.PNG(3)
+	if err != nil {
+		t.Fatalf("PNG() error = %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+
+	side := (q.Size + quietZone*2) * 3
+	if bounds := img.Bounds(); bounds.Dx() != side || bounds.Dy() != side {
+		t.Errorf("PNG() size = %v, want %dx%d", bounds.Size(), side, side)
+	}
+}
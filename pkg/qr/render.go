@@ -0,0 +1,55 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// quietZone is the light border around the symbol, in modules.
+const quietZone = 4
+
+// PNG draws the code with scale pixels per module.
+func (q *Code) PNG(scale int) ([]byte, error) {
+	side := (q.Size + quietZone*2) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			mx, my := x/scale-quietZone, y/scale-quietZone
+
+			c := color.Gray{Y: 0xFF}
+			if mx >= 0 && my >= 0 && mx < q.Size && my < q.Size && q.modules[my][mx] {
+				c = color.Gray{Y: 0x00}
+			}
+			img.SetGray(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// SVG draws the code as a single path, one unit per module.
+func (q *Code) SVG() string {
+	side := q.Size + quietZone*2
+
+	var path strings.Builder
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.modules[y][x] {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+quietZone, y+quietZone)
+			}
+		}
+	}
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#FFFFFF"/><path d="%s" fill="#000000"/></svg>`, side, side, path.String())
+}
@@ -0,0 +1,359 @@
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Knetic/govaluate"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// Rule outcomes, the strictest outcome of the matched rules wins
+const (
+	Allow  = "allow"
+	StepUp = "step_up"
+	Deny   = "deny"
+)
+
+var severity = map[string]int{
+	Allow:  0,
+	StepUp: 1,
+	Deny:   2,
+}
+
+// MaxDecisions caps the decisions listed at once.
+const MaxDecisions = 1000
+
+var (
+	onceEngine     sync.Once
+	instanceEngine *Engine
+)
+
+// Rule is an expression over the parameters of an attempt. The parameters are:
+//
+//	type                    income, expense, transfer or exchange_out
+//	amount                  amount of the attempt
+//	currency, category, merchant
+//	hour                    hour of the day, 0-23
+//	operations_last_minute  attempts of the user in the last minute, this one included
+//	operations_last_hour    attempts of the user in the last hour, this one included
+//	history_count           earlier operations of the same type, direction and currency
+//	average_amount          their average amount, 0 without history
+//	max_amount              their largest amount, 0 without history
+//	new_ip                  the address was never trusted for the user, who has others trusted
+//	new_device              the device was never trusted for the user, who has others trusted
+//	new_recipient           the user never transferred to the recipient before
+//
+// Addresses and devices are trusted once an attempt from them is allowed or
+// confirmed with a one-time code.
+type Rule struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	Outcome    string `json:"outcome"`
+
+	expression *govaluate.EvaluableExpression
+}
+
+// Attempt is a money operation about to be done.
+type Attempt struct {
+	UserID    string
+	Type      string
+	Amount    int64
+	Currency  string
+	Category  string
+	Merchant  string
+	Recipient string
+	// IP is the address the attempt came from as the gateway sees it
+	IP string
+	// DeviceID is the identifier the client sent for its device. Clients
+	// choose it, so a new one only ever makes the rules stricter.
+	DeviceID string
+}
+
+// Decision is the audited result of evaluating an attempt.
+type Decision struct {
+	ID        string `db:"id"`
+	UserID    string `db:"user_id"`
+	Type      string `db:"type"`
+	Amount    int64  `db:"amount"`
+	Currency  string `db:"currency"`
+	Recipient string `db:"recipient"`
+	IP        string `db:"ip"`
+	DeviceID  string `db:"device_id"`
+	Outcome   string `db:"outcome"`
+	// Rules are the names of the matched rules
+	Rules []string `db:"-"`
+	// Confirmed tells a step up decision was confirmed with a one-time code
+	Confirmed bool      `db:"confirmed"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// decisionRow is a decision as it is read from the database.
+type decisionRow struct {
+	Decision
+	Rules pq.StringArray `db:"rules"`
+}
+
+const decisionColumns = `id, user_id, type, amount, currency, recipient, ip, device_id, outcome, rules, confirmed, created_at`
+
+// activity is what the earlier decisions tell about the user.
+type activity struct {
+	LastMinute int64 `db:"last_minute"`
+	LastHour   int64 `db:"last_hour"`
+	// KnownIP tells the address of the attempt is trusted, TrustedIP that any is
+	KnownIP   bool `db:"known_ip"`
+	TrustedIP bool `db:"trusted_ip"`
+	// KnownDevice tells the device of the attempt is trusted, TrustedDevice that any is
+	KnownDevice   bool `db:"known_device"`
+	TrustedDevice bool `db:"trusted_device"`
+}
+
+// Engine evaluates attempts against the rules and keeps its decisions in the
+// shared database, they are both the audit and the activity the rules count.
+type Engine struct {
+	db    *sqlx.DB
+	rules []*Rule
+}
+
+// Service returns the rules engine shared by the handlers.
+func Service() *Engine {
+	onceEngine.Do(func() {
+		cfg := config.Config()
+
+		rules, err := LoadRules(cfg.RiskRulesPath)
+		if err != nil {
+			panic(fmt.Errorf("risk rules %s: %s", cfg.RiskRulesPath, err))
+		}
+
+		instanceEngine = NewEngine(database.Service(), rules)
+	})
+
+	return instanceEngine
+}
+
+// NewEngine ...
+func NewEngine(db *sqlx.DB, rules []*Rule) *Engine {
+	return &Engine{
+		db:    db,
+		rules: rules,
+	}
+}
+
+// LoadRules reads rules from a JSON file like
+// [{"name": "velocity", "expression": "operations_last_minute >= 5", "outcome": "deny"}].
+// Rules naming unknown parameters or not evaluating to a condition are rejected.
+func LoadRules(path string) ([]*Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []*Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+
+	sample := parameters(Attempt{}, ledger.Stats{}, activity{}, time.Time{})
+	for _, rule := range rules {
+		if _, ok := severity[rule.Outcome]; !ok {
+			return nil, fmt.Errorf("rule %s: unknown outcome '%s'", rule.Name, rule.Outcome)
+		}
+
+		rule.expression, err = govaluate.NewEvaluableExpression(rule.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %s", rule.Name, err)
+		}
+
+		for _, name := range rule.expression.Vars() {
+			if _, ok := sample[name]; !ok {
+				return nil, fmt.Errorf("rule %s: unknown parameter '%s'", rule.Name, name)
+			}
+		}
+
+		result, err := rule.expression.Evaluate(sample)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %s", rule.Name, err)
+		}
+		if _, ok := result.(bool); !ok {
+			return nil, fmt.Errorf("rule %s: not a condition", rule.Name)
+		}
+	}
+
+	return rules, nil
+}
+
+// Evaluate decides on the attempt and records the decision. Attempts of a user
+// are decided one at a time on every instance, so each one counts the others.
+func (e *Engine) Evaluate(ctx context.Context, attempt Attempt) (Decision, error) {
+	direction := ledger.Debit
+	if attempt.Type == ledger.Income {
+		direction = ledger.Credit
+	}
+
+	history, err := ledger.Service().Stats(ctx, attempt.UserID, direction, attempt.Recipient, ledger.Filter{
+		Type:     attempt.Type,
+		Currency: attempt.Currency,
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+
+	decision := Decision{
+		ID:        uuid.New().String(),
+		UserID:    attempt.UserID,
+		Type:      attempt.Type,
+		Amount:    attempt.Amount,
+		Currency:  attempt.Currency,
+		Recipient: attempt.Recipient,
+		IP:        attempt.IP,
+		DeviceID:  attempt.DeviceID,
+		CreatedAt: time.Now(),
+	}
+
+	err = database.InTx(ctx, e.db, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "risk:"+attempt.UserID); err != nil {
+			return err
+		}
+
+		var seen activity
+		err := tx.GetContext(ctx, &seen, `
+			SELECT
+				(SELECT count(*) FROM risk_decisions
+					WHERE user_id = $1 AND created_at >= $2::timestamptz - interval '1 minute') AS last_minute,
+				(SELECT count(*) FROM risk_decisions
+					WHERE user_id = $1 AND created_at >= $2::timestamptz - interval '1 hour') AS last_hour,
+				EXISTS (SELECT 1 FROM risk_decisions
+					WHERE user_id = $1 AND ip = $3 AND (outcome = 'allow' OR confirmed)) AS known_ip,
+				EXISTS (SELECT 1 FROM risk_decisions
+					WHERE user_id = $1 AND ip <> '' AND (outcome = 'allow' OR confirmed)) AS trusted_ip,
+				EXISTS (SELECT 1 FROM risk_decisions
+					WHERE user_id = $1 AND device_id = $4 AND (outcome = 'allow' OR confirmed)) AS known_device,
+				EXISTS (SELECT 1 FROM risk_decisions
+					WHERE user_id = $1 AND device_id <> '' AND (outcome = 'allow' OR confirmed)) AS trusted_device`,
+			attempt.UserID, decision.CreatedAt, attempt.IP, attempt.DeviceID)
+		if err != nil {
+			return err
+		}
+
+		decision.Outcome, decision.Rules = e.match(ctx, parameters(attempt, history, seen, decision.CreatedAt))
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO risk_decisions (`+decisionColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			decision.ID, decision.UserID, decision.Type, decision.Amount, decision.Currency, decision.Recipient,
+			decision.IP, decision.DeviceID, decision.Outcome, pq.StringArray(decision.Rules), decision.Confirmed, decision.CreatedAt)
+		return err
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+
+	logger.Info(ctx, "Risk decision",
+		logger.Any("decision_id", decision.ID),
+		logger.Any("user_id", decision.UserID),
+		logger.Any("type", decision.Type),
+		logger.Any("amount", decision.Amount),
+		logger.Any("currency", decision.Currency),
+		logger.Any("ip", decision.IP),
+		logger.Any("device_id", decision.DeviceID),
+		logger.Any("outcome", decision.Outcome),
+		logger.Any("rules", decision.Rules),
+	)
+
+	return decision, nil
+}
+
+// match evaluates the rules against the parameters and returns the strictest
+// outcome with the names of the matched rules. A rule failing to evaluate
+// matches with the deny outcome, so a broken rule never lets attempts through.
+func (e *Engine) match(ctx context.Context, parameters map[string]interface{}) (string, []string) {
+	outcome, rules := Allow, []string{}
+
+	for _, rule := range e.rules {
+		ruleOutcome := rule.Outcome
+
+		result, err := rule.expression.Evaluate(parameters)
+		matched, ok := result.(bool)
+		if err != nil || !ok {
+			logger.Error(ctx, "Error while evaluating risk rule, denying",
+				logger.Any("rule", rule.Name), logger.Any("result", result), logger.Err(err))
+			matched, ruleOutcome = true, Deny
+		}
+
+		if !matched {
+			continue
+		}
+
+		rules = append(rules, rule.Name)
+		if severity[ruleOutcome] > severity[outcome] {
+			outcome = ruleOutcome
+		}
+	}
+
+	return outcome, rules
+}
+
+// Confirm marks a step up decision as confirmed by the user, which trusts its
+// address and device.
+func (e *Engine) Confirm(ctx context.Context, id string) error {
+	_, err := e.db.ExecContext(ctx, `UPDATE risk_decisions SET confirmed = TRUE WHERE id = $1`, id)
+	return err
+}
+
+// Decisions returns at most limit audited decisions, newest first. Empty
+// userID or outcome match all.
+func (e *Engine) Decisions(ctx context.Context, userID, outcome string, limit int) ([]Decision, error) {
+	if limit <= 0 || limit > MaxDecisions {
+		limit = MaxDecisions
+	}
+
+	var rows []decisionRow
+	err := e.db.SelectContext(ctx, &rows, `
+		SELECT `+decisionColumns+` FROM risk_decisions
+		WHERE ($1 = '' OR user_id = $1) AND ($2 = '' OR outcome = $2)
+		ORDER BY created_at DESC LIMIT $3`, userID, outcome, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := make([]Decision, 0, len(rows))
+	for _, row := range rows {
+		decision := row.Decision
+		decision.Rules = append([]string{}, row.Rules...)
+		decisions = append(decisions, decision)
+	}
+
+	return decisions, nil
+}
+
+// parameters returns the parameters of the attempt for the rules, the attempt
+// is counted in with the earlier ones.
+func parameters(attempt Attempt, history ledger.Stats, seen activity, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"type":                   attempt.Type,
+		"amount":                 float64(attempt.Amount),
+		"currency":               attempt.Currency,
+		"category":               attempt.Category,
+		"merchant":               attempt.Merchant,
+		"hour":                   float64(now.Hour()),
+		"operations_last_minute": float64(seen.LastMinute + 1),
+		"operations_last_hour":   float64(seen.LastHour + 1),
+		"history_count":          float64(history.Count),
+		"average_amount":         history.Average,
+		"max_amount":             float64(history.Largest),
+		"new_ip":                 attempt.IP != "" && seen.TrustedIP && !seen.KnownIP,
+		"new_device":             attempt.DeviceID != "" && seen.TrustedDevice && !seen.KnownDevice,
+		"new_recipient":          attempt.Recipient != "" && !history.Counterparty,
+	}
+}
@@ -0,0 +1,329 @@
+package risk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Knetic/govaluate"
+	"github.com/google/uuid"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/testenv"
+)
+
+func writeRules(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	return path
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{name: "empty", content: `[]`},
+		{name: "rules", content: `[{"name": "big", "expression": "amount > 100", "outcome": "deny"}, {"name": "night", "expression": "hour < 6", "outcome": "step_up"}]`, want: 2},
+		{name: "not json", content: `big: amount > 100`, wantErr: true},
+		{name: "unknown outcome", content: `[{"name": "big", "expression": "amount > 100", "outcome": "block"}]`, wantErr: true},
+		{name: "no outcome", content: `[{"name": "big", "expression": "amount > 100"}]`, wantErr: true},
+		{name: "bad expression", content: `[{"name": "big", "expression": "amount >", "outcome": "deny"}]`, wantErr: true},
+		{name: "unknown parameter", content: `[{"name": "device", "expression": "device == 'new'", "outcome": "deny"}]`, wantErr: true},
+		{name: "unknown parameter after a false condition", content: `[{"name": "device", "expression": "type == 'transfer' && device == 'new'", "outcome": "deny"}]`, wantErr: true},
+		{name: "not a condition", content: `[{"name": "double", "expression": "amount * 2", "outcome": "deny"}]`, wantErr: true},
+		{name: "not comparable", content: `[{"name": "big", "expression": "amount > 'large'", "outcome": "deny"}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		rules, err := LoadRules(writeRules(t, tt.content))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: LoadRules() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(rules) != tt.want {
+			t.Errorf("%s: LoadRules() = %d rules, want %d", tt.name, len(rules), tt.want)
+		}
+	}
+
+	if _, err := LoadRules(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadRules() of a missing file error = nil, want an error")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules, err := LoadRules("../../config/risk_rules.json")
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	debits := ledger.Stats{Count: 5, Average: 100, Largest: 100}
+
+	tests := []struct {
+		name    string
+		attempt Attempt
+		// history of the operations like the attempt
+		history ledger.Stats
+		// seen is what the earlier decisions of the user tell
+		seen        activity
+		wantOutcome string
+		wantRules   []string
+	}{
+		{
+			name:        "small expense",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 100},
+			wantOutcome: Allow,
+			wantRules:   []string{},
+		},
+		{
+			name:        "velocity",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 100},
+			seen:        activity{LastMinute: 4, LastHour: 4},
+			wantOutcome: Deny,
+			wantRules:   []string{"velocity"},
+		},
+		{
+			name:        "attempts older than a minute are no velocity",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 100},
+			seen:        activity{LastMinute: 3, LastHour: 4},
+			wantOutcome: Allow,
+			wantRules:   []string{},
+		},
+		{
+			name:        "income is never limited",
+			attempt:     Attempt{Type: ledger.Income, Amount: 100},
+			seen:        activity{LastMinute: 40, LastHour: 40},
+			wantOutcome: Allow,
+			wantRules:   []string{},
+		},
+		{
+			name:        "burst",
+			attempt:     Attempt{Type: ledger.Transfer, Amount: 100},
+			seen:        activity{LastHour: 29},
+			wantOutcome: StepUp,
+			wantRules:   []string{"burst"},
+		},
+		{
+			name:        "deny wins over step up",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 100},
+			seen:        activity{LastMinute: 29, LastHour: 29},
+			wantOutcome: Deny,
+			wantRules:   []string{"velocity", "burst"},
+		},
+		{
+			name:        "amount spike",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 1001},
+			history:     debits,
+			wantOutcome: StepUp,
+			wantRules:   []string{"amount_spike"},
+		},
+		{
+			name:        "ten times the average",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 1000},
+			history:     debits,
+			wantOutcome: Allow,
+			wantRules:   []string{},
+		},
+		{
+			name:        "too little history for a spike",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 100000},
+			history:     ledger.Stats{Count: 4, Average: 100, Largest: 100},
+			wantOutcome: Allow,
+			wantRules:   []string{},
+		},
+		{
+			name:        "income is never a spike",
+			attempt:     Attempt{Type: ledger.Income, Amount: 100000},
+			history:     debits,
+			wantOutcome: Allow,
+			wantRules:   []string{},
+		},
+		{
+			name:        "large amount from a new address",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 1000000, IP: "10.0.0.2"},
+			seen:        activity{TrustedIP: true},
+			wantOutcome: StepUp,
+			wantRules:   []string{"new_ip_large_amount"},
+		},
+		{
+			name:        "large amount from a trusted address",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 1000000, IP: "10.0.0.1"},
+			seen:        activity{TrustedIP: true, KnownIP: true},
+			wantOutcome: Allow,
+			wantRules:   []string{},
+		},
+		{
+			name:        "first address of the user",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 1000000, IP: "10.0.0.1"},
+			wantOutcome: Allow,
+			wantRules:   []string{},
+		},
+		{
+			name:        "new device",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 100000, DeviceID: "tablet"},
+			seen:        activity{TrustedDevice: true},
+			wantOutcome: StepUp,
+			wantRules:   []string{"new_device"},
+		},
+		{
+			name:        "trusted device",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 100000, DeviceID: "phone"},
+			seen:        activity{TrustedDevice: true, KnownDevice: true},
+			wantOutcome: Allow,
+			wantRules:   []string{},
+		},
+		{
+			name:        "first device of the user",
+			attempt:     Attempt{Type: ledger.Expense, Amount: 100000, DeviceID: "phone"},
+			wantOutcome: Allow,
+			wantRules:   []string{},
+		},
+		{
+			name:        "first transfer to a recipient",
+			attempt:     Attempt{Type: ledger.Transfer, Amount: 500000, Recipient: "bob"},
+			wantOutcome: StepUp,
+			wantRules:   []string{"first_transfer_to_recipient"},
+		},
+		{
+			name:        "transfer to a known recipient",
+			attempt:     Attempt{Type: ledger.Transfer, Amount: 500000, Recipient: "bob"},
+			history:     ledger.Stats{Count: 1, Average: 10, Largest: 10, Counterparty: true},
+			wantOutcome: Allow,
+			wantRules:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEngine(nil, rules)
+			tt.attempt.UserID = "user"
+
+			outcome, matched := e.match(context.Background(), parameters(tt.attempt, tt.history, tt.seen, now))
+			if outcome != tt.wantOutcome || !reflect.DeepEqual(matched, tt.wantRules) {
+				t.Errorf("match() = %s %v, want %s %v", outcome, matched, tt.wantOutcome, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestMatchFailsClosed(t *testing.T) {
+	rule := func(name, expression, outcome string) *Rule {
+		parsed, err := govaluate.NewEvaluableExpression(expression)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return &Rule{Name: name, Expression: expression, Outcome: outcome, expression: parsed}
+	}
+
+	// The rules are made by hand, LoadRules rejects the broken ones.
+	tests := []struct {
+		name        string
+		rules       []*Rule
+		wantOutcome string
+		wantRules   []string
+	}{
+		{
+			name:        "unknown parameter",
+			rules:       []*Rule{rule("device", "device == 'new'", StepUp)},
+			wantOutcome: Deny,
+			wantRules:   []string{"device"},
+		},
+		{
+			name:        "not a condition",
+			rules:       []*Rule{rule("double", "amount * 2", Allow)},
+			wantOutcome: Deny,
+			wantRules:   []string{"double"},
+		},
+		{
+			name: "broken rule among working ones",
+			rules: []*Rule{
+				rule("strings", "currency == 'USD' && category == 'food'", StepUp),
+				rule("not comparable", "amount > 'large'", StepUp),
+				rule("small", "amount < 10", Deny),
+			},
+			wantOutcome: Deny,
+			wantRules:   []string{"strings", "not comparable"},
+		},
+	}
+
+	attempt := Attempt{UserID: "user", Type: ledger.Expense, Amount: 100, Currency: "USD", Category: "food"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEngine(nil, tt.rules)
+
+			outcome, matched := e.match(context.Background(), parameters(attempt, ledger.Stats{}, activity{}, time.Now()))
+			if outcome != tt.wantOutcome || !reflect.DeepEqual(matched, tt.wantRules) {
+				t.Errorf("match() = %s %v, want %s %v", outcome, matched, tt.wantOutcome, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestEvaluateAcrossInstances(t *testing.T) {
+	db := testenv.DB(t)
+	ctx := context.Background()
+
+	rules, err := LoadRules("../../config/risk_rules.json")
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+	first, second := NewEngine(db, rules), NewEngine(db, rules)
+	userID := uuid.New().String()
+
+	// The attempts counted by the velocity rule are made on either instance.
+	for i := 0; i < 4; i++ {
+		e := first
+		if i%2 == 1 {
+			e = second
+		}
+		decision, err := e.Evaluate(ctx, Attempt{UserID: userID, Type: ledger.Expense, Amount: 100, DeviceID: "phone"})
+		if err != nil || decision.Outcome != Allow {
+			t.Fatalf("attempt %d = %+v, %v, want allowed", i, decision, err)
+		}
+	}
+
+	denied, err := second.Evaluate(ctx, Attempt{UserID: userID, Type: ledger.Expense, Amount: 100, DeviceID: "phone"})
+	if err != nil || denied.Outcome != Deny || !reflect.DeepEqual(denied.Rules, []string{"velocity"}) {
+		t.Fatalf("fifth attempt = %+v, %v, want denied by velocity", denied, err)
+	}
+
+	// The devices the user is known by are shared too.
+	otherUser := uuid.New().String()
+	if decision, err := first.Evaluate(ctx, Attempt{UserID: otherUser, Type: ledger.Expense, Amount: 100000, DeviceID: "phone"}); err != nil || decision.Outcome != Allow {
+		t.Fatalf("first device = %+v, %v, want allowed", decision, err)
+	}
+	stepUp, err := second.Evaluate(ctx, Attempt{UserID: otherUser, Type: ledger.Expense, Amount: 100000, DeviceID: "tablet"})
+	if err != nil || stepUp.Outcome != StepUp {
+		t.Fatalf("new device = %+v, %v, want step up", stepUp, err)
+	}
+	if err := second.Confirm(ctx, stepUp.ID); err != nil {
+		t.Fatal(err)
+	}
+	if decision, err := first.Evaluate(ctx, Attempt{UserID: otherUser, Type: ledger.Expense, Amount: 100000, DeviceID: "tablet"}); err != nil || decision.Outcome != Allow {
+		t.Errorf("confirmed device = %+v, %v, want allowed", decision, err)
+	}
+
+	// Every decision is audited.
+	decisions, err := first.Decisions(ctx, userID, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 5 || decisions[0].ID != denied.ID || decisions[0].DeviceID != "phone" {
+		t.Errorf("decisions = %+v, want 5, the denied one first", decisions)
+	}
+	confirmed, err := second.Decisions(ctx, otherUser, StepUp, 10)
+	if err != nil || len(confirmed) != 1 || !confirmed[0].Confirmed {
+		t.Errorf("step up decisions = %+v, %v, want the confirmed one", confirmed, err)
+	}
+}
@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	client "github.com/toshkentov01/alif-tech-task/api-gateway/grpc_client"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/gateway"
+)
+
+// GatewayRoutes registers the routes declared in the routes file and the
+// routes of google.api.http annotated methods, and returns the casbin policies
+// of their roles.
+func GatewayRoutes(a *fiber.App) ([][]string, error) {
+	cfg := config.Config()
+	timeout := time.Second * time.Duration(cfg.CtxTimeout)
+
+	var routes []*gateway.Route
+	if cfg.RoutesConfigPath != "" {
+		declared, err := gateway.LoadRoutes(cfg.RoutesConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, declared...)
+	}
+
+	descriptors := gateway.Chain{}
+	transcoding := gateway.Transcoding{
+		Upstream: cfg.TranscodingUpstream,
+		Prefix:   cfg.TranscodingPrefix,
+		UserID:   cfg.TranscodingUserIDField,
+		Roles:    splitList(cfg.TranscodingRoles),
+	}
+
+	var sets []*protoregistry.Files
+	if paths := splitList(cfg.TranscodingDescriptorSets); len(paths) > 0 {
+		files, err := gateway.LoadDescriptorSets(paths)
+		if err != nil {
+			return nil, fmt.Errorf("descriptor sets: %s", err)
+		}
+		sets = append(sets, files)
+	}
+	if cfg.TranscodingReflection {
+		conn, err := client.Upstreams().Conn(cfg.TranscodingUpstream)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		files, err := gateway.Reflect(ctx, conn)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("%s upstream reflection: %s", cfg.TranscodingUpstream, err)
+		}
+		sets = append(sets, files)
+	}
+	for _, files := range sets {
+		transcoded, err := transcoding.Routes(files)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, transcoded...)
+		descriptors = append(descriptors, files)
+	}
+	descriptors = append(descriptors, protoregistry.GlobalFiles)
+
+	seen := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		key := route.Method + " " + route.Path
+		if seen[key] {
+			return nil, fmt.Errorf("route %s: declared twice", key)
+		}
+		seen[key] = true
+	}
+
+	g := gateway.New(client.Upstreams(), descriptors)
+	if err := g.Register(a, routes); err != nil {
+		return nil, err
+	}
+
+	var policies [][]string
+	for _, route := range routes {
+		policies = append(policies, route.Policies()...)
+	}
+
+	return policies, nil
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/controllers"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	client "github.com/toshkentov01/alif-tech-task/api-gateway/grpc_client"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/health"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/middleware"
+)
+
+// HealthRoutes registers the readiness checks and the probes of load balancers
+// and orchestrators. The probes need no token, so they are added before the authorizer.
+func HealthRoutes(a *fiber.App, authorizer *middleware.JWTRoleAuthorizer) {
+	checker := health.Service()
+
+	checker.Register("casbin", authorizer.Check)
+	checker.Register("config", func(context.Context) error {
+		return config.Config().Validate()
+	})
+	checker.Register("postgres", database.Service().PingContext)
+	for _, upstream := range client.Upstreams().List() {
+		checker.Register("upstream "+upstream.Name(), upstream.Check)
+	}
+
+	a.Get("/healthz", controllers.Healthz)
+	a.Get("/readyz", controllers.Readyz)
+}
@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/api/controllers"
+	client "github.com/toshkentov01/alif-tech-task/api-gateway/grpc_client"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/metrics"
+)
+
+var (
+	connectionStates = []string{"IDLE", "CONNECTING", "READY", "TRANSIENT_FAILURE", "SHUTDOWN"}
+	breakerStates    = []string{client.BreakerClosed, client.BreakerOpen, client.BreakerHalfOpen}
+)
+
+// MetricsRoutes registers the metrics of the upstreams and serves /metrics on
+// the admin app, which listens apart from the public one.
+func MetricsRoutes(a *fiber.App) {
+	upstreams := client.Upstreams()
+
+	metrics.NewGaugeFunc("gateway_upstream_connection_state",
+		"Connectivity state of the upstream connections, 1 for the current state.",
+		func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, upstream := range upstreams.List() {
+				current := upstream.Health().State
+				for _, state := range connectionStates {
+					samples = append(samples, metrics.Sample{
+						Values: []string{upstream.Name(), state},
+						Value:  boolValue(state == current),
+					})
+				}
+			}
+			return samples
+		}, "upstream", "state")
+
+	metrics.NewGaugeFunc("gateway_upstream_healthy",
+		"Whether the upstream connection did not fail and its last health check passed.",
+		func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, upstream := range upstreams.List() {
+				samples = append(samples, metrics.Sample{
+					Values: []string{upstream.Name()},
+					Value:  boolValue(upstream.Health().Healthy()),
+				})
+			}
+			return samples
+		}, "upstream")
+
+	metrics.NewGaugeFunc("gateway_circuit_breaker_state",
+		"State of the circuit breakers of the upstream methods called so far, 1 for the current state.",
+		func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, breaker := range upstreams.Breakers() {
+				for _, state := range breakerStates {
+					samples = append(samples, metrics.Sample{
+						Values: []string{breaker.Upstream, breaker.Method, state},
+						Value:  boolValue(state == breaker.State),
+					})
+				}
+			}
+			return samples
+		}, "upstream", "method", "state")
+
+	a.Get("/metrics", controllers.Metrics)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -1,8 +1,12 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/toshkentov01/alif-tech-task/api-gateway/api/controllers"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/middleware"
 )
 
 // UserRoutes func for describe group of public routes.
@@ -15,30 +19,78 @@ func UserRoutes(a *fiber.App) {
 	route.Post("/create-unidentified-user/", controllers.CreateUnidentifiedUser)
 	route.Post("/user/income/", controllers.Income)
 	route.Post("/user/expense/", controllers.Expense)
+	route.Post("/user/transfer/", controllers.Transfer)
+	route.Post("/user/exchange/quote/", controllers.ExchangeQuote)
+	route.Post("/user/exchange/", controllers.Exchange)
+	route.Post("/user/holds/", controllers.CreateHold)
+	route.Post("/admin/operations/:id/reverse/", controllers.ReverseOperation)
+	route.Post("/admin/operations/:id/refund/", controllers.RefundOperation)
+	route.Post("/webhooks/", controllers.CreateWebhook)
+	route.Post("/webhooks/deliveries/:id/replay/", controllers.ReplayWebhookDelivery)
+	route.Post("/batch/operations/", middleware.Deadline(time.Second*time.Duration(config.Config().BatchTimeout)), controllers.BatchOperations)
+	route.Post("/user/schedules/", controllers.CreateSchedule)
+	route.Post("/user/schedules/:id/pause/", controllers.PauseSchedule)
+	route.Post("/user/schedules/:id/resume/", controllers.ResumeSchedule)
+	route.Post("/user/requests/", controllers.CreatePaymentRequest)
+	route.Post("/user/requests/:id/accept/", controllers.AcceptPaymentRequest)
+	route.Post("/user/requests/:id/decline/", controllers.DeclinePaymentRequest)
+	route.Post("/user/requests/:id/cancel/", controllers.CancelPaymentRequest)
+	route.Post("/user/limits/", controllers.SetLimit)
+	route.Post("/user/otp/", controllers.IssueOTP)
+	route.Post("/user/merchants/", controllers.OnboardMerchant)
+	route.Post("/user/merchants/:id/keys/", controllers.CreateMerchantAPIKey)
+	route.Post("/user/charges/:id/confirm/", controllers.ConfirmCharge)
+	route.Post("/user/charges/:id/decline/", controllers.DeclineCharge)
+	route.Post("/user/pay-qr/", controllers.PayQR)
+	route.Post("/user/pockets/", controllers.CreatePocket)
+	route.Post("/user/pockets/:id/deposit/", controllers.MoveToPocket)
+	route.Post("/user/pockets/:id/withdraw/", controllers.MoveFromPocket)
+	route.Post("/user/partners/", controllers.GrantPartner)
+	route.Post("/merchant/charge/", controllers.CreateCharge)
+	route.Post("/merchant/charges/:id/cancel/", controllers.CancelMerchantCharge)
+	route.Post("/merchant/holds/:id/capture/", controllers.CaptureMerchantHold)
+	route.Post("/merchant/holds/:id/void/", controllers.VoidMerchantHold)
 
 	// Routes For GET Method:
 	route.Get("/check-user-account/", controllers.CheckUserAccount)
 	route.Get("/user/balance/", controllers.GetBalance)
 	route.Get("/user/operations/", controllers.ListOperationsByType)
+	route.Get("/user/holds/", controllers.ListHolds)
+	route.Get("/user/history/", controllers.ListHistory)
+	route.Get("/user/stream/", controllers.Stream)
+	route.Get("/admin/operations/:id/", controllers.GetOperation)
+	route.Get("/webhooks/", controllers.ListWebhooks)
+	route.Get("/webhooks/deliveries/", controllers.ListWebhookDeliveries)
+	route.Get("/batch/operations/:id/", controllers.GetBatchJob)
+	route.Get("/user/schedules/", controllers.ListSchedules)
+	route.Get("/user/requests/", controllers.ListPaymentRequests)
+	route.Get("/user/requests/:id/", controllers.GetPaymentRequest)
+	route.Get("/user/limits/", controllers.ListLimits)
+	route.Get("/user/notifications/", controllers.ListNotifications)
+	route.Get("/admin/risk/decisions/", controllers.ListRiskDecisions)
+	route.Get("/admin/upstreams/", controllers.ListUpstreams)
+	route.Get("/user/merchants/", controllers.ListMerchants)
+	route.Get("/user/merchants/:id/keys/", controllers.ListMerchantAPIKeys)
+	route.Get("/user/charges/:id/", controllers.GetCharge)
+	route.Get("/user/pockets/", controllers.ListPockets)
+	route.Get("/user/pockets/:id/", controllers.GetPocket)
+	route.Get("/user/analytics/", controllers.GetAnalytics)
+	route.Get("/user/partners/", controllers.ListPartnerGrants)
+	route.Get("/merchant/charges/:id/", controllers.GetMerchantCharge)
+	route.Get("/merchant/settlements/", controllers.GetSettlement)
+	route.Get("/merchant/qr/", controllers.GetMerchantQR)
 
-}
+	// Routes For PUT Method:
+	route.Put("/user/history/:id/category/", controllers.SetOperationCategory)
+	route.Put("/user/history/:id/tags/", controllers.SetOperationTags)
+	route.Put("/user/pockets/:id/", controllers.UpdatePocket)
+
+	// Routes For DELETE Method:
+	route.Delete("/webhooks/:id/", controllers.DeleteWebhook)
+	route.Delete("/user/schedules/:id/", controllers.DeleteSchedule)
+	route.Delete("/user/limits/:id/", controllers.DeleteLimit)
+	route.Delete("/user/merchants/:id/keys/:key_id/", controllers.RevokeMerchantAPIKey)
+	route.Delete("/user/pockets/:id/", controllers.DeletePocket)
+	route.Delete("/user/partners/:id/", controllers.RevokePartner)
 
-// HealthCheck godoc
-// @Summary Show the status of server.
-// @Description get the status of server.
-// @Tags root
-// @Accept */*
-// @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Router / [get]
-func HealthCheck(c *fiber.Ctx) error {
-	res := map[string]interface{}{
-		"data": "Server is up and running",
-	}
-
-	if err := c.JSON(res); err != nil {
-		return err
-	}
-
-	return nil
 }
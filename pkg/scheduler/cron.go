@@ -0,0 +1,183 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is a cron-like rule with five fields: minute, hour, day of month,
+// month and day of week. Fields support "*", lists, ranges and steps, e.g.
+// "0 9 1 * *" runs at 09:00 on the 1st of every month and "30 18 * * 5" runs
+// every Friday at 18:30. The shortcuts @hourly, @daily, @weekly, @monthly and
+// @yearly are understood too.
+type Rule struct {
+	spec                        string
+	minute, hour, dom, month    uint64
+	dow                         uint64
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+var shortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+type bounds struct {
+	min, max int
+}
+
+var (
+	minuteBounds = bounds{0, 59}
+	hourBounds   = bounds{0, 23}
+	domBounds    = bounds{1, 31}
+	monthBounds  = bounds{1, 12}
+	dowBounds    = bounds{0, 7}
+)
+
+// ParseRule ...
+func ParseRule(spec string) (*Rule, error) {
+	spec = strings.TrimSpace(spec)
+
+	expr := spec
+	if shortcut, ok := shortcuts[spec]; ok {
+		expr = shortcut
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("rule %q must have 5 fields", spec)
+	}
+
+	rule := &Rule{
+		spec:          spec,
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*",
+	}
+
+	var err error
+	if rule.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, err
+	}
+	if rule.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, err
+	}
+	if rule.dom, err = parseField(fields[2], domBounds); err != nil {
+		return nil, err
+	}
+	if rule.month, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, err
+	}
+	if rule.dow, err = parseField(fields[4], dowBounds); err != nil {
+		return nil, err
+	}
+	// Both 0 and 7 stand for Sunday.
+	if rule.dow&(1<<7) != 0 {
+		rule.dow = rule.dow&^(1<<7) | 1
+	}
+
+	return rule, nil
+}
+
+// String ...
+func (r *Rule) String() string {
+	return r.spec
+}
+
+// Next returns the first time after t matching the rule, or zero time if there
+// is none within five years.
+func (r *Rule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if r.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !r.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if r.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if r.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both day fields are restricted, either may match.
+func (r *Rule) dayMatches(t time.Time) bool {
+	domMatch := r.dom&(1<<uint(t.Day())) != 0
+	dowMatch := r.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case r.anyDayOfMonth && r.anyDayOfWeek:
+		return true
+	case r.anyDayOfMonth:
+		return dowMatch
+	case r.anyDayOfWeek:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", field)
+			}
+			part = part[:i]
+		}
+
+		low, high := b.min, b.max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			ends := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			low, err1 = strconv.Atoi(ends[0])
+			high, err2 = strconv.Atoi(ends[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range in %q", field)
+			}
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %q", field)
+			}
+			low, high = value, value
+			if step > 1 {
+				high = b.max
+			}
+		}
+
+		if low < b.min || high > b.max || low > high {
+			return 0, fmt.Errorf("%q is out of range %d-%d", field, b.min, b.max)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRuleInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@every 5m",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+	}
+
+	for _, spec := range tests {
+		if _, err := ParseRule(spec); err == nil {
+			t.Errorf("ParseRule(%q) error = nil, want an error", spec)
+		}
+	}
+}
+
+func TestRuleNext(t *testing.T) {
+	// 2024-01-10 is a Wednesday.
+	from := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"0 9 1 * *", from, time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"30 18 * * 5", from, time.Date(2024, 1, 12, 18, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2024, 1, 10, 12, 15, 0, 0, time.UTC)},
+		{"*/15 * * * *", from.Add(7*time.Minute + 30*time.Second), time.Date(2024, 1, 10, 12, 15, 0, 0, time.UTC)},
+		{"10-20/5 * * * *", from.Add(16 * time.Minute), time.Date(2024, 1, 10, 12, 20, 0, 0, time.UTC)},
+		{"5/20 * * * *", from.Add(30 * time.Minute), time.Date(2024, 1, 10, 12, 45, 0, 0, time.UTC)},
+		{"0 12 * * 1-5", from.AddDate(0, 0, 2), time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 0 1 1,7 *", from, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", from, time.Date(2024, 1, 10, 13, 0, 0, 0, time.UTC)},
+		{"@daily", from, time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", from, time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", from, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", from, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// 7 is Sunday as well as 0.
+		{"0 0 * * 7", from, time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		// Either day field may match when both are restricted.
+		{"0 0 13 * 5", from, time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", from, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		rule, err := ParseRule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseRule(%q) error = %v", tt.spec, err)
+			continue
+		}
+
+		if got := rule.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("ParseRule(%q).Next(%v) = %v, want %v", tt.spec, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestRuleString(t *testing.T) {
+	for _, spec := range []string{"@daily", "0 9 1 * *"} {
+		rule, err := ParseRule(" " + spec + " ")
+		if err != nil {
+			t.Fatalf("ParseRule(%q) error = %v", spec, err)
+		}
+		if got := rule.String(); got != spec {
+			t.Errorf("String() = %q, want %q", got, spec)
+		}
+	}
+}
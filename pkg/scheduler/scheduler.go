@@ -0,0 +1,546 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+// Schedule kinds
+const (
+	KindExpense  = "expense"
+	KindTransfer = "transfer"
+)
+
+// Policies on insufficient funds
+const (
+	// PolicySkip skips the occurrence and waits for the next one
+	PolicySkip = "skip"
+	// PolicyRetry tries the occurrence again a few times before skipping it
+	PolicyRetry = "retry"
+)
+
+// Schedule statuses
+const (
+	Active = "active"
+	Paused = "paused"
+)
+
+// Run outcomes
+const (
+	RunSucceeded = "succeeded"
+	RunSkipped   = "skipped"
+	RunRetrying  = "retrying"
+	RunFailed    = "failed"
+)
+
+// Statuses of a claimed occurrence
+const (
+	runPending = "pending"
+	runPaid    = "paid"
+	runFailed  = "failed"
+)
+
+var (
+	onceScheduler     sync.Once
+	instanceScheduler *Scheduler
+)
+
+// Schedule is a payment repeated by a rule.
+type Schedule struct {
+	ID          string    `db:"id"`
+	UserID      string    `db:"user_id"`
+	Kind        string    `db:"kind"`
+	Amount      int64     `db:"amount"`
+	Currency    string    `db:"currency"`
+	RecipientID string    `db:"recipient_id"`
+	Merchant    string    `db:"merchant"`
+	Note        string    `db:"note"`
+	Category    string    `db:"category"`
+	Rule        string    `db:"rule"`
+	Policy      string    `db:"policy"`
+	Status      string    `db:"status"`
+	NextRunAt   time.Time `db:"next_run_at"`
+	LastRunAt   time.Time `db:"-"`
+	LastStatus  string    `db:"last_status"`
+	LastError   string    `db:"last_error"`
+	Runs        int       `db:"runs"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// scheduleRow is a schedule as it is stored, with the state of its runs.
+type scheduleRow struct {
+	Schedule
+	LastRunAt sql.NullTime `db:"last_run_at"`
+	// Occurrence is the planned time of the run in progress, retries keep it
+	Occurrence time.Time `db:"occurrence"`
+	Retries    int       `db:"retries"`
+	// LockedUntil is the end of the lease of the instance running the schedule
+	LockedUntil sql.NullTime `db:"locked_until"`
+}
+
+func (row scheduleRow) schedule() Schedule {
+	schedule := row.Schedule
+	schedule.LastRunAt = row.LastRunAt.Time
+
+	return schedule
+}
+
+const scheduleColumns = `id, user_id, kind, amount, currency, recipient_id, merchant, note, category, rule, policy,
+	status, next_run_at, last_run_at, last_status, last_error, runs, occurrence, retries, locked_until, created_at`
+
+// runLease is how long an instance owns a due schedule it runs. Another
+// instance takes the schedule over once the lease is over.
+const runLease = time.Minute
+
+// dueBatch caps the schedules an instance takes on one tick.
+const dueBatch = 100
+
+// Scheduler runs schedules kept in the shared database. Every gateway
+// instance runs due schedules, a schedule is run by one instance at a time.
+type Scheduler struct {
+	db *sqlx.DB
+
+	tick          time.Duration
+	retryInterval time.Duration
+	maxRetries    int
+}
+
+// Service returns the scheduler shared by the gateway.
+func Service() *Scheduler {
+	onceScheduler.Do(func() {
+		cfg := config.Config()
+
+		instanceScheduler = &Scheduler{
+			db:            database.Service(),
+			tick:          time.Second * time.Duration(cfg.SchedulerTick),
+			retryInterval: time.Second * time.Duration(cfg.SchedulerRetryInterval),
+			maxRetries:    cfg.SchedulerMaxRetries,
+		}
+	})
+
+	return instanceScheduler
+}
+
+// Start runs due schedules in the background.
+func (s *Scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.tick)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			s.runDue(now)
+		}
+	}()
+}
+
+// Create adds a schedule, the rule must be valid.
+func (s *Scheduler) Create(ctx context.Context, schedule Schedule) (Schedule, error) {
+	rule, err := ParseRule(schedule.Rule)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("%w: %s", newerrors.ErrInvalidRule, err)
+	}
+
+	now := time.Now()
+
+	schedule.ID = uuid.New().String()
+	schedule.Status = Active
+	schedule.CreatedAt = now
+	schedule.NextRunAt = rule.Next(now)
+
+	if schedule.NextRunAt.IsZero() {
+		return Schedule{}, fmt.Errorf("%w: rule %q never runs", newerrors.ErrInvalidRule, schedule.Rule)
+	}
+
+	_, err = s.db.NamedExecContext(ctx, `
+		INSERT INTO schedules (id, user_id, kind, amount, currency, recipient_id, merchant, note, category,
+			rule, policy, status, next_run_at, occurrence, created_at)
+		VALUES (:id, :user_id, :kind, :amount, :currency, :recipient_id, :merchant, :note, :category,
+			:rule, :policy, :status, :next_run_at, :next_run_at, :created_at)`, schedule)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	return schedule, nil
+}
+
+// List returns the user's schedules.
+func (s *Scheduler) List(ctx context.Context, userID string) ([]Schedule, error) {
+	var rows []scheduleRow
+	err := s.db.SelectContext(ctx, &rows, `SELECT `+scheduleColumns+` FROM schedules WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Schedule, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, row.schedule())
+	}
+
+	return result, nil
+}
+
+// Pause stops running the user's schedule until it is resumed.
+func (s *Scheduler) Pause(ctx context.Context, userID, id string) (Schedule, error) {
+	return s.update(ctx, userID, id, `UPDATE schedules SET status = $3 WHERE id = $1 AND user_id = $2`, Paused)
+}
+
+// Resume runs the paused schedule again. Occurrences missed while it was paused are not paid.
+func (s *Scheduler) Resume(ctx context.Context, userID, id string) (Schedule, error) {
+	var schedule Schedule
+	err := database.InTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		var row scheduleRow
+		err := tx.GetContext(ctx, &row, `SELECT `+scheduleColumns+` FROM schedules WHERE id = $1 AND user_id = $2 FOR UPDATE`, id, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return newerrors.ErrScheduleNotFound
+		} else if err != nil {
+			return err
+		}
+		schedule = row.schedule()
+
+		if schedule.Status != Paused {
+			return nil
+		}
+
+		rule, err := ParseRule(schedule.Rule)
+		if err != nil {
+			return err
+		}
+		schedule.Status = Active
+		schedule.NextRunAt = rule.Next(time.Now())
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE schedules SET status = $2, retries = 0, next_run_at = $3, occurrence = $3 WHERE id = $1`,
+			id, schedule.Status, schedule.NextRunAt)
+		return err
+	})
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	return schedule, nil
+}
+
+// Delete removes the user's schedule.
+func (s *Scheduler) Delete(ctx context.Context, userID, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM schedules WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return newerrors.ErrScheduleNotFound
+	}
+
+	return nil
+}
+
+func (s *Scheduler) update(ctx context.Context, userID, id, query string, value interface{}) (Schedule, error) {
+	var row scheduleRow
+	err := s.db.GetContext(ctx, &row, query+` RETURNING `+scheduleColumns, id, userID, value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Schedule{}, newerrors.ErrScheduleNotFound
+	} else if err != nil {
+		return Schedule{}, err
+	}
+
+	return row.schedule(), nil
+}
+
+// runDue takes the due schedules no other instance is running and runs them.
+func (s *Scheduler) runDue(now time.Time) {
+	due, err := s.take(context.Background(), now)
+	if err != nil {
+		logger.Error(context.Background(), "Error while taking due schedules", logger.Err(err))
+		return
+	}
+
+	for _, schedule := range due {
+		go s.run(schedule)
+	}
+}
+
+// take leases the due schedules no other instance is running.
+func (s *Scheduler) take(ctx context.Context, now time.Time) ([]scheduleRow, error) {
+	var due []scheduleRow
+	err := s.db.SelectContext(ctx, &due, `
+		UPDATE schedules SET locked_until = now() + $2 * interval '1 second'
+		WHERE id IN (
+			SELECT id FROM schedules
+			WHERE status = 'active' AND next_run_at <= $1 AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY next_run_at LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+scheduleColumns, now, runLease.Seconds(), dueBatch)
+
+	return due, err
+}
+
+// occurrenceKey identifies the payment of one occurrence in the log lines of the run.
+func occurrenceKey(schedule scheduleRow) string {
+	return fmt.Sprintf("schedule-%s-%d", schedule.ID, schedule.Occurrence.Unix())
+}
+
+// run pays the occurrence of the schedule once. The occurrence is claimed
+// before it is paid and the payment ends halfway through the lease, so an
+// instance taking the schedule over after the lease finds the claim and
+// fails the occurrence instead of paying it again.
+func (s *Scheduler) run(schedule scheduleRow) {
+	// the lease bounds the run, another instance may take the schedule after it
+	ctx, cancel := context.WithTimeout(context.Background(), runLease)
+	defer cancel()
+
+	ctx = logger.WithRequestID(ctx, occurrenceKey(schedule))
+	logger.SetUserID(ctx, schedule.UserID)
+
+	claimed, previous, err := s.claim(ctx, schedule)
+	if errors.Is(err, errLeaseLost) {
+		logger.Warn(ctx, "Schedule was taken over by another instance", logger.Any("schedule_id", schedule.ID))
+		return
+	} else if err != nil {
+		s.release(ctx, schedule.ID, err)
+		return
+	}
+
+	next := schedule
+	next.LastRunAt = sql.NullTime{Time: time.Now(), Valid: true}
+	next.LastError = ""
+
+	var outcome runOutcome
+	if claimed {
+		payCtx, cancelPay := context.WithTimeout(ctx, runLease/2)
+		op, err := s.pay(payCtx, schedule.Schedule)
+		cancelPay()
+
+		outcome = s.settle(&next, op, err)
+	} else {
+		outcome = s.resume(&next, previous)
+	}
+
+	if next.LastStatus == RunFailed {
+		logger.Error(ctx, "Schedule failed, occurrence given up", logger.Any("schedule_id", schedule.ID), logger.Any("error", next.LastError))
+	}
+
+	// the run is saved even when the lease ran out meanwhile, a paid
+	// occurrence has to be recorded
+	saveCtx, cancelSave := wallet.Service().Detached()
+	defer cancelSave()
+
+	err = database.InTx(saveCtx, s.db, func(tx *sqlx.Tx) error {
+		if err := outcome.save(saveCtx, tx, schedule); err != nil {
+			return err
+		}
+
+		// A late save does not overwrite the run of the instance that took the schedule over.
+		_, err := tx.ExecContext(saveCtx, `
+			UPDATE schedules SET next_run_at = $2, last_run_at = $3, last_status = $4, last_error = $5,
+				runs = $6, occurrence = $7, retries = $8, locked_until = NULL
+			WHERE id = $1 AND locked_until = $9`,
+			schedule.ID, next.NextRunAt, next.LastRunAt, next.LastStatus, next.LastError,
+			next.Runs, next.Occurrence, next.Retries, schedule.LockedUntil)
+		return err
+	})
+	if err != nil {
+		logger.Error(ctx, "Error while saving the run of a schedule", logger.Err(err), logger.Any("schedule_id", schedule.ID))
+	}
+}
+
+// errLeaseLost tells the lease of a schedule is over and another instance may run it.
+var errLeaseLost = errors.New("schedule lease lost")
+
+// claim takes the occurrence of the schedule with a pending run while the
+// lease is held. When the occurrence was claimed before, its run is returned.
+func (s *Scheduler) claim(ctx context.Context, schedule scheduleRow) (claimed bool, previous scheduleRun, err error) {
+	err = database.InTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		var held bool
+		err := tx.GetContext(ctx, &held, `
+			SELECT EXISTS (
+				SELECT 1 FROM schedules
+				WHERE id = $1 AND occurrence = $2 AND locked_until = $3 AND locked_until > now()
+				FOR UPDATE
+			)`, schedule.ID, schedule.Occurrence, schedule.LockedUntil)
+		if err != nil {
+			return err
+		} else if !held {
+			return errLeaseLost
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO schedule_runs (schedule_id, occurrence, status) VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING`, schedule.ID, schedule.Occurrence, runPending)
+		if err != nil {
+			return err
+		}
+
+		if inserted, err := result.RowsAffected(); err != nil {
+			return err
+		} else if inserted == 1 {
+			claimed = true
+			return nil
+		}
+
+		return tx.GetContext(ctx, &previous, `
+			SELECT status, operation_id, error FROM schedule_runs WHERE schedule_id = $1 AND occurrence = $2`,
+			schedule.ID, schedule.Occurrence)
+	})
+
+	return claimed, previous, err
+}
+
+// settle plans the schedule after the payment of its claimed occurrence.
+// Only a payment that surely moved no money lets the occurrence be tried
+// again, one with an unknown outcome is failed.
+func (s *Scheduler) settle(next *scheduleRow, op ledger.Operation, err error) runOutcome {
+	switch {
+	case err == nil:
+		next.Runs++
+		next.LastStatus = RunSucceeded
+		s.planNext(next)
+		return runOutcome{status: runPaid, operationID: op.ID}
+	case !notPaid(err):
+		next.LastStatus = RunFailed
+		next.LastError = "payment outcome is unknown: " + err.Error()
+		s.planNext(next)
+		return runOutcome{status: runFailed, err: next.LastError}
+	}
+
+	next.LastError = err.Error()
+	switch {
+	case status.Code(err) == codes.PermissionDenied && next.Policy == PolicyRetry && next.Retries < s.maxRetries:
+		next.Retries++
+		next.LastStatus = RunRetrying
+		next.NextRunAt = time.Now().Add(s.retryInterval)
+	case status.Code(err) == codes.PermissionDenied:
+		next.LastStatus = RunSkipped
+		s.planNext(next)
+	default:
+		next.LastStatus = RunFailed
+		s.planNext(next)
+	}
+
+	// nothing was paid, the claim is dropped
+	return runOutcome{}
+}
+
+// resume plans the schedule whose occurrence was claimed by a run before,
+// without paying it.
+func (s *Scheduler) resume(next *scheduleRow, previous scheduleRun) runOutcome {
+	switch previous.Status {
+	case runPaid:
+		// the previous run paid but could not save the schedule
+		next.Runs++
+		next.LastStatus = RunSucceeded
+		s.planNext(next)
+		return runOutcome{status: runPaid, operationID: previous.OperationID}
+	case runPending:
+		// the previous run lost its lease while paying
+		next.LastError = "payment outcome is unknown: the run was interrupted"
+	default:
+		next.LastError = previous.Error
+	}
+
+	next.LastStatus = RunFailed
+	s.planNext(next)
+
+	return runOutcome{status: runFailed, err: next.LastError}
+}
+
+// notPaid tells whether a failed payment surely moved no money: it was
+// refused by the wallet's own checks or answered with an error by the user
+// service. Timeouts, cancellations and internal errors may come after the
+// money moved.
+func notPaid(err error) bool {
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.PermissionDenied, codes.NotFound, codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+			return true
+		}
+
+		return false
+	}
+
+	return errors.Is(err, newerrors.ErrOperationDenied) || errors.Is(err, newerrors.ErrStepUpRequired) ||
+		errors.Is(err, newerrors.ErrSpendingLimitExceeded)
+}
+
+// release gives the schedule up to run it on a later tick.
+func (s *Scheduler) release(ctx context.Context, id string, cause error) {
+	logger.Error(ctx, "Schedule failed", logger.Err(cause), logger.Any("schedule_id", id))
+
+	if _, err := s.db.ExecContext(ctx, `UPDATE schedules SET locked_until = NULL WHERE id = $1`, id); err != nil {
+		logger.Error(ctx, "Error while releasing a schedule", logger.Err(err), logger.Any("schedule_id", id))
+	}
+}
+
+func (s *Scheduler) pay(ctx context.Context, schedule Schedule) (ledger.Operation, error) {
+	op := ledger.Operation{
+		UserID:   schedule.UserID,
+		Currency: schedule.Currency,
+		Amount:   schedule.Amount,
+		Merchant: schedule.Merchant,
+		Note:     schedule.Note,
+		Category: schedule.Category,
+	}
+
+	if schedule.Kind == KindTransfer {
+		op.Counterparty = schedule.RecipientID
+		return wallet.Service().Transfer(ctx, op)
+	}
+
+	return wallet.Service().Expense(ctx, op)
+}
+
+// scheduleRun is an occurrence claimed by a run.
+type scheduleRun struct {
+	Status      string `db:"status"`
+	OperationID string `db:"operation_id"`
+	Error       string `db:"error"`
+}
+
+// runOutcome is what becomes of the claim of a run, no status drops it.
+type runOutcome struct {
+	status      string
+	operationID string
+	err         string
+}
+
+func (o runOutcome) save(ctx context.Context, tx *sqlx.Tx, schedule scheduleRow) error {
+	if o.status == "" {
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM schedule_runs WHERE schedule_id = $1 AND occurrence = $2 AND status = $3`,
+			schedule.ID, schedule.Occurrence, runPending)
+		return err
+	}
+
+	// A paid run stays paid, whoever saves it last.
+	_, err := tx.ExecContext(ctx, `
+		UPDATE schedule_runs SET status = $3, operation_id = $4, error = $5
+		WHERE schedule_id = $1 AND occurrence = $2 AND status <> $6`,
+		schedule.ID, schedule.Occurrence, o.status, o.operationID, o.err, runPaid)
+	return err
+}
+
+func (s *Scheduler) planNext(schedule *scheduleRow) {
+	schedule.Retries = 0
+	// The rule was checked when the schedule was created.
+	rule, _ := ParseRule(schedule.Rule)
+	schedule.NextRunAt = rule.Next(time.Now())
+	schedule.Occurrence = schedule.NextRunAt
+}
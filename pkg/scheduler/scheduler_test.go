@@ -0,0 +1,220 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/testenv"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/wallet"
+)
+
+func newScheduler(db *sqlx.DB) *Scheduler {
+	return &Scheduler{db: db, tick: time.Second, retryInterval: time.Hour, maxRetries: 3}
+}
+
+// dueSchedule creates a monthly expense of the user whose occurrence is due.
+func dueSchedule(t *testing.T, s *Scheduler, userID string) (Schedule, time.Time) {
+	t.Helper()
+	ctx := context.Background()
+
+	schedule, err := s.Create(ctx, Schedule{
+		UserID:   userID,
+		Kind:     KindExpense,
+		Amount:   100,
+		Currency: wallet.Service().DefaultCurrency(),
+		Rule:     "0 9 1 * *",
+		Policy:   PolicySkip,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	occurrence := time.Now().Add(-time.Minute).Truncate(time.Second)
+	_, err = s.db.ExecContext(ctx, `UPDATE schedules SET next_run_at = $2, occurrence = $2 WHERE id = $1`, schedule.ID, occurrence)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return schedule, occurrence
+}
+
+// takeOwn takes the due schedules and returns the one with the ID.
+func takeOwn(t *testing.T, s *Scheduler, id string) []scheduleRow {
+	t.Helper()
+
+	due, err := s.take(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var own []scheduleRow
+	for _, row := range due {
+		if row.ID == id {
+			own = append(own, row)
+		}
+	}
+
+	return own
+}
+
+func runOf(t *testing.T, db *sqlx.DB, id string) scheduleRun {
+	t.Helper()
+
+	var run scheduleRun
+	if err := db.GetContext(context.Background(), &run, `
+		SELECT status, operation_id, error FROM schedule_runs WHERE schedule_id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+
+	return run
+}
+
+func TestOccurrenceTakenByOneInstance(t *testing.T) {
+	db := testenv.DB(t)
+	users := testenv.UserService(t)
+	ctx := context.Background()
+
+	userID := uuid.New().String()
+	users.Add(userID, 1000)
+
+	instances := []*Scheduler{newScheduler(db), newScheduler(db)}
+	schedule, _ := dueSchedule(t, instances[0], userID)
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		taken []scheduleRow
+	)
+	for _, s := range instances {
+		wg.Add(1)
+		go func(s *Scheduler) {
+			defer wg.Done()
+
+			own := takeOwn(t, s, schedule.ID)
+			mu.Lock()
+			taken = append(taken, own...)
+			mu.Unlock()
+		}(s)
+	}
+	wg.Wait()
+
+	if len(taken) != 1 {
+		t.Fatalf("schedule taken %d times, want 1", len(taken))
+	}
+	instances[0].run(taken[0])
+
+	if calls := users.Calls("Expense", userID); calls != 1 {
+		t.Errorf("paid %d times, want 1", calls)
+	}
+	if balance := users.Balance(userID); balance != 900 {
+		t.Errorf("balance = %d, want 900", balance)
+	}
+	if run := runOf(t, db, schedule.ID); run.Status != runPaid || run.OperationID == "" {
+		t.Errorf("run = %+v, want paid", run)
+	}
+
+	schedules, err := instances[1].List(ctx, userID)
+	if err != nil || len(schedules) != 1 {
+		t.Fatalf("List() = %v, %v", schedules, err)
+	}
+	if got := schedules[0]; got.LastStatus != RunSucceeded || got.Runs != 1 || !got.NextRunAt.After(time.Now()) {
+		t.Errorf("schedule = %+v, want succeeded once and planned", got)
+	}
+	if own := takeOwn(t, instances[1], schedule.ID); len(own) != 0 {
+		t.Errorf("paid schedule taken again")
+	}
+}
+
+func TestDoubleRunPaysOnce(t *testing.T) {
+	db := testenv.DB(t)
+	users := testenv.UserService(t)
+
+	userID := uuid.New().String()
+	users.Add(userID, 1000)
+
+	s := newScheduler(db)
+	schedule, _ := dueSchedule(t, s, userID)
+
+	own := takeOwn(t, s, schedule.ID)
+	if len(own) != 1 {
+		t.Fatalf("schedule taken %d times, want 1", len(own))
+	}
+
+	// The same lease run twice at once, the occurrence is claimed by one of them.
+	var wg sync.WaitGroup
+	for _, instance := range []*Scheduler{s, newScheduler(db)} {
+		wg.Add(1)
+		go func(instance *Scheduler) {
+			defer wg.Done()
+			instance.run(own[0])
+		}(instance)
+	}
+	wg.Wait()
+
+	if calls := users.Calls("Expense", userID); calls != 1 {
+		t.Errorf("paid %d times, want 1", calls)
+	}
+	if balance := users.Balance(userID); balance != 900 {
+		t.Errorf("balance = %d, want 900", balance)
+	}
+	if run := runOf(t, db, schedule.ID); run.Status != runPaid {
+		t.Errorf("run = %+v, want paid", run)
+	}
+}
+
+func TestInterruptedOccurrenceNotPaidAgain(t *testing.T) {
+	db := testenv.DB(t)
+	users := testenv.UserService(t)
+	ctx := context.Background()
+
+	userID := uuid.New().String()
+	users.Add(userID, 1000)
+
+	crashed, other := newScheduler(db), newScheduler(db)
+	schedule, _ := dueSchedule(t, crashed, userID)
+
+	// The first instance claims the occurrence and stops before it saves the
+	// outcome of the payment.
+	own := takeOwn(t, crashed, schedule.ID)
+	if len(own) != 1 {
+		t.Fatalf("schedule taken %d times, want 1", len(own))
+	}
+	if claimed, _, err := crashed.claim(ctx, own[0]); err != nil || !claimed {
+		t.Fatalf("claim() = %v, %v, want claimed", claimed, err)
+	}
+
+	// A run holding a lease that is over can not claim the occurrence any more.
+	_, err := db.ExecContext(ctx, `UPDATE schedules SET locked_until = now() - interval '1 second' WHERE id = $1`, schedule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := crashed.claim(ctx, own[0]); err != errLeaseLost {
+		t.Errorf("claim() after the lease error = %v, want errLeaseLost", err)
+	}
+
+	taken := takeOwn(t, other, schedule.ID)
+	if len(taken) != 1 {
+		t.Fatalf("schedule taken over %d times, want 1", len(taken))
+	}
+	other.run(taken[0])
+
+	if calls := users.Calls("Expense", userID); calls != 0 {
+		t.Errorf("paid %d times, want 0", calls)
+	}
+	if run := runOf(t, db, schedule.ID); run.Status != runFailed || run.Error == "" {
+		t.Errorf("run = %+v, want failed", run)
+	}
+
+	schedules, err := other.List(ctx, userID)
+	if err != nil || len(schedules) != 1 {
+		t.Fatalf("List() = %v, %v", schedules, err)
+	}
+	if got := schedules[0]; got.LastStatus != RunFailed || got.Runs != 0 || !got.NextRunAt.After(time.Now()) {
+		t.Errorf("schedule = %+v, want failed and planned", got)
+	}
+}
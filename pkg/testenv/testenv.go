@@ -0,0 +1,174 @@
+// Package testenv prepares the shared database and a fake user service for
+// tests of the packages keeping their state in them. Tests using it are
+// skipped unless POSTGRES_HOST points to a database they may write to.
+package testenv
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	pb "github.com/toshkentov01/alif-tech-task/api-gateway/genproto/user-service"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+)
+
+var (
+	onceDB  sync.Once
+	errDB   error
+	onceRun sync.Once
+
+	onceUsers     sync.Once
+	instanceUsers *Users
+	errUsers      error
+)
+
+// DB returns the shared database with the migrations applied.
+func DB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	if os.Getenv("POSTGRES_HOST") == "" {
+		t.Skip("POSTGRES_HOST is not set, the test needs the shared database")
+	}
+	configure()
+
+	onceDB.Do(func() {
+		errDB = database.Migrate(context.Background(), database.Service())
+	})
+	if errDB != nil {
+		t.Fatalf("migrate: %v", errDB)
+	}
+
+	return database.Service()
+}
+
+// UserService starts the fake user service once and points the gateway at
+// it. It has to be called before the gateway dials its upstreams.
+func UserService(t *testing.T) *Users {
+	t.Helper()
+	configure()
+
+	onceUsers.Do(func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			errUsers = err
+			return
+		}
+
+		instanceUsers = &Users{
+			balances: make(map[string]int64),
+			calls:    make(map[string]int),
+		}
+		server := grpc.NewServer()
+		pb.RegisterUserServiceServer(server, instanceUsers)
+		go server.Serve(listener)
+
+		cfg := config.Config()
+		cfg.UserServiceHost = "127.0.0.1"
+		cfg.UserServicePort = listener.Addr().(*net.TCPAddr).Port
+	})
+	if errUsers != nil {
+		t.Fatalf("user service: %v", errUsers)
+	}
+
+	return instanceUsers
+}
+
+// configure points the file settings at the repository, tests run in the
+// directory of their package.
+func configure() {
+	onceRun.Do(func() {
+		_, file, _, _ := runtime.Caller(0)
+		root := filepath.Join(filepath.Dir(file), "..", "..")
+
+		cfg := config.Config()
+		cfg.RiskRulesPath = filepath.Join(root, "config", "risk_rules.json")
+		cfg.RatesFilePath = filepath.Join(root, "config", "rates.json")
+		cfg.UpstreamsConfigPath = ""
+	})
+}
+
+// Users is a fake user service keeping the balances in the default currency
+// in memory. Users not added are not found.
+type Users struct {
+	pb.UnimplementedUserServiceServer
+
+	mu       sync.Mutex
+	balances map[string]int64
+	// calls count the calls of each method by user, like "Expense user-id"
+	calls map[string]int
+}
+
+// Add creates the user with the balance.
+func (u *Users) Add(userID string, balance int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.balances[userID] = balance
+}
+
+// Balance ...
+func (u *Users) Balance(userID string) int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.balances[userID]
+}
+
+// Calls returns how many times the method was called for the user.
+func (u *Users) Calls(method, userID string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.calls[method+" "+userID]
+}
+
+// Income ...
+func (u *Users) Income(ctx context.Context, req *pb.IncomeRequest) (*pb.Empty, error) {
+	return &pb.Empty{}, u.change("Income", req.UserId, req.IncomeAmount)
+}
+
+// Expense ...
+func (u *Users) Expense(ctx context.Context, req *pb.ExpenseRequest) (*pb.Empty, error) {
+	return &pb.Empty{}, u.change("Expense", req.UserId, -req.ExpenseAmount)
+}
+
+// GetBalance ...
+func (u *Users) GetBalance(ctx context.Context, req *pb.GetBalanceRequest) (*pb.GetBalanceResponse, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.calls["GetBalance "+req.UserId]++
+	balance, ok := u.balances[req.UserId]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	return &pb.GetBalanceResponse{Balance: balance}, nil
+}
+
+func (u *Users) change(method, userID string, amount int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.calls[method+" "+userID]++
+	balance, ok := u.balances[userID]
+	if !ok {
+		return status.Error(codes.NotFound, "user not found")
+	}
+	if balance+amount < 0 {
+		return status.Error(codes.PermissionDenied, "not enough cash")
+	}
+	u.balances[userID] = balance + amount
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// Exporters of spans
+const (
+	// NoExporter does not record spans, trace contexts are still passed on
+	NoExporter     = "none"
+	StdoutExporter = "stdout"
+	FileExporter   = "file"
+	// OTLPExporter posts spans to an OpenTelemetry collector with OTLP/HTTP
+	OTLPExporter = "otlp"
+)
+
+// instrumentationName names the tracer of the gateway's own spans.
+const instrumentationName = "github.com/toshkentov01/alif-tech-task/api-gateway"
+
+var (
+	onceProvider     sync.Once
+	instanceProvider *sdktrace.TracerProvider
+)
+
+// Service returns the tracer of the gateway. The first call installs the
+// OpenTelemetry tracer provider exporting with TRACING_EXPORTER and the W3C
+// trace context propagator.
+func Service() trace.Tracer {
+	onceProvider.Do(func() {
+		cfg := config.Config()
+
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			logger.Error(context.Background(), "Error while tracing", logger.Err(err))
+		}))
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+		options := []sdktrace.TracerProviderOption{
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSampleRatio))),
+			sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(cfg.TracingServiceName))),
+		}
+
+		exporter, err := newExporter(cfg)
+		if err != nil {
+			logger.Error(context.Background(), "Error while creating the trace exporter, spans are not exported", logger.Err(err))
+		} else if exporter != nil {
+			options = append(options, sdktrace.WithBatcher(exporter))
+		}
+
+		instanceProvider = sdktrace.NewTracerProvider(options...)
+		otel.SetTracerProvider(instanceProvider)
+	})
+
+	return instanceProvider.Tracer(instrumentationName)
+}
+
+// Shutdown exports the spans not sent yet and stops the exporter, waiting
+// until ctx is done at most.
+func Shutdown(ctx context.Context) {
+	if instanceProvider == nil {
+		return
+	}
+
+	if err := instanceProvider.Shutdown(ctx); err != nil {
+		logger.Error(ctx, "Error while shutting tracing down", logger.Err(err))
+	}
+}
+
+// SetError marks the span failed with the error, nil errors are ignored.
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+func newExporter(cfg *config.Configuration) (sdktrace.SpanExporter, error) {
+	switch cfg.TracingExporter {
+	case "", NoExporter:
+		return nil, nil
+	case StdoutExporter:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case FileExporter:
+		file, err := os.OpenFile(cfg.TracingFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(file))
+	case OTLPExporter:
+		endpoint, err := url.Parse(cfg.TracingEndpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		options := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(endpoint.Host),
+			otlptracehttp.WithURLPath(endpoint.Path),
+		}
+		if endpoint.Scheme == "http" {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+
+		return otlptracehttp.New(context.Background(), options...)
+	}
+
+	return nil, fmt.Errorf("unknown trace exporter %s", cfg.TracingExporter)
+}
@@ -1,12 +1,17 @@
 package utils
 
 import (
-	"fmt"
-	"log"
+	"context"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/health"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/tracing"
 )
 
 // StartServer func for starting a simple server.
@@ -14,10 +19,17 @@ func StartServer(a *fiber.App) {
 	// Build Fiber connection URL.
 	fiberConnURL, _ := ConnectionURLBuilder("fiber")
 
-	fmt.Println("url:", fiberConnURL)
+	logger.Info(context.Background(), "Starting the server", logger.Any("url", fiberConnURL))
 	// Run server.
 	if err := a.Listen(fiberConnURL); err != nil {
-		log.Printf("Oops... Server is not running! Reason: %v", err)
+		logger.Error(context.Background(), "Oops... Server is not running!", logger.Err(err))
+	}
+}
+
+// StartAdminServer starts the admin server on its own address, apart from the public one.
+func StartAdminServer(a *fiber.App, address string) {
+	if err := a.Listen(address); err != nil {
+		logger.Error(context.Background(), "Oops... Admin server is not running!", logger.Err(err))
 	}
 }
 
@@ -28,15 +40,24 @@ func StartServerWithGracefulShutdown(a *fiber.App) {
 
 	go func() {
 		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt) // Catch OS signals.
+		signal.Notify(sigint, os.Interrupt, syscall.SIGTERM) // Catch OS signals.
 		<-sigint
 
+		// Report not ready first, so load balancers stop sending new requests.
+		health.Service().Drain()
+		time.Sleep(time.Second * time.Duration(config.Config().ShutdownDrain))
+
 		// Received an interrupt signal, shutdown.
 		if err := a.Shutdown(); err != nil {
 			// Error from closing listeners, or context timeout:
-			log.Printf("Oops... Server is not shutting down! Reason: %v", err)
+			logger.Error(context.Background(), "Oops... Server is not shutting down!", logger.Err(err))
 		}
 
+		// Export the spans of the last requests.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		tracing.Shutdown(ctx)
+		cancel()
+
 		close(idleConnsClosed)
 	}()
 
@@ -45,7 +66,7 @@ func StartServerWithGracefulShutdown(a *fiber.App) {
 
 	// Run server.
 	if err := a.Listen(fiberConnURL); err != nil {
-		log.Printf("Oops... Server is not running! Reason: %v", err)
+		logger.Error(context.Background(), "Oops... Server is not running!", logger.Err(err))
 	}
 
 	<-idleConnsClosed
@@ -0,0 +1,115 @@
+package wallet
+
+import (
+	"context"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/limits"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/otp"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/risk"
+)
+
+type confirmationKey struct{}
+
+// Confirmation is what the user sent along with a request to confirm the
+// operations it makes.
+type Confirmation struct {
+	// StepUpOTP confirms an operation the risk rules ask to confirm
+	StepUpOTP string
+	// LimitOTP lets an expense go above the user's own limits
+	LimitOTP string
+	// IP is the address the request came from
+	IP string
+	// DeviceID is the identifier the client sent for its device
+	DeviceID string
+}
+
+// WithConfirmation attaches the user's confirmation to the request context.
+// Operations made without one, like scheduled payments, can not be confirmed.
+func WithConfirmation(ctx context.Context, confirmation Confirmation) context.Context {
+	return context.WithValue(ctx, confirmationKey{}, confirmation)
+}
+
+func confirmationFrom(ctx context.Context) Confirmation {
+	confirmation, _ := ctx.Value(confirmationKey{}).(Confirmation)
+	return confirmation
+}
+
+// Assess runs the operation through the risk rules. A step up decision passes
+// only with a valid step_up code in the context's confirmation, confirmed
+// tells it was used.
+func (w *Wallet) Assess(ctx context.Context, op ledger.Operation) (confirmed bool, err error) {
+	return w.assess(ctx, op, false)
+}
+
+// authorize lets a debit of the user through the risk rules and, for an
+// expense, the user's own limits. A step up or a limit override passes
+// without a code when the user confirmed the operation beforehand, like a
+// hold made with a one-time code.
+func (w *Wallet) authorize(ctx context.Context, op ledger.Operation, preconfirmed bool) (confirmed bool, err error) {
+	steppedUp, err := w.assess(ctx, op, preconfirmed)
+	if err != nil {
+		return false, err
+	}
+
+	if op.Type != ledger.Expense {
+		return steppedUp, nil
+	}
+
+	err = limits.Service().Check(ctx, op)
+	if err == nil || preconfirmed {
+		return steppedUp, nil
+	}
+
+	code := confirmationFrom(ctx).LimitOTP
+	if code == "" {
+		return false, err
+	}
+	if err := otp.Service().Verify(op.UserID, otp.LimitOverride, code); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (w *Wallet) assess(ctx context.Context, op ledger.Operation, preconfirmed bool) (bool, error) {
+	confirmation := confirmationFrom(ctx)
+
+	decision, err := risk.Service().Evaluate(ctx, risk.Attempt{
+		UserID:    op.UserID,
+		Type:      op.Type,
+		Amount:    op.Amount,
+		Currency:  op.Currency,
+		Category:  op.Category,
+		Merchant:  op.Merchant,
+		Recipient: op.Counterparty,
+		IP:        confirmation.IP,
+		DeviceID:  confirmation.DeviceID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	switch decision.Outcome {
+	case risk.Deny:
+		return false, newerrors.ErrOperationDenied
+	case risk.StepUp:
+		if !preconfirmed {
+			if confirmation.StepUpOTP == "" {
+				return false, newerrors.ErrStepUpRequired
+			}
+
+			if err := otp.Service().Verify(op.UserID, otp.StepUp, confirmation.StepUpOTP); err != nil {
+				return false, err
+			}
+		}
+		if err := risk.Service().Confirm(ctx, decision.ID); err != nil {
+			return false, err
+		}
+
+		return !preconfirmed, nil
+	}
+
+	return false, nil
+}
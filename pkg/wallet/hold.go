@@ -0,0 +1,305 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// Hold statuses
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldVoided   = "voided"
+	HoldExpired  = "expired"
+)
+
+// Hold reserves an amount of a user's balance until it is captured, voided or expires.
+type Hold struct {
+	ID             string    `db:"id"`
+	UserID         string    `db:"user_id"`
+	Merchant       string    `db:"merchant"`
+	Currency       string    `db:"currency"`
+	Amount         int64     `db:"amount"`
+	CapturedAmount int64     `db:"captured_amount"`
+	Status         string    `db:"status"`
+	OperationID    string    `db:"operation_id"`
+	CreatedAt      time.Time `db:"created_at"`
+	ExpiresAt      time.Time `db:"expires_at"`
+
+	// Confirmed tells the user confirmed the hold with a one-time code
+	Confirmed bool `db:"confirmed"`
+}
+
+// selectHolds reads holds, showing active ones past their expiry as expired.
+const selectHolds = `
+	SELECT id, user_id, merchant, currency, amount, captured_amount,
+		CASE WHEN status = 'active' AND expires_at <= now() THEN 'expired' ELSE status END AS status,
+		operation_id, confirmed, created_at, expires_at
+	FROM wallet_holds`
+
+// CreateHold reserves the amount for the merchant if the user has enough
+// available balance. The hold is checked as an expense against the risk
+// rules and the user's own limits. A hold the user confirmed with a one-time
+// code needs no confirmation when the merchant captures it.
+func (w *Wallet) CreateHold(ctx context.Context, userID, merchant, code string, amount int64) (*Hold, error) {
+	code = w.Currency(code)
+
+	confirmed, err := w.authorize(ctx, ledger.Operation{
+		UserID:   userID,
+		Type:     ledger.Expense,
+		Currency: code,
+		Amount:   amount,
+		Merchant: merchant,
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	hold, err := w.createHold(ctx, userID, merchant, code, amount, confirmed)
+	if err != nil {
+		return nil, err
+	}
+
+	w.notify(ctx, userID)
+
+	return hold, nil
+}
+
+func (w *Wallet) createHold(ctx context.Context, userID, merchant, code string, amount int64, confirmed bool) (*Hold, error) {
+	now := time.Now()
+	hold := &Hold{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Merchant:  merchant,
+		Currency:  code,
+		Amount:    amount,
+		Status:    HoldActive,
+		Confirmed: confirmed,
+		CreatedAt: now,
+		ExpiresAt: now.Add(w.holdTTL),
+	}
+
+	// The hold reserves its amount first and then checks the balance covers it.
+	_, err := w.db.NamedExecContext(ctx, `
+		INSERT INTO wallet_holds (id, user_id, merchant, currency, amount, status, confirmed, created_at, expires_at)
+		VALUES (:id, :user_id, :merchant, :currency, :amount, :status, :confirmed, :created_at, :expires_at)`, hold)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.checkAvailable(ctx, userID, code, amount, true); err != nil {
+		deleteCtx, cancel := w.Detached()
+		defer cancel()
+
+		if _, deleteErr := w.db.ExecContext(deleteCtx, `DELETE FROM wallet_holds WHERE id = $1`, hold.ID); deleteErr != nil {
+			logger.Error(ctx, "could not delete a hold", logger.Any("hold_id", hold.ID), logger.Err(deleteErr))
+		}
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// CaptureHold debits the captured amount, which may be lower than the held one,
+// and closes the merchant's hold. Zero amount captures the whole hold. The
+// user's expense operation is returned with the hold.
+func (w *Wallet) CaptureHold(ctx context.Context, merchant, id string, amount int64) (*Hold, ledger.Operation, error) {
+	hold, op, err := w.captureHold(ctx, merchant, id, amount)
+	if err != nil {
+		return nil, ledger.Operation{}, err
+	}
+
+	w.notify(ctx, hold.UserID, op)
+
+	return hold, op, nil
+}
+
+func (w *Wallet) captureHold(ctx context.Context, merchant, id string, amount int64) (*Hold, ledger.Operation, error) {
+	hold, err := w.MerchantHold(ctx, merchant, id)
+	if err != nil {
+		return nil, ledger.Operation{}, err
+	}
+
+	if hold.Status != HoldActive {
+		return nil, ledger.Operation{}, newerrors.ErrHoldNotActive
+	}
+
+	if amount == 0 {
+		amount = hold.Amount
+	}
+	if amount < 0 || amount > hold.Amount {
+		return nil, ledger.Operation{}, newerrors.ErrCaptureAmount
+	}
+
+	// The merchant can not confirm for the user, the confirmation given with
+	// the hold stands for the capture.
+	_, err = w.authorize(ctx, ledger.Operation{
+		UserID:   hold.UserID,
+		Type:     ledger.Expense,
+		Currency: hold.Currency,
+		Amount:   amount,
+		Merchant: hold.Merchant,
+	}, hold.Confirmed)
+	if err != nil {
+		return nil, ledger.Operation{}, err
+	}
+
+	// The hold hands its reservation over to the debit, so the money stays
+	// reserved while it is being taken.
+	var seq int64
+	err = database.InTx(ctx, w.db, func(tx *sqlx.Tx) error {
+		if err := setHoldStatus(ctx, tx, id, HoldActive, HoldCaptured); err != nil {
+			return err
+		}
+
+		seq, err = w.reserveDebit(ctx, tx, hold.UserID, hold.Currency, amount)
+		return err
+	})
+	if err != nil {
+		return nil, ledger.Operation{}, err
+	}
+
+	if err := w.debit(ctx, hold.UserID, hold.Currency, amount); err != nil {
+		// When the money may be gone the hold stays captured, it must not be captured twice.
+		if mayBeApplied(err) {
+			return nil, ledger.Operation{}, err
+		}
+
+		restoreCtx, cancel := w.Detached()
+		defer cancel()
+
+		restoreErr := database.InTx(restoreCtx, w.db, func(tx *sqlx.Tx) error {
+			if _, err := tx.ExecContext(restoreCtx, `DELETE FROM wallet_debits WHERE seq = $1`, seq); err != nil {
+				return err
+			}
+
+			return setHoldStatus(restoreCtx, tx, id, HoldCaptured, HoldActive)
+		})
+		if restoreErr != nil {
+			return nil, ledger.Operation{}, restoreErr
+		}
+		return nil, ledger.Operation{}, err
+	}
+	w.completeDebit(ctx, seq)
+
+	hold.Status = HoldCaptured
+	hold.CapturedAmount = amount
+
+	op, err := w.record(ledger.Operation{
+		UserID:    hold.UserID,
+		Type:      ledger.Expense,
+		Direction: ledger.Debit,
+		Currency:  hold.Currency,
+		Amount:    amount,
+		Merchant:  hold.Merchant,
+	})
+	if err != nil {
+		return nil, ledger.Operation{}, err
+	}
+	hold.OperationID = op.ID
+
+	updateCtx, cancel := w.Detached()
+	defer cancel()
+
+	_, err = w.db.ExecContext(updateCtx, `
+		UPDATE wallet_holds SET captured_amount = $2, operation_id = $3 WHERE id = $1`,
+		id, hold.CapturedAmount, hold.OperationID)
+	if err != nil {
+		return nil, ledger.Operation{}, err
+	}
+
+	return hold, op, nil
+}
+
+// VoidHold releases the amount reserved for the merchant.
+func (w *Wallet) VoidHold(ctx context.Context, merchant, id string) (*Hold, error) {
+	hold, err := w.voidHold(ctx, merchant, id)
+	if err != nil {
+		return nil, err
+	}
+
+	w.notify(ctx, hold.UserID)
+
+	return hold, nil
+}
+
+func (w *Wallet) voidHold(ctx context.Context, merchant, id string) (*Hold, error) {
+	hold, err := w.MerchantHold(ctx, merchant, id)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != HoldActive {
+		return nil, newerrors.ErrHoldNotActive
+	}
+
+	if err := setHoldStatus(ctx, w.db, id, HoldActive, HoldVoided); err != nil {
+		return nil, err
+	}
+	hold.Status = HoldVoided
+
+	return hold, nil
+}
+
+// Holds lists the user's holds, newest first.
+func (w *Wallet) Holds(ctx context.Context, userID string) ([]Hold, error) {
+	var holds []Hold
+	err := w.db.SelectContext(ctx, &holds, selectHolds+` WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+// Held returns the amount reserved by the user's active holds.
+func (w *Wallet) Held(ctx context.Context, userID, code string) (int64, error) {
+	var total int64
+	err := w.db.GetContext(ctx, &total, `
+		SELECT COALESCE(SUM(amount), 0) FROM wallet_holds
+		WHERE user_id = $1 AND currency = $2 AND status = 'active' AND expires_at > now()`,
+		userID, w.Currency(code))
+
+	return total, err
+}
+
+// MerchantHold returns a hold made for the merchant.
+func (w *Wallet) MerchantHold(ctx context.Context, merchant, id string) (*Hold, error) {
+	var hold Hold
+	err := w.db.GetContext(ctx, &hold, selectHolds+` WHERE id = $1 AND merchant = $2`, id, merchant)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, newerrors.ErrHoldNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// setHoldStatus moves the hold from one status to another, an active hold
+// only while it has not expired.
+func setHoldStatus(ctx context.Context, db sqlx.ExecerContext, id, from, to string) error {
+	result, err := db.ExecContext(ctx, `
+		UPDATE wallet_holds SET status = $3
+		WHERE id = $1 AND status = $2 AND ($2 <> 'active' OR expires_at > now())`, id, from, to)
+	if err != nil {
+		return err
+	}
+
+	if changed, err := result.RowsAffected(); err != nil {
+		return err
+	} else if changed == 0 {
+		return newerrors.ErrHoldNotActive
+	}
+
+	return nil
+}
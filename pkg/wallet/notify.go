@@ -0,0 +1,37 @@
+package wallet
+
+import (
+	"context"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/events"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/limits"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// notify publishes the user's new operations followed by the changed balances,
+// and alerts the user about spending limits the operations brought close. The
+// operations are done, so the balances are read even if the request was
+// cancelled. Errors are logged with the request of ctx.
+func (w *Wallet) notify(ctx context.Context, userID string, ops ...ledger.Operation) {
+	bus := events.Service()
+
+	detached, cancel := w.Detached()
+	defer cancel()
+
+	for _, op := range ops {
+		bus.Publish(detached, userID, events.OperationPrefix+op.Type, op)
+
+		if err := limits.Service().Track(detached, op); err != nil {
+			logger.Error(ctx, "Error while tracking spending limits", logger.Err(err))
+		}
+	}
+
+	balances, err := w.Balances(detached, userID)
+	if err != nil {
+		logger.Error(ctx, "Error while getting a balance for events", logger.Err(err))
+		return
+	}
+
+	bus.Publish(detached, userID, events.BalanceChanged, balances)
+}
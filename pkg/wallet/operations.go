@@ -0,0 +1,203 @@
+package wallet
+
+import (
+	"context"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+)
+
+// Income tops up the user's balance and records the operation.
+func (w *Wallet) Income(ctx context.Context, op ledger.Operation) (ledger.Operation, error) {
+	op.Type, op.Direction = ledger.Income, ledger.Credit
+	op.Currency = w.Currency(op.Currency)
+
+	if err := w.Credit(ctx, op.UserID, op.Currency, op.Amount); err != nil {
+		return ledger.Operation{}, err
+	}
+
+	op, err := w.record(op)
+	if err != nil {
+		return ledger.Operation{}, err
+	}
+	w.notify(ctx, op.UserID, op)
+
+	return op, nil
+}
+
+// Expense reduces the user's balance and records the operation. The expense
+// has to pass the risk rules and the user's own limits.
+func (w *Wallet) Expense(ctx context.Context, op ledger.Operation) (ledger.Operation, error) {
+	op.Type, op.Direction = ledger.Expense, ledger.Debit
+	op.Currency = w.Currency(op.Currency)
+
+	if _, err := w.authorize(ctx, op, false); err != nil {
+		return ledger.Operation{}, err
+	}
+
+	if err := w.Debit(ctx, op.UserID, op.Currency, op.Amount); err != nil {
+		return ledger.Operation{}, err
+	}
+
+	op, err := w.record(op)
+	if err != nil {
+		return ledger.Operation{}, err
+	}
+	w.notify(ctx, op.UserID, op)
+
+	return op, nil
+}
+
+// Reverse moves the money of an operation back and records a compensating
+// operation linked to it. Zero amount reverses the whole operation, otherwise
+// the amount is refunded. The leg of the operation, like the income a
+// merchant's owner got for the user's payment, is reversed along with it and
+// the money is taken from there first.
+func (w *Wallet) Reverse(ctx context.Context, id string, amount int64, reason string) (ledger.Operation, error) {
+	original, leg, err := ledger.Service().Compensate(ctx, id, amount)
+	if err != nil {
+		return ledger.Operation{}, err
+	}
+
+	op := compensating(original, amount, reason)
+
+	var legOp ledger.Operation
+	if leg != nil {
+		legOp = compensating(*leg, amount, reason)
+		err = w.moveBack(ctx, legOp)
+	}
+	if err == nil {
+		if err = w.moveBack(ctx, op); err != nil && leg != nil {
+			// The user did not get the money, return it to the leg.
+			undoCtx, cancel := w.Detached()
+			defer cancel()
+
+			if undoErr := w.moveBack(undoCtx, compensating(legOp, 0, reason)); undoErr != nil {
+				return ledger.Operation{}, undoErr
+			}
+		}
+	}
+
+	if err != nil {
+		releaseCtx, cancel := w.Detached()
+		defer cancel()
+
+		if releaseErr := ledger.Service().Release(releaseCtx, original.ID, op.Amount); releaseErr != nil {
+			return ledger.Operation{}, releaseErr
+		}
+		return ledger.Operation{}, err
+	}
+
+	op, err = w.record(op)
+	if err != nil {
+		return ledger.Operation{}, err
+	}
+	w.notify(ctx, op.UserID, op)
+
+	if leg != nil {
+		legOp, err = w.record(legOp)
+		if err != nil {
+			return ledger.Operation{}, err
+		}
+		w.notify(ctx, legOp.UserID, legOp)
+	}
+
+	return op, nil
+}
+
+// compensating is the operation moving the amount of original back, all of
+// it for zero amount.
+func compensating(original ledger.Operation, amount int64, reason string) ledger.Operation {
+	op := ledger.Operation{
+		UserID:   original.UserID,
+		Type:     ledger.Refund,
+		Currency: original.Currency,
+		Amount:   amount,
+		Merchant: original.Merchant,
+		Category: original.Category,
+		Reason:   reason,
+		Reverses: original.ID,
+	}
+	if amount == 0 {
+		op.Type, op.Amount = ledger.Reversal, original.Amount
+	}
+
+	op.Direction = ledger.Credit
+	if original.Direction == ledger.Credit {
+		op.Direction = ledger.Debit
+	}
+
+	return op
+}
+
+// moveBack moves the money of a compensating operation.
+func (w *Wallet) moveBack(ctx context.Context, op ledger.Operation) error {
+	if op.Direction == ledger.Debit {
+		return w.Debit(ctx, op.UserID, op.Currency, op.Amount)
+	}
+
+	return w.Credit(ctx, op.UserID, op.Currency, op.Amount)
+}
+
+// Transfer moves money from op.UserID to op.Counterparty and records an
+// operation for each side. The sender's operation is returned. The transfer
+// has to pass the risk rules, nothing is debited for an unknown recipient.
+func (w *Wallet) Transfer(ctx context.Context, op ledger.Operation) (ledger.Operation, error) {
+	op.Type, op.Direction = ledger.Transfer, ledger.Debit
+	op.Currency = w.Currency(op.Currency)
+
+	if err := w.checkUser(ctx, op.Counterparty); err != nil {
+		return ledger.Operation{}, err
+	}
+
+	if _, err := w.authorize(ctx, op, false); err != nil {
+		return ledger.Operation{}, err
+	}
+
+	if err := w.Debit(ctx, op.UserID, op.Currency, op.Amount); err != nil {
+		return ledger.Operation{}, err
+	}
+
+	if err := w.Credit(ctx, op.Counterparty, op.Currency, op.Amount); err != nil {
+		// Give the money back, the transfer did not happen.
+		refundCtx, cancel := w.Detached()
+		defer cancel()
+
+		if refundErr := w.Credit(refundCtx, op.UserID, op.Currency, op.Amount); refundErr != nil {
+			return ledger.Operation{}, refundErr
+		}
+
+		return ledger.Operation{}, err
+	}
+
+	sent, err := w.record(op)
+	if err != nil {
+		return ledger.Operation{}, err
+	}
+	received, err := w.record(ledger.Operation{
+		UserID:       op.Counterparty,
+		Type:         ledger.Transfer,
+		Direction:    ledger.Credit,
+		Currency:     op.Currency,
+		Amount:       op.Amount,
+		Counterparty: op.UserID,
+		RequestID:    op.RequestID,
+		Note:         op.Note,
+	})
+	if err != nil {
+		return ledger.Operation{}, err
+	}
+
+	w.notify(ctx, sent.UserID, sent)
+	w.notify(ctx, received.UserID, received)
+
+	return sent, nil
+}
+
+// record stores an operation whose money already moved, even if the request
+// that moved it was cancelled.
+func (w *Wallet) record(op ledger.Operation) (ledger.Operation, error) {
+	ctx, cancel := w.Detached()
+	defer cancel()
+
+	return ledger.Service().Record(ctx, op)
+}
@@ -0,0 +1,267 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/currency"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+)
+
+// Pocket sets a part of a user's balance aside. The money stays in the balance
+// but is not available for spending until it is moved out of the pocket.
+type Pocket struct {
+	ID       string `db:"id"`
+	UserID   string `db:"user_id"`
+	Name     string `db:"name"`
+	Currency string `db:"currency"`
+	Amount   int64  `db:"amount"`
+	// TargetAmount and TargetDate are optional goals of the pocket
+	TargetAmount int64     `db:"target_amount"`
+	TargetDate   time.Time `db:"-"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
+
+// pocketRow is a pocket as it is read from the database, without a target date it is NULL.
+type pocketRow struct {
+	Pocket
+	TargetDate sql.NullTime `db:"target_date"`
+}
+
+func (row pocketRow) pocket() *Pocket {
+	pocket := row.Pocket
+	pocket.TargetDate = row.TargetDate.Time
+
+	return &pocket
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+const (
+	pocketColumns = `id, user_id, name, currency, amount, target_amount, target_date, created_at, updated_at`
+	selectPockets = `SELECT ` + pocketColumns + ` FROM wallet_pockets`
+	returnPocket  = ` RETURNING ` + pocketColumns
+)
+
+// Progress is the percent of the target amount in the pocket, 0 without a target.
+func (p Pocket) Progress() int {
+	if p.TargetAmount <= 0 {
+		return 0
+	}
+
+	if p.Amount >= p.TargetAmount {
+		return 100
+	}
+
+	return int(p.Amount * 100 / p.TargetAmount)
+}
+
+// Remaining is what is left to put into the pocket to reach the target.
+func (p Pocket) Remaining() int64 {
+	if p.Amount >= p.TargetAmount {
+		return 0
+	}
+
+	return p.TargetAmount - p.Amount
+}
+
+// CreatePocket opens an empty pocket in the given currency.
+func (w *Wallet) CreatePocket(ctx context.Context, userID, name, code string, targetAmount int64, targetDate time.Time) (*Pocket, error) {
+	code = w.Currency(code)
+	if !currency.IsSupported(currency.Provider(), code) {
+		return nil, newerrors.ErrUnsupportedCurrency
+	}
+
+	now := time.Now()
+	pocket := &Pocket{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		Name:         name,
+		Currency:     code,
+		TargetAmount: targetAmount,
+		TargetDate:   targetDate,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	err := database.InTx(ctx, w.db, func(tx *sqlx.Tx) error {
+		// Pockets of one user are counted one at a time.
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "pockets:"+userID); err != nil {
+			return err
+		}
+
+		var count int
+		if err := tx.GetContext(ctx, &count, `SELECT count(*) FROM wallet_pockets WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		if count >= w.maxPockets {
+			return newerrors.ErrTooManyPockets
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO wallet_pockets (id, user_id, name, currency, target_amount, target_date, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			pocket.ID, pocket.UserID, pocket.Name, pocket.Currency, pocket.TargetAmount, nullTime(pocket.TargetDate), pocket.CreatedAt, pocket.UpdatedAt)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pocket, nil
+}
+
+// Pockets lists the user's pockets, oldest first.
+func (w *Wallet) Pockets(ctx context.Context, userID string) ([]Pocket, error) {
+	var rows []pocketRow
+	err := w.db.SelectContext(ctx, &rows, selectPockets+` WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	pockets := make([]Pocket, 0, len(rows))
+	for _, row := range rows {
+		pockets = append(pockets, *row.pocket())
+	}
+
+	return pockets, nil
+}
+
+// Pocket ...
+func (w *Wallet) Pocket(ctx context.Context, userID, id string) (*Pocket, error) {
+	var row pocketRow
+	err := w.db.GetContext(ctx, &row, selectPockets+` WHERE id = $1 AND user_id = $2`, id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, newerrors.ErrPocketNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return row.pocket(), nil
+}
+
+// UpdatePocket renames the pocket and sets its target. Zero target amount and
+// date remove the target.
+func (w *Wallet) UpdatePocket(ctx context.Context, userID, id, name string, targetAmount int64, targetDate time.Time) (*Pocket, error) {
+	var row pocketRow
+	err := w.db.GetContext(ctx, &row, `
+		UPDATE wallet_pockets SET name = $3, target_amount = $4, target_date = $5, updated_at = now()
+		WHERE id = $1 AND user_id = $2`+returnPocket, id, userID, name, targetAmount, nullTime(targetDate))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, newerrors.ErrPocketNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return row.pocket(), nil
+}
+
+// DeletePocket closes the pocket, its money goes back to the available balance.
+func (w *Wallet) DeletePocket(ctx context.Context, userID, id string) (*Pocket, error) {
+	var row pocketRow
+	err := w.db.GetContext(ctx, &row, `
+		DELETE FROM wallet_pockets WHERE id = $1 AND user_id = $2`+returnPocket, id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, newerrors.ErrPocketNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	pocket := row.pocket()
+	if pocket.Amount > 0 {
+		w.notify(ctx, userID)
+	}
+
+	return pocket, nil
+}
+
+// MoveToPocket sets the amount of the available balance aside in the pocket.
+func (w *Wallet) MoveToPocket(ctx context.Context, userID, id string, amount int64) (*Pocket, error) {
+	pocket, err := w.moveToPocket(ctx, userID, id, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	w.notify(ctx, userID)
+
+	return pocket, nil
+}
+
+func (w *Wallet) moveToPocket(ctx context.Context, userID, id string, amount int64) (*Pocket, error) {
+	// The pocket takes the amount first and then checks the balance covers it.
+	var row pocketRow
+	err := w.db.GetContext(ctx, &row, `
+		UPDATE wallet_pockets SET amount = amount + $3, updated_at = now()
+		WHERE id = $1 AND user_id = $2`+returnPocket, id, userID, amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, newerrors.ErrPocketNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	pocket := row.pocket()
+
+	if err := w.checkAvailable(ctx, userID, pocket.Currency, amount, true); err != nil {
+		// The pocket may be gone or emptied meanwhile, then there is less to give back.
+		restoreCtx, cancel := w.Detached()
+		defer cancel()
+
+		_, restoreErr := w.db.ExecContext(restoreCtx, `
+			UPDATE wallet_pockets SET amount = GREATEST(amount - $3, 0), updated_at = now()
+			WHERE id = $1 AND user_id = $2`, id, userID, amount)
+		if restoreErr != nil {
+			return nil, restoreErr
+		}
+		return nil, err
+	}
+
+	return pocket, nil
+}
+
+// MoveFromPocket makes the amount of the pocket available for spending again.
+func (w *Wallet) MoveFromPocket(ctx context.Context, userID, id string, amount int64) (*Pocket, error) {
+	pocket, err := w.moveFromPocket(ctx, userID, id, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	w.notify(ctx, userID)
+
+	return pocket, nil
+}
+
+func (w *Wallet) moveFromPocket(ctx context.Context, userID, id string, amount int64) (*Pocket, error) {
+	var row pocketRow
+	err := w.db.GetContext(ctx, &row, `
+		UPDATE wallet_pockets SET amount = amount - $3, updated_at = now()
+		WHERE id = $1 AND user_id = $2 AND amount >= $3`+returnPocket, id, userID, amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := w.Pocket(ctx, userID, id); err != nil {
+			return nil, err
+		}
+		return nil, newerrors.ErrPocketAmount
+	} else if err != nil {
+		return nil, err
+	}
+
+	return row.pocket(), nil
+}
+
+// Pocketed returns the amount the user set aside in pockets.
+func (w *Wallet) Pocketed(ctx context.Context, userID, code string) (int64, error) {
+	var total int64
+	err := w.db.GetContext(ctx, &total, `
+		SELECT COALESCE(SUM(amount), 0) FROM wallet_pockets
+		WHERE user_id = $1 AND currency = $2`, userID, w.Currency(code))
+
+	return total, err
+}
@@ -0,0 +1,143 @@
+package wallet
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// The available balance is shared by debits, holds and pockets of a user,
+// which may run on different gateways at the same time. None of them holds a
+// lock while the balance is read from the user service. Instead each one
+// first reserves its amount in the database and then checks that the balance
+// covers everything reserved, its own amount included, so of two concurrent
+// reservations at least one sees the other.
+
+// reserveDebit reserves the amount of a debit about to be made, the
+// reservation expires if the gateway stops before completing it.
+func (w *Wallet) reserveDebit(ctx context.Context, db sqlx.QueryerContext, userID, code string, amount int64) (int64, error) {
+	var seq int64
+	err := sqlx.GetContext(ctx, db, &seq, `
+		INSERT INTO wallet_debits (user_id, currency, amount, expires_at)
+		VALUES ($1, $2, $3, now() + $4 * interval '1 second') RETURNING seq`,
+		userID, code, amount, w.debitLease().Seconds())
+
+	return seq, err
+}
+
+// completeDebit marks the debit done. The money has left the balance, still
+// the debit stays reserved for checks which read the balance before that.
+// Should that fail the debit stays reserved until it expires.
+func (w *Wallet) completeDebit(ctx context.Context, seq int64) {
+	detached, cancel := w.Detached()
+	defer cancel()
+
+	_, err := w.db.ExecContext(detached, `
+		UPDATE wallet_debits SET completed_seq = nextval('wallet_debit_marks'),
+			expires_at = now() + $2 * interval '1 second'
+		WHERE seq = $1`, seq, w.debitLease().Seconds())
+	if err != nil {
+		logger.Error(ctx, "could not complete a debit", logger.Any("seq", seq), logger.Err(err))
+	}
+}
+
+// cancelDebit drops the reservation of a debit which did not happen.
+func (w *Wallet) cancelDebit(ctx context.Context, seq int64) {
+	detached, cancel := w.Detached()
+	defer cancel()
+
+	if _, err := w.db.ExecContext(detached, `DELETE FROM wallet_debits WHERE seq = $1`, seq); err != nil {
+		logger.Error(ctx, "could not cancel a debit", logger.Any("seq", seq), logger.Err(err))
+	}
+}
+
+// failDebit cancels the debit which failed with err. When the user service
+// may still have applied it the reservation is kept until it expires.
+func (w *Wallet) failDebit(ctx context.Context, seq int64, err error) error {
+	if !mayBeApplied(err) {
+		w.cancelDebit(ctx, seq)
+	}
+
+	return err
+}
+
+// checkAvailable makes sure the balance covers all the reserved money, own
+// being the amount the caller has just reserved. When nothing else is
+// reserved a debit is left to the balance check of the user service itself,
+// a hold or a pocket (needBalance) always reads the balance.
+func (w *Wallet) checkAvailable(ctx context.Context, userID, code string, own int64, needBalance bool) error {
+	// A debit completed before the mark is seen in the balance read after it.
+	var mark int64
+	if err := w.db.GetContext(ctx, &mark, `SELECT nextval('wallet_debit_marks')`); err != nil {
+		return err
+	}
+
+	reserved, err := w.reserved(ctx, userID, code, mark)
+	if err != nil {
+		return err
+	}
+	if !needBalance && reserved <= own {
+		return nil
+	}
+
+	balance, err := w.Balance(ctx, userID, code)
+	if err != nil {
+		return err
+	}
+
+	if balance < reserved {
+		return status.Error(codes.PermissionDenied, "not enough cash")
+	}
+
+	return nil
+}
+
+// reserved is the part of the balance which can not be spent: the amount of
+// active holds, pockets and debits which may not be seen in a balance read
+// after the mark.
+func (w *Wallet) reserved(ctx context.Context, userID, code string, mark int64) (int64, error) {
+	var total int64
+	err := w.db.GetContext(ctx, &total, `
+		SELECT
+			(SELECT COALESCE(SUM(amount), 0) FROM wallet_holds
+			WHERE user_id = $1 AND currency = $2 AND status = 'active' AND expires_at > now()) +
+			(SELECT COALESCE(SUM(amount), 0) FROM wallet_pockets
+			WHERE user_id = $1 AND currency = $2) +
+			(SELECT COALESCE(SUM(amount), 0) FROM wallet_debits
+			WHERE user_id = $1 AND currency = $2
+				AND ((completed_seq IS NULL AND expires_at > now()) OR completed_seq > $3))`,
+		userID, code, mark)
+
+	return total, err
+}
+
+// pruneDebits removes the user's debits nobody needs to see anymore.
+func (w *Wallet) pruneDebits(ctx context.Context, userID, code string) error {
+	_, err := w.db.ExecContext(ctx, `
+		DELETE FROM wallet_debits WHERE user_id = $1 AND currency = $2 AND expires_at <= now()`,
+		userID, code)
+
+	return err
+}
+
+// debitLease is how long a debit stays reserved: longer than a request may
+// wait for the user service.
+func (w *Wallet) debitLease() time.Duration {
+	return w.detachedTimeout + time.Minute
+}
+
+// mayBeApplied tells whether a failed debit could still have taken the money,
+// because its outcome is unknown.
+func mayBeApplied(err error) bool {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.Canceled, codes.Unknown, codes.Internal:
+		return true
+	}
+
+	return false
+}
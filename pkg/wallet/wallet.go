@@ -0,0 +1,303 @@
+package wallet
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	pb "github.com/toshkentov01/alif-tech-task/api-gateway/genproto/user-service"
+	client "github.com/toshkentov01/alif-tech-task/api-gateway/grpc_client"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/currency"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+)
+
+var (
+	onceWallet     sync.Once
+	instanceWallet *Wallet
+)
+
+// Balance is an amount of one currency held by a user. Held is the part
+// reserved by active holds, Pocketed the part set aside in pockets, Available
+// is what is left for spending.
+type Balance struct {
+	Currency  string `json:"currency" db:"currency"`
+	Amount    int64  `json:"amount" db:"amount"`
+	Held      int64  `json:"held" db:"-"`
+	Pocketed  int64  `json:"pocketed" db:"-"`
+	Available int64  `json:"available" db:"-"`
+}
+
+// Wallet keeps per-currency balances of users. The balance in the default
+// currency lives in the user service, other currencies, holds and pockets are
+// kept in the shared database.
+type Wallet struct {
+	db              *sqlx.DB
+	defaultCurrency string
+
+	holdTTL time.Duration
+
+	// detachedTimeout limits work finishing an operation after its request ended
+	detachedTimeout time.Duration
+
+	maxPockets int
+}
+
+// Service returns the wallet shared by the handlers.
+func Service() *Wallet {
+	onceWallet.Do(func() {
+		cfg := config.Config()
+
+		instanceWallet = &Wallet{
+			db:              database.Service(),
+			defaultCurrency: strings.ToUpper(cfg.DefaultCurrency),
+			holdTTL:         time.Second * time.Duration(cfg.HoldTTL),
+			detachedTimeout: time.Second * time.Duration(cfg.CtxTimeout),
+			maxPockets:      cfg.MaxPockets,
+		}
+	})
+
+	return instanceWallet
+}
+
+// Detached returns a context for work that has to be done once money moved,
+// like refunds, even when the request that moved it was cancelled.
+func (w *Wallet) Detached() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), w.detachedTimeout)
+}
+
+// DefaultCurrency ...
+func (w *Wallet) DefaultCurrency() string {
+	return w.defaultCurrency
+}
+
+// Currency normalizes a currency code, an empty code means the default currency.
+func (w *Wallet) Currency(code string) string {
+	if code == "" {
+		return w.defaultCurrency
+	}
+
+	return strings.ToUpper(code)
+}
+
+// Balances lists all balances of the user, the default currency goes first.
+func (w *Wallet) Balances(ctx context.Context, userID string) ([]Balance, error) {
+	result, err := client.Upstreams().User().GetBalance(ctx, &pb.GetBalanceRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	balances := []Balance{{Currency: w.defaultCurrency, Amount: result.Balance}}
+
+	var others []Balance
+	err = w.db.SelectContext(ctx, &others, `
+		SELECT currency, amount FROM wallet_balances
+		WHERE user_id = $1 AND currency <> $2 ORDER BY currency`, userID, w.defaultCurrency)
+	if err != nil {
+		return nil, err
+	}
+	balances = append(balances, others...)
+
+	for i := range balances {
+		if balances[i].Held, err = w.Held(ctx, userID, balances[i].Currency); err != nil {
+			return nil, err
+		}
+		if balances[i].Pocketed, err = w.Pocketed(ctx, userID, balances[i].Currency); err != nil {
+			return nil, err
+		}
+		balances[i].Available = balances[i].Amount - balances[i].Held - balances[i].Pocketed
+	}
+
+	return balances, nil
+}
+
+// Balance returns the user's balance in one currency.
+func (w *Wallet) Balance(ctx context.Context, userID, code string) (int64, error) {
+	code = w.Currency(code)
+	if code != w.defaultCurrency {
+		var amount int64
+		err := w.db.GetContext(ctx, &amount, `
+			SELECT COALESCE(SUM(amount), 0) FROM wallet_balances
+			WHERE user_id = $1 AND currency = $2`, userID, code)
+
+		return amount, err
+	}
+
+	result, err := client.Upstreams().User().GetBalance(ctx, &pb.GetBalanceRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Balance, nil
+}
+
+// Credit tops up the user's balance in the given currency. The user service
+// checks the user for the default currency, the gateway asks it for the others.
+func (w *Wallet) Credit(ctx context.Context, userID, code string, amount int64) error {
+	if amount <= 0 {
+		return status.Error(codes.InvalidArgument, "amount must be positive")
+	}
+
+	code = w.Currency(code)
+	if code == w.defaultCurrency {
+		_, err := client.Upstreams().User().Income(ctx, &pb.IncomeRequest{
+			UserId:       userID,
+			IncomeAmount: amount,
+		})
+
+		return err
+	}
+
+	if !currency.IsSupported(currency.Provider(), code) {
+		return status.Error(codes.InvalidArgument, "unsupported currency")
+	}
+
+	if err := w.checkUser(ctx, userID); err != nil {
+		return err
+	}
+
+	_, err := w.db.ExecContext(ctx, `
+		INSERT INTO wallet_balances (user_id, currency, amount) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, currency) DO UPDATE
+		SET amount = wallet_balances.amount + EXCLUDED.amount, updated_at = now()`,
+		userID, code, amount)
+
+	return err
+}
+
+// checkUser fails with NotFound when the user service does not know the user.
+func (w *Wallet) checkUser(ctx context.Context, userID string) error {
+	_, err := client.Upstreams().User().GetBalance(ctx, &pb.GetBalanceRequest{
+		UserId: userID,
+	})
+	if status.Code(err) == codes.NotFound {
+		return status.Error(codes.NotFound, "user not found")
+	}
+
+	return err
+}
+
+// Debit reduces the user's balance in the given currency. Money reserved by
+// holds or set aside in pockets can not be spent.
+func (w *Wallet) Debit(ctx context.Context, userID, code string, amount int64) error {
+	code = w.Currency(code)
+	if amount <= 0 {
+		return status.Error(codes.InvalidArgument, "amount must be positive")
+	}
+
+	if err := w.pruneDebits(ctx, userID, code); err != nil {
+		return err
+	}
+
+	seq, err := w.reserveDebit(ctx, w.db, userID, code, amount)
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkAvailable(ctx, userID, code, amount, false); err != nil {
+		w.cancelDebit(ctx, seq)
+		return err
+	}
+
+	if err := w.debit(ctx, userID, code, amount); err != nil {
+		return w.failDebit(ctx, seq, err)
+	}
+	w.completeDebit(ctx, seq)
+
+	return nil
+}
+
+func (w *Wallet) debit(ctx context.Context, userID, code string, amount int64) error {
+	if amount <= 0 {
+		return status.Error(codes.InvalidArgument, "amount must be positive")
+	}
+
+	if code == w.defaultCurrency {
+		_, err := client.Upstreams().User().Expense(ctx, &pb.ExpenseRequest{
+			UserId:        userID,
+			ExpenseAmount: amount,
+		})
+
+		return err
+	}
+
+	result, err := w.db.ExecContext(ctx, `
+		UPDATE wallet_balances SET amount = amount - $3, updated_at = now()
+		WHERE user_id = $1 AND currency = $2 AND amount >= $3`, userID, code, amount)
+	if err != nil {
+		return err
+	}
+	if changed, err := result.RowsAffected(); err != nil {
+		return err
+	} else if changed == 0 {
+		return status.Error(codes.PermissionDenied, "not enough cash")
+	}
+
+	return nil
+}
+
+// Exchange applies a quote: debits the source currency and credits the
+// converted amount. The exchange has to pass the risk rules.
+func (w *Wallet) Exchange(ctx context.Context, quote *currency.Quote) error {
+	_, err := w.authorize(ctx, ledger.Operation{
+		UserID:   quote.UserID,
+		Type:     ledger.ExchangeOut,
+		Currency: quote.From,
+		Amount:   quote.Amount,
+	}, false)
+	if err != nil {
+		return err
+	}
+
+	err = w.Debit(ctx, quote.UserID, quote.From, quote.Amount)
+	if err != nil {
+		return err
+	}
+
+	err = w.Credit(ctx, quote.UserID, quote.To, quote.Converted)
+	if err != nil {
+		// Give the money back, the exchange did not happen.
+		refundCtx, cancel := w.Detached()
+		defer cancel()
+
+		if refundErr := w.Credit(refundCtx, quote.UserID, quote.From, quote.Amount); refundErr != nil {
+			return refundErr
+		}
+
+		return err
+	}
+
+	out, err := w.record(ledger.Operation{
+		UserID:    quote.UserID,
+		Type:      ledger.ExchangeOut,
+		Direction: ledger.Debit,
+		Currency:  quote.From,
+		Amount:    quote.Amount,
+	})
+	if err != nil {
+		return err
+	}
+	in, err := w.record(ledger.Operation{
+		UserID:    quote.UserID,
+		Type:      ledger.ExchangeIn,
+		Direction: ledger.Credit,
+		Currency:  quote.To,
+		Amount:    quote.Converted,
+	})
+	if err != nil {
+		return err
+	}
+	w.notify(ctx, quote.UserID, out, in)
+
+	return nil
+}
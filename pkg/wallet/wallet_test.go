@@ -0,0 +1,91 @@
+package wallet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/ledger"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/testenv"
+)
+
+func TestTransferToUnknownRecipient(t *testing.T) {
+	db := testenv.DB(t)
+	users := testenv.UserService(t)
+	ctx := context.Background()
+	w := Service()
+
+	sender, unknown := uuid.New().String(), uuid.New().String()
+	users.Add(sender, 10000)
+	if err := w.Credit(ctx, sender, "USD", 500); err != nil {
+		t.Fatalf("Credit() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		currency string
+	}{
+		{name: "default currency", currency: w.DefaultCurrency()},
+		{name: "other currency", currency: "USD"},
+	}
+
+	for _, tt := range tests {
+		_, err := w.Transfer(ctx, ledger.Operation{
+			UserID:       sender,
+			Counterparty: unknown,
+			Currency:     tt.currency,
+			Amount:       100,
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("%s: Transfer() error = %v, want NotFound", tt.name, err)
+		}
+	}
+
+	if calls := users.Calls("Expense", sender); calls != 0 {
+		t.Errorf("sender debited %d times, want 0", calls)
+	}
+	if balance := users.Balance(sender); balance != 10000 {
+		t.Errorf("sender balance = %d, want 10000", balance)
+	}
+	if balance, err := w.Balance(ctx, sender, "USD"); err != nil || balance != 500 {
+		t.Errorf("sender USD balance = %d, %v, want 500", balance, err)
+	}
+
+	var rows int
+	if err := db.GetContext(ctx, &rows, `SELECT count(*) FROM wallet_balances WHERE user_id = $1`, unknown); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 0 {
+		t.Errorf("unknown recipient has %d balances, want 0", rows)
+	}
+
+	history, err := ledger.Service().List(ctx, sender, ledger.Filter{Type: ledger.Transfer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 0 {
+		t.Errorf("sender has %d transfers, want 0", len(history))
+	}
+}
+
+func TestCreditUnknownUser(t *testing.T) {
+	db := testenv.DB(t)
+	testenv.UserService(t)
+	ctx := context.Background()
+
+	unknown := uuid.New().String()
+	if err := Service().Credit(ctx, unknown, "USD", 100); status.Code(err) != codes.NotFound {
+		t.Errorf("Credit() error = %v, want NotFound", err)
+	}
+
+	var rows int
+	if err := db.GetContext(ctx, &rows, `SELECT count(*) FROM wallet_balances WHERE user_id = $1`, unknown); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 0 {
+		t.Errorf("unknown user has %d balances, want 0", rows)
+	}
+}
@@ -0,0 +1,302 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/events"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/logger"
+)
+
+// Delivery headers
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	workers    = 4
+	maxBackoff = time.Hour
+	// consumer is the name the dispatcher reads the event bus under
+	consumer = "webhooks"
+	// consumeInterval is how often new events are turned into deliveries
+	consumeInterval = time.Second
+	// pollInterval is how often due retries and deliveries left by other
+	// instances are looked for
+	pollInterval = time.Second * 5
+	pollBatch    = 100
+	// pruneBatch caps the old deliveries deleted on one poll
+	pruneBatch = 1000
+)
+
+// Start turns the published events into deliveries and delivers them in the
+// background. Events are read from the bus as a durable consumer, so the ones
+// published while no instance was running are delivered too.
+func (d *Dispatcher) Start() {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for id := range d.queue {
+				d.deliver(id)
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(consumeInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			d.consume()
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			d.poll()
+		}
+	}()
+}
+
+// Sign returns the signature of the payload sent at the timestamp:
+// hex encoded HMAC-SHA256 of "<timestamp>.<payload>" with the subscription secret.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// consume stores deliveries for the new events until the bus is read up.
+func (d *Dispatcher) consume() {
+	ctx, cancel := context.WithTimeout(context.Background(), d.client.Timeout)
+	defer cancel()
+
+	for {
+		var ids []string
+		count, err := events.Service().Consume(ctx, consumer, pollBatch, func(tx *sqlx.Tx, published []events.Event) error {
+			ids = ids[:0]
+			for _, event := range published {
+				stored, err := d.dispatch(ctx, tx, event)
+				if err != nil {
+					return err
+				}
+				ids = append(ids, stored...)
+			}
+
+			return nil
+		})
+		if err != nil {
+			logger.Error(ctx, "Error while storing webhook deliveries", logger.Err(err))
+			return
+		}
+
+		for _, id := range ids {
+			d.enqueue(id)
+		}
+
+		if count < pollBatch {
+			return
+		}
+	}
+}
+
+// dispatch stores a delivery of the event for every subscription to it whose
+// owner may see the events of the user. The grant is looked at when the event
+// is dispatched, so a revoked partner hears nothing more.
+func (d *Dispatcher) dispatch(ctx context.Context, tx *sqlx.Tx, event events.Event) ([]string, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []subscriptionRow
+	err = tx.SelectContext(ctx, &subs, `
+		SELECT `+subscriptionColumns+` FROM webhook_subscriptions s
+		WHERE $1 = ANY(s.event_types) AND (s.user_id = '' OR s.user_id = $2)
+			AND (s.owner = $2 OR EXISTS (
+				SELECT 1 FROM partner_grants g WHERE g.user_id = $2 AND g.partner_id = s.owner
+			))`, event.Type, event.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	now := time.Now()
+	for _, sub := range subs {
+		delivery := Delivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: sub.ID,
+			Owner:          sub.Owner,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         Pending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		}
+
+		_, err := tx.NamedExecContext(ctx, `
+			INSERT INTO webhook_deliveries (id, subscription_id, owner, event_id, event_type, payload, status, next_attempt_at, created_at)
+			VALUES (:id, :subscription_id, :owner, :event_id, :event_type, :payload, :status, :next_attempt_at, :created_at)`, delivery)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, delivery.ID)
+	}
+
+	return ids, nil
+}
+
+// enqueue hands the delivery to a worker. When the queue is full the delivery
+// is left for the poller.
+func (d *Dispatcher) enqueue(id string) {
+	select {
+	case d.queue <- id:
+	default:
+	}
+}
+
+// poll enqueues the due deliveries nobody is sending.
+func (d *Dispatcher) poll() {
+	ctx := context.Background()
+
+	var ids []string
+	err := d.db.SelectContext(ctx, &ids, `
+		SELECT id FROM webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= now() AND (locked_until IS NULL OR locked_until < now())
+		ORDER BY next_attempt_at LIMIT $1`, pollBatch)
+	if err != nil {
+		logger.Error(ctx, "Error while looking for due webhook deliveries", logger.Err(err))
+		return
+	}
+
+	for _, id := range ids {
+		d.enqueue(id)
+	}
+
+	d.prune()
+}
+
+// prune deletes delivered and dead deliveries older than the retention.
+func (d *Dispatcher) prune() {
+	ctx := context.Background()
+
+	_, err := d.db.ExecContext(ctx, `
+		DELETE FROM webhook_deliveries WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status <> 'pending' AND created_at < now() - $1 * interval '1 second'
+			LIMIT $2
+		)`, d.retention.Seconds(), pruneBatch)
+	if err != nil {
+		logger.Error(ctx, "Error while pruning webhook deliveries", logger.Err(err))
+	}
+}
+
+func (d *Dispatcher) deliver(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.lease)
+	defer cancel()
+
+	// Take the delivery, so no other worker or instance sends it at the same time.
+	var target struct {
+		deliveryRow
+		URL    string `db:"url"`
+		Secret string `db:"secret"`
+	}
+	err := d.db.GetContext(ctx, &target, `
+		WITH taken AS (
+			UPDATE webhook_deliveries SET locked_until = now() + $2 * interval '1 second'
+			WHERE id = $1 AND status = 'pending' AND next_attempt_at <= now() AND (locked_until IS NULL OR locked_until < now())
+			RETURNING `+deliveryColumns+`
+		)
+		SELECT taken.*, COALESCE(s.url, '') AS url, COALESCE(s.secret, '') AS secret
+		FROM taken LEFT JOIN webhook_subscriptions s ON s.id = taken.subscription_id`, id, d.lease.Seconds())
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	} else if err != nil {
+		logger.Error(ctx, "Error while taking a webhook delivery", logger.Err(err), logger.Any("delivery_id", id))
+		return
+	}
+	delivery := target.delivery()
+
+	if target.URL == "" {
+		d.finish(ctx, id, Dead, delivery.Attempts, "subscription was deleted", delivery.NextAttemptAt)
+		return
+	}
+
+	attempt := delivery.Attempts + 1
+	err = d.send(target.URL, target.Secret, id, delivery.EventType, delivery.Payload)
+	if err == nil {
+		d.finish(ctx, id, Delivered, attempt, "", time.Now())
+		return
+	}
+
+	if attempt >= d.maxAttempts {
+		logger.Warn(ctx, "Webhook delivery moved to dead letters", logger.Err(err), logger.Any("delivery_id", id), logger.Any("attempts", attempt))
+		d.finish(ctx, id, Dead, attempt, err.Error(), time.Now())
+		return
+	}
+
+	delay := d.backoff << uint(attempt-1)
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	d.finish(ctx, id, Pending, attempt, err.Error(), time.Now().Add(delay))
+}
+
+// finish saves the outcome of an attempt and gives the delivery up.
+func (d *Dispatcher) finish(ctx context.Context, id, status string, attempts int, lastError string, nextAttemptAt time.Time) {
+	_, err := d.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET status = $2, attempts = $3, last_error = $4, next_attempt_at = $5,
+			delivered_at = CASE WHEN $2 = 'delivered' THEN now() END, locked_until = NULL
+		WHERE id = $1`, id, status, attempts, lastError, nextAttemptAt)
+	if err != nil {
+		logger.Error(ctx, "Error while saving a webhook delivery", logger.Err(err), logger.Any("delivery_id", id))
+	}
+}
+
+func (d *Dispatcher) send(url, secret, deliveryID, eventType string, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, payload))
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(DeliveryHeader, deliveryID)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
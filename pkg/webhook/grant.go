@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+)
+
+// Grant lets a partner receive the events of a user's wallet.
+type Grant struct {
+	UserID    string    `db:"user_id"`
+	PartnerID string    `db:"partner_id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+const grantColumns = `user_id, partner_id, created_at`
+
+// Grant lets the partner subscribe to the user's events. Granting again keeps
+// the first grant.
+func (d *Dispatcher) Grant(ctx context.Context, userID, partnerID string) (Grant, error) {
+	var grant Grant
+	err := d.db.GetContext(ctx, &grant, `
+		INSERT INTO partner_grants (`+grantColumns+`) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, partner_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING `+grantColumns, userID, partnerID, time.Now())
+	if err != nil {
+		return Grant{}, err
+	}
+
+	return grant, nil
+}
+
+// Grants lists the partners the user granted access, oldest first.
+func (d *Dispatcher) Grants(ctx context.Context, userID string) ([]Grant, error) {
+	var grants []Grant
+	err := d.db.SelectContext(ctx, &grants, `
+		SELECT `+grantColumns+` FROM partner_grants
+		WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+// Revoke takes the partner's access away and deletes its subscriptions naming
+// the user. Events of the user already turned into deliveries are still sent.
+func (d *Dispatcher) Revoke(ctx context.Context, userID, partnerID string) error {
+	return database.InTx(ctx, d.db, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			DELETE FROM partner_grants WHERE user_id = $1 AND partner_id = $2`, userID, partnerID)
+		if err != nil {
+			return err
+		}
+
+		if deleted, err := result.RowsAffected(); err != nil {
+			return err
+		} else if deleted == 0 {
+			return newerrors.ErrGrantNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM webhook_subscriptions WHERE owner = $1 AND user_id = $2`, partnerID, userID)
+		return err
+	})
+}
+
+// granted tells whether the user granted the partner access, a partner always
+// has access to its own events.
+func (d *Dispatcher) granted(ctx context.Context, userID, partnerID string) (bool, error) {
+	if userID == partnerID {
+		return true, nil
+	}
+
+	var granted bool
+	err := d.db.GetContext(ctx, &granted, `
+		SELECT EXISTS (SELECT 1 FROM partner_grants WHERE user_id = $1 AND partner_id = $2)`, userID, partnerID)
+
+	return granted, err
+}
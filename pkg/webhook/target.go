@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, internal like the private ones.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP tells whether deliveries may be sent to the address.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip))
+}
+
+// checkURL accepts http and https URLs whose host resolves to public addresses only.
+func checkURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return newerrors.ErrWebhookURL
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: %s can not be resolved", newerrors.ErrWebhookURL, u.Hostname())
+	}
+
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return newerrors.ErrWebhookURL
+		}
+	}
+
+	return nil
+}
+
+// dialPublic refuses connections to internal addresses. The host is checked
+// again on every delivery, it may resolve elsewhere than when it was subscribed.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("%w: %s", newerrors.ErrWebhookURL, host)
+	}
+
+	return nil
+}
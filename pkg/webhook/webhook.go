@@ -0,0 +1,270 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/toshkentov01/alif-tech-task/api-gateway/config"
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/events"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/rand"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/utils"
+)
+
+// EventTypes partners can subscribe to
+var EventTypes = []string{
+	events.OperationPrefix + "income",
+	events.OperationPrefix + "expense",
+	events.OperationPrefix + "transfer",
+	events.AccountCreated,
+}
+
+// Delivery statuses
+const (
+	Pending   = "pending"
+	Delivered = "delivered"
+	Dead      = "dead"
+)
+
+const secretLength = 32
+
+var (
+	onceDispatcher     sync.Once
+	instanceDispatcher *Dispatcher
+)
+
+// Subscription tells where to deliver the events of the given types. They are
+// the events of the owner and of the users who granted the owner access, or
+// only of UserID when it is set.
+type Subscription struct {
+	ID         string    `db:"id"`
+	Owner      string    `db:"owner"`
+	UserID     string    `db:"user_id"`
+	URL        string    `db:"url"`
+	Secret     string    `db:"secret"`
+	EventTypes []string  `db:"-"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// subscriptionRow is a subscription as it is read from the database.
+type subscriptionRow struct {
+	Subscription
+	EventTypes pq.StringArray `db:"event_types"`
+}
+
+func (row subscriptionRow) subscription() Subscription {
+	sub := row.Subscription
+	sub.EventTypes = append([]string(nil), row.EventTypes...)
+
+	return sub
+}
+
+const subscriptionColumns = `id, owner, user_id, url, secret, event_types, created_at`
+
+// Delivery is one event sent to one subscription.
+type Delivery struct {
+	ID             string    `db:"id"`
+	SubscriptionID string    `db:"subscription_id"`
+	Owner          string    `db:"owner"`
+	EventID        uint64    `db:"event_id"`
+	EventType      string    `db:"event_type"`
+	Payload        []byte    `db:"payload"`
+	Status         string    `db:"status"`
+	Attempts       int       `db:"attempts"`
+	LastError      string    `db:"last_error"`
+	NextAttemptAt  time.Time `db:"next_attempt_at"`
+	CreatedAt      time.Time `db:"created_at"`
+	DeliveredAt    time.Time `db:"-"`
+}
+
+// deliveryRow is a delivery as it is read from the database, DeliveredAt is
+// NULL until the delivery succeeds.
+type deliveryRow struct {
+	Delivery
+	DeliveredAt sql.NullTime `db:"delivered_at"`
+}
+
+func (row deliveryRow) delivery() Delivery {
+	delivery := row.Delivery
+	delivery.DeliveredAt = row.DeliveredAt.Time
+
+	return delivery
+}
+
+const deliveryColumns = `id, subscription_id, owner, event_id, event_type, payload, status, attempts,
+	last_error, next_attempt_at, created_at, delivered_at`
+
+// Dispatcher keeps subscriptions and deliveries in the shared database and
+// delivers events to them with retries. Deliveries left by a stopped instance
+// are sent by the others.
+type Dispatcher struct {
+	db    *sqlx.DB
+	queue chan string
+
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	// lease is how long an instance owns a delivery it sends
+	lease time.Duration
+	// retention is how long delivered and dead deliveries are kept
+	retention time.Duration
+}
+
+// Service returns the webhook dispatcher shared by the gateway.
+func Service() *Dispatcher {
+	onceDispatcher.Do(func() {
+		cfg := config.Config()
+		timeout := time.Second * time.Duration(cfg.WebhookTimeout)
+
+		instanceDispatcher = &Dispatcher{
+			db:    database.Service(),
+			queue: make(chan string, 1024),
+			client: &http.Client{
+				Timeout: timeout,
+				Transport: &http.Transport{
+					DialContext: (&net.Dialer{
+						Timeout: timeout,
+						Control: dialPublic,
+					}).DialContext,
+					TLSHandshakeTimeout: timeout,
+				},
+			},
+			maxAttempts: cfg.WebhookMaxAttempts,
+			backoff:     time.Second * time.Duration(cfg.WebhookBackoff),
+			lease:       2*timeout + time.Minute,
+			retention:   time.Hour * 24 * time.Duration(cfg.WebhookRetention),
+		}
+	})
+
+	return instanceDispatcher
+}
+
+// Subscribe creates a subscription, a secret is generated when none is given.
+// The URL may not point at an internal address. A subscription naming a user
+// needs the user's grant.
+func (d *Dispatcher) Subscribe(ctx context.Context, owner, userID, url, secret string, eventTypes []string) (Subscription, error) {
+	for _, eventType := range eventTypes {
+		if !utils.InEnums(eventType, EventTypes) {
+			return Subscription{}, newerrors.ErrUnknownEventType
+		}
+	}
+
+	if userID != "" {
+		granted, err := d.granted(ctx, userID, owner)
+		if err != nil {
+			return Subscription{}, err
+		} else if !granted {
+			return Subscription{}, newerrors.ErrNotGranted
+		}
+	}
+
+	if err := checkURL(ctx, url); err != nil {
+		return Subscription{}, err
+	}
+
+	if secret == "" {
+		secret = rand.String(secretLength)
+	}
+
+	sub := Subscription{
+		ID:         uuid.New().String(),
+		Owner:      owner,
+		UserID:     userID,
+		URL:        url,
+		Secret:     secret,
+		EventTypes: append([]string(nil), eventTypes...),
+		CreatedAt:  time.Now(),
+	}
+
+	_, err := d.db.ExecContext(ctx, `
+		INSERT INTO webhook_subscriptions (`+subscriptionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		sub.ID, sub.Owner, sub.UserID, sub.URL, sub.Secret, pq.StringArray(sub.EventTypes), sub.CreatedAt)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	return sub, nil
+}
+
+// Subscriptions lists the owner's subscriptions.
+func (d *Dispatcher) Subscriptions(ctx context.Context, owner string) ([]Subscription, error) {
+	var rows []subscriptionRow
+	err := d.db.SelectContext(ctx, &rows, `
+		SELECT `+subscriptionColumns+` FROM webhook_subscriptions
+		WHERE owner = $1 ORDER BY created_at`, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Subscription, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, row.subscription())
+	}
+
+	return result, nil
+}
+
+// Unsubscribe deletes the owner's subscription.
+func (d *Dispatcher) Unsubscribe(ctx context.Context, owner, id string) error {
+	result, err := d.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1 AND owner = $2`, id, owner)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return newerrors.ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// Deliveries lists the owner's deliveries with the given status, newest first.
+// An empty status lists all of them.
+func (d *Dispatcher) Deliveries(ctx context.Context, owner, status string) ([]Delivery, error) {
+	var rows []deliveryRow
+	err := d.db.SelectContext(ctx, &rows, `
+		SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE owner = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC`, owner, status)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Delivery, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, row.delivery())
+	}
+
+	return result, nil
+}
+
+// Replay sends a delivery again from the first attempt, usually one from the dead-letter list.
+func (d *Dispatcher) Replay(ctx context.Context, owner, id string) (Delivery, error) {
+	var row deliveryRow
+	err := d.db.GetContext(ctx, &row, `
+		UPDATE webhook_deliveries SET status = $3, attempts = 0, next_attempt_at = now()
+		WHERE id = $1 AND owner = $2
+		RETURNING `+deliveryColumns, id, owner, Pending)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Delivery{}, newerrors.ErrDeliveryNotFound
+	} else if err != nil {
+		return Delivery{}, err
+	}
+
+	d.enqueue(id)
+
+	return row.delivery(), nil
+}
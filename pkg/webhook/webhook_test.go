@@ -0,0 +1,217 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	newerrors "github.com/toshkentov01/alif-tech-task/api-gateway/new_errors"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/database"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/events"
+	"github.com/toshkentov01/alif-tech-task/api-gateway/pkg/testenv"
+)
+
+// publicURL is not resolved nor called, deliveries are only stored for it.
+const publicURL = "http://93.184.216.34/hook"
+
+func newDispatcher(db *sqlx.DB, maxAttempts int) *Dispatcher {
+	return &Dispatcher{
+		db:          db,
+		queue:       make(chan string, 1024),
+		client:      &http.Client{Timeout: time.Second * 5},
+		maxAttempts: maxAttempts,
+		backoff:     time.Millisecond,
+		lease:       time.Minute,
+		retention:   time.Hour,
+	}
+}
+
+func TestDispatchScoping(t *testing.T) {
+	db := testenv.DB(t)
+	ctx := context.Background()
+	d := newDispatcher(db, 3)
+	bus := events.Service()
+
+	partner := uuid.New().String()
+	granted, other, signedUp := uuid.New().String(), uuid.New().String(), uuid.New().String()
+
+	if _, err := d.Subscribe(ctx, partner, other, publicURL, "", []string{events.OperationPrefix + "income"}); !errors.Is(err, newerrors.ErrNotGranted) {
+		t.Fatalf("Subscribe() to a user without a grant error = %v, want ErrNotGranted", err)
+	}
+
+	if _, err := d.Grant(ctx, granted, partner); err != nil {
+		t.Fatal(err)
+	}
+	all, err := d.Subscribe(ctx, partner, "", publicURL, "", []string{events.OperationPrefix + "income", events.AccountCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	one, err := d.Subscribe(ctx, partner, granted, publicURL, "", []string{events.OperationPrefix + "income"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The consumer starts after the events published so far.
+	d.consume()
+
+	bus.Publish(ctx, granted, events.OperationPrefix+"income", map[string]int{"amount": 1})
+	bus.Publish(ctx, other, events.OperationPrefix+"income", map[string]int{"amount": 2})
+	bus.Publish(ctx, granted, events.OperationPrefix+"expense", map[string]int{"amount": 3})
+	if _, err := d.Grant(ctx, signedUp, partner); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(ctx, signedUp, events.AccountCreated, map[string]string{"user_id": signedUp})
+	d.consume()
+
+	type match struct {
+		SubscriptionID string `db:"subscription_id"`
+		EventType      string `db:"event_type"`
+	}
+	var got []match
+	err = db.SelectContext(ctx, &got, `
+		SELECT subscription_id, event_type FROM webhook_deliveries WHERE owner = $1 ORDER BY event_id, subscription_id`, partner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[match]bool{
+		{SubscriptionID: all.ID, EventType: events.OperationPrefix + "income"}: true,
+		{SubscriptionID: one.ID, EventType: events.OperationPrefix + "income"}: true,
+		{SubscriptionID: all.ID, EventType: events.AccountCreated}:             true,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("deliveries = %+v, want %d", got, len(want))
+	}
+	for _, m := range got {
+		if !want[m] {
+			t.Errorf("unexpected delivery %+v", m)
+		}
+	}
+
+	// A revoked partner hears nothing more and loses the subscriptions naming the user.
+	if err := d.Revoke(ctx, granted, partner); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(ctx, granted, events.OperationPrefix+"income", map[string]int{"amount": 4})
+	d.consume()
+
+	var count int
+	if err := db.GetContext(ctx, &count, `SELECT count(*) FROM webhook_deliveries WHERE owner = $1`, partner); err != nil {
+		t.Fatal(err)
+	}
+	if count != len(want) {
+		t.Errorf("deliveries after revoke = %d, want %d", count, len(want))
+	}
+	subs, err := d.Subscriptions(ctx, partner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].ID != all.ID {
+		t.Errorf("subscriptions after revoke = %+v, want only %s", subs, all.ID)
+	}
+}
+
+func TestDeliverRetryAndDeadLetter(t *testing.T) {
+	db := testenv.DB(t)
+	ctx := context.Background()
+	d := newDispatcher(db, 2)
+
+	var (
+		failing  int32 = 1
+		requests int32
+		signed   int32
+	)
+	const secret = "0123456789abcdef"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get(SignatureHeader) != "" && r.Header.Get(TimestampHeader) != "" {
+			atomic.AddInt32(&signed, 1)
+		}
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// The test server is local, so the subscription is stored without the URL check.
+	owner := uuid.New().String()
+	sub := Subscription{
+		ID:         uuid.New().String(),
+		Owner:      owner,
+		URL:        server.URL,
+		Secret:     secret,
+		EventTypes: []string{events.AccountCreated},
+		CreatedAt:  time.Now(),
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO webhook_subscriptions (`+subscriptionColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		sub.ID, sub.Owner, sub.UserID, sub.URL, sub.Secret, pq.StringArray(sub.EventTypes), sub.CreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	err = database.InTx(ctx, db, func(tx *sqlx.Tx) error {
+		ids, err = d.dispatch(ctx, tx, events.Event{ID: 1, Type: events.AccountCreated, UserID: owner, CreatedAt: time.Now()})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 {
+		t.Fatalf("dispatch() stored %d deliveries, want 1", len(ids))
+	}
+	id := ids[0]
+
+	status := func() Delivery {
+		t.Helper()
+		deliveries, err := d.Deliveries(ctx, owner, "")
+		if err != nil || len(deliveries) != 1 {
+			t.Fatalf("Deliveries() = %v, %v", deliveries, err)
+		}
+		return deliveries[0]
+	}
+
+	d.deliver(id)
+	if got := status(); got.Status != Pending || got.Attempts != 1 || got.LastError == "" {
+		t.Errorf("after a failed attempt = %+v, want pending with 1 attempt", got)
+	}
+
+	time.Sleep(time.Millisecond * 10)
+	d.deliver(id)
+	if got := status(); got.Status != Dead || got.Attempts != 2 {
+		t.Errorf("after the last attempt = %+v, want dead with 2 attempts", got)
+	}
+
+	// A dead delivery is not sent again until it is replayed.
+	d.deliver(id)
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	if _, err := d.Replay(ctx, owner, id); err != nil {
+		t.Fatal(err)
+	}
+	d.deliver(id)
+	if got := status(); got.Status != Delivered || got.Attempts != 1 {
+		t.Errorf("after the replay = %+v, want delivered with 1 attempt", got)
+	}
+	if got := atomic.LoadInt32(&signed); got != 3 {
+		t.Errorf("signed requests = %d, want 3", got)
+	}
+
+	if _, err := d.Replay(ctx, uuid.New().String(), id); !errors.Is(err, newerrors.ErrDeliveryNotFound) {
+		t.Errorf("Replay() by another owner error = %v, want ErrDeliveryNotFound", err)
+	}
+}
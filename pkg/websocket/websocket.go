@@ -0,0 +1,264 @@
+// Package websocket is a small server side implementation of RFC 6455 on top
+// of fasthttp connection hijacking. It supports what the gateway needs: text
+// messages, ping/pong and the closing handshake.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxMessageSize limits messages read from clients.
+const maxMessageSize = 64 << 10
+
+// Opcodes
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// Close codes
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseTooBig        = 1009
+)
+
+var (
+	// ErrClosed is returned when the peer closed the connection.
+	ErrClosed = errors.New("websocket: connection closed")
+
+	// ErrProtocol is returned on malformed frames.
+	ErrProtocol = errors.New("websocket: protocol error")
+
+	// ErrTooBig is returned when a message is above maxMessageSize.
+	ErrTooBig = errors.New("websocket: message too big")
+)
+
+// IsUpgrade tells whether the request asks to switch to the WebSocket protocol.
+func IsUpgrade(c *fiber.Ctx) bool {
+	return strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket") &&
+		strings.Contains(strings.ToLower(c.Get(fiber.HeaderConnection)), "upgrade")
+}
+
+// Upgrade completes the opening handshake and runs the handler on the hijacked
+// connection. The connection is closed when the handler returns.
+func Upgrade(c *fiber.Ctx, handler func(*Conn)) error {
+	key := c.Get("Sec-WebSocket-Key")
+	if key == "" || c.Get("Sec-WebSocket-Version") != "13" {
+		return c.Status(http.StatusBadRequest).SendString("Bad WebSocket handshake")
+	}
+
+	hash := sha1.Sum([]byte(key + acceptGUID))
+
+	c.Set(fiber.HeaderUpgrade, "websocket")
+	c.Set(fiber.HeaderConnection, "Upgrade")
+	c.Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(hash[:]))
+	c.Status(http.StatusSwitchingProtocols)
+
+	c.Context().Hijack(func(netConn net.Conn) {
+		conn := &Conn{
+			conn:   netConn,
+			reader: bufio.NewReader(netConn),
+		}
+		defer netConn.Close()
+
+		handler(conn)
+	})
+
+	return nil
+}
+
+// Conn is an established WebSocket connection. Writes are safe for concurrent
+// use, reads must be done from one goroutine.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// WriteText sends a text message.
+func (c *Conn) WriteText(data []byte) error {
+	return c.writeFrame(OpText, data)
+}
+
+// WritePing sends a ping, the client answers with a pong.
+func (c *Conn) WritePing() error {
+	return c.writeFrame(OpPing, nil)
+}
+
+// WriteClose starts the closing handshake with the given code.
+func (c *Conn) WriteClose(code int) error {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+
+	err := c.writeFrame(OpClose, payload)
+
+	c.writeMu.Lock()
+	c.closed = true
+	c.writeMu.Unlock()
+
+	return err
+}
+
+// SetWriteDeadline ...
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// ReadMessage returns the next data message. Pings are answered and pongs are
+// skipped. ErrClosed is returned once the client closes the connection.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		opcode  int
+		message []byte
+	)
+
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case OpPing:
+			if err := c.writeFrame(OpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			continue
+		case OpClose:
+			c.writeMu.Lock()
+			closed := c.closed
+			c.writeMu.Unlock()
+
+			if !closed {
+				_ = c.WriteClose(CloseNormal)
+			}
+			return 0, nil, ErrClosed
+		case OpContinuation:
+			if opcode == 0 {
+				return 0, nil, ErrProtocol
+			}
+		case OpText, OpBinary:
+			if opcode != 0 {
+				return 0, nil, ErrProtocol
+			}
+			opcode = op
+		default:
+			return 0, nil, ErrProtocol
+		}
+
+		if len(message)+len(payload) > maxMessageSize {
+			_ = c.WriteClose(CloseTooBig)
+			return 0, nil, ErrTooBig
+		}
+		message = append(message, payload...)
+
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	// Clients must mask their frames.
+	if !masked {
+		return false, 0, nil, ErrProtocol
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if length > maxMessageSize {
+		_ = c.WriteClose(CloseTooBig)
+		return false, 0, nil, ErrTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|byte(opcode))
+
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(length))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+	frame = append(frame, payload...)
+
+	_, err := c.conn.Write(frame)
+
+	return err
+}